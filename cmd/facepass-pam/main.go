@@ -1,17 +1,26 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
+	"strconv"
 	"time"
 
+	"github.com/MrCodeEU/facepass/pkg/camera"
 	"github.com/MrCodeEU/facepass/pkg/config"
 	"github.com/MrCodeEU/facepass/pkg/logging"
 	"github.com/MrCodeEU/facepass/pkg/pam"
 )
 
-const version = "0.2.0"
+// version is set at link time by the Makefile (-X main.version=...).
+var version = "0.2.0"
+
+// debugJSONFlag makes the helper log the full authentication result as JSON,
+// as does setting PAM_FACEPASS_DEBUG=1.
+const debugJSONFlag = "--debug-json"
 
 func main() {
 	// PAM module entry point
@@ -19,21 +28,21 @@ func main() {
 	// Exit codes:
 	//   0 = authentication successful
 	//   1 = authentication failed
-	//   2 = user not enrolled (fallback to password)
+	//   2 = user not enrolled or disabled (fallback to password)
 	//   3 = system error (fallback to password)
+	os.Exit(run())
+}
 
+// run authenticates the PAM user and returns the exit code. Deferred calls
+// run before main exits.
+func run() int {
 	startTime := time.Now()
 
-	// Get the username from PAM environment
-	username := os.Getenv("PAM_USER")
-	if username == "" {
-		// Fallback: try to get current user
-		currentUser, err := user.Current()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error: Could not determine username")
-			os.Exit(3)
-		}
-		username = currentUser.Username
+	args, debugJSON := parseDebugJSON(os.Args[1:], os.Getenv)
+	username, source, err := resolveUsername(args, os.Getenv, user.Current)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Could not determine username")
+		return 3
 	}
 
 	// Load configuration
@@ -43,31 +52,80 @@ func main() {
 		cfg, err = config.Load("/etc/facepass/facepass.yaml")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "FacePass: Configuration error: %v\n", err)
-			os.Exit(3)
+			return 3
 		}
 	}
 
-	// Initialize logging (to file for PAM, stdout would interfere)
-	if err := logging.Init(cfg.Logging.Level, cfg.Logging.File); err != nil {
+	// Initialize logging. PAM defaults to syslog: stdout would interfere and
+	// the configured log file may be under a home directory that is not
+	// available at authentication time.
+	logOutput := cfg.Logging.Output
+	if logOutput == "" {
+		logOutput = logging.OutputSyslog
+	}
+	logLevel := cfg.Logging.Level
+	if debugJSON {
+		logLevel = "debug"
+	}
+	if err := logging.Initialize(logging.Options{
+		Level:  logLevel,
+		Format: cfg.Logging.Format,
+		Output: logOutput,
+		File:   cfg.Logging.File,
+		Rotation: logging.Rotation{
+			MaxSizeMB:  cfg.Logging.MaxSizeMB,
+			MaxBackups: cfg.Logging.MaxBackups,
+			MaxAgeDays: cfg.Logging.MaxAgeDays,
+		},
+	}); err != nil {
 		fmt.Fprintf(os.Stderr, "FacePass: Logging init error: %v\n", err)
 	}
+	defer func() { _ = logging.Close() }()
+
+	logging.Infof("FacePass PAM v%s starting authentication for: %s (from %s)", version, username, source)
+
+	// Log where enrollments are read from: a data directory under a home
+	// directory is a common reason for "not enrolled" when the user enrolled
+	// as themselves but PAM runs as root (or the other way round)
+	dataDir, inHome := cfg.ResolveDataDir()
+	cfg.Storage.DataDir = dataDir
+	if inHome {
+		logging.Warnf("Using data directory %s (euid %d), which is inside a home directory; enrollments made by other users are not visible here",
+			dataDir, os.Geteuid())
+	} else {
+		logging.Infof("Using data directory %s (euid %d)", dataDir, os.Geteuid())
+	}
 
-	logging.Infof("FacePass PAM v%s starting authentication for: %s", version, username)
+	if err := cfg.Validate(); err != nil {
+		logging.Errorf("Invalid configuration: %v", err)
+		fmt.Fprintf(os.Stderr, "FacePass: Configuration error: %v\n", err)
+		return 3
+	}
+	for _, warning := range cfg.PAMWarnings() {
+		logging.Warnf("Configuration: %s", warning)
+	}
 
 	// Check if face auth is enabled
 	if !cfg.Auth.Enabled {
 		fmt.Fprintln(os.Stderr, "FacePass: Face authentication disabled")
-		os.Exit(2)
+		return 2
 	}
 
 	// Create authenticator
 	auth, err := pam.NewPAMAuthenticator(cfg)
 	if err != nil {
 		logging.Errorf("Failed to initialize authenticator: %v", err)
+		if errors.Is(err, camera.ErrCameraBusy) {
+			fmt.Fprintln(os.Stderr, "FacePass: The camera is in use by another application, falling back to password")
+			return 3
+		}
 		fmt.Fprintf(os.Stderr, "FacePass: Initialization error\n")
-		os.Exit(3)
+		return 3
 	}
 	defer auth.Close()
+	auth.SetPrompt(func(message string) {
+		fmt.Fprintf(os.Stderr, "FacePass: %s\n", message)
+	})
 
 	// Override timeout if set in environment
 	if pamTimeout := os.Getenv("PAM_FACEPASS_TIMEOUT"); pamTimeout != "" {
@@ -78,14 +136,53 @@ func main() {
 	}
 
 	// Perform authentication
-	exitCode := runAuthentication(auth, username, startTime)
-	os.Exit(exitCode)
+	return runAuthentication(auth, username, startTime, debugJSON)
 }
 
-func runAuthentication(auth pam.Authenticator, username string, startTime time.Time) int {
+// parseDebugJSON removes --debug-json from the helper arguments and reports
+// whether the JSON result was requested by the flag or PAM_FACEPASS_DEBUG.
+func parseDebugJSON(args []string, getenv func(string) string) ([]string, bool) {
+	enabled, _ := strconv.ParseBool(getenv("PAM_FACEPASS_DEBUG"))
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == debugJSONFlag {
+			enabled = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, enabled
+}
+
+// resolveUsername returns the user to authenticate and where the name came
+// from. An explicit argument (facepass-pam <username>, e.g. from the pam_exec
+// line) takes precedence over PAM_USER, which takes precedence over the user
+// running the helper.
+func resolveUsername(args []string, getenv func(string) string, current func() (*user.User, error)) (string, string, error) {
+	if len(args) > 0 && args[0] != "" {
+		return args[0], "argument", nil
+	}
+	if username := getenv("PAM_USER"); username != "" {
+		return username, "PAM_USER", nil
+	}
+	currentUser, err := current()
+	if err != nil {
+		return "", "", err
+	}
+	return currentUser.Username, "current user", nil
+}
+
+func runAuthentication(auth pam.Authenticator, username string, startTime time.Time, debugJSON bool) int {
 	fmt.Fprintf(os.Stderr, "FacePass: Authenticating %s (look at camera)...\n", username)
 
 	result := auth.Authenticate(username)
+	if debugJSON {
+		if data, err := json.Marshal(result); err == nil {
+			logging.Infof("Authentication result: %s", data)
+		} else {
+			logging.Warnf("Failed to encode authentication result: %v", err)
+		}
+	}
 
 	// Handle result
 	if result.Success {
@@ -106,10 +203,14 @@ func runAuthentication(auth pam.Authenticator, username string, startTime time.T
 		case pam.ErrCodeNotEnrolled:
 			fmt.Fprintln(os.Stderr, "FacePass: User not enrolled")
 			return 2
+		case pam.ErrCodeDisabled:
+			fmt.Fprintln(os.Stderr, "FacePass: Face authentication disabled for this user")
+			return 2
 		case pam.ErrCodeTimeout:
 			fmt.Fprintln(os.Stderr, "FacePass: Timeout, falling back to password")
 			return 2
 		case pam.ErrCodeCamera:
+			fmt.Fprintf(os.Stderr, "FacePass: %s\n", authErr.Message)
 			fmt.Fprintln(os.Stderr, "FacePass: Camera error, falling back to password")
 			return 3
 		case pam.ErrCodeLiveness:
@@ -121,6 +222,9 @@ func runAuthentication(auth pam.Authenticator, username string, startTime time.T
 		case pam.ErrCodeNoFace:
 			fmt.Fprintln(os.Stderr, "FacePass: No face detected, falling back to password")
 			return 2
+		case pam.ErrCodeOverexposed:
+			fmt.Fprintf(os.Stderr, "FacePass: %s\n", authErr.Message)
+			return 2
 		default:
 			fmt.Fprintf(os.Stderr, "FacePass: %s\n", result.Reason)
 			return 1
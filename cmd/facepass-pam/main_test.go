@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os/user"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,6 +45,15 @@ func TestRunAuthentication(t *testing.T) {
 			},
 			expected: 2,
 		},
+		{
+			name: "Disabled",
+			result: pam.AuthResult{
+				Success: false,
+				Error:   &pam.AuthError{Code: pam.ErrCodeDisabled},
+				Reason:  "user disabled",
+			},
+			expected: 2,
+		},
 		{
 			name: "Timeout",
 			result: pam.AuthResult{
@@ -87,6 +99,15 @@ func TestRunAuthentication(t *testing.T) {
 			},
 			expected: 2,
 		},
+		{
+			name: "Overexposed",
+			result: pam.AuthResult{
+				Success: false,
+				Error:   &pam.AuthError{Code: pam.ErrCodeOverexposed, Message: "Too much light"},
+				Reason:  "overexposed",
+			},
+			expected: 2,
+		},
 		{
 			name: "GenericError",
 			result: pam.AuthResult{
@@ -101,10 +122,81 @@ func TestRunAuthentication(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &MockAuthenticator{Result: tt.result}
-			code := runAuthentication(mock, "testuser", time.Now())
+			code := runAuthentication(mock, "testuser", time.Now(), tt.name == "GenericError")
 			if code != tt.expected {
 				t.Errorf("runAuthentication() = %d, want %d", code, tt.expected)
 			}
 		})
 	}
 }
+
+func TestResolveUsername(t *testing.T) {
+	env := func(value string) func(string) string {
+		return func(key string) string {
+			if key == "PAM_USER" {
+				return value
+			}
+			return ""
+		}
+	}
+	current := func() (*user.User, error) { return &user.User{Username: "runner"}, nil }
+
+	tests := []struct {
+		name       string
+		args       []string
+		pamUser    string
+		wantUser   string
+		wantSource string
+	}{
+		{name: "argument wins", args: []string{"alice"}, pamUser: "bob", wantUser: "alice", wantSource: "argument"},
+		{name: "PAM_USER", pamUser: "bob", wantUser: "bob", wantSource: "PAM_USER"},
+		{name: "empty argument", args: []string{""}, pamUser: "bob", wantUser: "bob", wantSource: "PAM_USER"},
+		{name: "current user", wantUser: "runner", wantSource: "current user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, source, err := resolveUsername(tt.args, env(tt.pamUser), current)
+			if err != nil || username != tt.wantUser || source != tt.wantSource {
+				t.Errorf("resolveUsername() = %q, %q, %v, want %q, %q", username, source, err, tt.wantUser, tt.wantSource)
+			}
+		})
+	}
+
+	failing := func() (*user.User, error) { return nil, errors.New("no passwd entry") }
+	if _, _, err := resolveUsername(nil, env(""), failing); err == nil {
+		t.Error("resolveUsername() should fail without any source")
+	}
+}
+
+func TestParseDebugJSON(t *testing.T) {
+	env := func(value string) func(string) string {
+		return func(key string) string {
+			if key == "PAM_FACEPASS_DEBUG" {
+				return value
+			}
+			return ""
+		}
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		debug    string
+		wantArgs []string
+		want     bool
+	}{
+		{name: "off", args: []string{"alice"}, wantArgs: []string{"alice"}},
+		{name: "flag", args: []string{"--debug-json", "alice"}, wantArgs: []string{"alice"}, want: true},
+		{name: "flag after user", args: []string{"alice", "--debug-json"}, wantArgs: []string{"alice"}, want: true},
+		{name: "env", debug: "1", wantArgs: []string{}, want: true},
+		{name: "env off", debug: "0", wantArgs: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, got := parseDebugJSON(tt.args, env(tt.debug))
+			if got != tt.want || strings.Join(args, " ") != strings.Join(tt.wantArgs, " ") {
+				t.Errorf("parseDebugJSON() = %q, %t, want %q, %t", args, got, tt.wantArgs, tt.want)
+			}
+		})
+	}
+}
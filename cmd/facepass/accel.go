@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+func cmdAccel(args []string) error {
+	manager := acceleration.GetManager()
+	// A missing device is reported below together with the detected backends
+	initErr := manager.Initialize(acceleration.Config{
+		PreferredBackend: acceleration.Backend(cfg.Acceleration.Backend),
+		FallbackToCPU:    cfg.Acceleration.FallbackToCPU,
+		DeviceIndex:      cfg.Acceleration.DeviceIndex,
+		EnableProfiling:  cfg.Acceleration.EnableProfiling,
+		ModelPath:        cfg.Acceleration.ONNXModelPath,
+	})
+	if initErr != nil && !errors.Is(initErr, acceleration.ErrBackendNotAvailable) {
+		return fmt.Errorf("failed to detect acceleration backends: %w", initErr)
+	}
+
+	active := manager.GetActiveBackend()
+	backends := manager.GetAllBackends()
+
+	fmt.Println("Acceleration Backends:")
+	for _, backend := range []acceleration.Backend{
+		acceleration.BackendCPU,
+		acceleration.BackendROCm,
+		acceleration.BackendCUDA,
+		acceleration.BackendOpenVINO,
+	} {
+		info, ok := backends[backend]
+		if !ok {
+			fmt.Printf("\n  %s: not detected\n", backend)
+			continue
+		}
+
+		marker := ""
+		if backend == active && initErr == nil {
+			marker = " (selected)"
+		}
+		fmt.Printf("\n  %s%s\n", info.Name, marker)
+		fmt.Printf("    Available: %v\n", info.Available)
+		fmt.Printf("    Tested:    %v\n", info.Tested)
+		if len(info.Devices) > 1 {
+			fmt.Println("    Devices:")
+			for i, name := range info.Devices {
+				fmt.Printf("      [%d] %s\n", i, name)
+			}
+		} else if info.DeviceName != "" {
+			fmt.Printf("    Device:    %s", info.DeviceName)
+			if backend != acceleration.BackendCPU && info.DeviceCount > 1 {
+				fmt.Printf(" (%d devices)", info.DeviceCount)
+			}
+			fmt.Println()
+		}
+		if info.Version != "" {
+			fmt.Printf("    Version:   %s\n", info.Version)
+		}
+		if info.Warning != "" {
+			fmt.Printf("    Warning:   %s\n", info.Warning)
+		}
+	}
+
+	fmt.Printf("\nConfigured: acceleration.backend=%s, device_index=%d, recognition.backend=%s\n",
+		cfg.Acceleration.Backend, cfg.Acceleration.DeviceIndex, cfg.Recognition.Backend)
+	if initErr != nil {
+		fmt.Printf("Error: %v\n", initErr)
+	}
+	if cfg.Recognition.Backend != recognition.BackendONNX {
+		fmt.Println("GPU backends are only used with recognition.backend: onnx.")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// Auto-capture settings for 'enroll --auto'.
+const (
+	autoCaptureCountdown    = 3                // Seconds counted down before looking for a face
+	autoCaptureStableFrames = 5                // Consecutive frames the face must hold still
+	autoCaptureMaxShift     = 0.1              // Allowed movement between frames, relative to the face width
+	autoCaptureTimeout      = 15 * time.Second // Give up on an angle after this long
+)
+
+// countdown prints a 3-2-1 style countdown on one line.
+func countdown(seconds int) {
+	for i := seconds; i > 0; i-- {
+		fmt.Printf("%d... ", i)
+		time.Sleep(time.Second)
+	}
+}
+
+// autoCaptureFace reads frames until a single, fully visible face has stayed
+// in place for autoCaptureStableFrames consecutive frames, and returns the
+// last frame and its face. Frames with several faces are skipped, unless
+// strict is set: then the first one fails the capture with
+// recognition.ErrMultipleFaces.
+func autoCaptureFace(cam *camera.V4L2Camera, strict bool) (*camera.Frame, *recognition.Face, error) {
+	deadline := time.Now().Add(autoCaptureTimeout)
+	var prev *recognition.Face
+	stable := 0
+	lastErr := recognition.ErrNoFaceDetected
+
+	for time.Now().Before(deadline) {
+		frame, err := cam.ReadFrame()
+		if errors.Is(err, camera.ErrCameraBusy) {
+			return nil, nil, cameraBusyError(err)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		face, err := detectFrameFace(frame)
+		if err == nil {
+			err = recognition.CheckFaceInFrame(face, frame.Width, frame.Height, cfg.Recognition.EdgeMargin)
+		}
+		if strict && errors.Is(err, recognition.ErrMultipleFaces) {
+			return nil, nil, err
+		}
+		if err != nil {
+			lastErr = err
+			prev, stable = nil, 0
+			continue
+		}
+
+		if prev != nil && faceStable(prev, face) {
+			stable++
+		} else {
+			stable = 1
+		}
+		prev = face
+		logging.Debugf("Auto-capture: face stable for %d/%d frames", stable, autoCaptureStableFrames)
+
+		if stable >= autoCaptureStableFrames {
+			return frame, face, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no stable face within %s: %w", autoCaptureTimeout, lastErr)
+}
+
+// faceStable reports whether cur is close to prev in position and size.
+func faceStable(prev, cur *recognition.Face) bool {
+	a, b := prev.BoundingBox, cur.BoundingBox
+	if a.Width <= 0 || b.Width <= 0 {
+		return false
+	}
+	limit := autoCaptureMaxShift * float64(a.Width)
+	dx := float64(b.X+b.Width/2) - float64(a.X+a.Width/2)
+	dy := float64(b.Y+b.Height/2) - float64(a.Y+a.Height/2)
+	return math.Hypot(dx, dy) <= limit && math.Abs(float64(b.Width-a.Width)) <= limit
+}
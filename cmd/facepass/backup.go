@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+// parseArchiveArgs parses [--force] <archive> for backup and restore,
+// accepting the flag on either side of the archive path.
+func parseArchiveArgs(name string, args []string) (string, bool, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	force := flags.Bool("force", false, "Overwrite existing data")
+	if err := flags.Parse(args); err != nil {
+		return "", false, err
+	}
+	archive := flags.Arg(0)
+	if archive != "" {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return "", false, err
+		}
+	}
+
+	switch {
+	case archive == "":
+		return "", false, fmt.Errorf("archive path required\nUsage: %s", commands[name].Usage)
+	case flags.NArg() > 0:
+		return "", false, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return archive, *force, nil
+}
+
+func cmdBackup(args []string) error {
+	archive, force, err := parseArchiveArgs("backup", args)
+	if err != nil {
+		return err
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(archive, mode, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", archive)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	manifest, err := storage.Backup(storageOptions(), f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write archive: %w", closeErr)
+	}
+	if err != nil {
+		_ = os.Remove(archive)
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	fmt.Printf("Backed up %d user(s) from %s to %s\n", len(manifest.Users), cfg.Storage.DataDir, archive)
+	if manifest.Encrypted {
+		fmt.Printf("Data is encrypted with key %s (storage.key_source: %s).\n", manifest.KeyFingerprint, cfg.Storage.KeySource)
+		if cfg.Storage.KeySource == "" || cfg.Storage.KeySource == string(storage.KeySourceMachine) {
+			fmt.Println("Note: the machine key only exists on this machine; restoring elsewhere")
+			fmt.Println("      needs 'facepass rekey' with this machine's key afterwards.")
+		}
+	} else {
+		fmt.Println("WARNING: encryption is disabled; the archive contains unencrypted face data.")
+	}
+	return nil
+}
+
+func cmdRestore(args []string) error {
+	archive, force, err := parseArchiveArgs("restore", args)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	manifest, err := storage.RestoreAll(storageOptions(), f, force)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	fmt.Printf("Restored %d user(s) from %s (created %s) to %s\n",
+		len(manifest.Users), archive, manifest.Created.Local().Format("2006-01-02 15:04"), cfg.Storage.DataDir)
+
+	if manifest.Encrypted {
+		key, err := storage.ResolveKey(storage.KeySource(cfg.Storage.KeySource), cfg.Storage.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to resolve configured key: %w", err)
+		}
+		if !manifest.KeyMatches(key) {
+			fmt.Printf("\nWARNING: the backup was encrypted with key %s, but the configured key is %s.\n",
+				manifest.KeyFingerprint, storage.KeyFingerprint(key))
+			fmt.Println("The restored data cannot be decrypted until the original key is configured")
+			fmt.Println("(storage.key_source) or the data is re-encrypted with 'facepass rekey -old-key ...'.")
+			return nil
+		}
+	}
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+	var failed []string
+	for _, username := range manifest.Users {
+		if _, err := store.LoadUser(username); err != nil {
+			fmt.Printf("  %s: %v\n", username, err)
+			failed = append(failed, username)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d restored user(s) could not be read: %s", len(failed), strings.Join(failed, ", "))
+	}
+	fmt.Println("All restored users can be read with the configured key.")
+	return nil
+}
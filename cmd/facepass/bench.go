@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+func cmdBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	backend := fs.String("backend", "", "Engine to benchmark: dlib, or an ONNX execution provider (cpu, rocm, cuda, openvino)")
+	iterations := fs.Int("iterations", 20, "Number of detection+embedding iterations")
+	imagePath := fs.String("image", "", "Benchmark on this image instead of a camera frame")
+	noWarmUp := fs.Bool("no-warmup", false, "Skip the warm-up inference, to measure a cold first frame")
+	detector := fs.String("detector", cfg.Recognition.Detector, "Face detector to benchmark: hog or cnn (dlib only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *iterations <= 0 {
+		return fmt.Errorf("--iterations must be positive")
+	}
+
+	if *detector != recognition.DetectorHOG && *detector != recognition.DetectorCNN {
+		return fmt.Errorf("unknown detector: %s (use hog or cnn)", *detector)
+	}
+	cfg.Recognition.Detector = *detector
+
+	switch *backend {
+	case "":
+	case recognition.BackendDlib:
+		cfg.Recognition.Backend = recognition.BackendDlib
+	case "cpu", "rocm", "cuda", "openvino":
+		cfg.Recognition.Backend = recognition.BackendONNX
+		cfg.Acceleration.Backend = *backend
+	default:
+		return fmt.Errorf("unknown backend: %s (use dlib, cpu, rocm, cuda or openvino)", *backend)
+	}
+
+	var image []byte
+	var err error
+	if *imagePath != "" {
+		image, err = os.ReadFile(*imagePath)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+	} else {
+		image, err = captureBenchImage()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := initRecognizer(false); err != nil {
+		return err
+	}
+	defer func() { _ = recognizer.Close() }()
+
+	engine := recognition.BackendDlib
+	if _, ok := recognizer.(*recognition.ONNXRecognizer); ok {
+		engine = recognition.BackendONNX
+	} else if cfg.Recognition.Backend == recognition.BackendONNX {
+		engine += " (ONNX unavailable, fell back)"
+	}
+
+	// Time the warm-up and the first frame apart from the average, the way
+	// authentication sees them; compare with --no-warmup to see what the
+	// warm-up saves
+	start := time.Now()
+	if !*noWarmUp {
+		if err := recognizer.WarmUp(); err != nil {
+			return fmt.Errorf("warm-up failed: %w", err)
+		}
+	}
+	warmUp := time.Since(start)
+	start = time.Now()
+	if _, err := recognizer.DetectFaces(image); err != nil {
+		return fmt.Errorf("benchmark failed: %w", err)
+	}
+	firstFrame := time.Since(start)
+
+	fmt.Printf("Benchmarking %d iterations...\n", *iterations)
+	result, err := recognition.Benchmark(recognizer, image, *iterations)
+	if err != nil {
+		return fmt.Errorf("benchmark failed: %w", err)
+	}
+
+	fmt.Println("\nBenchmark Results:")
+	fmt.Printf("  Engine:       %s\n", engine)
+	fmt.Printf("  Backend:      %s\n", result.Backend)
+	if engine == recognition.BackendDlib {
+		fmt.Printf("  Detector:     %s\n", *detector)
+	}
+	if !*noWarmUp {
+		fmt.Printf("  Warm-up:      %.2f ms\n", float64(warmUp)/float64(time.Millisecond))
+	}
+	fmt.Printf("  First frame:  %.2f ms\n", float64(firstFrame)/float64(time.Millisecond))
+	fmt.Printf("  Iterations:   %d\n", result.Iterations)
+	fmt.Printf("  Detection:    %.2f ms\n", result.DetectionTimeMs)
+	fmt.Printf("  Recognition:  %.2f ms\n", result.RecognitionTimeMs)
+	fmt.Printf("  Total:        %.2f ms\n", result.TotalTimeMs)
+	fmt.Printf("  FPS:          %.1f\n", result.FPS)
+	return nil
+}
+
+// captureBenchImage captures a single frame that all benchmark iterations
+// run on, so results only depend on the engine.
+func captureBenchImage() ([]byte, error) {
+	cam := camera.NewCamera()
+	_ = cam.SetResolution(cfg.Camera.Width, cfg.Camera.Height)
+	_ = cam.SetPixelFormat(cfg.Camera.PixelFormat)
+	_ = cam.SetJPEGQuality(cfg.Camera.JPEGQuality)
+
+	device := captureDevice(cfg)
+
+	if err := cam.Open(device); err != nil {
+		return nil, cameraOpenError(device, err)
+	}
+	defer func() { _ = cam.Close() }()
+	trackCamera(cam)
+
+	if cam.HasIREmitter() && cfg.Camera.IREmitterEnabled {
+		_ = cam.EnableIREmitter()
+		defer func() { _ = cam.DisableIREmitter() }()
+	}
+
+	fmt.Println("Look at the camera; one frame is captured and reused for every iteration.")
+	waitForEnter("Press Enter when ready... ")
+
+	frame, err := captureSettledFrame(cam)
+	if err != nil {
+		return nil, fmt.Errorf("capture failed: %w", err)
+	}
+	return frame.Data, nil
+}
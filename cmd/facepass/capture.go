@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+)
+
+// maxCaptureCount limits 'facepass capture --count'.
+const maxCaptureCount = 1000
+
+// cmdCapture captures frames and writes them to disk with timing
+// information. It loads no models, so it tells whether the camera works at
+// all, independent of face detection and recognition.
+func cmdCapture(args []string) error {
+	flags := flag.NewFlagSet("capture", flag.ContinueOnError)
+	out := flags.String("out", "frame.jpg", "Output file; with --count > 1 the frame number is added before the extension")
+	count := flags.Int("count", 1, "Number of frames to capture")
+	device := flags.String("device", "", "Camera device (default: the configured camera, preferring the IR camera)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *count < 1 || *count > maxCaptureCount {
+		return fmt.Errorf("--count must be between 1 and %d, got %d", maxCaptureCount, *count)
+	}
+
+	if *device == "" {
+		*device = captureDevice(cfg)
+	}
+
+	cam := camera.NewCamera()
+	_ = cam.SetResolution(cfg.Camera.Width, cfg.Camera.Height)
+	if err := cam.SetPixelFormat(cfg.Camera.PixelFormat); err != nil {
+		return err
+	}
+	if err := cam.SetJPEGQuality(cfg.Camera.JPEGQuality); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := cam.Open(*device); err != nil {
+		return cameraOpenError(*device, err)
+	}
+	defer func() { _ = cam.Close() }()
+	trackCamera(cam)
+
+	info := cam.GetDeviceInfo()
+	fmt.Printf("Camera:  %s (%s)\n", camera.RedactDevice(*device), orUnknown(info.Name))
+	fmt.Printf("Request: %dx%d, pixel format %s, JPEG quality %d\n",
+		cfg.Camera.Width, cfg.Camera.Height, cfg.Camera.PixelFormat, cfg.Camera.JPEGQuality)
+	fmt.Printf("Opened in %s\n", time.Since(start).Round(time.Millisecond))
+
+	if cam.HasIREmitter() && cfg.Camera.IREmitterEnabled {
+		if err := cam.EnableIREmitter(); err != nil {
+			fmt.Printf("Warning: could not enable the IR emitter: %v\n", err)
+		} else {
+			defer func() { _ = cam.DisableIREmitter() }()
+		}
+	}
+
+	// Stream for several frames, so the timing shows the real frame rate
+	if *count > 1 {
+		streamStart := time.Now()
+		if err := cam.StartStreaming(); err != nil {
+			fmt.Printf("Warning: streaming failed, capturing frames one by one: %v\n", err)
+		} else {
+			defer func() { _ = cam.StopStreaming() }()
+			fmt.Printf("Streaming started in %s\n", time.Since(streamStart).Round(time.Millisecond))
+		}
+	}
+
+	fmt.Println()
+	written := 0
+	first := time.Now()
+	last := first
+	for i := 0; i < *count; i++ {
+		frame, err := cam.ReadFrame()
+		now := time.Now()
+		if errors.Is(err, camera.ErrCameraBusy) {
+			return cameraBusyError(err)
+		}
+		if err != nil {
+			fmt.Printf("Frame %d: FAILED after %s: %v\n", i+1, now.Sub(last).Round(time.Millisecond), err)
+			if errors.Is(err, camera.ErrCaptureTimeout) {
+				fmt.Println("  The camera delivered no frame in time; is another program using it?")
+			}
+			last = now
+			continue
+		}
+
+		path := captureOutputPath(*out, i, *count)
+		if err := os.WriteFile(path, frame.Data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		written++
+		fmt.Printf("Frame %d: %dx%d %s, %d bytes, +%s -> %s\n",
+			i+1, frame.Width, frame.Height, frame.Format, len(frame.Data), now.Sub(last).Round(time.Millisecond), path)
+		last = now
+	}
+
+	elapsed := last.Sub(first)
+	fmt.Printf("\nWrote %d of %d frames in %s", written, *count, elapsed.Round(time.Millisecond))
+	if written > 1 && elapsed > 0 {
+		fmt.Printf(" (%.1f FPS)", float64(written)/elapsed.Seconds())
+	}
+	fmt.Println()
+	if written == 0 {
+		return errors.New("no frame captured")
+	}
+	return nil
+}
+
+// captureOutputPath returns the file for frame i of count: out itself for a
+// single frame, otherwise out with the frame number before the extension.
+func captureOutputPath(out string, i, count int) string {
+	if count == 1 {
+		return out
+	}
+	ext := filepath.Ext(out)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(out, ext), i+1, ext)
+}
+
+// orUnknown returns s, or "unknown" if it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
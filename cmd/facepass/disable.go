@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+func cmdDisable(args []string) error {
+	return setUserDisabled("disable", args, true)
+}
+
+func cmdEnable(args []string) error {
+	return setUserDisabled("enable", args, false)
+}
+
+// setUserDisabled suspends or resumes face authentication for the user in
+// args. The enrollment is kept either way.
+func setUserDisabled(command string, args []string, disabled bool) error {
+	switch {
+	case len(args) == 0 || args[0] == "":
+		return fmt.Errorf("username required\nUsage: %s", commands[command].Usage)
+	case len(args) > 1:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args[1:], " "))
+	}
+	username := args[0]
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+	if !store.UserExists(username) {
+		return fmt.Errorf("user '%s' is not enrolled in %s", username, cfg.Storage.DataDir)
+	}
+
+	state := "disabled"
+	if !disabled {
+		state = "enabled"
+	}
+	unchanged := false
+	err := store.UpdateUser(username, func(user *storage.UserFaceData) error {
+		if user.Disabled == disabled {
+			unchanged = true
+			return storage.ErrSkipUpdate
+		}
+		user.Disabled = disabled
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user %s: %w", username, err)
+	}
+	if unchanged {
+		fmt.Printf("Face authentication for '%s' is already %s.\n", username, state)
+		return nil
+	}
+	logging.Infof("Face authentication %s for user: %s", state, username)
+
+	if disabled {
+		fmt.Printf("Face authentication for '%s' is disabled; the enrollment is kept.\n", username)
+		fmt.Printf("PAM falls back to the password. Re-enable with 'facepass enable %s'.\n", username)
+	} else {
+		fmt.Printf("Face authentication for '%s' is enabled again.\n", username)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// duplicateAngleDistance is the distance below which two captured angles are
+// reported as identical, i.e. the head did not actually move between them.
+const duplicateAngleDistance = 0.1
+
+// printDistanceMatrix prints the pairwise distances among the captured
+// embeddings and points out angles that look identical and angles that match
+// none of the others within tolerance.
+func printDistanceMatrix(embeddings []recognition.Embedding, tolerance float64) {
+	fmt.Println("\nPairwise distances:")
+	fmt.Printf("%12s", "")
+	for i := range embeddings {
+		fmt.Printf(" %7d", i+1)
+	}
+	fmt.Println()
+
+	var duplicates, outliers []string
+	for i, a := range embeddings {
+		fmt.Printf("%3d %-8s", i+1, a.Angle)
+		nearest := math.Inf(1)
+		for j, b := range embeddings {
+			if i == j {
+				fmt.Printf(" %7s", "-")
+				continue
+			}
+			distance := recognition.EuclideanDistance(a.Vector, b.Vector)
+			fmt.Printf(" %7.3f", distance)
+			nearest = math.Min(nearest, distance)
+			if j > i && distance < duplicateAngleDistance {
+				duplicates = append(duplicates, fmt.Sprintf("%d and %d", i+1, j+1))
+			}
+		}
+		fmt.Println()
+		if len(embeddings) > 1 && nearest > tolerance {
+			outliers = append(outliers, strconv.Itoa(i+1))
+		}
+	}
+
+	if len(duplicates) > 0 {
+		fmt.Printf("Angles %s are nearly identical; did you move your head?\n", strings.Join(duplicates, ", "))
+	}
+	if len(outliers) > 0 {
+		fmt.Printf("Angle(s) %s match none of the others within tolerance %.2f; possibly a bad capture.\n",
+			strings.Join(outliers, ", "), tolerance)
+	}
+}
+
+// askRecapture asks which of n captured angles to redo and returns their
+// zero-based indexes. An empty answer returns none.
+func askRecapture(n int) []int {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("Angles to recapture (e.g. 2,4), or Enter to save: ")
+		line, _ := reader.ReadString('\n')
+		indexes, err := parseRecapture(strings.TrimSpace(line), n)
+		if err == nil {
+			return indexes
+		}
+		fmt.Println(err)
+	}
+}
+
+// parseRecapture parses a comma-separated list of one-based angle numbers
+// between 1 and n.
+func parseRecapture(answer string, n int) ([]int, error) {
+	if answer == "" {
+		return nil, nil
+	}
+	var indexes []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(answer, ",") {
+		k, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || k < 1 || k > n {
+			return nil, fmt.Errorf("invalid angle number %q (valid: 1-%d)", strings.TrimSpace(field), n)
+		}
+		if !seen[k] {
+			seen[k] = true
+			indexes = append(indexes, k-1)
+		}
+	}
+	return indexes, nil
+}
@@ -10,10 +10,11 @@ import (
 	"time"
 
 	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
 )
 
 func cmdDownloadModels(args []string) error {
-	modelDir := cfg.Recognition.ModelPath
+	modelDir := cfg.Recognition.ModelPath.Primary()
 	if len(args) > 0 {
 		modelDir = args[0]
 	}
@@ -24,25 +25,7 @@ func cmdDownloadModels(args []string) error {
 		return fmt.Errorf("failed to create model directory: %w", err)
 	}
 
-	models := []struct {
-		Name string
-		URL  string
-	}{
-		{
-			Name: "shape_predictor_5_face_landmarks.dat",
-			URL:  "http://dlib.net/files/shape_predictor_5_face_landmarks.dat.bz2",
-		},
-		{
-			Name: "dlib_face_recognition_resnet_model_v1.dat",
-			URL:  "http://dlib.net/files/dlib_face_recognition_resnet_model_v1.dat.bz2",
-		},
-		{
-			Name: "mmod_human_face_detector.dat",
-			URL:  "http://dlib.net/files/mmod_human_face_detector.dat.bz2",
-		},
-	}
-
-	for _, model := range models {
+	for _, model := range modelDownloads(modelNames()) {
 		targetPath := filepath.Join(modelDir, model.Name)
 		if _, err := os.Stat(targetPath); err == nil {
 			logging.Infof("Model %s already exists, skipping", model.Name)
@@ -60,6 +43,35 @@ func cmdDownloadModels(args []string) error {
 	return nil
 }
 
+// dlibModelURL is the download location of the dlib model files.
+const dlibModelURL = "http://dlib.net/files/%s.bz2"
+
+// modelDownload is a model file and where to download it from.
+type modelDownload struct {
+	Name string
+	URL  string
+}
+
+// modelDownloads returns the models to download for the configured file
+// names. Files published by dlib are downloaded by name; renamed copies are
+// downloaded from the default model and saved under the configured name.
+func modelDownloads(names recognition.ModelNames) []modelDownload {
+	published := map[string]bool{recognition.ShapePredictor68Model: true}
+	for _, name := range recognition.ModelFiles {
+		published[name] = true
+	}
+
+	var models []modelDownload
+	for i, name := range names.Files() {
+		source := name
+		if !published[name] {
+			source = recognition.ModelFiles[i]
+		}
+		models = append(models, modelDownload{Name: name, URL: fmt.Sprintf(dlibModelURL, source)})
+	}
+	return models
+}
+
 func downloadAndExtract(url, targetPath string) error {
 	// Create HTTP client with timeout
 	client := &http.Client{
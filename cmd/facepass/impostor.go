@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for probe images
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// probeExtensions are the image types read by test --impostor-scan.
+var probeExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
+
+// runImpostorScan compares labeled probe images against every enrolled user
+// and prints the false accept and false reject rates at a range of
+// tolerances. dir has one subdirectory per person, named after the enrolled
+// username; people who are not enrolled only contribute impostor comparisons.
+func runImpostorScan(dir string) error {
+	labels, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read probe directory: %w", err)
+	}
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+	users, err := store.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	galleries := make(map[string][]recognition.Embedding, len(users))
+	for _, username := range users {
+		user, err := store.LoadUser(username)
+		if err == nil {
+			err = recognition.ValidateEmbeddings(user.Embeddings)
+		}
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", username, err)
+			continue
+		}
+		galleries[username] = user.Embeddings
+	}
+	if len(galleries) == 0 {
+		return fmt.Errorf("no usable enrolled users to compare against")
+	}
+
+	if err := initRecognizer(false); err != nil {
+		return err
+	}
+	defer func() { _ = recognizer.Close() }()
+
+	fmt.Printf("Scanning %s against %d enrolled user(s)...\n", dir, len(galleries))
+
+	var report recognition.TuningReport
+	probes, skipped := 0, 0
+	var unenrolled []string
+	for _, label := range labels {
+		if !label.IsDir() {
+			continue
+		}
+		if _, ok := galleries[label.Name()]; !ok {
+			unenrolled = append(unenrolled, label.Name())
+		}
+
+		files, err := os.ReadDir(filepath.Join(dir, label.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read probe directory: %w", err)
+		}
+		for _, file := range files {
+			if file.IsDir() || !probeExtensions[strings.ToLower(filepath.Ext(file.Name()))] {
+				continue
+			}
+			path := filepath.Join(dir, label.Name(), file.Name())
+			embedding, err := probeEmbedding(path)
+			if err != nil {
+				fmt.Printf("  Skipping %s: %v\n", path, err)
+				skipped++
+				continue
+			}
+			probes++
+			for username, gallery := range galleries {
+				_, distance, _ := recognizer.FindBestMatch(*embedding, gallery)
+				report.Add(distance, username == label.Name())
+			}
+		}
+	}
+	if probes == 0 {
+		return fmt.Errorf("no usable probe images in %s (expected <dir>/<username>/*.jpg or *.png)", dir)
+	}
+
+	fmt.Printf("\nProbes: %d (%d skipped)\n", probes, skipped)
+	fmt.Printf("Genuine comparisons:  %d\n", len(report.Genuine))
+	fmt.Printf("Impostor comparisons: %d\n", len(report.Impostor))
+	if len(unenrolled) > 0 {
+		fmt.Printf("Not enrolled (impostor only): %s\n", strings.Join(unenrolled, ", "))
+	}
+
+	tolerances := append([]float64{}, recognition.DefaultTuningTolerances...)
+	current := cfg.Recognition.Tolerance
+	found := false
+	for _, tolerance := range tolerances {
+		found = found || math.Abs(tolerance-current) < 1e-9
+	}
+	if !found {
+		tolerances = append(tolerances, current)
+		sort.Float64s(tolerances)
+	}
+
+	fmt.Println("\nTolerance | FAR     | FRR")
+	fmt.Println("----------+---------+--------")
+	for _, point := range report.OperatingPoints(tolerances) {
+		marker := ""
+		if math.Abs(point.Tolerance-current) < 1e-9 {
+			marker = "  (current)"
+		}
+		fmt.Printf("  %.3f   | %-7s | %s%s\n", point.Tolerance, formatRate(point.FAR), formatRate(point.FRR), marker)
+	}
+
+	fmt.Println("\nSuggested operating points:")
+	if point, ok := report.ZeroFAR(); ok {
+		fmt.Printf("  No false accepts: tolerance < %.3f (FRR %s)\n", point.Tolerance, formatRate(point.FRR))
+	}
+	if point, ok := report.EqualError(); ok {
+		fmt.Printf("  Equal error rate: tolerance %.3f (FAR %s, FRR %s)\n", point.Tolerance, formatRate(point.FAR), formatRate(point.FRR))
+	}
+	if len(report.Genuine) == 0 || len(report.Impostor) == 0 {
+		fmt.Println("  Need probes of both enrolled and other people for a suggestion.")
+	}
+	fmt.Println("\nFor login, prefer a tolerance without false accepts; set it as recognition.tolerance.")
+
+	return nil
+}
+
+// probeEmbedding decodes an image file and returns the embedding of its
+// single face.
+func probeEmbedding(path string) (*recognition.Embedding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return recognizer.RecognizeImage(img, "probe")
+}
+
+// formatRate formats an error rate as a percentage, or n/a without data.
+func formatRate(rate float64) string {
+	if math.IsNaN(rate) {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", rate*100)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+func cmdKey(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required\nUsage: %s", commands["key"].Usage)
+	}
+	switch args[0] {
+	case "export":
+		return cmdKeyExport(args[1:])
+	default:
+		return fmt.Errorf("unknown key subcommand: %s\nUsage: %s", args[0], commands["key"].Usage)
+	}
+}
+
+// cmdKeyExport prints the configured encryption key, or writes it to a
+// new file, so the face data can still be decrypted after the machine
+// identity behind key_source: machine changes.
+func cmdKeyExport(args []string) error {
+	flags := flag.NewFlagSet("key export", flag.ContinueOnError)
+	out := flags.String("out", "", "Write the key to this new file (mode 0600) instead of printing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	key, err := storage.ResolveKey(storage.KeySource(cfg.Storage.KeySource), cfg.Storage.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve configured key: %w", err)
+	}
+	encoded := hex.EncodeToString(key[:])
+
+	if *out == "" {
+		fmt.Println(encoded)
+		return nil
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := fmt.Fprintln(f, encoded); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	fmt.Printf("Key written to %s (fingerprint %s). Keep it somewhere only you can read.\n",
+		*out, storage.KeyFingerprint(key))
+	return nil
+}
+
+// oldMachineKey derives the machine key from the identity before a
+// reinstall or rename: machineID is the old /etc/machine-id, or a file
+// holding it, and hostname the old hostname. Either may be empty to keep
+// the current value.
+func oldMachineKey(machineID, hostname string) ([storage.KeySize]byte, error) {
+	id := storage.CurrentMachineIdentity()
+	if machineID != "" {
+		if decoded, err := hex.DecodeString(machineID); err == nil && len(decoded) == 16 {
+			// /etc/machine-id ends with a newline, which is part of the key
+			id.MachineID = machineID + "\n"
+		} else if data, err := os.ReadFile(machineID); err == nil {
+			id.MachineID = string(data)
+		} else {
+			return [storage.KeySize]byte{}, fmt.Errorf("old machine ID must be 32 hex characters or a readable file: %w", err)
+		}
+	}
+	if hostname != "" {
+		id.Hostname = hostname
+	}
+	return storage.MachineKey(id), nil
+}
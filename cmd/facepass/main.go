@@ -2,91 +2,222 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
 	"github.com/MrCodeEU/facepass/pkg/camera"
 	"github.com/MrCodeEU/facepass/pkg/config"
 	"github.com/MrCodeEU/facepass/pkg/liveness"
 	"github.com/MrCodeEU/facepass/pkg/logging"
 	"github.com/MrCodeEU/facepass/pkg/recognition"
 	"github.com/MrCodeEU/facepass/pkg/storage"
+	"gopkg.in/yaml.v3"
 )
 
-const version = "0.2.0"
-
 // Command represents a CLI command.
 type Command struct {
 	Name        string
 	Description string
 	Usage       string
 	Run         func(args []string) error
+
+	// HandlesSignals is set for commands that shut down on SIGINT/SIGTERM
+	// themselves instead of using the global interrupt handler.
+	HandlesSignals bool
 }
 
 var (
-	cfg        *config.Config
-	commands   map[string]*Command
-	recognizer *recognition.DlibRecognizer
-	store      *storage.FileStorage
+	cfg *config.Config
+	// configFiles are the config files considered at startup, in load order
+	configFiles []string
+	commands    map[string]*Command
+	recognizer  recognition.Engine
+	store       storage.Backend
 )
 
-// Enrollment angles to capture
+// Enrollment angles to capture unless --angles is given
 var enrollmentAngles = []string{"front", "left", "right", "up", "down"}
 
+// allEnrollmentAngles are the poses --angles can select, in capture order.
+// "--angles N" takes the first N.
+var allEnrollmentAngles = []string{"front", "left", "right", "up", "down", "up-left", "up-right", "down-left", "down-right"}
+
+// minEnrollmentAngles is the number of angles enrollment must capture.
+const minEnrollmentAngles = 3
+
+// challengeCountdown is the number of seconds 'test --challenge' gives the
+// user to perform the action before capturing again.
+const challengeCountdown = 2
+
 func init() {
 	commands = map[string]*Command{
 		"enroll": {
 			Name:        "enroll",
-			Description: "Enroll a new face (captures 5 angles)",
-			Usage:       "facepass enroll <username>",
+			Description: "Enroll a new face (captures 5 angles by default)",
+			Usage:       "facepass enroll <username> [--angles front,left,right | --angles N] [--auto] [--verbose] [--strict]",
 			Run:         cmdEnroll,
 		},
 		"add-face": {
 			Name:        "add-face",
 			Description: "Add additional face angles to existing enrollment",
-			Usage:       "facepass add-face <username>",
+			Usage:       "facepass add-face <username> [--profile <name>]",
 			Run:         cmdAddFace,
 		},
 		"test": {
 			Name:        "test",
 			Description: "Test face recognition for a user",
-			Usage:       "facepass test <username>",
+			Usage:       "facepass test <username> [--no-liveness | --challenge] [--workers N] [--fps-cap N] [--pprof addr] | facepass test --impostor-scan <dir>",
 			Run:         cmdTest,
 		},
 		"remove": {
 			Name:        "remove",
 			Description: "Remove a user's face data",
-			Usage:       "facepass remove <username>",
+			Usage:       "facepass remove [--yes] <username> | --all [--yes]",
 			Run:         cmdRemove,
 		},
+		"disable": {
+			Name:        "disable",
+			Description: "Suspend face authentication for a user, keeping the enrollment",
+			Usage:       "facepass disable <username>",
+			Run:         cmdDisable,
+		},
+		"enable": {
+			Name:        "enable",
+			Description: "Resume face authentication for a disabled user",
+			Usage:       "facepass enable <username>",
+			Run:         cmdEnable,
+		},
+		"set-tolerance": {
+			Name:        "set-tolerance",
+			Description: "Override the match tolerance for a user",
+			Usage:       "facepass set-tolerance <username> <value|default>",
+			Run:         cmdSetTolerance,
+		},
 		"list": {
 			Name:        "list",
 			Description: "List all enrolled users",
-			Usage:       "facepass list",
+			Usage:       "facepass list [--summary]",
 			Run:         cmdList,
 		},
+		"stats": {
+			Name:        "stats",
+			Description: "Show per-embedding quality of enrollments",
+			Usage:       "facepass stats [username]",
+			Run:         cmdStats,
+		},
+		"verify-enrollment": {
+			Name:        "verify-enrollment",
+			Description: "Check that a user's embeddings show a single person",
+			Usage:       "facepass verify-enrollment <username> [--distance D] [--prune [--yes]]",
+			Run:         cmdVerifyEnrollment,
+		},
+		"test-spoof": {
+			Name:        "test-spoof",
+			Description: "Check that liveness detection rejects a photo of a user",
+			Usage:       "facepass test-spoof <username>",
+			Run:         cmdTestSpoof,
+		},
 		"cameras": {
 			Name:        "cameras",
 			Description: "List available cameras",
-			Usage:       "facepass cameras",
+			Usage:       "facepass cameras [--verbose]",
 			Run:         cmdCameras,
 		},
 		"config": {
 			Name:        "config",
-			Description: "Show current configuration",
-			Usage:       "facepass config",
+			Description: "Show current configuration or create a config file",
+			Usage:       "facepass config [--yaml | --json] | facepass config init [--force] [path]",
 			Run:         cmdConfig,
 		},
+		"rekey": {
+			Name:        "rekey",
+			Description: "Re-encrypt stored face data with a new key",
+			Usage:       "facepass rekey (-old-key <hex> | -old-key-file <file> | -old-machine-id <id|file> [-old-hostname <name>]) [-new-key <hex> | -new-key-file <file>]",
+			Run:         cmdRekey,
+		},
+		"key": {
+			Name:        "key",
+			Description: "Export the encryption key for safekeeping",
+			Usage:       "facepass key export [-out <file>]",
+			Run:         cmdKey,
+		},
+		"storage": {
+			Name:        "storage",
+			Description: "Maintain the face data directory",
+			Usage:       "facepass storage repair",
+			Run:         cmdStorage,
+		},
+		"migrate": {
+			Name:        "migrate",
+			Description: "Upgrade stored face data to the current format",
+			Usage:       "facepass migrate",
+			Run:         cmdMigrate,
+		},
+		"backup": {
+			Name:        "backup",
+			Description: "Archive all face data for migration or recovery",
+			Usage:       "facepass backup [--force] <archive>",
+			Run:         cmdBackup,
+		},
+		"restore": {
+			Name:        "restore",
+			Description: "Restore face data from a backup archive",
+			Usage:       "facepass restore [--force] <archive>",
+			Run:         cmdRestore,
+		},
+		"capture": {
+			Name:        "capture",
+			Description: "Capture frames to disk without recognition (camera debugging)",
+			Usage:       "facepass capture [--out frame.jpg] [--count N] [--device /dev/videoX]",
+			Run:         cmdCapture,
+		},
+		"bench": {
+			Name:        "bench",
+			Description: "Benchmark face detection and recognition speed",
+			Usage:       "facepass bench [--backend dlib|cpu|rocm|cuda|openvino] [--detector hog|cnn] [--iterations N] [--image file] [--no-warmup]",
+			Run:         cmdBench,
+		},
+		"accel": {
+			Name:        "accel",
+			Description: "Show detected GPU/NPU acceleration backends",
+			Usage:       "facepass accel",
+			Run:         cmdAccel,
+		},
+		"watch": {
+			Name:           "watch",
+			Description:    "Run a command whenever a user appears in front of the camera",
+			Usage:          "facepass watch --user <username> [--on-match <command>] [--debounce 30s] [--interval 1s]",
+			Run:            cmdWatch,
+			HandlesSignals: true,
+		},
+		"serve": {
+			Name:           "serve",
+			Description:    "Serve the local API for enrollment and authentication",
+			Usage:          "facepass serve [--socket path]",
+			Run:            cmdServe,
+			HandlesSignals: true,
+		},
+		"where": {
+			Name:        "where",
+			Description: "Show the config, data, model and log paths in use",
+			Usage:       "facepass where",
+			Run:         cmdWhere,
+		},
 		"version": {
 			Name:        "version",
 			Description: "Show version information",
-			Usage:       "facepass version",
+			Usage:       "facepass version [--json]",
 			Run:         cmdVersion,
 		},
 		"download-models": {
@@ -105,6 +236,12 @@ func init() {
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run executes the CLI and returns the exit code. Deferred calls run before
+// main exits.
+func run() int {
 	// Parse global flags
 	configFile := flag.String("config", "", "Path to configuration file")
 	debug := flag.Bool("debug", false, "Enable debug logging")
@@ -116,8 +253,13 @@ func main() {
 	// Load configuration
 	var err error
 	if *configFile != "" {
+		configFiles = []string{*configFile}
 		cfg, err = config.Load(*configFile)
 	} else {
+		configFiles = []string{config.SystemConfigPath}
+		if userConfig, err := config.UserConfigPath(); err == nil {
+			configFiles = append(configFiles, userConfig)
+		}
 		cfg, err = config.LoadDefault()
 	}
 	if err != nil {
@@ -125,6 +267,12 @@ func main() {
 		cfg = config.DefaultConfig()
 	}
 
+	// Apply FACEPASS_<SECTION>_<FIELD> environment overrides
+	if err := cfg.ApplyEnvOverrides(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
 	// Expand paths in config
 	cfg.ExpandPaths()
 
@@ -133,17 +281,38 @@ func main() {
 	if *debug {
 		logLevel = "debug"
 	}
-	if err := logging.Init(logLevel, cfg.Logging.File); err != nil {
+	if err := logging.Initialize(logging.Options{
+		Level:  logLevel,
+		Format: cfg.Logging.Format,
+		Output: cfg.Logging.Output,
+		File:   cfg.Logging.File,
+		Rotation: logging.Rotation{
+			MaxSizeMB:  cfg.Logging.MaxSizeMB,
+			MaxBackups: cfg.Logging.MaxBackups,
+			MaxAgeDays: cfg.Logging.MaxAgeDays,
+		},
+	}); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Could not initialize file logging: %v\n", err)
 	}
+	defer func() { _ = logging.Close() }()
 
 	logging.Debugf("FacePass v%s starting", version)
-	logging.Debugf("Config loaded, storage dir: %s", cfg.Storage.DataDir)
+
+	// A data directory under root's home is almost never intended: it is
+	// what 'sudo facepass enroll' uses with the default config, while the
+	// user (and PAM run from their session) read their own home directory
+	dataDir, inHome := cfg.ResolveDataDir()
+	cfg.Storage.DataDir = dataDir
+	logging.Infof("Using data directory %s (euid %d)", dataDir, os.Geteuid())
+	if inHome && os.Geteuid() == 0 {
+		logging.Warnf("Data directory %s is inside root's home directory; enrollments made without sudo are not visible here. Set storage.data_dir in %s to share one directory",
+			dataDir, config.SystemConfigPath)
+	}
 
 	// Show usage if no command provided
 	if len(args) < 1 {
 		printUsage()
-		os.Exit(0)
+		return 0
 	}
 
 	// Find and run command
@@ -152,15 +321,32 @@ func main() {
 	if !ok {
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", cmdName)
 		printUsage()
-		os.Exit(1)
+		return 1
+	}
+
+	// Reject invalid settings, except for the commands used to inspect or fix them
+	if cmdName != "config" && cmdName != "help" && cmdName != "version" {
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid configuration: %v\n", err)
+			return 1
+		}
+	}
+	for _, warning := range cfg.Warnings() {
+		logging.Warnf("Configuration: %s", warning)
+	}
+
+	if !cmd.HandlesSignals {
+		stop := handleInterrupts()
+		defer stop()
 	}
 
 	// Run the command
 	if err := cmd.Run(args[1:]); err != nil {
 		logging.WithError(err).Errorf("Command '%s' failed", cmdName)
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
 
 func printUsage() {
@@ -171,9 +357,9 @@ func printUsage() {
 	fmt.Println("  -config <file>   Path to configuration file")
 	fmt.Println("  -debug           Enable debug logging")
 	fmt.Println("\nCommands:")
-	for _, name := range []string{"enroll", "add-face", "test", "remove", "list", "cameras", "config", "download-models", "version", "help"} {
+	for _, name := range []string{"enroll", "add-face", "test", "test-spoof", "remove", "disable", "enable", "set-tolerance", "list", "stats", "verify-enrollment", "cameras", "capture", "config", "rekey", "key", "migrate", "storage", "backup", "restore", "download-models", "bench", "accel", "watch", "serve", "where", "version", "help"} {
 		cmd := commands[name]
-		fmt.Printf("  %-12s %s\n", cmd.Name, cmd.Description)
+		fmt.Printf("  %-18s %s\n", cmd.Name, cmd.Description)
 	}
 	fmt.Println("\nExamples:")
 	fmt.Println("  facepass enroll john       # Enroll user 'john'")
@@ -182,22 +368,58 @@ func printUsage() {
 	fmt.Println("\nRun 'facepass help <command>' for more information on a command.")
 }
 
-// initRecognizer initializes the face recognizer.
-func initRecognizer() error {
+// initRecognizer initializes the face recognizer. Enrollment uses jittered
+// descriptors if configured; they are slower but more robust.
+func initRecognizer(forEnrollment bool) error {
 	if recognizer != nil && recognizer.IsLoaded() {
 		return nil
 	}
 
-	recognizer = recognition.NewRecognizer()
-	recognizer.SetTolerance(cfg.Recognition.Tolerance)
+	jitter := 0
+	if forEnrollment {
+		jitter = cfg.Recognition.Jitter
+	}
 
-	if err := recognizer.LoadModels(cfg.Recognition.ModelPath); err != nil {
-		return fmt.Errorf("failed to load face recognition models: %w\n\nPlease ensure dlib models are installed in: %s\n\nRequired files:\n  - shape_predictor_5_face_landmarks.dat\n  - dlib_face_recognition_resnet_model_v1.dat\n\nDownload from: http://dlib.net/files/", err, cfg.Recognition.ModelPath)
+	var err error
+	recognizer, err = recognition.NewEngine(recognition.Options{
+		Backend:    cfg.Recognition.Backend,
+		ModelPaths: cfg.Recognition.ModelPath,
+		ModelNames: modelNames(),
+		ONNX: acceleration.ONNXConfig{
+			Backend:         acceleration.Backend(cfg.Acceleration.Backend),
+			ModelPath:       cfg.Acceleration.ONNXModelPath,
+			DeviceIndex:     cfg.Acceleration.DeviceIndex,
+			EnableProfiling: cfg.Acceleration.EnableProfiling,
+		},
+		FallbackToDlib: cfg.Acceleration.FallbackToCPU,
+		Tolerance:      cfg.Recognition.Tolerance,
+		MinQuality:     cfg.Recognition.MinEmbeddingQuality,
+		Normalize:      cfg.Recognition.NormalizeEmbeddings,
+		MinFaceSize:    cfg.Recognition.MinFacePx,
+		Padding:        cfg.Recognition.Padding,
+		Jitter:         jitter,
+		Detector:       cfg.Recognition.Detector,
+		Preprocess:     cfg.Recognition.Preprocess,
+	})
+	if err != nil {
+		if cfg.Recognition.Backend == recognition.BackendONNX && !cfg.Acceleration.FallbackToCPU {
+			return fmt.Errorf("failed to load ONNX recognition models from %s: %w", cfg.Acceleration.ONNXModelPath, err)
+		}
+		return fmt.Errorf("failed to load face recognition models: %w\n\nPlease ensure dlib models are installed in one of: %s\n\nRequired files:\n  - %s\n\nRun 'facepass download-models' or download from: http://dlib.net/files/",
+			err, strings.Join(cfg.Recognition.ModelPath, ", "), strings.Join(modelNames().Files(), "\n  - "))
 	}
 
 	return nil
 }
 
+// modelNames returns the configured dlib model file names.
+func modelNames() recognition.ModelNames {
+	return recognition.ModelNames{
+		ShapePredictor: cfg.Recognition.LandmarkModel,
+		Recognition:    cfg.Recognition.RecognitionModel,
+	}
+}
+
 // initStorage initializes the storage system.
 func initStorage() error {
 	if store != nil {
@@ -205,7 +427,7 @@ func initStorage() error {
 	}
 
 	var err error
-	store, err = storage.NewFileStorage(cfg.Storage.DataDir, cfg.Storage.EncryptionEnabled)
+	store, err = storage.NewBackend(storageOptions())
 	if err != nil {
 		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
@@ -213,6 +435,19 @@ func initStorage() error {
 	return nil
 }
 
+// storageOptions returns the storage options from the configuration.
+func storageOptions() storage.Options {
+	return storage.Options{
+		Backend:           cfg.Storage.Backend,
+		DataDir:           cfg.Storage.DataDir,
+		EncryptionEnabled: cfg.Storage.EncryptionEnabled,
+		KeySource:         storage.KeySource(cfg.Storage.KeySource),
+		KeyFile:           cfg.Storage.KeyFile,
+		Compress:          cfg.Storage.Compress,
+		LastUsedInterval:  time.Duration(cfg.Storage.LastUsedInterval) * time.Second,
+	}
+}
+
 // waitForEnter waits for user to press Enter.
 func waitForEnter(prompt string) {
 	fmt.Print(prompt)
@@ -220,13 +455,41 @@ func waitForEnter(prompt string) {
 	_, _ = reader.ReadString('\n')
 }
 
+// confirm asks a yes/no question and reports whether the answer was yes.
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N]: ", prompt)
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
+
 // Command implementations
 
 func cmdEnroll(args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf("username required\nUsage: facepass enroll <username>")
+		return fmt.Errorf("username required\nUsage: %s", commands["enroll"].Usage)
 	}
 	username := args[0]
+	if err := storage.ValidateUsername(username); err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("enroll", flag.ContinueOnError)
+	angleSpec := flags.String("angles", "", "Comma-separated angles to capture, or a number of angles (default: "+strings.Join(enrollmentAngles, ",")+")")
+	auto := flags.Bool("auto", false, "Count down and capture automatically once the face holds still, instead of waiting for Enter")
+	verbose := flags.Bool("verbose", false, "Print the distances between the captured angles before saving and offer to recapture some")
+	strict := flags.Bool("strict", false, "Abort the enrollment if more than one face is ever in frame, instead of skipping the angle")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	angles := enrollmentAngles
+	if *angleSpec != "" {
+		var err error
+		if angles, err = parseAngles(*angleSpec); err != nil {
+			return err
+		}
+	}
 
 	logging.Infof("Starting enrollment for user: %s", username)
 
@@ -246,7 +509,7 @@ func cmdEnroll(args []string) error {
 	}
 
 	// Initialize recognizer
-	if err := initRecognizer(); err != nil {
+	if err := initRecognizer(true); err != nil {
 		return err
 	}
 	defer func() { _ = recognizer.Close() }()
@@ -254,20 +517,16 @@ func cmdEnroll(args []string) error {
 	// Initialize camera
 	cam := camera.NewCamera()
 	_ = cam.SetResolution(cfg.Camera.Width, cfg.Camera.Height)
+	_ = cam.SetPixelFormat(cfg.Camera.PixelFormat)
+	_ = cam.SetJPEGQuality(cfg.Camera.JPEGQuality)
 
-	// Select camera device
-	device := cfg.Camera.Device
-	if cfg.Camera.PreferIR {
-		// Try IR camera first
-		if _, err := os.Stat(cfg.Camera.IRDevice); err == nil {
-			device = cfg.Camera.IRDevice
-		}
-	}
+	device := captureDevice(cfg)
 
 	if err := cam.Open(device); err != nil {
-		return fmt.Errorf("failed to open camera %s: %w", device, err)
+		return cameraOpenError(device, err)
 	}
 	defer func() { _ = cam.Close() }()
+	trackCamera(cam)
 
 	// Enable IR emitter if available
 	if cam.HasIREmitter() && cfg.Camera.IREmitterEnabled {
@@ -283,58 +542,102 @@ func cmdEnroll(args []string) error {
 
 	fmt.Printf("\nStarting enrollment for '%s'...\n", username)
 	fmt.Println("Please ensure good lighting and face the camera.")
-	fmt.Println("You will be prompted to capture 5 different angles.")
+	fmt.Printf("You will be prompted to capture %d different angles.\n", len(angles))
 
-	embeddings := make([]recognition.Embedding, 0, len(enrollmentAngles))
+	// captureAngle prompts for and captures one angle. It returns nil if the
+	// capture failed and the angle should be skipped, and an error if the
+	// whole enrollment must be aborted.
+	captureAngle := func(step string, angle string) (*recognition.Embedding, error) {
+		fmt.Printf("[%s] %s\n", step, getAnglePrompt(angle))
 
-	for i, angle := range enrollmentAngles {
-		prompt := getAnglePrompt(angle)
-		fmt.Printf("[%d/%d] %s\n", i+1, len(enrollmentAngles), prompt)
-		waitForEnter("      Press Enter when ready...")
-
-		// Capture frame (uses ReadFrame which handles streaming)
-		fmt.Print("      Capturing... ")
-
-		// We capture a few frames to ensure we get a good one, but for enrollment
-		// we just take the first valid one for now.
-		// In the future we could average them.
-		var frame *camera.Frame
+		var embedding *recognition.Embedding
 		var err error
-
-		// Try to read up to 5 frames to clear buffer/get fresh frame
-		for k := 0; k < 5; k++ {
-			frame, err = cam.ReadFrame()
-			if err == nil {
-				break
+		if *auto {
+			fmt.Print("      ")
+			countdown(autoCaptureCountdown)
+			fmt.Print("Hold still... ")
+			var face *recognition.Face
+			if _, face, err = autoCaptureFace(cam, *strict); err == nil {
+				e := recognizer.GetEmbedding(face, angle)
+				embedding = &e
+			}
+		} else {
+			waitForEnter("      Press Enter when ready...")
+
+			// Capture frame (uses ReadFrame which handles streaming)
+			fmt.Print("      Capturing... ")
+
+			// Discard stale/unsettled frames, then take the first valid one.
+			// In the future we could average them.
+			frame, captureErr := captureSettledFrame(cam)
+			if captureErr != nil {
+				fmt.Printf("FAILED: %v\n", captureErr)
+				fmt.Println("      Skipping this angle, continuing...")
+				return nil, nil
 			}
-		}
 
-		if err != nil {
-			fmt.Printf("FAILED: %v\n", err)
-			fmt.Println("      Skipping this angle, continuing...")
-			continue
+			// Detect and recognize face
+			embedding, err = recognizeEnrollmentFace(frame, angle)
+		}
+		if *strict && errors.Is(err, recognition.ErrMultipleFaces) {
+			fmt.Println("FAILED")
+			return nil, errors.New("enrollment aborted: someone other than the user was in frame (--strict); nothing was saved")
 		}
-
-		// Detect and recognize face
-		embedding, err := recognizer.RecognizeFace(frame.Data, angle)
 		if err != nil {
 			fmt.Printf("FAILED: %v\n", err)
-			switch err {
-			case recognition.ErrNoFaceDetected:
+			switch {
+			case errors.Is(err, camera.ErrOverexposed):
+				fmt.Println("      Too much light. Move away from the window or bright light.")
+			case errors.Is(err, recognition.ErrNoFaceDetected):
 				fmt.Println("      No face detected. Please ensure your face is visible.")
-			case recognition.ErrMultipleFaces:
+			case errors.Is(err, recognition.ErrMultipleFaces):
 				fmt.Println("      Multiple faces detected. Please ensure only you are in frame.")
+			case errors.Is(err, recognition.ErrFaceTooSmall):
+				fmt.Println("      Face too small. Please move closer to the camera.")
+			case errors.Is(err, recognition.ErrFaceAtEdge):
+				fmt.Println("      Face at edge of frame. Please center your face.")
 			}
 			fmt.Println("      Skipping this angle, continuing...")
-			continue
+			return nil, nil
 		}
 
-		embeddings = append(embeddings, *embedding)
+		embedding.MarkCaptured(camera.RedactDevice(device))
 		fmt.Println("OK")
+		return embedding, nil
+	}
+
+	embeddings := make([]recognition.Embedding, 0, len(angles))
+	for i, angle := range angles {
+		embedding, err := captureAngle(fmt.Sprintf("%d/%d", i+1, len(angles)), angle)
+		if err != nil {
+			return err
+		}
+		if embedding != nil {
+			embeddings = append(embeddings, *embedding)
+		}
+	}
+
+	// With --verbose, show how the angles relate so identical or outlying
+	// captures can be redone before anything is saved
+	for *verbose && len(embeddings) > 1 {
+		printDistanceMatrix(embeddings, cfg.Recognition.Tolerance)
+		redo := askRecapture(len(embeddings))
+		if len(redo) == 0 {
+			break
+		}
+		for _, k := range redo {
+			embedding, err := captureAngle(fmt.Sprintf("redo %d", k+1), embeddings[k].Angle)
+			if err != nil {
+				return err
+			}
+			if embedding != nil {
+				embeddings[k] = *embedding
+			}
+		}
 	}
 
-	if len(embeddings) < 3 {
-		return fmt.Errorf("enrollment failed: only %d angles captured (minimum 3 required)", len(embeddings))
+	if len(embeddings) < minEnrollmentAngles {
+		return fmt.Errorf("enrollment failed: only %d angles captured (minimum %d required)", len(embeddings), minEnrollmentAngles)
 	}
 
 	// Save user data
@@ -357,10 +660,19 @@ func cmdEnroll(args []string) error {
 
 func cmdAddFace(args []string) error {
 	if len(args) < 1 {
-		return fmt.Errorf("username required\nUsage: facepass add-face <username>")
+		return fmt.Errorf("username required\nUsage: %s", commands["add-face"].Usage)
 	}
 	username := args[0]
 
+	flags := flag.NewFlagSet("add-face", flag.ContinueOnError)
+	profile := flags.String("profile", storage.DefaultProfile, "Enrollment profile to add the face to, e.g. glasses")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := storage.ValidateProfile(*profile); err != nil {
+		return err
+	}
+
 	// Initialize storage
 	if err := initStorage(); err != nil {
 		return err
@@ -372,7 +684,7 @@ func cmdAddFace(args []string) error {
 	}
 
 	// Initialize recognizer
-	if err := initRecognizer(); err != nil {
+	if err := initRecognizer(true); err != nil {
 		return err
 	}
 	defer func() { _ = recognizer.Close() }()
@@ -380,18 +692,16 @@ func cmdAddFace(args []string) error {
 	// Initialize camera
 	cam := camera.NewCamera()
 	_ = cam.SetResolution(cfg.Camera.Width, cfg.Camera.Height)
+	_ = cam.SetPixelFormat(cfg.Camera.PixelFormat)
+	_ = cam.SetJPEGQuality(cfg.Camera.JPEGQuality)
 
-	device := cfg.Camera.Device
-	if cfg.Camera.PreferIR {
-		if _, err := os.Stat(cfg.Camera.IRDevice); err == nil {
-			device = cfg.Camera.IRDevice
-		}
-	}
+	device := captureDevice(cfg)
 
 	if err := cam.Open(device); err != nil {
-		return fmt.Errorf("failed to open camera: %w", err)
+		return cameraOpenError(device, err)
 	}
 	defer func() { _ = cam.Close() }()
+	trackCamera(cam)
 
 	if cam.HasIREmitter() && cfg.Camera.IREmitterEnabled {
 		_ = cam.EnableIREmitter()
@@ -404,66 +714,185 @@ func cmdAddFace(args []string) error {
 	}
 	defer func() { _ = cam.StopStreaming() }()
 
-	fmt.Printf("\nAdding face angles for '%s'...\n", username)
+	fmt.Printf("\nAdding face angles for '%s' (profile: %s)...\n", username, *profile)
 	fmt.Println("Position yourself and press Enter when ready.")
 
 	waitForEnter("Press Enter to capture... ")
 
 	fmt.Print("Capturing... ")
 
-	// Read a few frames to clear buffer
+	frame, err := captureSettledFrame(cam)
+	if err != nil {
+		return fmt.Errorf("capture failed: %w", err)
+	}
+
+	embedding, err := recognizeEnrollmentFace(frame, "additional")
+	if err != nil {
+		return fmt.Errorf("face recognition failed: %w", err)
+	}
+	embedding.MarkCaptured(camera.RedactDevice(device))
+
+	if err := store.AddEmbeddingToProfile(username, *profile, *embedding, 0); err != nil {
+		if errors.Is(err, storage.ErrDuplicateEmbedding) {
+			fmt.Println("SKIPPED")
+			fmt.Printf("This capture is already enrolled for '%s'; nothing was added.\n", username)
+			return nil
+		}
+		return fmt.Errorf("failed to save embedding: %w", err)
+	}
+
+	fmt.Println("OK")
+	fmt.Printf("Additional face angle added for '%s'.\n", username)
+
+	return nil
+}
+
+// captureSettledFrame discards camera.warmup_frames frames so exposure and
+// the IR emitter can settle and buffered frames from before the prompt are
+// dropped, then returns the first frame that reads successfully.
+func captureSettledFrame(cam *camera.V4L2Camera) (*camera.Frame, error) {
+	for k := 0; k < cfg.Camera.WarmupFrames; k++ {
+		if _, err := cam.ReadFrame(); errors.Is(err, camera.ErrCameraBusy) {
+			return nil, cameraBusyError(err)
+		} else if err != nil {
+			logging.Debugf("Warm-up frame %d failed: %v", k+1, err)
+		}
+	}
+
 	var frame *camera.Frame
 	var err error
 	for k := 0; k < 5; k++ {
 		frame, err = cam.ReadFrame()
 		if err == nil {
-			break
+			return frame, nil
+		}
+		if errors.Is(err, camera.ErrCameraBusy) {
+			return nil, cameraBusyError(err)
 		}
 	}
+	return nil, err
+}
 
+// recognizeEnrollmentFace detects a single, fully visible face in the frame
+// and returns its embedding.
+func recognizeEnrollmentFace(frame *camera.Frame, angle string) (*recognition.Embedding, error) {
+	face, err := detectFrameFace(frame)
 	if err != nil {
-		return fmt.Errorf("capture failed: %w", err)
+		return nil, err
 	}
 
-	embedding, err := recognizer.RecognizeFace(frame.Data, "additional")
-	if err != nil {
-		return fmt.Errorf("face recognition failed: %w", err)
+	if err := recognition.CheckFaceInFrame(face, frame.Width, frame.Height, cfg.Recognition.EdgeMargin); err != nil {
+		return nil, err
 	}
 
-	if err := store.AddEmbedding(username, *embedding); err != nil {
-		return fmt.Errorf("failed to save embedding: %w", err)
+	embedding := recognizer.GetEmbedding(face, angle)
+	return &embedding, nil
+}
+
+// detectFrameFace detects a single face in the frame. When no face is found
+// in an overexposed frame, the error also wraps camera.ErrOverexposed.
+func detectFrameFace(frame *camera.Frame) (*recognition.Face, error) {
+	face, err := detectSingleFace(frame)
+	if errors.Is(err, recognition.ErrNoFaceDetected) {
+		if exposureErr := frame.CheckExposure(cfg.Camera.MaxSaturation); errors.Is(exposureErr, camera.ErrOverexposed) {
+			return nil, fmt.Errorf("%w: %w", err, exposureErr)
+		}
 	}
+	return face, err
+}
 
-	fmt.Println("OK")
-	fmt.Printf("Additional face angle added for '%s'.\n", username)
+// detectSingleFace detects a single face in the frame. Raw GREY/Y16/RGB
+// frames are decoded once and passed to the engine as pixels instead of
+// being re-encoded to JPEG.
+func detectSingleFace(frame *camera.Frame) (*recognition.Face, error) {
+	if frame.Format == camera.FormatJPEG || frame.Format == "" {
+		return recognizer.DetectSingleFace(frame.Data)
+	}
 
-	return nil
+	img, err := frame.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	faces, err := recognizer.DetectFacesImage(img)
+	if err != nil {
+		return nil, err
+	}
+	switch len(faces) {
+	case 0:
+		return nil, recognition.ErrNoFaceDetected
+	case 1:
+		return &faces[0], nil
+	default:
+		return nil, recognition.ErrMultipleFaces
+	}
 }
 
 func cmdTest(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("username required\nUsage: facepass test <username>")
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	noLiveness := flags.Bool("no-liveness", false, "Skip the liveness check and only report the match")
+	challenge := flags.Bool("challenge", false, "Also run a random challenge-response check")
+	impostorScan := flags.String("impostor-scan", "", "Directory of labeled face images to evaluate tolerances with")
+	workers := flags.Int("workers", cfg.Recognition.Workers, "Frames analyzed in parallel (0 = min(CPUs, 4))")
+	fpsCap := flags.Int("fps-cap", cfg.Recognition.MaxProcessFPS, "Frames handed to the workers per second (0 = unlimited)")
+	pprofAddr := flags.String("pprof", os.Getenv(pprofEnv), "Serve net/http/pprof on this address, e.g. 127.0.0.1:6060")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// Allow flags after the username as well
+	username := flags.Arg(0)
+	if username != "" {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case *impostorScan != "" && username != "":
+		return fmt.Errorf("--impostor-scan compares against all users and does not take a username\nUsage: %s", commands["test"].Usage)
+	case *impostorScan != "":
+		return runImpostorScan(*impostorScan)
+	case username == "":
+		return fmt.Errorf("username required\nUsage: %s", commands["test"].Usage)
+	case flags.NArg() > 0:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	case *challenge && *noLiveness:
+		return fmt.Errorf("--challenge is a liveness check and cannot be combined with --no-liveness")
+	case *workers < 0 || *fpsCap < 0:
+		return fmt.Errorf("--workers and --fps-cap must not be negative")
+	}
+	pipeline := testPipeline{workers: testWorkers(*workers), maxFPS: *fpsCap}
+
+	if *pprofAddr != "" {
+		stop, err := startPprof(*pprofAddr)
+		if err != nil {
+			return err
+		}
+		defer stop()
 	}
-	username := args[0]
 
 	// Initialize storage
 	if err := initStorage(); err != nil {
 		return err
 	}
 
+	fmt.Printf("Data directory: %s\n", cfg.Storage.DataDir)
+
 	// Check if user is enrolled
 	if !store.UserExists(username) {
-		return fmt.Errorf("user '%s' is not enrolled. Use 'facepass enroll %s' first", username, username)
+		return fmt.Errorf("user '%s' is not enrolled in %s. Use 'facepass enroll %s' first (run 'facepass where' to check the paths in use)", username, cfg.Storage.DataDir, username)
 	}
 
 	// Load user embeddings
-	storedEmbeddings, err := store.GetAllEmbeddings(username)
+	userData, err := store.LoadUser(username)
 	if err != nil {
 		return fmt.Errorf("failed to load user data: %w", err)
 	}
+	if err := recognition.ValidateEmbeddings(userData.Embeddings); err != nil {
+		return fmt.Errorf("enrollment of '%s' cannot be used: %w", username, err)
+	}
 
 	// Initialize recognizer
-	if err := initRecognizer(); err != nil {
+	if err := initRecognizer(false); err != nil {
 		return err
 	}
 	defer func() { _ = recognizer.Close() }()
@@ -471,18 +900,16 @@ func cmdTest(args []string) error {
 	// Initialize camera
 	cam := camera.NewCamera()
 	_ = cam.SetResolution(cfg.Camera.Width, cfg.Camera.Height)
+	_ = cam.SetPixelFormat(cfg.Camera.PixelFormat)
+	_ = cam.SetJPEGQuality(cfg.Camera.JPEGQuality)
 
-	device := cfg.Camera.Device
-	if cfg.Camera.PreferIR {
-		if _, err := os.Stat(cfg.Camera.IRDevice); err == nil {
-			device = cfg.Camera.IRDevice
-		}
-	}
+	device := captureDevice(cfg)
 
 	if err := cam.Open(device); err != nil {
-		return fmt.Errorf("failed to open camera: %w", err)
+		return cameraOpenError(device, err)
 	}
 	defer func() { _ = cam.Close() }()
+	trackCamera(cam)
 
 	if cam.HasIREmitter() && cfg.Camera.IREmitterEnabled {
 		_ = cam.EnableIREmitter()
@@ -490,6 +917,9 @@ func cmdTest(args []string) error {
 	}
 
 	fmt.Printf("\nTesting face recognition for '%s'...\n", username)
+	if *noLiveness {
+		fmt.Println("Liveness check disabled (--no-liveness): only recognition is tested.")
+	}
 	fmt.Println("Look at the camera and press Enter.")
 
 	waitForEnter("Press Enter when ready... ")
@@ -502,26 +932,159 @@ func cmdTest(args []string) error {
 	}
 	defer func() { _ = cam.StopStreaming() }()
 
-	// Initialize liveness detector
-	livenessCfg := liveness.DefaultConfig()
-	livenessCfg.Level = liveness.LevelStandard
-	// Map thresholds from config
-	livenessCfg.MovementThreshold = cfg.Liveness.Thresholds.Movement
-	livenessCfg.DepthThreshold = cfg.Liveness.Thresholds.Depth
-	livenessCfg.ConsistencyThreshold = cfg.Liveness.Thresholds.Consistency
-	detector := liveness.NewDetector(livenessCfg)
+	// Initialize liveness detector with the same level and thresholds as PAM
+	// authentication
+	detector := liveness.NewDetectorFromConfig(cfg)
+
+	frames, embeddings := captureTestWindow(cam, pipeline)
+
+	// The challenge compares this window with a second one captured after
+	// the user performed the requested action
+	var challengeTest *liveness.Challenge
+	challengePassed := false
+	if *challenge && len(embeddings) > 0 {
+		c := liveness.RandomChallenge()
+		challengeTest = &c
+		fmt.Printf("\nChallenge: %s, and keep it up until the capture is done. Capturing in ", c.Instruction())
+		countdown(challengeCountdown)
+		fmt.Println()
+		afterFrames, _ := captureTestWindow(cam, pipeline)
+		challengePassed = detector.PerformChallenge(c, frames, afterFrames)
+	}
+	_ = cam.StopStreaming() // Stop streaming immediately to save resources
+
+	if len(embeddings) == 0 {
+		fmt.Println("FAILED: No face detected in any frame")
+		return nil
+	}
+
+	// Liveness Check
+	var livenessResult liveness.Result
+	if !*noLiveness {
+		livenessResult = detector.Detect(frames)
+	}
+
+	// Authentication fails when someone else appears mid-capture; here the
+	// frames are only left out so the rest can still be checked
+	if changed := recognition.IdentityChanges(embeddings, cfg.Recognition.IdentityDistance); len(changed) > 0 {
+		fmt.Printf("Warning: %d of %d frames show a different face than the first one; ignoring them\n", len(changed), len(embeddings))
+		kept := embeddings[:0:0]
+		for i, emb := range embeddings {
+			if len(changed) > 0 && changed[0] == i {
+				changed = changed[1:]
+				continue
+			}
+			kept = append(kept, emb)
+		}
+		embeddings = kept
+	}
+
+	// Recognition (use average embedding, without outlier frames)
+	if kept := recognition.RejectOutliers(embeddings, cfg.Recognition.OutlierDistance); len(kept) < len(embeddings) {
+		fmt.Printf("Ignoring %d of %d frames whose embedding is far from the others\n", len(embeddings)-len(kept), len(embeddings))
+		embeddings = kept
+	}
+	avgEmbedding := recognition.AverageEmbedding(embeddings)
+	if cfg.Recognition.NormalizeEmbeddings {
+		avgEmbedding = recognition.AverageNormalizedEmbedding(embeddings)
+	}
+	idx, distance, _ := recognizer.FindBestMatch(avgEmbedding, userData.Embeddings)
+	tolerance := userData.MatchTolerance(cfg.Recognition.Tolerance)
+	matched := distance < tolerance
+
+	fmt.Println("Done")
+	fmt.Println()
+
+	// Calculate confidence (inverse of distance, normalized)
+	confidence := 1.0 - (distance / 1.0)
+	if confidence < 0 {
+		confidence = 0
+	}
+	if confidence > 1 {
+		confidence = 1
+	}
+
+	fmt.Println("Results:")
+	fmt.Printf("  Distance:   %.4f\n", distance)
+	fmt.Printf("  Confidence: %.1f%%\n", confidence*100)
+	if matched {
+		fmt.Printf("  Profile:    %s\n", userData.ProfileAt(idx))
+	}
+	if userData.Tolerance != nil {
+		fmt.Printf("  Threshold:  %.2f (set for %s)\n", tolerance, username)
+	} else {
+		fmt.Printf("  Threshold:  %.2f\n", tolerance)
+	}
+	if *noLiveness {
+		fmt.Println("  Liveness:   SKIPPED (--no-liveness)")
+	} else {
+		fmt.Printf("  Liveness:   %v (Score: %.2f)\n", livenessResult.IsLive, livenessResult.Score)
+		if !livenessResult.IsLive {
+			fmt.Printf("  Liveness Reason: %s\n", livenessResult.Reason)
+		}
+	}
+	if challengeTest != nil {
+		status := "FAILED"
+		if challengePassed {
+			status = "PASSED"
+		}
+		fmt.Printf("  Challenge:  %s (%s)\n", status, challengeTest.Action)
+	}
+	fmt.Println()
+
+	if matched {
+		if *noLiveness {
+			fmt.Printf("MATCH: Face matches user '%s' (liveness NOT checked)\n", username)
+			logging.Infof("Face recognition test MATCHED for user: %s (distance: %.4f, liveness skipped)", username, distance)
+		} else if livenessResult.IsLive {
+			fmt.Printf("SUCCESS: Face matches user '%s' and liveness confirmed\n", username)
+			logging.Infof("Face recognition test PASSED for user: %s (distance: %.4f, liveness: %.2f)", username, distance, livenessResult.Score)
+		} else {
+			fmt.Printf("WARNING: Face matches user '%s' BUT liveness check failed\n", username)
+			logging.Warnf("Face recognition test MATCHED but LIVENESS FAILED for user: %s (distance: %.4f, reason: %s)", username, distance, livenessResult.Reason)
+		}
+	} else {
+		fmt.Printf("FAILED: Face does not match user '%s'\n", username)
+		logging.Warnf("Face recognition test FAILED for user: %s (distance: %.4f)", username, distance)
+	}
+
+	// Update last used timestamp
+	_ = store.UpdateLastUsed(username)
+
+	return nil
+}
+
+// maxDefaultTestWorkers caps the default worker count of the test pipeline.
+// Using every core makes laptops throttle, which slows capture down.
+const maxDefaultTestWorkers = 4
+
+// testPipeline limits the CPU use of the test capture pipeline.
+type testPipeline struct {
+	workers int // Frames analyzed in parallel
+	maxFPS  int // Frames handed to the workers per second (0 = unlimited)
+}
 
-	var frames []liveness.Frame
-	var embeddings []recognition.Embedding
+// testWorkers returns the worker count for the test pipeline: n if set,
+// otherwise min(NumCPU, maxDefaultTestWorkers).
+func testWorkers(n int) int {
+	if n > 0 {
+		return n
+	}
+	return min(runtime.NumCPU(), maxDefaultTestWorkers)
+}
 
+// captureTestWindow captures about one second of frames from the streaming
+// camera, prints the per-frame analysis and returns the frames for the
+// liveness checks and the embeddings of the frames with a face.
+func captureTestWindow(cam *camera.V4L2Camera, pipeline testPipeline) (frames []liveness.Frame, embeddings []recognition.Embedding) {
 	fmt.Println("\nFrame Analysis (Debug):")
 	fmt.Println("Frame | Face | EAR   | Blink? | Action")
 	fmt.Println("------+------+-------+--------+-------")
 
 	// Pipeline Architecture:
 	// 1. Capture Goroutine -> rawFramesChan
-	// 2. Worker Pool -> resultsChan
-	// 3. Main Thread -> Collects results
+	// 2. Main Thread -> batches of pipeline.workers frames -> DetectFacesBatch
+	// Capture continues while a batch is analyzed.
 
 	type captureJob struct {
 		index int
@@ -529,13 +1092,6 @@ func cmdTest(args []string) error {
 		err   error
 	}
 
-	type processedFrame struct {
-		index     int
-		liveFrame liveness.Frame
-		embedding *recognition.Embedding
-		logMsg    string
-	}
-
 	// Performance Tuning:
 	// We capture 30 frames (approx 1 second at 30fps) to ensure we catch blinks and movement.
 	// However, we only process every 3rd frame (10 frames total) to reduce CPU load.
@@ -547,12 +1103,18 @@ func cmdTest(args []string) error {
 	processCount := (captureCount + processInterval - 1) / processInterval
 
 	rawFramesChan := make(chan captureJob, processCount)
-	resultsChan := make(chan processedFrame, processCount)
 
-	// Start Capture Goroutine
+	// Start Capture Goroutine. With a rate cap, frames are handed to the
+	// workers no faster than maxFPS, which stretches the capture window.
 	startCapture := time.Now()
 	go func() {
 		defer close(rawFramesChan)
+		var pace <-chan time.Time
+		if pipeline.maxFPS > 0 {
+			ticker := time.NewTicker(time.Second / time.Duration(pipeline.maxFPS))
+			defer ticker.Stop()
+			pace = ticker.C
+		}
 		for i := 0; i < captureCount; i++ {
 			frameStart := time.Now()
 			camFrame, err := cam.ReadFrame()
@@ -565,177 +1127,190 @@ func cmdTest(args []string) error {
 
 			// Only process every Nth frame
 			if i%processInterval == 0 {
+				if pace != nil {
+					<-pace
+				}
 				rawFramesChan <- captureJob{index: i, frame: camFrame, err: err}
 			}
 		}
 	}()
 
-	// Start Worker Pool
-	numWorkers := runtime.NumCPU()
-	var wg sync.WaitGroup
-
-	for w := 0; w < numWorkers; w++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for job := range rawFramesChan {
-				if job.err != nil {
-					logging.Warnf("Failed to capture frame %d: %v", job.index, job.err)
-					continue
-				}
-
-				camFrame := job.frame
-				liveFrame := liveness.Frame{
-					Data:      camFrame.Data,
-					IsIR:      cam.GetDeviceInfo().IsIR,
-					Timestamp: camFrame.Timestamp,
-					FaceFound: false,
-				}
-
-				var emb *recognition.Embedding
-				var logMsg string
-
-				// Detect face
-				face, err := recognizer.DetectSingleFace(camFrame.Data)
-				if err == nil {
-					liveFrame.FaceFound = true
-					embVal := recognizer.GetEmbedding(face, "test")
-					emb = &embVal
-					liveFrame.Embedding = embVal // Copy embedding to frame
-
-					// Convert landmarks
-					var landmarks []liveness.Point
-					for _, p := range face.Landmarks {
-						landmarks = append(landmarks, liveness.Point{X: float64(p.X), Y: float64(p.Y)})
-					}
-					liveFrame.Landmarks = landmarks
-
-					// Calculate EAR
-					if len(landmarks) >= 5 {
-						leftEye := landmarks[0:2]
-						rightEye := landmarks[2:4]
-						leftEAR := liveness.CalculateEyeAspectRatio(leftEye)
-						rightEAR := liveness.CalculateEyeAspectRatio(rightEye)
-						liveFrame.EyeAspectRatio = (leftEAR + rightEAR) / 2.0
-					}
-					logMsg = fmt.Sprintf(" %4d | Yes  | %.3f |        |\n", job.index, liveFrame.EyeAspectRatio)
-				} else {
-					logMsg = fmt.Sprintf(" %4d | No   | ----- |        |\n", job.index)
-				}
-
-				resultsChan <- processedFrame{index: job.index, liveFrame: liveFrame, embedding: emb, logMsg: logMsg}
+	// Analyze the frames in batches as they arrive. A batch holds as many
+	// frames as there are workers, which bounds the parallel detections.
+	numWorkers := pipeline.workers
+	isIR := cam.GetDeviceInfo().IsIR
+	var indexes []int
+	var batch []*camera.Frame
+	var logLines []string
+	analyze := func() {
+		for i, detection := range detectFramesFaces(batch) {
+			liveFrame, logMsg := analyzeTestFrame(indexes[i], batch[i], isIR, detection)
+			frames = append(frames, liveFrame)
+			if liveFrame.FaceFound {
+				embeddings = append(embeddings, liveFrame.Embedding)
 			}
-		}()
+			logLines = append(logLines, logMsg)
+		}
+		indexes, batch = indexes[:0], batch[:0]
 	}
-
-	// Wait for workers in background to close results channel
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	// Collect results as they come in
-	processedResults := make([]processedFrame, 0, processCount)
-	for res := range resultsChan {
-		processedResults = append(processedResults, res)
+	for job := range rawFramesChan {
+		if job.err != nil {
+			logging.Warnf("Failed to capture frame %d: %v", job.index, job.err)
+			continue
+		}
+		indexes = append(indexes, job.index)
+		batch = append(batch, job.frame)
+		if len(batch) >= numWorkers {
+			analyze()
+		}
+	}
+	if len(batch) > 0 {
+		analyze()
 	}
 
 	captureDuration := time.Since(startCapture)
-	_ = cam.StopStreaming() // Stop streaming immediately to save resources
 
-	fmt.Printf("Captured %d frames, processed %d frames in %v.\n",
-		captureCount, len(processedResults), captureDuration)
+	fmt.Printf("Captured %d frames, processed %d frames in %v with %d worker(s).\n",
+		captureCount, len(frames), captureDuration, numWorkers)
+	for _, logMsg := range logLines {
+		fmt.Print(logMsg)
+	}
 
-	// Sort by index to maintain order
-	sort.Slice(processedResults, func(i, j int) bool {
-		return processedResults[i].index < processedResults[j].index
-	})
+	return frames, embeddings
+}
 
-	// Output results and build final lists
-	frames = make([]liveness.Frame, 0, len(processedResults))
-	for _, res := range processedResults {
-		frames = append(frames, res.liveFrame)
-		if res.embedding != nil {
-			embeddings = append(embeddings, *res.embedding)
-		}
-		fmt.Print(res.logMsg)
-	}
+// frameDetection is the single face found in a frame, or why none was.
+type frameDetection struct {
+	face *recognition.Face
+	err  error
+}
 
-	if len(embeddings) == 0 {
-		fmt.Println("FAILED: No face detected in any frame")
-		return nil
+// detectFramesFaces detects a single face in each frame like
+// detectFrameFace. JPEG frames are handed to the engine as one batch; raw
+// frames are decoded and detected in parallel alongside it.
+func detectFramesFaces(frames []*camera.Frame) []frameDetection {
+	detections := make([]frameDetection, len(frames))
+	var images [][]byte
+	var batched []int
+	var wg sync.WaitGroup
+	for i, frame := range frames {
+		if frame.Format == camera.FormatJPEG || frame.Format == "" {
+			images = append(images, frame.Data)
+			batched = append(batched, i)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, frame *camera.Frame) {
+			defer wg.Done()
+			face, err := detectFrameFace(frame)
+			detections[i] = frameDetection{face: face, err: err}
+		}(i, frame)
 	}
 
-	// Liveness Check
-	livenessResult := detector.Detect(frames)
-
-	// Recognition (use average embedding)
-	avgEmbedding := recognition.AverageEmbedding(embeddings)
-	_, distance, matched := recognizer.FindBestMatch(avgEmbedding, storedEmbeddings)
-
-	fmt.Println("Done")
-	fmt.Println()
-
-	// Calculate confidence (inverse of distance, normalized)
-	confidence := 1.0 - (distance / 1.0)
-	if confidence < 0 {
-		confidence = 0
-	}
-	if confidence > 1 {
-		confidence = 1
+	if len(images) > 0 {
+		detected, err := recognizer.DetectFacesBatch(images)
+		for k, i := range batched {
+			if err != nil {
+				detections[i].err = err
+				continue
+			}
+			switch faces := detected[k]; len(faces) {
+			case 0:
+				detections[i].err = recognition.ErrNoFaceDetected
+				if exposureErr := frames[i].CheckExposure(cfg.Camera.MaxSaturation); errors.Is(exposureErr, camera.ErrOverexposed) {
+					detections[i].err = fmt.Errorf("%w: %w", recognition.ErrNoFaceDetected, exposureErr)
+				}
+			case 1:
+				detections[i].face = &faces[0]
+			default:
+				detections[i].err = recognition.ErrMultipleFaces
+			}
+		}
 	}
 
-	fmt.Println("Results:")
-	fmt.Printf("  Distance:   %.4f\n", distance)
-	fmt.Printf("  Confidence: %.1f%%\n", confidence*100)
-	fmt.Printf("  Threshold:  %.2f\n", cfg.Recognition.Tolerance)
-	fmt.Printf("  Liveness:   %v (Score: %.2f)\n", livenessResult.IsLive, livenessResult.Score)
-	if !livenessResult.IsLive {
-		fmt.Printf("  Liveness Reason: %s\n", livenessResult.Reason)
+	wg.Wait()
+	return detections
+}
+
+// analyzeTestFrame turns a captured frame and its detection into a liveness
+// frame and the matching line of the frame analysis table.
+func analyzeTestFrame(index int, camFrame *camera.Frame, isIR bool, detection frameDetection) (liveness.Frame, string) {
+	liveFrame := liveness.Frame{
+		Data:        camFrame.Data,
+		IsIR:        isIR,
+		Timestamp:   camFrame.Timestamp,
+		FaceFound:   false,
+		IRHistogram: camFrame.IRHistogram(liveness.IRHistogramBins),
 	}
-	fmt.Println()
 
-	if matched {
-		if livenessResult.IsLive {
-			fmt.Printf("SUCCESS: Face matches user '%s' and liveness confirmed\n", username)
-			logging.Infof("Face recognition test PASSED for user: %s (distance: %.4f, liveness: %.2f)", username, distance, livenessResult.Score)
-		} else {
-			fmt.Printf("WARNING: Face matches user '%s' BUT liveness check failed\n", username)
-			logging.Warnf("Face recognition test MATCHED but LIVENESS FAILED for user: %s (distance: %.4f, reason: %s)", username, distance, livenessResult.Reason)
+	if detection.err != nil {
+		if errors.Is(detection.err, camera.ErrOverexposed) {
+			return liveFrame, fmt.Sprintf(" %4d | No   | ----- |        | too much light\n", index)
 		}
-	} else {
-		fmt.Printf("FAILED: Face does not match user '%s'\n", username)
-		logging.Warnf("Face recognition test FAILED for user: %s (distance: %.4f)", username, distance)
+		return liveFrame, fmt.Sprintf(" %4d | No   | ----- |        |\n", index)
 	}
 
-	// Update last used timestamp
-	_ = store.UpdateLastUsed(username)
+	face := detection.face
+	liveFrame.FaceFound = true
+	liveFrame.Embedding = recognizer.GetEmbedding(face, "test")
 
-	return nil
+	// Convert landmarks
+	var landmarks []liveness.Point
+	for _, p := range face.Landmarks {
+		landmarks = append(landmarks, liveness.Point{X: float64(p.X), Y: float64(p.Y)})
+	}
+	liveFrame.Landmarks = landmarks
+
+	// Calculate EAR
+	if len(landmarks) >= 5 {
+		leftEye := landmarks[0:2]
+		rightEye := landmarks[2:4]
+		leftEAR := liveness.CalculateEyeAspectRatio(leftEye)
+		rightEAR := liveness.CalculateEyeAspectRatio(rightEye)
+		liveFrame.EyeAspectRatio = (leftEAR + rightEAR) / 2.0
+	}
+	return liveFrame, fmt.Sprintf(" %4d | Yes  | %.3f |        |\n", index, liveFrame.EyeAspectRatio)
 }
 
 func cmdRemove(args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("username required\nUsage: facepass remove <username>")
+	flags := flag.NewFlagSet("remove", flag.ContinueOnError)
+	all := flags.Bool("all", false, "Remove every enrolled user")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// Allow flags after the username as well
+	username := flags.Arg(0)
+	if username != "" {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case *all && username != "":
+		return fmt.Errorf("--all does not take a username\nUsage: %s", commands["remove"].Usage)
+	case !*all && username == "":
+		return fmt.Errorf("username required\nUsage: %s", commands["remove"].Usage)
+	case flags.NArg() > 0:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
 	}
-	username := args[0]
 
 	// Initialize storage
 	if err := initStorage(); err != nil {
 		return err
 	}
 
+	if *all {
+		return removeAllUsers(*yes)
+	}
+
 	if !store.UserExists(username) {
 		return fmt.Errorf("user '%s' is not enrolled", username)
 	}
 
 	// Confirm deletion
-	fmt.Printf("Are you sure you want to remove face data for '%s'? [y/N]: ", username)
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.TrimSpace(strings.ToLower(response))
-
-	if response != "y" && response != "yes" {
+	if !*yes && !confirm(fmt.Sprintf("Are you sure you want to remove face data for '%s'?", username)) {
 		fmt.Println("Cancelled.")
 		return nil
 	}
@@ -750,7 +1325,54 @@ func cmdRemove(args []string) error {
 	return nil
 }
 
+// removeAllUsers deletes every enrolled user after a single confirmation.
+// Failures are reported per user without stopping the others.
+func removeAllUsers(yes bool) error {
+	users, err := store.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	if len(users) == 0 {
+		fmt.Println("No users enrolled.")
+		return nil
+	}
+
+	if !yes && !confirm(fmt.Sprintf("Are you sure you want to remove face data for all %d user(s)?", len(users))) {
+		fmt.Println("Cancelled.")
+		return nil
+	}
+
+	logging.Infof("Removing face data for all %d user(s)", len(users))
+	removed, failed, err := storage.RemoveAll(store)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	for _, username := range removed {
+		fmt.Printf("  %s: removed\n", username)
+	}
+	names := make([]string, 0, len(failed))
+	for username := range failed {
+		names = append(names, username)
+	}
+	sort.Strings(names)
+	for _, username := range names {
+		fmt.Printf("  %s: %v\n", username, failed[username])
+	}
+	fmt.Printf("Removed face data for %d of %d user(s)\n", len(removed), len(removed)+len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove %d user(s): %s", len(failed), strings.Join(names, ", "))
+	}
+	return nil
+}
+
 func cmdList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	summary := flags.Bool("summary", false, "Only print user and embedding totals")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
 	logging.Debug("Listing enrolled users")
 
 	// Initialize storage
@@ -758,6 +1380,21 @@ func cmdList(args []string) error {
 		return err
 	}
 
+	fmt.Printf("Data directory: %s\n\n", cfg.Storage.DataDir)
+
+	if *summary {
+		users, embeddings, err := store.Stats()
+		if err != nil {
+			return fmt.Errorf("failed to read storage stats: %w", err)
+		}
+		fmt.Printf("Users:      %d\n", users)
+		fmt.Printf("Embeddings: %d\n", embeddings)
+		if users > 0 {
+			fmt.Printf("Average:    %.1f embeddings/user\n", float64(embeddings)/float64(users))
+		}
+		return nil
+	}
+
 	users, err := store.ListUsers()
 	if err != nil {
 		return fmt.Errorf("failed to list users: %w", err)
@@ -771,14 +1408,27 @@ func cmdList(args []string) error {
 	fmt.Println("Enrolled users:")
 	for _, username := range users {
 		user, err := store.LoadUser(username)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			// Listed, but saved with the other encryption setting
+			fmt.Printf("  - %s (not readable with the current encryption setting; run 'facepass storage repair')\n", username)
+			continue
+		}
 		if err != nil {
 			fmt.Printf("  - %s (error loading data)\n", username)
 			continue
 		}
-		fmt.Printf("  - %s (%d embeddings, enrolled: %s)\n",
+		extra := ""
+		if user.Tolerance != nil {
+			extra += fmt.Sprintf(", tolerance: %.2f", *user.Tolerance)
+		}
+		if user.Disabled {
+			extra += ", disabled"
+		}
+		fmt.Printf("  - %s (%d embeddings, enrolled: %s%s)\n",
 			username,
 			len(user.Embeddings),
-			user.EnrolledAt.Format("2006-01-02"))
+			user.EnrolledAt.Format("2006-01-02"),
+			extra)
 	}
 	fmt.Printf("\nTotal: %d user(s)\n", len(users))
 
@@ -786,9 +1436,27 @@ func cmdList(args []string) error {
 }
 
 func cmdCameras(args []string) error {
+	flags := flag.NewFlagSet("cameras", flag.ContinueOnError)
+	verbose := flags.Bool("verbose", false, "Show IR emitter and format support of each camera")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
 	fmt.Println("Detecting cameras...")
 
 	cameras, err := camera.ListCameras()
+	if errors.Is(err, camera.ErrNoCameras) {
+		fmt.Println("No camera devices found (/dev/video* does not exist).")
+		fmt.Println("Check that the camera is connected and not disabled in the BIOS/UEFI settings.")
+		fmt.Println("In a container, pass the device through, e.g. --device /dev/video0.")
+		return nil
+	}
+	if errors.Is(err, camera.ErrCameraPermission) {
+		return cameraOpenError("", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to list cameras: %w", err)
 	}
@@ -804,16 +1472,125 @@ func cmdCameras(args []string) error {
 		if cam.IsIR {
 			irLabel = " [IR]"
 		}
+		if cam.Busy {
+			irLabel += " (in use by another process)"
+		}
 		fmt.Printf("  %s: %s%s\n", cam.Path, cam.Name, irLabel)
 		if cam.Driver != "" {
 			fmt.Printf("       Driver: %s\n", cam.Driver)
 		}
+		if *verbose {
+			printCameraCapabilities(cam.Path)
+		}
 	}
 
 	return nil
 }
 
+// printCameraCapabilities opens device again and prints its IR emitter and
+// format support.
+func printCameraCapabilities(device string) {
+	cam := camera.NewCamera()
+	if err := cam.Open(device); err != nil {
+		fmt.Printf("       Capabilities unavailable: %v\n", err)
+		return
+	}
+	defer cam.Close()
+	caps := cam.Capabilities()
+
+	if caps.IREmitter {
+		fmt.Printf("       IR emitter: yes (%s)\n", caps.EmitterTool)
+	} else {
+		fmt.Println("       IR emitter: no")
+	}
+	if len(caps.Formats) == 0 {
+		fmt.Println("       Formats: unknown (is v4l2-ctl installed?)")
+		return
+	}
+	fmt.Println("       Formats:")
+	for _, f := range caps.Formats {
+		sizes := make([]string, len(f.Resolutions))
+		for i, r := range f.Resolutions {
+			sizes[i] = r.String()
+		}
+		format := "not supported by facepass"
+		if f.PixelFormat != "" {
+			format = "pixel_format: " + f.PixelFormat
+		}
+		fmt.Printf("         %-4s %s (%s)\n", f.FourCC, strings.Join(sizes, ", "), format)
+	}
+}
+
+// captureDevice returns the camera the CLI captures from: camera.ir_device
+// if prefer_ir is set and it exists, camera.device otherwise.
+func captureDevice(cfg *config.Config) string {
+	if cfg.Camera.PreferIR {
+		if _, err := os.Stat(cfg.Camera.IRDevice); err == nil {
+			return cfg.Camera.IRDevice
+		}
+	}
+	return cfg.Camera.Device
+}
+
+// cameraOpenError wraps an error from opening the camera. Permission errors
+// get a hint on how to gain access, tailored to the group owning the device
+// (taken from err if device is empty), and busy devices one naming the
+// process holding them.
+func cameraOpenError(device string, err error) error {
+	if errors.Is(err, camera.ErrCameraBusy) {
+		return cameraBusyError(err)
+	}
+	if !errors.Is(err, camera.ErrCameraPermission) {
+		return fmt.Errorf("failed to open camera %s: %w", device, err)
+	}
+	var pathErr *fs.PathError
+	if device == "" && errors.As(err, &pathErr) {
+		device = pathErr.Path
+	}
+	return fmt.Errorf("%w\n%s", err, camera.PermissionHint(device))
+}
+
+// cameraBusyError adds a hint on what holds the camera to err, an
+// ErrCameraBusy from opening or capturing.
+func cameraBusyError(err error) error {
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		return err
+	}
+	return fmt.Errorf("%w\n%s", err, camera.BusyHint(pathErr.Path))
+}
+
 func cmdConfig(args []string) error {
+	if len(args) > 0 && args[0] == "init" {
+		return cmdConfigInit(args[1:])
+	}
+
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	asYAML := flags.Bool("yaml", false, "Print the effective configuration as YAML")
+	asJSON := flags.Bool("json", false, "Print the effective configuration as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *asYAML && *asJSON:
+		return fmt.Errorf("--yaml and --json are mutually exclusive")
+	case *asYAML:
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	case *asJSON:
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
 	logging.Debug("Showing configuration")
 
 	fmt.Println("Current Configuration:")
@@ -822,28 +1599,47 @@ func cmdConfig(args []string) error {
 	fmt.Println("[Camera]")
 	fmt.Printf("  Device:          %s\n", cfg.Camera.Device)
 	fmt.Printf("  Resolution:      %dx%d @ %d FPS\n", cfg.Camera.Width, cfg.Camera.Height, cfg.Camera.FPS)
+	fmt.Printf("  JPEG Quality:    %d (1 = best, 31 = fastest)\n", cfg.Camera.JPEGQuality)
 	fmt.Printf("  Prefer IR:       %t\n", cfg.Camera.PreferIR)
 	fmt.Printf("  IR Device:       %s\n", cfg.Camera.IRDevice)
 	fmt.Printf("  IR Emitter:      %t\n", cfg.Camera.IREmitterEnabled)
 	fmt.Println()
 	fmt.Println("[Recognition]")
+	fmt.Printf("  Detector:        %s\n", cfg.Recognition.Detector)
+	fmt.Printf("  Preprocess:      %s\n", cfg.Recognition.Preprocess)
 	fmt.Printf("  Confidence:      %.2f\n", cfg.Recognition.ConfidenceThreshold)
 	fmt.Printf("  Tolerance:       %.2f\n", cfg.Recognition.Tolerance)
-	fmt.Printf("  Model Path:      %s\n", cfg.Recognition.ModelPath)
+	fmt.Printf("  Model Path:      %s\n", strings.Join(cfg.Recognition.ModelPath, ", "))
 	fmt.Println()
 	fmt.Println("[Liveness Detection]")
 	fmt.Printf("  Level:           %s\n", cfg.Liveness.Level)
 	fmt.Printf("  Blink Required:  %t\n", cfg.Liveness.BlinkRequired)
 	fmt.Printf("  Min Score:       %.2f\n", cfg.Liveness.MinLivenessScore)
+	fmt.Printf("  Cross Check:     %t\n", cfg.Liveness.CrossCheck)
 	fmt.Println()
 	fmt.Println("[Authentication]")
 	fmt.Printf("  Timeout:         %d seconds\n", cfg.Auth.Timeout)
 	fmt.Printf("  Max Attempts:    %d\n", cfg.Auth.MaxAttempts)
+	fmt.Printf("  Capture Frames:  %d per attempt\n", cfg.Auth.CaptureFrames)
+	fmt.Printf("  Retry Delay:     %d ms (prompt: %t)\n", cfg.Auth.RetryDelayMS, cfg.Auth.RetryPrompt)
 	fmt.Printf("  Fallback:        %t\n", cfg.Auth.FallbackEnabled)
+	if cfg.Auth.CameraGraceSeconds > 0 {
+		fmt.Printf("  Camera Grace:    %d seconds\n", cfg.Auth.CameraGraceSeconds)
+	}
+	if cfg.Auth.MinConfidenceMargin > 0 {
+		fmt.Printf("  Confidence:      distance below %.2f (tolerance - %.2f)\n",
+			cfg.Recognition.Tolerance-cfg.Auth.MinConfidenceMargin, cfg.Auth.MinConfidenceMargin)
+	}
+	if cfg.Auth.MinMatchingEmbeddings > 1 {
+		fmt.Printf("  Min Matches:     %d enrolled embeddings\n", cfg.Auth.MinMatchingEmbeddings)
+	}
 	fmt.Println()
 	fmt.Println("[Storage]")
 	fmt.Printf("  Data Dir:        %s\n", cfg.Storage.DataDir)
+	fmt.Printf("  Backend:         %s\n", cfg.Storage.Backend)
 	fmt.Printf("  Encryption:      %t\n", cfg.Storage.EncryptionEnabled)
+	fmt.Printf("  Key Source:      %s\n", cfg.Storage.KeySource)
+	fmt.Printf("  Compression:     %t\n", cfg.Storage.Compress)
 	fmt.Println()
 	fmt.Println("[Logging]")
 	fmt.Printf("  Level:           %s\n", cfg.Logging.Level)
@@ -852,21 +1648,222 @@ func cmdConfig(args []string) error {
 	return nil
 }
 
-func cmdVersion(args []string) error {
-	fmt.Printf("FacePass v%s\n", version)
-	fmt.Println("Face Recognition Authentication for Linux")
-	fmt.Println()
-	fmt.Println("Build Information:")
-	fmt.Printf("  Go version: %s\n", "1.21+")
-	fmt.Printf("  Platform:   linux/amd64\n")
-	fmt.Println()
-	fmt.Println("Components:")
-	fmt.Println("  - Face Recognition: dlib/go-face")
-	fmt.Println("  - Encryption: NaCl secretbox")
-	fmt.Println("  - Camera: V4L2")
+// cmdConfigInit writes a commented default config file. Without a path it
+// writes the system config when run as root and the user config otherwise.
+func cmdConfigInit(args []string) error {
+	flags := flag.NewFlagSet("config init", flag.ContinueOnError)
+	force := flags.Bool("force", false, "Overwrite an existing config file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	path := flags.Arg(0)
+	if path == "" {
+		if os.Geteuid() == 0 {
+			path = config.SystemConfigPath
+		} else {
+			userConfig, err := config.UserConfigPath()
+			if err != nil {
+				return fmt.Errorf("failed to determine user config path: %w", err)
+			}
+			path = userConfig
+		}
+	}
+
+	if err := config.DefaultConfig().WriteFile(path, *force); err != nil {
+		if errors.Is(err, config.ErrConfigExists) {
+			return fmt.Errorf("%w (use --force to overwrite)", err)
+		}
+		return err
+	}
+
+	fmt.Printf("Wrote default configuration to %s\n", path)
+	return nil
+}
+
+// weakEmbeddingQuality is the quality below which stats flags an embedding.
+const weakEmbeddingQuality = 0.5
+
+func cmdStats(args []string) error {
+	if err := initStorage(); err != nil {
+		return err
+	}
+
+	users := args
+	if len(users) == 0 {
+		var err error
+		users, err = store.ListUsers()
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+	}
+
+	if len(users) == 0 {
+		fmt.Println("No users enrolled.")
+		return nil
+	}
+
+	for _, username := range users {
+		user, err := store.LoadUser(username)
+		if err != nil {
+			return fmt.Errorf("failed to load user %s: %w", username, err)
+		}
+
+		fmt.Printf("%s (%d embeddings)\n", username, len(user.Embeddings))
+		fmt.Printf("  Enrolled %s\n", user.EnrolledAt.Local().Format("2006-01-02 15:04"))
+		if user.Tolerance != nil {
+			fmt.Printf("  Tolerance %.2f (recognition.tolerance is %.2f)\n", *user.Tolerance, cfg.Recognition.Tolerance)
+		}
+		if user.Disabled {
+			fmt.Printf("  Face authentication disabled ('facepass enable %s' to resume)\n", username)
+		}
+		weak, i := 0, 0
+		for _, profile := range user.ProfileNames() {
+			fmt.Printf("  Profile %s (%d embeddings)\n", profile, len(user.Profiles[profile]))
+			for _, emb := range user.Profiles[profile] {
+				i++
+				marker := ""
+				if emb.Quality < weakEmbeddingQuality {
+					marker = "  <- weak"
+					weak++
+				}
+				fmt.Printf("    %2d. %-10s quality %.2f  %s%s\n", i, emb.Angle, emb.Quality, captureInfo(emb), marker)
+			}
+		}
+		if weak > 0 {
+			fmt.Printf("  %d weak embedding(s); consider 'facepass add-face %s' in better lighting\n", weak, username)
+		}
+		for _, group := range recognition.DuplicateEmbeddings(user.Embeddings) {
+			fmt.Printf("  Duplicates: embeddings %s are identical; only one is needed\n", embeddingNumbers(group))
+		}
+		if cfg.Recognition.MinEmbeddingQuality > 0 {
+			fmt.Printf("  Embeddings below %.2f are ignored during matching\n", cfg.Recognition.MinEmbeddingQuality)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// captureInfo describes when and with which device an embedding was
+// captured, for stats.
+func captureInfo(emb recognition.Embedding) string {
+	if emb.CapturedAt.IsZero() {
+		return "captured: unknown"
+	}
+	info := "captured " + emb.CapturedAt.Local().Format("2006-01-02 15:04")
+	if emb.Device != "" {
+		info += " on " + emb.Device
+	}
+	return info
+}
+
+func cmdRekey(args []string) error {
+	flags := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	oldKeyHex := flags.String("old-key", "", "Old encryption key (64 hex characters)")
+	oldKeyFile := flags.String("old-key-file", "", "File containing the old encryption key")
+	oldMachineID := flags.String("old-machine-id", "", "Old /etc/machine-id, or a file holding it, to derive the old machine key")
+	oldHostname := flags.String("old-hostname", "", "Old hostname to derive the old machine key (default: the current one)")
+	newKeyHex := flags.String("new-key", "", "New encryption key (64 hex characters, default: the configured key)")
+	newKeyFile := flags.String("new-key-file", "", "File containing the new encryption key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !cfg.Storage.EncryptionEnabled {
+		return fmt.Errorf("encryption is disabled in the configuration, nothing to rekey")
+	}
+
+	fromKey := *oldKeyHex != "" || *oldKeyFile != ""
+	fromMachine := *oldMachineID != "" || *oldHostname != ""
+	if !fromKey && !fromMachine {
+		return fmt.Errorf("old key required\nUsage: %s", commands["rekey"].Usage)
+	}
+	if fromKey && fromMachine {
+		return fmt.Errorf("give either the old key or the old machine identity, not both")
+	}
+
+	var oldKey [storage.KeySize]byte
+	var err error
+	if fromMachine {
+		oldKey, err = oldMachineKey(*oldMachineID, *oldHostname)
+	} else {
+		oldKey, err = resolveKey(*oldKeyHex, *oldKeyFile)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid old key: %w", err)
+	}
+
+	configuredKey, err := storage.ResolveKey(storage.KeySource(cfg.Storage.KeySource), cfg.Storage.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve configured key: %w", err)
+	}
+
+	newKey := configuredKey
+	if *newKeyHex != "" || *newKeyFile != "" {
+		newKey, err = resolveKey(*newKeyHex, *newKeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid new key: %w", err)
+		}
+	}
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+
+	if err := store.RotateKey(oldKey, newKey); err != nil {
+		return fmt.Errorf("failed to rotate key: %w", err)
+	}
+
+	fmt.Printf("Face data re-encrypted. Key fingerprint: %s\n", storage.KeyFingerprint(newKey))
+	if newKey != configuredKey {
+		fmt.Println("Note: the new key differs from the configured key; update storage.key_source to use it.")
+	}
+
 	return nil
 }
 
+func cmdMigrate(args []string) error {
+	if err := initStorage(); err != nil {
+		return err
+	}
+
+	users, err := store.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	migrated := 0
+	var failed []string
+	for _, username := range users {
+		changed, err := store.MigrateUser(username)
+		if err != nil {
+			fmt.Printf("  %s: %v\n", username, err)
+			failed = append(failed, username)
+			continue
+		}
+		if changed {
+			fmt.Printf("  %s: migrated\n", username)
+			migrated++
+		}
+	}
+
+	fmt.Printf("Migrated %d of %d user(s) to schema version %d\n", migrated, len(users), storage.CurrentSchemaVersion)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to migrate %d user(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// resolveKey parses a key from a hex string or a key file.
+func resolveKey(hexValue, file string) ([storage.KeySize]byte, error) {
+	if file != "" {
+		return storage.ReadKeyFile(file)
+	}
+	return storage.ParseKey(hexValue)
+}
+
 func cmdHelp(args []string) error {
 	if len(args) == 0 {
 		printUsage()
@@ -895,36 +1892,228 @@ func cmdHelp(args []string) error {
 		fmt.Println("     - Up (head tilted up)")
 		fmt.Println("     - Down (head tilted down)")
 		fmt.Println("  4. Face data is encrypted and stored locally")
+		fmt.Println("\n  --auto replaces the Enter presses: each angle starts with a 3-2-1")
+		fmt.Println("  countdown and is captured once a single face holds still.")
+		fmt.Println("\n  --angles selects the poses, e.g. --angles front,left,right for a quick")
+		fmt.Printf("  enrollment or --angles 9 for all of: %s.\n", strings.Join(allEnrollmentAngles, ", "))
+		fmt.Printf("  At least %d angles are required.\n", minEnrollmentAngles)
+		fmt.Println("\n  --verbose prints the distances between all captured angles before")
+		fmt.Println("  saving, flags angles that look identical or match none of the others,")
+		fmt.Println("  and lets you recapture them.")
+		fmt.Println("\n  --strict aborts the whole enrollment as soon as a second face is in")
+		fmt.Println("  frame, instead of skipping the angle, so nobody else's face can end up")
+		fmt.Println("  in the gallery (e.g. when enrolling in a shared space).")
 	case "test":
 		fmt.Println("\nTesting Process:")
 		fmt.Println("  1. Look at the camera")
 		fmt.Println("  2. The system captures your face")
 		fmt.Println("  3. Compares against stored embeddings")
 		fmt.Println("  4. Shows match confidence and result")
+		fmt.Println("\nOptions:")
+		fmt.Println("  --no-liveness  Skip the liveness check and only report the match, to")
+		fmt.Println("                 tell recognition failures from liveness failures")
+		fmt.Println("  --challenge    After the normal capture, ask for a random action (turn")
+		fmt.Println("                 your head, look up or down, blink, or look at a screen")
+		fmt.Println("                 corner with only your eyes), capture again and report")
+		fmt.Println("                 whether the challenge-response check passed")
+		fmt.Println("  --workers N    Frames analyzed in parallel (default recognition.workers;")
+		fmt.Println("                 0 = min(CPUs, 4))")
+		fmt.Println("  --fps-cap N    Hand at most N frames per second to the workers (default")
+		fmt.Println("                 recognition.max_process_fps; 0 = unlimited)")
+		fmt.Println("  --pprof addr   Serve Go profiles (net/http/pprof) on addr while testing,")
+		fmt.Println("                 e.g. 127.0.0.1:6060 (default $FACEPASS_PPROF). On exit,")
+		fmt.Println("                 profiles still being recorded are waited for, so run")
+		fmt.Println("                 'go tool pprof' while the test captures")
+		fmt.Println("\nTolerance tuning:")
+		fmt.Println("  facepass test --impostor-scan <dir> reads face images from")
+		fmt.Println("  <dir>/<username>/*.jpg (or .png), compares each against every enrolled")
+		fmt.Println("  user and prints false accept (FAR) and false reject (FRR) rates at a")
+		fmt.Println("  range of tolerances. Include people who are not enrolled: they only")
+		fmt.Println("  produce impostor comparisons.")
+	case "rekey":
+		fmt.Println("\nKey Rotation:")
+		fmt.Println("  Decrypts every enrolled user with the old key and re-encrypts")
+		fmt.Println("  with the new key (the configured key by default).")
+		fmt.Println("  Use this to recover enrollments after /etc/machine-id or the")
+		fmt.Println("  hostname changed: pass the key saved with 'facepass key export', or")
+		fmt.Println("  the old identity with -old-machine-id (the 32 hex characters of the")
+		fmt.Println("  old /etc/machine-id, or a copy of the file from a backup) and/or")
+		fmt.Println("  -old-hostname. Run it as the user who enrolled (sudo for system-wide")
+		fmt.Println("  data): the machine key depends on the user ID.")
+	case "key":
+		fmt.Println("\nKey Export:")
+		fmt.Println("  export prints the configured encryption key as 64 hex characters,")
+		fmt.Println("  or writes it to a new file with -out. With key_source: machine the")
+		fmt.Println("  key changes when /etc/machine-id or the hostname does; save it")
+		fmt.Println("  before a reinstall and restore with 'facepass rekey -old-key-file'.")
+		fmt.Println("  Anyone with the key can decrypt the face data.")
+	case "storage":
+		fmt.Println("\nStorage Repair:")
+		fmt.Println("  repair brings user files saved before storage.encryption_enabled was")
+		fmt.Println("  changed into the configured state: plaintext .json files are")
+		fmt.Println("  encrypted, or .enc files decrypted with the configured key. Files")
+		fmt.Println("  that cannot be read, and users with both a .json and a .enc file,")
+		fmt.Println("  are skipped and listed. File backend only.")
+	case "remove":
+		fmt.Println("\nRemoval:")
+		fmt.Println("  Deletes a user's face data after a confirmation prompt.")
+		fmt.Println("  --all removes every enrolled user after a single confirmation;")
+		fmt.Println("  users that fail to delete are reported and the rest are removed.")
+		fmt.Println("  --yes skips the prompt for scripted teardown.")
+	case "disable", "enable":
+		fmt.Println("\nDisabling Users:")
+		fmt.Println("  disable suspends face authentication for a user without deleting the")
+		fmt.Println("  enrollment, e.g. during an investigation; PAM then falls back to the")
+		fmt.Println("  password. enable resumes it with the same enrollment.")
+	case "set-tolerance":
+		fmt.Println("\nPer-User Tolerance:")
+		fmt.Println("  Overrides recognition.tolerance for one user. Use a stricter (lower)")
+		fmt.Println("  value for someone with a lookalike sibling, without making")
+		fmt.Println("  recognition harder for everyone else. The confidence margin and")
+		fmt.Println("  template update margin are applied to the override as well.")
+		fmt.Println("  'default' removes the override. 'facepass test' shows the threshold")
+		fmt.Println("  in effect.")
+	case "verify-enrollment":
+		fmt.Println("\nEnrollment Check:")
+		fmt.Println("  Groups the user's stored embeddings by distance (average-linkage")
+		fmt.Println("  clustering) and warns when they form more than one group, e.g.")
+		fmt.Println("  because a roommate was enrolled by mistake. Embeddings outside the")
+		fmt.Println("  largest group are listed with the numbers 'facepass stats' uses.")
+		fmt.Println("  --distance D  Mean distance that separates two people (default 0.6)")
+		fmt.Println("  --prune       Remove the listed embeddings (asks first unless --yes)")
+		fmt.Println("  Exits with an error if a second person was found and not pruned.")
+	case "backup", "restore":
+		fmt.Println("\nBackup and Restore:")
+		fmt.Println("  backup writes every enrolled user and a manifest to a .tar.gz")
+		fmt.Println("  archive. The data stays encrypted with the current key, so keep")
+		fmt.Println("  the key (storage.key_source: file or env) to restore elsewhere.")
+		fmt.Println("  restore checks the whole archive before writing and warns if the")
+		fmt.Println("  configured key cannot decrypt it. Existing users in the archive")
+		fmt.Println("  are only replaced with --force; other users are kept.")
+	case "migrate":
+		fmt.Println("\nMigration:")
+		fmt.Println("  Rewrites enrolled users stored by older FacePass versions")
+		fmt.Println("  in the current data format. Safe to run repeatedly.")
+		fmt.Println("  Embeddings enrolled before profiles existed join the default profile.")
+	case "test-spoof":
+		fmt.Println("\nSpoof Test:")
+		fmt.Println("  Captures while you hold a printed photo of the user, or a phone showing")
+		fmt.Println("  one, in front of the camera, and runs the same liveness checks as PAM")
+		fmt.Println("  authentication at the configured level. Reports whether the photo")
+		fmt.Println("  matches the user, the result of each check and which checks caught it.")
+		fmt.Println("  Exits with an error if liveness accepts the spoof, so it can be used to")
+		fmt.Println("  verify a setup before enabling PAM.")
+	case "cameras":
+		fmt.Println("\nCamera List:")
+		fmt.Println("  Lists the V4L2 devices with their name, driver and whether they look")
+		fmt.Println("  like an IR camera. --verbose also shows whether an IR emitter can be")
+		fmt.Println("  controlled and with which tool, and the formats and resolutions each")
+		fmt.Println("  device offers, with the camera.pixel_format value to select them.")
+	case "capture":
+		fmt.Println("\nCamera Capture:")
+		fmt.Println("  Opens the camera and writes --count frames to --out, printing the")
+		fmt.Println("  resolution, size and time of each. No models are loaded, so this")
+		fmt.Println("  shows whether the camera works at all: if the frames look fine but")
+		fmt.Println("  'facepass test' finds no face, the problem is detection, not the camera.")
+		fmt.Println("  With --count > 1 the frames are streamed and numbered, e.g.")
+		fmt.Println("  frame-001.jpg, and the frame rate is reported.")
+	case "bench":
+		fmt.Println("\nBenchmark:")
+		fmt.Println("  Runs detection and embedding matching repeatedly on one camera frame")
+		fmt.Println("  (or --image) and reports the average time per stage and FPS.")
+		fmt.Println("  --backend dlib benchmarks dlib; cpu, rocm, cuda or openvino use the")
+		fmt.Println("  ONNX engine with that execution provider. Without --backend the")
+		fmt.Println("  configured engine is used.")
+		fmt.Println("  With dlib, detection includes computing the face descriptor.")
+		fmt.Println("  --detector cnn measures dlib's CNN face detector instead of the")
+		fmt.Println("  configured one; compare it with hog before setting recognition.detector.")
+		fmt.Println("  The first frame is timed separately after a warm-up inference, as in")
+		fmt.Println("  authentication; --no-warmup skips it to show the cold first frame.")
+	case "watch":
+		fmt.Println("\nPresence Watch:")
+		fmt.Println("  Repeatedly runs the quick liveness check and matches against the user.")
+		fmt.Println("  --on-match runs through /bin/sh with FACEPASS_USER set when the user")
+		fmt.Println("  appears, and again only after they were gone for --debounce.")
+		fmt.Println("  Example: facepass watch --user john --on-match \"loginctl unlock-session\"")
+		fmt.Println("  If metrics.listen is set, Prometheus metrics are served there.")
+	case "serve":
+		fmt.Println("\nLocal API:")
+		fmt.Println("  Serves enroll, add-face, authenticate, list and remove, and the camera's")
+		fmt.Println("  capabilities, as JSON over HTTP on a Unix socket (see pkg/api), for")
+		fmt.Println("  integration into display managers and other applications. The socket")
+		fmt.Println("  is only accessible to the user running the server.")
+		fmt.Println("  Default socket: $XDG_RUNTIME_DIR/facepass.sock")
+		fmt.Println("  If metrics.listen is set, Prometheus metrics are served there.")
+	case "where":
+		fmt.Println("\nPrints the paths in effect for the user running the command. If")
+		fmt.Println("'facepass test' says a user is not enrolled, compare the output of")
+		fmt.Println("'facepass where' and 'sudo facepass where': with the default config each")
+		fmt.Println("user (including root, which PAM usually runs as) has its own data dir.")
 	case "config":
 		fmt.Println("\nConfiguration Locations:")
 		fmt.Println("  System: /etc/facepass/facepass.yaml")
 		fmt.Println("  User:   ~/.config/facepass/facepass.yaml")
+		fmt.Println("\nThe user file is merged on top of the system file.")
 		fmt.Println("\nUse -config flag to specify a custom config file.")
+		fmt.Println("\nUse --yaml or --json to print the effective configuration")
+		fmt.Println("(after merging files and environment overrides), e.g. for bug reports.")
+		fmt.Println("\nSubcommands:")
+		fmt.Println("  init [path]  Write a commented default config file (--force to overwrite)")
 	}
 
 	return nil
 }
 
+// anglePrompts holds the capture instruction for each enrollment angle.
+var anglePrompts = map[string]string{
+	"front":      "Look directly at the camera",
+	"left":       "Turn your head slightly to the LEFT",
+	"right":      "Turn your head slightly to the RIGHT",
+	"up":         "Tilt your head slightly UP",
+	"down":       "Tilt your head slightly DOWN",
+	"up-left":    "Tilt your head slightly UP and turn it to the LEFT",
+	"up-right":   "Tilt your head slightly UP and turn it to the RIGHT",
+	"down-left":  "Tilt your head slightly DOWN and turn it to the LEFT",
+	"down-right": "Tilt your head slightly DOWN and turn it to the RIGHT",
+}
+
 // getAnglePrompt returns the instruction for capturing a specific angle.
 func getAnglePrompt(angle string) string {
-	prompts := map[string]string{
-		"front": "Look directly at the camera",
-		"left":  "Turn your head slightly to the LEFT",
-		"right": "Turn your head slightly to the RIGHT",
-		"up":    "Tilt your head slightly UP",
-		"down":  "Tilt your head slightly DOWN",
-	}
-	if prompt, ok := prompts[angle]; ok {
+	if prompt, ok := anglePrompts[angle]; ok {
 		return prompt
 	}
 	return "Position your face"
 }
 
+// parseAngles parses the --angles value of enroll: either a comma-separated
+// list of known angles or a count selecting the first angles of
+// allEnrollmentAngles. At least minEnrollmentAngles are required.
+func parseAngles(spec string) ([]string, error) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < minEnrollmentAngles || n > len(allEnrollmentAngles) {
+			return nil, fmt.Errorf("--angles must be between %d and %d, got %d", minEnrollmentAngles, len(allEnrollmentAngles), n)
+		}
+		return allEnrollmentAngles[:n], nil
+	}
+
+	var angles []string
+	seen := make(map[string]bool)
+	for _, angle := range strings.Split(spec, ",") {
+		angle = strings.ToLower(strings.TrimSpace(angle))
+		if _, ok := anglePrompts[angle]; !ok {
+			return nil, fmt.Errorf("unknown angle %q (valid: %s)", angle, strings.Join(allEnrollmentAngles, ", "))
+		}
+		if seen[angle] {
+			return nil, fmt.Errorf("angle %q given more than once", angle)
+		}
+		seen[angle] = true
+		angles = append(angles, angle)
+	}
+	if len(angles) < minEnrollmentAngles {
+		return nil, fmt.Errorf("at least %d angles are required, got %d", minEnrollmentAngles, len(angles))
+	}
+	return angles, nil
+}
+
 // Unused but kept for potential future use
 var _ = time.Now
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// pprofEnv sets the default of the --pprof flag.
+const pprofEnv = "FACEPASS_PPROF"
+
+// pprofDrainTimeout is how long the command waits on exit for profiles that
+// are still being recorded, e.g. a CPU profile started before the command.
+const pprofDrainTimeout = time.Minute
+
+// startPprof serves the net/http/pprof handlers on addr in the background.
+// The returned function stops the server, letting profile downloads in
+// progress finish first.
+func startPprof(addr string) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if host, _, _ := net.SplitHostPort(addr); host == "" || !isLoopback(host) {
+		logging.Warnf("pprof on %s is reachable from other hosts; prefer 127.0.0.1", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Errorf("pprof server stopped: %v", err)
+		}
+	}()
+
+	url := "http://" + listener.Addr().String() + "/debug/pprof"
+	fmt.Printf("Profiling on %s/ (e.g. go tool pprof '%s/profile?seconds=20')\n", url, url)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pprofDrainTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+// isLoopback reports whether host is localhost or a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/MrCodeEU/facepass/pkg/api"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/metrics"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+)
+
+func cmdServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	socketPath := flags.String("socket", api.DefaultSocketPath(), "Unix socket to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := cfg.EnsureDirectories(); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	if err := initStorage(); err != nil {
+		return err
+	}
+
+	auth, err := pam.NewPAMAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+	defer auth.Close()
+
+	server := api.NewServer(auth, store)
+
+	if cfg.Metrics.Listen != "" {
+		recorder := metrics.NewRecorder()
+		metricsServer, err := metrics.Serve(cfg.Metrics.Listen, recorder)
+		if err != nil {
+			return err
+		}
+		defer metricsServer.Close()
+		server.SetRecorder(recorder)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		sig := <-signals
+		logging.Infof("Received %s, shutting down", sig)
+		_ = server.Close()
+	}()
+
+	fmt.Printf("FacePass API %s listening on %s\n", api.Version, *socketPath)
+	return server.Serve(*socketPath)
+}
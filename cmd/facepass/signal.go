@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// openCameras holds the cameras opened by the running command. Deferred
+// calls do not run when the process is interrupted, so the signal handler
+// releases them instead; otherwise ffmpeg and the IR emitter keep running.
+var openCameras struct {
+	sync.Mutex
+	list []*camera.V4L2Camera
+}
+
+// trackCamera registers cam to be released if the command is interrupted.
+func trackCamera(cam *camera.V4L2Camera) {
+	openCameras.Lock()
+	defer openCameras.Unlock()
+	openCameras.list = append(openCameras.list, cam)
+}
+
+// releaseCameras stops streaming, turns off the IR emitter and closes every
+// tracked camera.
+func releaseCameras() {
+	openCameras.Lock()
+	defer openCameras.Unlock()
+	for _, cam := range openCameras.list {
+		_ = cam.StopStreaming()
+		_ = cam.DisableIREmitter()
+		_ = cam.Close()
+	}
+	openCameras.list = nil
+}
+
+// handleInterrupts releases the tracked cameras and exits with 128+signal on
+// SIGINT or SIGTERM. The returned function removes the handler.
+func handleInterrupts() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintln(os.Stderr, "\nInterrupted, releasing camera")
+			logging.Infof("Received %s, releasing camera", sig)
+			releaseCameras()
+			_ = logging.Close()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
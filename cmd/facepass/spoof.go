@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/liveness"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// livenessChecks lists the checks in liveness.Result.Checks in the order
+// Detect runs them, with what each one looks for.
+var livenessChecks = []struct {
+	name        string
+	description string
+}{
+	{"3d_geometry", "head pose varies like a 3D face"},
+	{"consistency", "face looks the same in every frame"},
+	{"movement", "natural small movements"},
+	{"face_present", "face visible throughout"},
+	{"ir_reflectance", "IR reflectance of skin (y16 cameras)"},
+}
+
+// cmdTestSpoof captures while the user holds a photo or a phone in front of
+// the camera and reports whether liveness detection rejects it, and which
+// checks caught it. It fails if the spoof is accepted.
+func cmdTestSpoof(args []string) error {
+	switch {
+	case len(args) == 0 || args[0] == "":
+		return fmt.Errorf("username required\nUsage: %s", commands["test-spoof"].Usage)
+	case len(args) > 1:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args[1:], " "))
+	}
+	username := args[0]
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+	if !store.UserExists(username) {
+		return fmt.Errorf("user '%s' is not enrolled in %s. Use 'facepass enroll %s' first", username, cfg.Storage.DataDir, username)
+	}
+	userData, err := store.LoadUser(username)
+	if err != nil {
+		return fmt.Errorf("failed to load user data: %w", err)
+	}
+
+	if err := initRecognizer(false); err != nil {
+		return err
+	}
+	defer func() { _ = recognizer.Close() }()
+
+	cam := camera.NewCamera()
+	_ = cam.SetResolution(cfg.Camera.Width, cfg.Camera.Height)
+	_ = cam.SetPixelFormat(cfg.Camera.PixelFormat)
+	_ = cam.SetJPEGQuality(cfg.Camera.JPEGQuality)
+
+	device := captureDevice(cfg)
+	if err := cam.Open(device); err != nil {
+		return cameraOpenError(device, err)
+	}
+	defer func() { _ = cam.Close() }()
+	trackCamera(cam)
+
+	if cam.HasIREmitter() && cfg.Camera.IREmitterEnabled {
+		_ = cam.EnableIREmitter()
+		defer func() { _ = cam.DisableIREmitter() }()
+	}
+
+	fmt.Printf("Spoof test for '%s' (liveness level: %s)\n\n", username, cfg.Liveness.Level)
+	fmt.Printf("Hold a printed photo of %s, or a phone showing one, in front of the\n", username)
+	fmt.Println("camera where the face would be, and keep your own face out of view.")
+	fmt.Println("Move it a little as a person would; a good spoof is not held perfectly still.")
+	waitForEnter("Press Enter when ready... ")
+
+	if err := cam.StartStreaming(); err != nil {
+		logging.Warnf("Failed to start streaming, falling back to single capture: %v", err)
+	}
+	pipeline := testPipeline{workers: testWorkers(cfg.Recognition.Workers), maxFPS: cfg.Recognition.MaxProcessFPS}
+	frames, embeddings := captureTestWindow(cam, pipeline)
+	_ = cam.StopStreaming()
+
+	fmt.Println()
+	if len(embeddings) == 0 {
+		fmt.Println("REJECTED: no face was detected in any frame.")
+		fmt.Println("The camera does not see the spoof as a face; IR cameras usually cannot see")
+		fmt.Println("phone screens at all. If it was a photo, hold it closer and try again to")
+		fmt.Println("exercise the liveness checks.")
+		return nil
+	}
+
+	avgEmbedding := recognition.AverageEmbedding(embeddings)
+	if cfg.Recognition.NormalizeEmbeddings {
+		avgEmbedding = recognition.AverageNormalizedEmbedding(embeddings)
+	}
+	_, distance, _ := recognizer.FindBestMatch(avgEmbedding, userData.Embeddings)
+	tolerance := userData.MatchTolerance(cfg.Recognition.Tolerance)
+	matched := distance < tolerance
+
+	result := liveness.NewDetectorFromConfig(cfg).Detect(frames)
+
+	fmt.Println("Results:")
+	matchLabel := "no"
+	if matched {
+		matchLabel = "yes"
+	}
+	fmt.Printf("  Matches %s: %s (distance %.4f, tolerance %.2f)\n", username, matchLabel, distance, tolerance)
+	minScore := liveness.ConfigFromLevel(liveness.Level(cfg.Liveness.Level)).MinScore
+	fmt.Printf("  Liveness score: %.2f (minimum %.2f)\n", result.Score, minScore)
+	fmt.Println("  Checks:")
+	var caught []string
+	for _, check := range livenessChecks {
+		passed, ok := result.Checks[check.name]
+		if !ok {
+			continue
+		}
+		status := "pass"
+		if !passed {
+			status = "FAIL"
+			caught = append(caught, check.name)
+		}
+		fmt.Printf("    %-15s %-4s  %s\n", check.name, status, check.description)
+	}
+	if cfg.Liveness.CrossCheck {
+		fmt.Println("    (cross_check needs both cameras and only runs during authentication)")
+	}
+	fmt.Println()
+
+	if !result.IsLive {
+		fmt.Printf("REJECTED: liveness detection rejected the spoof (%s).\n", result.Reason)
+		if len(caught) > 0 {
+			fmt.Printf("Caught by: %s\n", strings.Join(caught, ", "))
+		}
+		if !matched {
+			fmt.Printf("Note: the spoof did not match %s either, so recognition alone would have\n", username)
+			fmt.Println("rejected it. Use a clearer photo to be sure liveness is what stops it.")
+		}
+		logging.Infof("Spoof test for %s: rejected (score %.2f, caught by %s)", username, result.Score, strings.Join(caught, ", "))
+		return nil
+	}
+
+	fmt.Println("ACCEPTED: liveness detection did not recognize the spoof.")
+	if matched {
+		fmt.Printf("A photo of %s would unlock this account.\n", username)
+	}
+	fmt.Println("Make liveness stricter by raising liveness_detection.level. strict and paranoid")
+	fmt.Println("add the IR reflectance check, which needs an IR camera with pixel_format y16.")
+	logging.Warnf("Spoof test for %s: ACCEPTED (score %.2f, matched: %t)", username, result.Score, matched)
+	return fmt.Errorf("liveness detection accepted a spoof of %s", username)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+func cmdStorage(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required\nUsage: %s", commands["storage"].Usage)
+	}
+	switch args[0] {
+	case "repair":
+		if len(args) > 1 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(args[1:], " "))
+		}
+		return cmdStorageRepair()
+	default:
+		return fmt.Errorf("unknown storage subcommand: %s\nUsage: %s", args[0], commands["storage"].Usage)
+	}
+}
+
+// cmdStorageRepair rewrites user files saved with the other encryption
+// setting in the configured one.
+func cmdStorageRepair() error {
+	if err := initStorage(); err != nil {
+		return err
+	}
+	fileStore, ok := store.(*storage.FileStorage)
+	if !ok {
+		return fmt.Errorf("storage repair only applies to the file backend, storage.backend is %s", cfg.Storage.Backend)
+	}
+
+	// Decrypting needs the key even though encryption is now disabled
+	var key *[storage.KeySize]byte
+	if !cfg.Storage.EncryptionEnabled {
+		if k, err := storage.ResolveKey(storage.KeySource(cfg.Storage.KeySource), cfg.Storage.KeyFile); err == nil {
+			key = &k
+		} else {
+			fmt.Printf("Warning: no encryption key (%v); encrypted files cannot be repaired.\n", err)
+		}
+	}
+
+	state := "encrypted"
+	if !cfg.Storage.EncryptionEnabled {
+		state = "unencrypted"
+	}
+	report, err := fileStore.RepairEncryption(key)
+	if err != nil {
+		return fmt.Errorf("failed to repair storage: %w", err)
+	}
+
+	for _, username := range report.Repaired {
+		fmt.Printf("  %s: now %s\n", username, state)
+	}
+	skipped := make([]string, 0, len(report.Skipped))
+	for username := range report.Skipped {
+		skipped = append(skipped, username)
+	}
+	sort.Strings(skipped)
+	for _, username := range skipped {
+		fmt.Printf("  %s: skipped: %v\n", username, report.Skipped[username])
+	}
+
+	if len(report.Repaired) == 0 && len(skipped) == 0 {
+		fmt.Printf("All user files in %s are already %s.\n", cfg.Storage.DataDir, state)
+		return nil
+	}
+	fmt.Printf("Repaired %d user file(s); every repaired file is now %s.\n", len(report.Repaired), state)
+	if len(skipped) > 0 {
+		return fmt.Errorf("skipped %d user file(s): %s", len(skipped), strings.Join(skipped, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+// cmdSetTolerance sets or clears the match tolerance override of a user.
+func cmdSetTolerance(args []string) error {
+	switch {
+	case len(args) < 2 || args[0] == "":
+		return fmt.Errorf("username and tolerance required\nUsage: %s", commands["set-tolerance"].Usage)
+	case len(args) > 2:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args[2:], " "))
+	}
+	username := args[0]
+
+	var tolerance *float64
+	if args[1] != "default" {
+		value, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || value <= 0 || value > 1 {
+			return fmt.Errorf("invalid tolerance: %s (must be between 0 and 1, or 'default')", args[1])
+		}
+		tolerance = &value
+	}
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+	if !store.UserExists(username) {
+		return fmt.Errorf("user '%s' is not enrolled in %s", username, cfg.Storage.DataDir)
+	}
+
+	unchanged := false
+	err := store.UpdateUser(username, func(user *storage.UserFaceData) error {
+		if tolerance == nil && user.Tolerance == nil {
+			unchanged = true
+			return storage.ErrSkipUpdate
+		}
+		user.Tolerance = tolerance
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user %s: %w", username, err)
+	}
+	if unchanged {
+		fmt.Printf("'%s' already uses recognition.tolerance (%.2f).\n", username, cfg.Recognition.Tolerance)
+		return nil
+	}
+
+	if tolerance == nil {
+		logging.Infof("Tolerance override removed for user: %s", username)
+		fmt.Printf("'%s' uses recognition.tolerance (%.2f) again.\n", username, cfg.Recognition.Tolerance)
+		return nil
+	}
+
+	logging.Infof("Tolerance for user %s set to %.2f", username, *tolerance)
+	fmt.Printf("Tolerance for '%s' set to %.2f (recognition.tolerance is %.2f).\n", username, *tolerance, cfg.Recognition.Tolerance)
+	if *tolerance > cfg.Recognition.Tolerance {
+		fmt.Println("Warning: this is looser than the global tolerance, so other people are")
+		fmt.Printf("more likely to be accepted as '%s'.\n", username)
+	}
+	if margin := cfg.Auth.MinConfidenceMargin; margin > 0 && *tolerance <= margin {
+		fmt.Printf("Warning: auth.min_confidence_margin (%.2f) leaves no room below this\n", margin)
+		fmt.Println("tolerance; every match will be rejected.")
+	}
+	fmt.Printf("Run 'facepass test %s' to check that you are still recognized.\n", username)
+	return nil
+}
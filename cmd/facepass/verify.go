@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+func cmdVerifyEnrollment(args []string) error {
+	flags := flag.NewFlagSet("verify-enrollment", flag.ContinueOnError)
+	distance := flags.Float64("distance", recognition.DefaultIdentityDistance, "Mean distance above which groups of embeddings count as different people")
+	prune := flags.Bool("prune", false, "Remove the embeddings outside the largest group")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation before pruning")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// Allow flags after the username as well
+	username := flags.Arg(0)
+	if username != "" {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	switch {
+	case username == "":
+		return fmt.Errorf("username required\nUsage: %s", commands["verify-enrollment"].Usage)
+	case flags.NArg() > 0:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	case *distance <= 0:
+		return fmt.Errorf("--distance must be positive")
+	}
+
+	if err := initStorage(); err != nil {
+		return err
+	}
+	if !store.UserExists(username) {
+		return fmt.Errorf("user '%s' is not enrolled in %s", username, cfg.Storage.DataDir)
+	}
+	user, err := store.LoadUser(username)
+	if err != nil {
+		return fmt.Errorf("failed to load user %s: %w", username, err)
+	}
+
+	embeddings := user.Embeddings
+	if len(embeddings) < 2 {
+		fmt.Printf("%s has %d embedding(s); nothing to compare.\n", username, len(embeddings))
+		return nil
+	}
+	if cfg.Recognition.NormalizeEmbeddings {
+		embeddings = make([]recognition.Embedding, len(user.Embeddings))
+		for i, e := range user.Embeddings {
+			embeddings[i] = recognition.NormalizeEmbedding(e)
+		}
+	}
+
+	clusters := recognition.ClusterEmbeddings(embeddings, *distance)
+	fmt.Printf("%s: %d embeddings in %d group(s) at distance %.2f (numbered as in 'facepass stats')\n",
+		username, len(embeddings), len(clusters), *distance)
+	for k, cluster := range clusters {
+		fmt.Printf("  Group %d: %d embedding(s): %s", k+1, len(cluster), embeddingNumbers(cluster))
+		if k > 0 {
+			fmt.Printf(" (%.2f from group 1)", recognition.ClusterDistance(embeddings, clusters[0], cluster))
+		}
+		fmt.Println()
+	}
+	if len(clusters) == 1 {
+		fmt.Println("All embeddings look like the same person.")
+		return nil
+	}
+
+	var outliers, identities []int
+	for _, cluster := range clusters[1:] {
+		outliers = append(outliers, cluster...)
+		if len(cluster) > 1 {
+			identities = append(identities, cluster...)
+		}
+	}
+	sort.Ints(outliers)
+	sort.Ints(identities)
+	ambiguous := len(clusters[1]) == len(clusters[0])
+
+	if len(identities) > 0 {
+		fmt.Printf("\nWarning: embeddings %s look like a different person than group 1.\n", embeddingNumbers(identities))
+		fmt.Println("Was someone else in front of the camera during enrollment?")
+	}
+	if singles := len(outliers) - len(identities); singles > 0 {
+		fmt.Printf("%d embedding(s) match no other group; possibly bad captures.\n", singles)
+	}
+	if ambiguous {
+		fmt.Println("The two largest groups are the same size, so it is unclear which one is the user.")
+	}
+	fmt.Printf("Outliers: %s\n", embeddingNumbers(outliers))
+
+	if *prune {
+		if ambiguous {
+			return fmt.Errorf("not pruning: cannot tell which group is %s; re-enroll instead", username)
+		}
+		if !*yes && !confirm(fmt.Sprintf("Remove %d embedding(s) outside group 1 from %s?", len(outliers), username)) {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+		// PAM may have added embeddings since the user was loaded, so
+		// remove the selected ones from the current data by fingerprint
+		selected := make([]string, len(outliers))
+		for i, idx := range outliers {
+			selected[i] = recognition.EmbeddingFingerprint(user.Embeddings[idx])
+		}
+		removed, remaining := 0, 0
+		err := store.UpdateUser(username, func(current *storage.UserFaceData) error {
+			removed = current.RemoveFingerprints(selected)
+			remaining = len(current.Embeddings)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update user %s: %w", username, err)
+		}
+		fmt.Printf("Removed %d embedding(s); %d remain.\n", removed, remaining)
+		return nil
+	}
+
+	if ambiguous {
+		fmt.Printf("Re-enroll with 'facepass remove %s' and 'facepass enroll %s --strict'.\n", username, username)
+	} else {
+		fmt.Printf("Remove them with 'facepass verify-enrollment %s --prune'.\n", username)
+	}
+	if len(identities) > 0 {
+		return fmt.Errorf("enrollment of %s appears to contain more than one person", username)
+	}
+	return nil
+}
+
+// embeddingNumbers formats zero-based embedding indexes as the one-based
+// numbers shown by 'facepass stats'.
+func embeddingNumbers(indexes []int) string {
+	numbers := make([]string, len(indexes))
+	for i, idx := range indexes {
+		numbers[i] = strconv.Itoa(idx + 1)
+	}
+	return strings.Join(numbers, ", ")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/MrCodeEU/facepass/pkg/config"
+)
+
+// Build metadata, set at link time by the Makefile:
+//
+//	go build -ldflags "-X main.version=0.2.1 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=..."
+//
+// commit and buildDate fall back to the VCS information Go embeds when
+// building from a git checkout.
+var (
+	version   = "0.2.0"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo describes the running binary for bug reports.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+	LowPower  bool   `json:"low_power_defaults"` // lighter defaults for ARM or few CPUs
+}
+
+// getBuildInfo collects the build metadata of the running binary.
+func getBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		LowPower:  config.LowPowerDefaults(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+func cmdVersion(args []string) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print the build information as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	info := getBuildInfo()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	commit := info.Commit
+	if info.Modified {
+		commit += " (modified)"
+	}
+	fmt.Printf("FacePass v%s\n", info.Version)
+	fmt.Println("Face Recognition Authentication for Linux")
+	fmt.Println()
+	fmt.Println("Build Information:")
+	fmt.Printf("  Commit:     %s\n", commit)
+	fmt.Printf("  Built:      %s\n", info.BuildDate)
+	fmt.Printf("  Go version: %s\n", info.GoVersion)
+	fmt.Printf("  Platform:   %s (%d CPUs)\n", info.Platform, runtime.NumCPU())
+	if info.LowPower {
+		fmt.Println("  Defaults:   low-power (smaller capture resolution, fewer frames)")
+	}
+	fmt.Println()
+	fmt.Println("Components:")
+	fmt.Println("  - Face Recognition: dlib/go-face")
+	fmt.Println("  - Encryption: NaCl secretbox")
+	fmt.Println("  - Camera: V4L2")
+	return nil
+}
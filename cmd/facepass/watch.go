@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/metrics"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+func cmdWatch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	username := flags.String("user", "", "User to watch for (required)")
+	onMatch := flags.String("on-match", "", "Shell command run when the user appears")
+	debounce := flags.Duration("debounce", 30*time.Second, "How long the user must be gone before the command runs again")
+	interval := flags.Duration("interval", time.Second, "Pause between checks")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("--user is required\nUsage: facepass watch --user <username> [--on-match <command>]")
+	}
+	if err := storage.ValidateUsername(*username); err != nil {
+		return err
+	}
+
+	auth, err := pam.NewPAMAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+	defer auth.Close()
+
+	var observe func(pam.AuthResult)
+	if cfg.Metrics.Listen != "" {
+		recorder := metrics.NewRecorder()
+		metricsServer, err := metrics.Serve(cfg.Metrics.Listen, recorder)
+		if err != nil {
+			return err
+		}
+		defer metricsServer.Close()
+		observe = recorder.ObserveAuth
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Watching for '%s' (Ctrl+C to stop)...\n", *username)
+	return auth.Watch(ctx, *username, pam.WatchOptions{Interval: *interval, Debounce: *debounce},
+		func(result pam.AuthResult) {
+			fmt.Printf("%s  %s recognized (confidence: %.1f%%)\n",
+				time.Now().Format("15:04:05"), result.Username, result.Confidence*100)
+			if *onMatch != "" {
+				runMatchCommand(*onMatch, result.Username)
+			}
+		}, observe)
+}
+
+// runMatchCommand runs the --on-match command through the shell with
+// FACEPASS_USER set to the recognized user.
+func runMatchCommand(command, username string) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), "FACEPASS_USER="+username)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logging.Warnf("--on-match command failed: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MrCodeEU/facepass/pkg/config"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+// cmdWhere prints the config, data, model and log paths in effect for the
+// user running the command. Comparing its output under sudo and as the user
+// shows whether enrollment and authentication read the same data.
+func cmdWhere(args []string) error {
+	fmt.Printf("Effective UID:   %d\n", os.Geteuid())
+	if home, err := os.UserHomeDir(); err == nil {
+		fmt.Printf("Home directory:  %s\n", home)
+	}
+
+	fmt.Println("\nConfig files (in load order):")
+	for _, path := range configFiles {
+		fmt.Printf("  %s (%s)\n", path, pathState(path))
+	}
+
+	fmt.Println("\nStorage:")
+	fmt.Printf("  Backend:       %s\n", cfg.Storage.Backend)
+	fmt.Printf("  Data dir:      %s (%s)\n", cfg.Storage.DataDir, pathState(cfg.Storage.DataDir))
+	switch cfg.Storage.Backend {
+	case storage.BackendSQLite:
+		db := filepath.Join(cfg.Storage.DataDir, storage.SQLiteDatabaseFile)
+		fmt.Printf("  Database:      %s (%s)\n", db, pathState(db))
+	default:
+		users := filepath.Join(cfg.Storage.DataDir, "users")
+		fmt.Printf("  Users dir:     %s (%s)\n", users, pathState(users))
+	}
+	if cfg.Storage.EncryptionEnabled && cfg.Storage.KeySource == string(storage.KeySourceFile) {
+		fmt.Printf("  Key file:      %s (%s)\n", cfg.Storage.KeyFile, pathState(cfg.Storage.KeyFile))
+	}
+	if _, inHome := cfg.ResolveDataDir(); inHome {
+		fmt.Println("  Note: the data dir is inside a home directory, so other users (and PAM")
+		fmt.Printf("  running as another user) will not see it. Set storage.data_dir in\n  %s to share one directory.\n", config.SystemConfigPath)
+	}
+
+	fmt.Println("\nModels:")
+	for _, path := range cfg.Recognition.ModelPath {
+		fmt.Printf("  dlib:          %s (%s)\n", path, pathState(path))
+	}
+	fmt.Printf("  ONNX:          %s (%s)\n", cfg.Acceleration.ONNXModelPath, pathState(cfg.Acceleration.ONNXModelPath))
+
+	fmt.Println("\nLogging:")
+	switch cfg.Logging.Output {
+	case logging.OutputSyslog:
+		fmt.Printf("  Syslog:        tag %q (journalctl -t %s)\n", logging.SyslogTag, logging.SyslogTag)
+	case logging.OutputStderr:
+		fmt.Println("  Stderr only")
+	default:
+		fmt.Printf("  Log file:      %s (%s)\n", cfg.Logging.File, pathState(cfg.Logging.File))
+	}
+
+	return nil
+}
+
+// pathState describes whether path exists, for the where command.
+func pathState(path string) string {
+	if path == "" {
+		return "not set"
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "missing"
+		}
+		return err.Error()
+	}
+	return "exists"
+}
@@ -0,0 +1,39 @@
+package facepass_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/MrCodeEU/facepass"
+	"github.com/MrCodeEU/facepass/pkg/config"
+)
+
+// Enroll a user, then verify and identify them. This needs a camera and the
+// recognition models, so the example is compiled but not run.
+func ExampleClient() {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := facepass.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	err = client.Enroll("alice", func(angle string) {
+		fmt.Printf("Capturing %s angle, hold still\n", angle)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if result, err := client.Verify("alice"); err == nil {
+		fmt.Printf("Verified alice (confidence %.2f)\n", result.Confidence)
+	}
+
+	if result, err := client.Identify(); err == nil {
+		fmt.Printf("Hello, %s\n", result.Username)
+	}
+}
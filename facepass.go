@@ -0,0 +1,140 @@
+// Package facepass wires the camera, recognition, liveness, storage and pam
+// packages together behind a single Client for applications that embed
+// face authentication.
+package facepass
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/config"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+// EnrollmentAngles are the head poses captured by Enroll, in order.
+var EnrollmentAngles = []string{"front", "left", "right", "up", "down"}
+
+// MinEnrollmentAngles is the number of angles Enroll must capture.
+const MinEnrollmentAngles = 3
+
+// ErrEnrollmentIncomplete is returned by Enroll if too few angles were
+// captured.
+var ErrEnrollmentIncomplete = errors.New("enrollment incomplete")
+
+// authenticator is the part of pam.PAMAuthenticator used by Client.
+type authenticator interface {
+	Authenticate(username string) pam.AuthResult
+	Identify(usernames []string) pam.AuthResult
+	CaptureEmbedding(angle string) (*recognition.Embedding, error)
+	CameraCapabilities() camera.CameraCapabilities
+	Close()
+}
+
+// Client enrolls, verifies and identifies users with the camera and models
+// selected by a configuration. It is not safe for concurrent use.
+type Client struct {
+	auth  authenticator
+	store storage.Backend
+}
+
+// New opens the storage, recognition models and camera configured in cfg.
+// Call Close to release them.
+func New(cfg *config.Config) (*Client, error) {
+	store, err := storage.NewBackend(storage.Options{
+		Backend:           cfg.Storage.Backend,
+		DataDir:           cfg.Storage.DataDir,
+		EncryptionEnabled: cfg.Storage.EncryptionEnabled,
+		KeySource:         storage.KeySource(cfg.Storage.KeySource),
+		KeyFile:           cfg.Storage.KeyFile,
+		Compress:          cfg.Storage.Compress,
+		LastUsedInterval:  time.Duration(cfg.Storage.LastUsedInterval) * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	auth, err := pam.NewPAMAuthenticator(cfg)
+	if err != nil {
+		closeStore(store)
+		return nil, err
+	}
+	return &Client{auth: auth, store: store}, nil
+}
+
+// Close releases the camera, models and storage.
+func (c *Client) Close() error {
+	c.auth.Close()
+	closeStore(c.store)
+	return nil
+}
+
+// Enroll captures a face for each of EnrollmentAngles and enrolls username.
+// prompt, if not nil, is called before each capture so the application can
+// ask the user to turn their head. Angles without a usable face are skipped;
+// ErrEnrollmentIncomplete is returned if fewer than MinEnrollmentAngles
+// remain.
+func (c *Client) Enroll(username string, prompt func(angle string)) error {
+	if err := storage.ValidateUsername(username); err != nil {
+		return err
+	}
+	if c.store.UserExists(username) {
+		return fmt.Errorf("%w: %s", storage.ErrUserExists, username)
+	}
+
+	embeddings := make([]recognition.Embedding, 0, len(EnrollmentAngles))
+	for _, angle := range EnrollmentAngles {
+		if prompt != nil {
+			prompt(angle)
+		}
+		embedding, err := c.auth.CaptureEmbedding(angle)
+		if err != nil {
+			logging.Warnf("Skipping angle %s: %v", angle, err)
+			continue
+		}
+		embeddings = append(embeddings, *embedding)
+	}
+
+	if len(embeddings) < MinEnrollmentAngles {
+		return fmt.Errorf("%w: only %d angles captured (minimum %d required)",
+			ErrEnrollmentIncomplete, len(embeddings), MinEnrollmentAngles)
+	}
+	return c.store.CreateUser(username, embeddings, map[string]string{"enrolled_by": "library"})
+}
+
+// Verify checks that username is in front of the camera, including the
+// configured liveness checks. A failed verification returns the result
+// together with its *pam.AuthError.
+func (c *Client) Verify(username string) (*pam.AuthResult, error) {
+	result := c.auth.Authenticate(username)
+	return &result, result.Error
+}
+
+// Identify finds which enrolled user is in front of the camera. On success
+// the result's Username is the matched user.
+func (c *Client) Identify() (*pam.AuthResult, error) {
+	usernames, err := c.store.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	result := c.auth.Identify(usernames)
+	return &result, result.Error
+}
+
+// CameraCapabilities reports the IR emitter and format support of the
+// camera.
+func (c *Client) CameraCapabilities() camera.CameraCapabilities {
+	return c.auth.CameraCapabilities()
+}
+
+// closeStore closes storage backends that hold resources, such as SQLite.
+func closeStore(store storage.Backend) {
+	if closer, ok := store.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
@@ -0,0 +1,113 @@
+package facepass
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+type fakeAuthenticator struct {
+	failAngles map[string]bool
+	result     pam.AuthResult
+	identified []string
+	closed     bool
+}
+
+func (f *fakeAuthenticator) Authenticate(username string) pam.AuthResult {
+	result := f.result
+	result.Username = username
+	return result
+}
+
+func (f *fakeAuthenticator) Identify(usernames []string) pam.AuthResult {
+	f.identified = usernames
+	return f.result
+}
+
+func (f *fakeAuthenticator) CaptureEmbedding(angle string) (*recognition.Embedding, error) {
+	if f.failAngles[angle] {
+		return nil, recognition.ErrNoFaceDetected
+	}
+	return &recognition.Embedding{Vector: recognition.Descriptor{1}, Angle: angle}, nil
+}
+
+func (f *fakeAuthenticator) CameraCapabilities() camera.CameraCapabilities {
+	return camera.CameraCapabilities{}
+}
+
+func (f *fakeAuthenticator) Close() { f.closed = true }
+
+func newTestClient(t *testing.T, auth *fakeAuthenticator) *Client {
+	t.Helper()
+	store, err := storage.NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{auth: auth, store: store}
+}
+
+func TestClient_Enroll(t *testing.T) {
+	auth := &fakeAuthenticator{failAngles: map[string]bool{"up": true}}
+	client := newTestClient(t, auth)
+
+	var prompted []string
+	if err := client.Enroll("alice", func(angle string) { prompted = append(prompted, angle) }); err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if len(prompted) != len(EnrollmentAngles) {
+		t.Errorf("prompted for %v, want %v", prompted, EnrollmentAngles)
+	}
+	user, err := client.store.LoadUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Embeddings) != 4 {
+		t.Errorf("enrolled %d embeddings, want 4 (up failed)", len(user.Embeddings))
+	}
+
+	if err := client.Enroll("alice", nil); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("Enroll() of an enrolled user error = %v, want ErrUserExists", err)
+	}
+
+	auth.failAngles = map[string]bool{"front": true, "left": true, "right": true}
+	if err := client.Enroll("bob", nil); !errors.Is(err, ErrEnrollmentIncomplete) {
+		t.Errorf("Enroll() with 2 angles error = %v, want ErrEnrollmentIncomplete", err)
+	}
+	if client.store.UserExists("bob") {
+		t.Error("incomplete enrollment should not be saved")
+	}
+}
+
+func TestClient_VerifyAndIdentify(t *testing.T) {
+	auth := &fakeAuthenticator{result: pam.AuthResult{Success: true, Confidence: 0.7}}
+	client := newTestClient(t, auth)
+	if err := client.Enroll("alice", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Verify("alice")
+	if err != nil || !result.Success || result.Username != "alice" {
+		t.Errorf("Verify() = %+v, %v", result, err)
+	}
+
+	if _, err := client.Identify(); err != nil {
+		t.Errorf("Identify() error = %v", err)
+	}
+	if len(auth.identified) != 1 || auth.identified[0] != "alice" {
+		t.Errorf("Identify() searched %v, want [alice]", auth.identified)
+	}
+
+	auth.result = pam.AuthResult{Error: pam.NewAuthError(pam.ErrCodeLiveness, false)}
+	var authErr *pam.AuthError
+	if _, err := client.Verify("alice"); !errors.As(err, &authErr) || authErr.Code != pam.ErrCodeLiveness {
+		t.Errorf("Verify() error = %v, want %s", err, pam.ErrCodeLiveness)
+	}
+
+	if err := client.Close(); err != nil || !auth.closed {
+		t.Errorf("Close() = %v, closed = %v", err, auth.closed)
+	}
+}
@@ -4,18 +4,26 @@
 package acceleration
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/MrCodeEU/facepass/pkg/logging"
 )
 
+// execCommand allows mocking exec.Command for testing
+var execCommand = exec.Command
+
 // Backend represents an acceleration backend type.
 type Backend string
 
@@ -50,9 +58,20 @@ type BackendInfo struct {
 	Available   bool
 	Tested      bool // Whether this backend has been tested by maintainers
 	Version     string
-	DeviceName  string
+	DeviceName  string // Name of the device selected by the device index
 	DeviceCount int
-	Warning     string // Warning message for untested backends
+	Devices     []string // Names of all detected devices, if known
+	Warning     string   // Warning message for untested backends
+}
+
+// HasDevice reports whether the backend can run on the device with the
+// given index. Device 0 is always accepted because detection cannot count
+// devices on every system; the CPU backend ignores the index.
+func (info *BackendInfo) HasDevice(index int) bool {
+	if info.Backend == BackendCPU || index == 0 {
+		return true
+	}
+	return index > 0 && index < info.DeviceCount
 }
 
 // Config holds acceleration configuration.
@@ -111,6 +130,15 @@ func (m *Manager) Initialize(cfg Config) error {
 	// Detect available backends
 	m.detectBackends()
 
+	// A GPU that is present but lacks the requested device is an error
+	// unless falling back to the CPU is allowed
+	if info, ok := m.availableBackends[cfg.PreferredBackend]; ok && info.Available && !info.HasDevice(cfg.DeviceIndex) {
+		if !cfg.FallbackToCPU {
+			return fmt.Errorf("%w: %s has no device %d (found %d)", ErrBackendNotAvailable, info.Name, cfg.DeviceIndex, info.DeviceCount)
+		}
+		logging.Warnf("%s has no device %d (found %d), falling back to CPU", info.Name, cfg.DeviceIndex, info.DeviceCount)
+	}
+
 	// Select the best backend
 	backend := m.selectBackend(cfg.PreferredBackend)
 	m.activeBackend = backend
@@ -141,12 +169,12 @@ func (m *Manager) detectBackends() {
 	}
 
 	// Detect ROCm (AMD)
-	if rocmInfo := detectROCm(); rocmInfo != nil {
+	if rocmInfo := detectROCm(m.config.DeviceIndex); rocmInfo != nil {
 		m.availableBackends[BackendROCm] = rocmInfo
 	}
 
 	// Detect CUDA (NVIDIA)
-	if cudaInfo := detectCUDA(); cudaInfo != nil {
+	if cudaInfo := detectCUDA(m.config.DeviceIndex); cudaInfo != nil {
 		m.availableBackends[BackendCUDA] = cudaInfo
 	}
 
@@ -156,11 +184,12 @@ func (m *Manager) detectBackends() {
 	}
 }
 
-// selectBackend selects the best available backend.
+// selectBackend selects the best available backend that has the configured
+// device.
 func (m *Manager) selectBackend(preferred Backend) Backend {
 	// If specific backend requested, try to use it
 	if preferred != BackendAuto {
-		if info, ok := m.availableBackends[preferred]; ok && info.Available {
+		if info, ok := m.availableBackends[preferred]; ok && info.Available && info.HasDevice(m.config.DeviceIndex) {
 			return preferred
 		}
 		if m.config.FallbackToCPU {
@@ -175,7 +204,7 @@ func (m *Manager) selectBackend(preferred Backend) Backend {
 	priorities := []Backend{BackendROCm, BackendCUDA, BackendOpenVINO, BackendCPU}
 
 	for _, backend := range priorities {
-		if info, ok := m.availableBackends[backend]; ok && info.Available {
+		if info, ok := m.availableBackends[backend]; ok && info.Available && info.HasDevice(m.config.DeviceIndex) {
 			return backend
 		}
 	}
@@ -216,8 +245,9 @@ func (m *Manager) IsAccelerated() bool {
 	return m.activeBackend != BackendCPU
 }
 
-// detectROCm detects AMD ROCm availability.
-func detectROCm() *BackendInfo {
+// detectROCm detects AMD ROCm availability. DeviceName describes the device
+// with the given index.
+func detectROCm(deviceIndex int) *BackendInfo {
 	info := &BackendInfo{
 		Backend:   BackendROCm,
 		Name:      "AMD ROCm",
@@ -236,26 +266,23 @@ func detectROCm() *BackendInfo {
 		return nil
 	}
 
-	// Check for rocm-smi to get device info
-	cmd := exec.Command("rocm-smi", "--showproductname")
-	output, err := cmd.Output()
-	if err != nil {
-		// Try alternative detection
-		cmd = exec.Command("rocminfo")
-		output, err = cmd.Output()
+	// Get the device list from rocm-smi, or rocminfo on older installs
+	var devices []string
+	output, err := execCommand("rocm-smi", "--showproductname", "--json").Output()
+	if err == nil {
+		devices, err = parseROCmSMI(output)
 		if err != nil {
-			return nil
+			logging.Debugf("Failed to parse rocm-smi output: %v", err)
 		}
 	}
-
-	// Parse device info
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "GPU") || strings.Contains(line, "gfx") {
-			info.DeviceName = strings.TrimSpace(line)
-			info.DeviceCount++
+	if len(devices) == 0 {
+		output, infoErr := execCommand("rocminfo").Output()
+		if infoErr != nil && err != nil {
+			return nil
 		}
+		devices = parseROCmInfo(output)
 	}
+	setDevices(info, devices, deviceIndex)
 
 	if info.DeviceCount == 0 {
 		// Check for any AMD GPU via /sys
@@ -279,6 +306,114 @@ func detectROCm() *BackendInfo {
 	return info
 }
 
+// setDevices stores the detected device names and selects the name of the
+// device with the given index.
+func setDevices(info *BackendInfo, devices []string, deviceIndex int) {
+	info.Devices = devices
+	info.DeviceCount = len(devices)
+	if deviceIndex >= 0 && deviceIndex < len(devices) {
+		info.DeviceName = devices[deviceIndex]
+	}
+}
+
+// rocmCardKey matches the per-GPU keys ("card0", "card1", ...) of rocm-smi
+// JSON output.
+var rocmCardKey = regexp.MustCompile(`^card(\d+)$`)
+
+// parseROCmSMI parses the output of 'rocm-smi --showproductname --json' and
+// returns the product names ordered by card index. Key capitalization
+// differs between ROCm releases ("Card series" vs "Card Series").
+func parseROCmSMI(output []byte) ([]string, error) {
+	// rocm-smi may print warnings before the JSON document
+	start := bytes.IndexByte(output, '{')
+	if start < 0 {
+		return nil, errors.New("no JSON object in rocm-smi output")
+	}
+
+	var cards map[string]map[string]string
+	if err := json.Unmarshal(output[start:], &cards); err != nil {
+		return nil, err
+	}
+
+	type card struct {
+		index int
+		name  string
+	}
+	var found []card
+	for key, fields := range cards {
+		m := rocmCardKey.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(m[1])
+		found = append(found, card{index: index, name: rocmProductName(fields)})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].index < found[j].index })
+
+	devices := make([]string, 0, len(found))
+	for _, c := range found {
+		devices = append(devices, c.name)
+	}
+	return devices, nil
+}
+
+// rocmProductName picks the most descriptive name from a rocm-smi card entry.
+func rocmProductName(fields map[string]string) string {
+	for _, key := range []string{"card series", "card model", "gfx version"} {
+		for k, v := range fields {
+			if strings.EqualFold(k, key) && strings.TrimSpace(v) != "" {
+				return strings.TrimSpace(v)
+			}
+		}
+	}
+	return "AMD GPU"
+}
+
+// parseROCmInfo parses rocminfo output and returns the names of the GPU
+// agents in order. CPU agents are skipped.
+func parseROCmInfo(output []byte) []string {
+	var devices []string
+	var name, marketingName, deviceType string
+
+	flush := func() {
+		if deviceType == "GPU" {
+			if marketingName != "" {
+				devices = append(devices, marketingName)
+			} else {
+				devices = append(devices, name)
+			}
+		}
+		name, marketingName, deviceType = "", "", ""
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Agent ") {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Name":
+			// Only the first Name belongs to the agent; pools and ISAs have their own
+			if name == "" {
+				name = value
+			}
+		case "Marketing Name":
+			marketingName = value
+		case "Device Type":
+			deviceType = value
+		}
+	}
+	flush()
+
+	return devices
+}
+
 // getROCmVersion gets the ROCm version.
 func getROCmVersion(rocmPath string) string {
 	versionFile := filepath.Join(rocmPath, ".info", "version")
@@ -295,8 +430,9 @@ func getROCmVersion(rocmPath string) string {
 	return "unknown"
 }
 
-// detectCUDA detects NVIDIA CUDA availability.
-func detectCUDA() *BackendInfo {
+// detectCUDA detects NVIDIA CUDA availability. DeviceName and Version
+// describe the device with the given index.
+func detectCUDA(deviceIndex int) *BackendInfo {
 	info := &BackendInfo{
 		Backend:   BackendCUDA,
 		Name:      "NVIDIA CUDA",
@@ -306,26 +442,69 @@ func detectCUDA() *BackendInfo {
 	}
 
 	// Check for nvidia-smi
-	cmd := exec.Command("nvidia-smi", "--query-gpu=name,driver_version", "--format=csv,noheader")
+	cmd := execCommand("nvidia-smi", "--query-gpu=index,name,driver_version", "--format=csv,noheader")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(lines) > 0 && lines[0] != "" {
-		parts := strings.Split(lines[0], ",")
-		if len(parts) >= 1 {
-			info.DeviceName = strings.TrimSpace(parts[0])
+	gpus := parseNvidiaSMI(output)
+	if len(gpus) == 0 {
+		return info
+	}
+
+	names := make([]string, len(gpus))
+	for i, gpu := range gpus {
+		names[i] = gpu.name
+	}
+	setDevices(info, names, deviceIndex)
+
+	info.Version = gpus[0].driverVersion
+	if deviceIndex >= 0 && deviceIndex < len(gpus) {
+		info.Version = gpus[deviceIndex].driverVersion
+	}
+	info.Available = true
+
+	return info
+}
+
+// nvidiaGPU is one row of nvidia-smi output.
+type nvidiaGPU struct {
+	name          string
+	driverVersion string
+}
+
+// parseNvidiaSMI parses the output of
+// 'nvidia-smi --query-gpu=index,name,driver_version --format=csv,noheader'
+// and returns the GPUs ordered by index. Malformed rows are skipped.
+func parseNvidiaSMI(output []byte) []nvidiaGPU {
+	type row struct {
+		index int
+		gpu   nvidiaGPU
+	}
+	var rows []row
+
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.Split(line, ",")
+		if len(parts) != 3 {
+			continue
 		}
-		if len(parts) >= 2 {
-			info.Version = strings.TrimSpace(parts[1])
+		index, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			continue
 		}
-		info.DeviceCount = len(lines)
-		info.Available = true
+		rows = append(rows, row{index: index, gpu: nvidiaGPU{
+			name:          strings.TrimSpace(parts[1]),
+			driverVersion: strings.TrimSpace(parts[2]),
+		}})
 	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].index < rows[j].index })
 
-	return info
+	gpus := make([]nvidiaGPU, len(rows))
+	for i, r := range rows {
+		gpus[i] = r.gpu
+	}
+	return gpus
 }
 
 // detectOpenVINO detects Intel OpenVINO availability.
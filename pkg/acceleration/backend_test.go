@@ -1,9 +1,45 @@
 package acceleration
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
+// fakeCommands makes execCommand run TestHelperProcess, which prints the
+// given output for each command name and fails for any other command.
+func fakeCommands(t *testing.T, outputs map[string]string) {
+	t.Helper()
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcess", "--", command}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		if output, ok := outputs[command]; ok {
+			cmd.Env = append(cmd.Env, "HELPER_OUTPUT="+output)
+		}
+		return cmd
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+}
+
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	output, ok := os.LookupEnv("HELPER_OUTPUT")
+	if !ok {
+		fmt.Fprintln(os.Stderr, "command not found")
+		os.Exit(1)
+	}
+	fmt.Print(output)
+	os.Exit(0)
+}
+
 func TestDefaultConfig(t *testing.T) {
 	cfg := DefaultConfig()
 
@@ -112,11 +148,12 @@ func TestManager_GetAllBackends(t *testing.T) {
 
 func TestManager_selectBackend(t *testing.T) {
 	tests := []struct {
-		name      string
-		preferred Backend
-		available map[Backend]*BackendInfo
-		fallback  bool
-		expected  Backend
+		name        string
+		preferred   Backend
+		available   map[Backend]*BackendInfo
+		fallback    bool
+		deviceIndex int
+		expected    Backend
 	}{
 		{
 			name:      "auto with only CPU",
@@ -165,6 +202,40 @@ func TestManager_selectBackend(t *testing.T) {
 			fallback: false,
 			expected: BackendCPU,
 		},
+		{
+			name:      "specific backend with second device",
+			preferred: BackendROCm,
+			available: map[Backend]*BackendInfo{
+				BackendCPU:  {Backend: BackendCPU, Available: true},
+				BackendROCm: {Backend: BackendROCm, Available: true, DeviceCount: 2},
+			},
+			fallback:    true,
+			deviceIndex: 1,
+			expected:    BackendROCm,
+		},
+		{
+			name:      "specific backend device index out of range",
+			preferred: BackendROCm,
+			available: map[Backend]*BackendInfo{
+				BackendCPU:  {Backend: BackendCPU, Available: true},
+				BackendROCm: {Backend: BackendROCm, Available: true, DeviceCount: 1},
+			},
+			fallback:    true,
+			deviceIndex: 1,
+			expected:    BackendCPU,
+		},
+		{
+			name:      "auto skips backends without the device",
+			preferred: BackendAuto,
+			available: map[Backend]*BackendInfo{
+				BackendCPU:  {Backend: BackendCPU, Available: true},
+				BackendROCm: {Backend: BackendROCm, Available: true, DeviceCount: 1},
+				BackendCUDA: {Backend: BackendCUDA, Available: true, DeviceCount: 2},
+			},
+			fallback:    true,
+			deviceIndex: 1,
+			expected:    BackendCUDA,
+		},
 	}
 
 	for _, tt := range tests {
@@ -173,6 +244,7 @@ func TestManager_selectBackend(t *testing.T) {
 				availableBackends: tt.available,
 				config: Config{
 					FallbackToCPU: tt.fallback,
+					DeviceIndex:   tt.deviceIndex,
 				},
 			}
 			result := manager.selectBackend(tt.preferred)
@@ -183,6 +255,30 @@ func TestManager_selectBackend(t *testing.T) {
 	}
 }
 
+func TestBackendInfo_HasDevice(t *testing.T) {
+	tests := []struct {
+		name  string
+		info  BackendInfo
+		index int
+		want  bool
+	}{
+		{"first device", BackendInfo{Backend: BackendROCm, DeviceCount: 1}, 0, true},
+		{"first device not counted", BackendInfo{Backend: BackendOpenVINO}, 0, true},
+		{"second device", BackendInfo{Backend: BackendROCm, DeviceCount: 2}, 1, true},
+		{"out of range", BackendInfo{Backend: BackendCUDA, DeviceCount: 2}, 2, false},
+		{"negative", BackendInfo{Backend: BackendCUDA, DeviceCount: 2}, -1, false},
+		{"CPU ignores index", BackendInfo{Backend: BackendCPU, DeviceCount: 1}, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.HasDevice(tt.index); got != tt.want {
+				t.Errorf("HasDevice(%d) = %v, want %v", tt.index, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestBackendInfo(t *testing.T) {
 	info := &BackendInfo{
 		Backend:     BackendROCm,
@@ -206,6 +302,125 @@ func TestBackendInfo(t *testing.T) {
 	}
 }
 
+// Sample output of 'rocm-smi --showproductname --json' (ROCm 6.x) on a
+// single GPU system. The text output of the same command has several header
+// lines mentioning "GPU".
+const rocmSMISingleGPU = `{"card0": {"Card Series": "Navi 31 [Radeon RX 7900 XT/7900 XTX]", "Card Model": "0x744c", "Card Vendor": "Advanced Micro Devices, Inc. [AMD/ATI]", "Card SKU": "EXT94393", "Subsystem ID": "0x5304", "Device Rev": "0xc8", "Node ID": "1", "GUID": "45068", "GFX Version": "gfx1100"}}`
+
+// Sample output of ROCm 5.x with two GPUs and a warning printed before the
+// JSON. Older releases use lower-case field names.
+const rocmSMITwoGPUs = `WARNING: AMD GPU device(s) is/are in a low-power state. Check power control/runtime_status
+
+{"card1": {"Card series": "Navi 21 [Radeon RX 6800/6800 XT / 6900 XT]", "Card model": "0x73bf", "Card vendor": "Advanced Micro Devices, Inc. [AMD/ATI]", "Card SKU": "D41205"}, "card0": {"Card series": "Raphael", "Card model": "0x164e", "Card vendor": "Advanced Micro Devices, Inc. [AMD/ATI]", "Card SKU": "RAPHAEL"}, "system": {"Driver version": "6.2.4"}}`
+
+func TestParseROCmSMI(t *testing.T) {
+	devices, err := parseROCmSMI([]byte(rocmSMISingleGPU))
+	if err != nil {
+		t.Fatalf("parseROCmSMI failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0] != "Navi 31 [Radeon RX 7900 XT/7900 XTX]" {
+		t.Errorf("unexpected devices: %q", devices)
+	}
+
+	devices, err = parseROCmSMI([]byte(rocmSMITwoGPUs))
+	if err != nil {
+		t.Fatalf("parseROCmSMI failed: %v", err)
+	}
+	want := []string{"Raphael", "Navi 21 [Radeon RX 6800/6800 XT / 6900 XT]"}
+	if len(devices) != len(want) || devices[0] != want[0] || devices[1] != want[1] {
+		t.Errorf("expected %q, got %q", want, devices)
+	}
+
+	if _, err := parseROCmSMI([]byte("ERROR: rocm-smi not supported")); err == nil {
+		t.Error("expected error for output without JSON")
+	}
+}
+
+// Sample rocminfo output (shortened): one CPU agent and one GPU agent.
+const rocmInfoOutput = `ROCk module is loaded
+=====================
+HSA System Attributes
+=====================
+Runtime Version:         1.1
+System Timestamp Freq.:  1000.000000MHz
+
+==========
+HSA Agents
+==========
+*******
+Agent 1
+*******
+  Name:                    AMD Ryzen 9 7950X 16-Core Processor
+  Uuid:                    CPU-XX
+  Marketing Name:          AMD Ryzen 9 7950X 16-Core Processor
+  Vendor Name:             CPU
+  Device Type:             CPU
+*******
+Agent 2
+*******
+  Name:                    gfx1100
+  Uuid:                    GPU-8a2f4c1d2e3b4a5c
+  Marketing Name:          Radeon RX 7900 XTX
+  Vendor Name:             AMD
+  Device Type:             GPU
+  Pool Info:
+    Pool 1
+      Segment:                 GLOBAL; FLAGS: COARSE GRAINED
+  ISA Info:
+    ISA 1
+      Name:                    amdgcn-amd-amdhsa--gfx1100
+*** Done ***
+`
+
+func TestParseROCmInfo(t *testing.T) {
+	devices := parseROCmInfo([]byte(rocmInfoOutput))
+	if len(devices) != 1 || devices[0] != "Radeon RX 7900 XTX" {
+		t.Errorf("unexpected devices: %q", devices)
+	}
+
+	if devices := parseROCmInfo(nil); len(devices) != 0 {
+		t.Errorf("expected no devices, got %q", devices)
+	}
+}
+
+// Sample output of 'nvidia-smi --query-gpu=index,name,driver_version --format=csv,noheader'.
+const nvidiaSMIOutput = `0, NVIDIA GeForce RTX 4090, 550.54.14
+1, NVIDIA RTX A4000, 550.54.14
+`
+
+func TestParseNvidiaSMI(t *testing.T) {
+	gpus := parseNvidiaSMI([]byte(nvidiaSMIOutput))
+	if len(gpus) != 2 {
+		t.Fatalf("expected 2 GPUs, got %d", len(gpus))
+	}
+	if gpus[0].name != "NVIDIA GeForce RTX 4090" || gpus[1].name != "NVIDIA RTX A4000" {
+		t.Errorf("unexpected names: %+v", gpus)
+	}
+	if gpus[1].driverVersion != "550.54.14" {
+		t.Errorf("unexpected driver version: %q", gpus[1].driverVersion)
+	}
+
+	// Errors printed by nvidia-smi are not GPUs
+	gpus = parseNvidiaSMI([]byte("NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver.\n"))
+	if len(gpus) != 0 {
+		t.Errorf("expected no GPUs, got %+v", gpus)
+	}
+}
+
+func TestSetDevices(t *testing.T) {
+	info := &BackendInfo{}
+	setDevices(info, []string{"GPU A", "GPU B"}, 1)
+	if info.DeviceCount != 2 || info.DeviceName != "GPU B" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	info = &BackendInfo{}
+	setDevices(info, []string{"GPU A"}, 3)
+	if info.DeviceCount != 1 || info.DeviceName != "" {
+		t.Errorf("out of range index should not select a device: %+v", info)
+	}
+}
+
 func TestGetCPUName(t *testing.T) {
 	name := getCPUName()
 	// Should return something, even if "Unknown CPU"
@@ -216,19 +431,114 @@ func TestGetCPUName(t *testing.T) {
 
 func TestDetectIREmitter_Unavailable(t *testing.T) {
 	// This test just ensures the detection functions don't panic
-	// Actual detection depends on hardware
+	// when no vendor tools are installed
+	fakeCommands(t, nil)
 
 	// These should return nil or non-nil based on system
-	rocmInfo := detectROCm()
+	rocmInfo := detectROCm(0)
 	_ = rocmInfo // May be nil on non-ROCm systems
 
-	cudaInfo := detectCUDA()
+	cudaInfo := detectCUDA(0)
 	_ = cudaInfo // May be nil on non-CUDA systems
 
 	openvinoInfo := detectOpenVINO()
 	_ = openvinoInfo // May be nil on non-OpenVINO systems
 }
 
+// fakeROCmInstall points ROCM_PATH at a temporary installation.
+func fakeROCmInstall(t *testing.T, version string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".info"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".info", "version"), []byte(version+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ROCM_PATH", dir)
+}
+
+func TestDetectROCm(t *testing.T) {
+	fakeROCmInstall(t, "6.0.2")
+
+	fakeCommands(t, map[string]string{"rocm-smi": rocmSMITwoGPUs})
+	info := detectROCm(1)
+	if info == nil || !info.Available {
+		t.Fatalf("expected ROCm to be available, got %+v", info)
+	}
+	if info.DeviceCount != 2 || info.DeviceName != "Navi 21 [Radeon RX 6800/6800 XT / 6900 XT]" {
+		t.Errorf("unexpected devices: %+v", info)
+	}
+	if info.Version != "6.0.2" {
+		t.Errorf("expected version 6.0.2, got %q", info.Version)
+	}
+
+	// Older installs without rocm-smi JSON support fall back to rocminfo
+	fakeCommands(t, map[string]string{"rocminfo": rocmInfoOutput})
+	info = detectROCm(0)
+	if info == nil || info.DeviceCount != 1 || info.DeviceName != "Radeon RX 7900 XTX" {
+		t.Errorf("unexpected rocminfo detection: %+v", info)
+	}
+
+	fakeCommands(t, nil)
+	if info := detectROCm(0); info != nil {
+		t.Errorf("expected nil without ROCm tools, got %+v", info)
+	}
+}
+
+func TestDetectROCm_NotInstalled(t *testing.T) {
+	t.Setenv("ROCM_PATH", filepath.Join(t.TempDir(), "missing"))
+	fakeCommands(t, map[string]string{"rocm-smi": rocmSMISingleGPU})
+
+	if info := detectROCm(0); info != nil {
+		t.Errorf("expected nil without ROCm installation, got %+v", info)
+	}
+}
+
+func TestDetectCUDA(t *testing.T) {
+	fakeCommands(t, map[string]string{"nvidia-smi": nvidiaSMIOutput})
+	info := detectCUDA(1)
+	if info == nil || !info.Available {
+		t.Fatalf("expected CUDA to be available, got %+v", info)
+	}
+	if info.DeviceCount != 2 || info.DeviceName != "NVIDIA RTX A4000" || info.Version != "550.54.14" {
+		t.Errorf("unexpected devices: %+v", info)
+	}
+	if info.Warning == "" {
+		t.Error("expected untested backend warning")
+	}
+
+	fakeCommands(t, nil)
+	if info := detectCUDA(0); info != nil {
+		t.Errorf("expected nil without nvidia-smi, got %+v", info)
+	}
+}
+
+func TestManager_InitializeDeviceIndex(t *testing.T) {
+	fakeCommands(t, map[string]string{"nvidia-smi": nvidiaSMIOutput})
+	t.Setenv("ROCM_PATH", filepath.Join(t.TempDir(), "missing"))
+
+	manager := &Manager{availableBackends: make(map[Backend]*BackendInfo)}
+	if err := manager.Initialize(Config{PreferredBackend: BackendCUDA, DeviceIndex: 1}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if manager.GetActiveBackend() != BackendCUDA {
+		t.Errorf("expected CUDA, got %s", manager.GetActiveBackend())
+	}
+
+	err := manager.Initialize(Config{PreferredBackend: BackendCUDA, DeviceIndex: 2})
+	if !errors.Is(err, ErrBackendNotAvailable) {
+		t.Errorf("expected ErrBackendNotAvailable, got %v", err)
+	}
+
+	if err := manager.Initialize(Config{PreferredBackend: BackendCUDA, DeviceIndex: 2, FallbackToCPU: true}); err != nil {
+		t.Fatalf("Initialize with fallback failed: %v", err)
+	}
+	if manager.GetActiveBackend() != BackendCPU {
+		t.Errorf("expected CPU fallback, got %s", manager.GetActiveBackend())
+	}
+}
+
 func TestBackendConstants(t *testing.T) {
 	// Verify backend constants are distinct
 	backends := []Backend{
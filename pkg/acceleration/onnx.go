@@ -2,7 +2,8 @@
 // This file provides ONNX Runtime integration for accelerated face recognition.
 //
 // IMPORTANT: This requires onnxruntime-go bindings and ONNX Runtime libraries.
-// Build tags are used to conditionally compile acceleration support.
+// Inference is only compiled in with the "onnx" build tag; without it
+// NewONNXEngine returns ErrONNXUnavailable.
 package acceleration
 
 import (
@@ -10,24 +11,41 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/MrCodeEU/facepass/pkg/logging"
 )
 
 // ONNXEngine provides accelerated inference using ONNX Runtime.
-// This is a placeholder for the actual ONNX Runtime integration.
-// The actual implementation requires CGO bindings to ONNX Runtime.
+// Embedding extraction runs on the CPU; detection and landmarks are not
+// implemented yet.
 type ONNXEngine struct {
 	backend     Backend
 	modelPath   string
 	initialized bool
 
-	// Session handles (placeholder - actual implementation uses CGO)
-	detectorSession   interface{}
-	recognizerSession interface{}
-	landmarkSession   interface{}
+	recognizerSession embeddingSession
 }
 
+// embeddingSession runs a face embedding model. Inputs are NCHW float32
+// tensors with a batch size of one.
+type embeddingSession interface {
+	InputShape() []int64
+	OutputShape() []int64
+	Run(input []float32) ([]float32, error)
+	Close() error
+}
+
+// ErrONNXUnavailable is returned when the binary was built without ONNX Runtime support.
+var ErrONNXUnavailable = errors.New("ONNX Runtime support not compiled in (rebuild with -tags onnx)")
+
+// Model files loaded by the ONNX engine.
+const (
+	detectorModel   = "face_detector.onnx"
+	recognizerModel = "face_recognizer.onnx"
+	landmarkModel   = "face_landmarks.onnx"
+)
+
 // ONNXConfig holds ONNX engine configuration.
 type ONNXConfig struct {
 	Backend         Backend
@@ -35,6 +53,7 @@ type ONNXConfig struct {
 	DeviceIndex     int
 	NumThreads      int
 	EnableProfiling bool
+	LibraryPath     string // Path to libonnxruntime.so (default: ONNXRUNTIME_LIB or the loader search path)
 }
 
 // DefaultONNXConfig returns default ONNX configuration.
@@ -55,14 +74,20 @@ func NewONNXEngine(cfg ONNXConfig) (*ONNXEngine, error) {
 		modelPath: cfg.ModelPath,
 	}
 
-	// Verify model files exist
+	// Verify model files exist and match the expected inputs/outputs
 	if err := engine.verifyModels(); err != nil {
 		return nil, err
 	}
 
-	// Initialize based on backend
-	// NOTE: Actual implementation requires ONNX Runtime CGO bindings
-	// This is a placeholder that documents the expected interface
+	session, err := newEmbeddingSession(filepath.Join(cfg.ModelPath, recognizerModel), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyEmbeddingShapes(session); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	engine.recognizerSession = session
 
 	logging.Infof("ONNX Engine initialized with backend: %s", cfg.Backend)
 	engine.initialized = true
@@ -73,9 +98,9 @@ func NewONNXEngine(cfg ONNXConfig) (*ONNXEngine, error) {
 // verifyModels checks that required ONNX model files exist.
 func (e *ONNXEngine) verifyModels() error {
 	requiredModels := []string{
-		"face_detector.onnx",
-		"face_recognizer.onnx",
-		"face_landmarks.onnx",
+		detectorModel,
+		recognizerModel,
+		landmarkModel,
 	}
 
 	for _, model := range requiredModels {
@@ -88,7 +113,21 @@ func (e *ONNXEngine) verifyModels() error {
 	return nil
 }
 
+// verifyEmbeddingShapes checks that the recognizer model takes a single RGB
+// image and returns a flat embedding.
+func verifyEmbeddingShapes(s embeddingSession) error {
+	in, out := s.InputShape(), s.OutputShape()
+	if len(in) != 4 || in[0] != 1 || in[1] != 3 || in[2] <= 0 || in[3] <= 0 {
+		return fmt.Errorf("%s: unsupported input shape %v, want [1 3 H W]", recognizerModel, in)
+	}
+	if len(out) != 2 || out[0] != 1 || out[1] <= 0 {
+		return fmt.Errorf("%s: unsupported output shape %v, want [1 D]", recognizerModel, out)
+	}
+	return nil
+}
+
 // DetectFaces detects faces in an image using accelerated inference.
+// imageData is packed 8-bit RGB (width*height*3 bytes).
 // Returns bounding boxes and confidence scores.
 func (e *ONNXEngine) DetectFaces(imageData []byte, width, height int) ([]FaceDetection, error) {
 	if !e.initialized {
@@ -107,20 +146,83 @@ func (e *ONNXEngine) DetectFaces(imageData []byte, width, height int) ([]FaceDet
 }
 
 // ExtractEmbedding extracts a face embedding using accelerated inference.
+// faceImage is the face crop as packed 8-bit RGB (width*height*3 bytes).
 func (e *ONNXEngine) ExtractEmbedding(faceImage []byte, width, height int) ([]float32, error) {
 	if !e.initialized {
 		return nil, ErrNotInitialized
 	}
 
-	// Placeholder implementation
-	// Actual implementation would:
-	// 1. Preprocess face image (align, normalize)
-	// 2. Run inference on face_recognizer.onnx
-	// 3. Return 128/512-dimensional embedding
+	shape := e.recognizerSession.InputShape()
+	input, err := preprocessFace(faceImage, width, height, int(shape[3]), int(shape[2]))
+	if err != nil {
+		return nil, err
+	}
 
-	logging.Debug("ONNX ExtractEmbedding called (placeholder)")
+	output, err := e.recognizerSession.Run(input)
+	if err != nil {
+		return nil, fmt.Errorf("embedding inference failed: %w", err)
+	}
+	return output, nil
+}
 
-	return nil, errors.New("ONNX inference not yet implemented - using dlib fallback")
+// Embedding model input normalization: pixels are mapped to roughly [-1, 1].
+const (
+	pixelMean  = 127.5
+	pixelScale = 1.0 / 128.0
+)
+
+// preprocessFace resizes a packed RGB face crop to outW x outH with bilinear
+// sampling and returns it normalized in CHW layout.
+func preprocessFace(rgb []byte, width, height, outW, outH int) ([]float32, error) {
+	if width <= 0 || height <= 0 || len(rgb) != width*height*3 {
+		return nil, fmt.Errorf("invalid face image: %d bytes for %dx%d RGB", len(rgb), width, height)
+	}
+
+	plane := outW * outH
+	out := make([]float32, 3*plane)
+	scaleX := float64(width) / float64(outW)
+	scaleY := float64(height) / float64(outH)
+
+	for y := 0; y < outH; y++ {
+		sy := (float64(y)+0.5)*scaleY - 0.5
+		y0, fy := clampIndex(sy, height)
+		y1 := y0 + 1
+		if y1 >= height {
+			y1 = height - 1
+		}
+		for x := 0; x < outW; x++ {
+			sx := (float64(x)+0.5)*scaleX - 0.5
+			x0, fx := clampIndex(sx, width)
+			x1 := x0 + 1
+			if x1 >= width {
+				x1 = width - 1
+			}
+			for c := 0; c < 3; c++ {
+				p00 := float64(rgb[(y0*width+x0)*3+c])
+				p01 := float64(rgb[(y0*width+x1)*3+c])
+				p10 := float64(rgb[(y1*width+x0)*3+c])
+				p11 := float64(rgb[(y1*width+x1)*3+c])
+				top := p00 + (p01-p00)*fx
+				bottom := p10 + (p11-p10)*fx
+				v := top + (bottom-top)*fy
+				out[c*plane+y*outW+x] = float32((v - pixelMean) * pixelScale)
+			}
+		}
+	}
+	return out, nil
+}
+
+// clampIndex splits a sample coordinate into a pixel index within [0, n-1]
+// and the fractional offset towards the next pixel.
+func clampIndex(v float64, n int) (int, float64) {
+	if v <= 0 {
+		return 0, 0
+	}
+	i := int(v)
+	if i >= n-1 {
+		return n - 1, 0
+	}
+	return i, v - float64(i)
 }
 
 // DetectLandmarks detects facial landmarks for a face.
@@ -147,9 +249,10 @@ func (e *ONNXEngine) Close() error {
 	}
 
 	// Release sessions
-	e.detectorSession = nil
-	e.recognizerSession = nil
-	e.landmarkSession = nil
+	if e.recognizerSession != nil {
+		_ = e.recognizerSession.Close()
+		e.recognizerSession = nil
+	}
 	e.initialized = false
 
 	logging.Debug("ONNX Engine closed")
@@ -195,31 +298,61 @@ type ModelInfo struct {
 
 // GetModelInfo returns information about loaded models.
 func (e *ONNXEngine) GetModelInfo() []ModelInfo {
+	recognizer := ModelInfo{Name: "face_recognizer", Path: filepath.Join(e.modelPath, recognizerModel)}
+	if e.recognizerSession != nil {
+		recognizer.InputShape = e.recognizerSession.InputShape()
+		recognizer.OutputShape = e.recognizerSession.OutputShape()
+		recognizer.Loaded = true
+	}
+
 	return []ModelInfo{
-		{Name: "face_detector", Path: filepath.Join(e.modelPath, "face_detector.onnx")},
-		{Name: "face_recognizer", Path: filepath.Join(e.modelPath, "face_recognizer.onnx")},
-		{Name: "face_landmarks", Path: filepath.Join(e.modelPath, "face_landmarks.onnx")},
+		{Name: "face_detector", Path: filepath.Join(e.modelPath, detectorModel)},
+		recognizer,
+		{Name: "face_landmarks", Path: filepath.Join(e.modelPath, landmarkModel)},
 	}
 }
 
-// Benchmark runs a performance benchmark on the current backend.
+// Benchmark runs embedding extraction on a fixed synthetic face crop and
+// reports the average time per iteration. Detection is not implemented for
+// ONNX yet, so DetectionTimeMs stays zero.
 func (e *ONNXEngine) Benchmark(iterations int) (*BenchmarkResult, error) {
 	if !e.initialized {
 		return nil, ErrNotInitialized
 	}
+	if iterations <= 0 {
+		return nil, errors.New("iterations must be positive")
+	}
 
-	result := &BenchmarkResult{
-		Backend:    e.backend,
-		Iterations: iterations,
+	shape := e.recognizerSession.InputShape()
+	width, height := int(shape[3]), int(shape[2])
+	crop := make([]byte, width*height*3)
+	for i := range crop {
+		crop[i] = byte(i % 251)
+	}
+
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if _, err := e.ExtractEmbedding(crop, width, height); err != nil {
+			return nil, err
+		}
 	}
+	elapsed := float64(time.Since(start)) / float64(time.Millisecond)
 
-	// Placeholder - actual implementation would run inference benchmarks
-	logging.Info("Benchmark not yet implemented for ONNX backend")
+	result := &BenchmarkResult{
+		Backend:           e.backend,
+		Iterations:        iterations,
+		RecognitionTimeMs: elapsed / float64(iterations),
+	}
+	result.TotalTimeMs = result.RecognitionTimeMs
+	if result.TotalTimeMs > 0 {
+		result.FPS = 1000 / result.TotalTimeMs
+	}
 
 	return result, nil
 }
 
-// BenchmarkResult contains benchmark results.
+// BenchmarkResult contains benchmark results. Times are averages per
+// iteration.
 type BenchmarkResult struct {
 	Backend           Backend
 	Iterations        int
@@ -0,0 +1,151 @@
+//go:build onnx
+
+package acceleration
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ONNX Runtime is initialized once per process.
+var (
+	runtimeOnce sync.Once
+	runtimeErr  error
+)
+
+// initRuntime loads the ONNX Runtime shared library.
+func initRuntime(libraryPath string) error {
+	runtimeOnce.Do(func() {
+		if libraryPath == "" {
+			libraryPath = os.Getenv("ONNXRUNTIME_LIB")
+		}
+		if libraryPath == "" {
+			libraryPath = "libonnxruntime.so"
+		}
+		ort.SetSharedLibraryPath(libraryPath)
+		runtimeErr = ort.InitializeEnvironment()
+	})
+	return runtimeErr
+}
+
+// ortEmbeddingSession runs an embedding model on the ONNX Runtime CPU
+// execution provider. The input and output tensors are bound to the session
+// and reused for every run.
+type ortEmbeddingSession struct {
+	mu          sync.Mutex
+	session     *ort.AdvancedSession
+	input       *ort.Tensor[float32]
+	output      *ort.Tensor[float32]
+	inputShape  []int64
+	outputShape []int64
+}
+
+// newEmbeddingSession opens modelPath, which must have a single float input
+// and a single float output.
+func newEmbeddingSession(modelPath string, cfg ONNXConfig) (embeddingSession, error) {
+	if err := initRuntime(cfg.LibraryPath); err != nil {
+		return nil, fmt.Errorf("failed to initialize ONNX Runtime: %w", err)
+	}
+
+	inputs, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", modelPath, err)
+	}
+	if len(inputs) != 1 || len(outputs) != 1 {
+		return nil, fmt.Errorf("%s: expected 1 input and 1 output, got %d and %d", modelPath, len(inputs), len(outputs))
+	}
+	if inputs[0].DataType != ort.TensorElementDataTypeFloat || outputs[0].DataType != ort.TensorElementDataTypeFloat {
+		return nil, fmt.Errorf("%s: only float32 models are supported", modelPath)
+	}
+
+	if cfg.Backend != BackendAuto && cfg.Backend != BackendCPU {
+		logging.Warnf("ONNX execution provider %s (device %d) is not supported yet, using CPU", cfg.Backend, cfg.DeviceIndex)
+	}
+
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	defer options.Destroy()
+	if cfg.NumThreads > 0 {
+		if err := options.SetIntraOpNumThreads(cfg.NumThreads); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &ortEmbeddingSession{
+		inputShape:  fixedShape(inputs[0].Dimensions),
+		outputShape: fixedShape(outputs[0].Dimensions),
+	}
+
+	s.input, err = ort.NewEmptyTensor[float32](ort.NewShape(s.inputShape...))
+	if err != nil {
+		return nil, err
+	}
+	s.output, err = ort.NewEmptyTensor[float32](ort.NewShape(s.outputShape...))
+	if err != nil {
+		s.input.Destroy()
+		return nil, err
+	}
+
+	s.session, err = ort.NewAdvancedSession(modelPath,
+		[]string{inputs[0].Name}, []string{outputs[0].Name},
+		[]ort.Value{s.input}, []ort.Value{s.output}, options)
+	if err != nil {
+		s.input.Destroy()
+		s.output.Destroy()
+		return nil, fmt.Errorf("failed to create session for %s: %w", modelPath, err)
+	}
+
+	return s, nil
+}
+
+// fixedShape replaces dynamic dimensions (batch size) with 1.
+func fixedShape(dims ort.Shape) []int64 {
+	shape := make([]int64, len(dims))
+	for i, d := range dims {
+		if d <= 0 {
+			d = 1
+		}
+		shape[i] = d
+	}
+	return shape
+}
+
+func (s *ortEmbeddingSession) InputShape() []int64  { return s.inputShape }
+func (s *ortEmbeddingSession) OutputShape() []int64 { return s.outputShape }
+
+// Run copies input into the bound input tensor and returns a copy of the output.
+func (s *ortEmbeddingSession) Run(input []float32) ([]float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.input.GetData()
+	if len(input) != len(data) {
+		return nil, fmt.Errorf("input has %d values, model expects %d", len(input), len(data))
+	}
+	copy(data, input)
+
+	if err := s.session.Run(); err != nil {
+		return nil, err
+	}
+
+	output := make([]float32, len(s.output.GetData()))
+	copy(output, s.output.GetData())
+	return output, nil
+}
+
+// Close destroys the session and its tensors.
+func (s *ortEmbeddingSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.session.Destroy()
+	s.input.Destroy()
+	s.output.Destroy()
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !onnx
+
+package acceleration
+
+// newEmbeddingSession is unavailable without the "onnx" build tag.
+func newEmbeddingSession(modelPath string, cfg ONNXConfig) (embeddingSession, error) {
+	return nil, ErrONNXUnavailable
+}
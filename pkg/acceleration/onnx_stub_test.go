@@ -0,0 +1,24 @@
+//go:build !onnx
+
+package acceleration
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewONNXEngine_Unavailable(t *testing.T) {
+	cfg := DefaultONNXConfig()
+	cfg.ModelPath = t.TempDir()
+	for _, model := range []string{detectorModel, recognizerModel, landmarkModel} {
+		if err := os.WriteFile(filepath.Join(cfg.ModelPath, model), []byte("model"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewONNXEngine(cfg); !errors.Is(err, ErrONNXUnavailable) {
+		t.Errorf("Expected ErrONNXUnavailable without the onnx build tag, got %v", err)
+	}
+}
@@ -27,3 +27,120 @@ func TestNewONNXEngine_Error(t *testing.T) {
 		t.Error("Expected nil engine")
 	}
 }
+
+type fakeEmbeddingSession struct {
+	inputShape  []int64
+	outputShape []int64
+	lastInput   []float32
+}
+
+func (f *fakeEmbeddingSession) InputShape() []int64  { return f.inputShape }
+func (f *fakeEmbeddingSession) OutputShape() []int64 { return f.outputShape }
+func (f *fakeEmbeddingSession) Close() error         { return nil }
+
+func (f *fakeEmbeddingSession) Run(input []float32) ([]float32, error) {
+	f.lastInput = input
+	return make([]float32, f.outputShape[1]), nil
+}
+
+func TestONNXEngine_ExtractEmbedding(t *testing.T) {
+	session := &fakeEmbeddingSession{inputShape: []int64{1, 3, 4, 4}, outputShape: []int64{1, 128}}
+	engine := &ONNXEngine{initialized: true, recognizerSession: session}
+
+	// 2x2 white crop
+	crop := make([]byte, 2*2*3)
+	for i := range crop {
+		crop[i] = 255
+	}
+
+	embedding, err := engine.ExtractEmbedding(crop, 2, 2)
+	if err != nil {
+		t.Fatalf("ExtractEmbedding failed: %v", err)
+	}
+	if len(embedding) != 128 {
+		t.Errorf("Expected 128-dimensional embedding, got %d", len(embedding))
+	}
+	if len(session.lastInput) != 3*4*4 {
+		t.Errorf("Expected input resized to 3x4x4, got %d values", len(session.lastInput))
+	}
+
+	if _, err := engine.ExtractEmbedding(crop[:5], 2, 2); err == nil {
+		t.Error("Expected error for truncated image data")
+	}
+}
+
+func TestONNXEngine_Benchmark(t *testing.T) {
+	session := &fakeEmbeddingSession{inputShape: []int64{1, 3, 8, 8}, outputShape: []int64{1, 128}}
+	engine := &ONNXEngine{backend: BackendCPU, initialized: true, recognizerSession: session}
+
+	result, err := engine.Benchmark(5)
+	if err != nil {
+		t.Fatalf("Benchmark failed: %v", err)
+	}
+	if result.Backend != BackendCPU || result.Iterations != 5 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.TotalTimeMs != result.RecognitionTimeMs || result.DetectionTimeMs != 0 {
+		t.Errorf("Expected total time to equal recognition time: %+v", result)
+	}
+	if len(session.lastInput) != 3*8*8 {
+		t.Errorf("Expected benchmark crop sized to the model input, got %d values", len(session.lastInput))
+	}
+
+	if _, err := engine.Benchmark(0); err == nil {
+		t.Error("Expected error for zero iterations")
+	}
+	if _, err := (&ONNXEngine{}).Benchmark(1); err != ErrNotInitialized {
+		t.Errorf("Expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestPreprocessFace(t *testing.T) {
+	// 2x1 image: black pixel, white pixel
+	rgb := []byte{0, 0, 0, 255, 255, 255}
+
+	out, err := preprocessFace(rgb, 2, 1, 2, 1)
+	if err != nil {
+		t.Fatalf("preprocessFace failed: %v", err)
+	}
+	if len(out) != 6 {
+		t.Fatalf("Expected 6 values, got %d", len(out))
+	}
+	// CHW layout: each channel plane holds [black, white]
+	for c := 0; c < 3; c++ {
+		black, white := out[c*2], out[c*2+1]
+		if black > -0.99 || white < 0.99 {
+			t.Errorf("Channel %d: expected normalized values near -1 and 1, got %f and %f", c, black, white)
+		}
+	}
+
+	// Upscaling interpolates between neighbours
+	out, err = preprocessFace(rgb, 2, 1, 4, 1)
+	if err != nil {
+		t.Fatalf("preprocessFace failed: %v", err)
+	}
+	if !(out[0] < out[1] && out[1] < out[2] && out[2] < out[3]) {
+		t.Errorf("Expected increasing values when upscaling a gradient, got %v", out[:4])
+	}
+}
+
+func TestVerifyEmbeddingShapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		in, out []int64
+		wantErr bool
+	}{
+		{"valid", []int64{1, 3, 112, 112}, []int64{1, 128}, false},
+		{"grayscale input", []int64{1, 1, 112, 112}, []int64{1, 128}, true},
+		{"batched output", []int64{1, 3, 112, 112}, []int64{1, 128, 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyEmbeddingShapes(&fakeEmbeddingSession{inputShape: tt.in, outputShape: tt.out})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyEmbeddingShapes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
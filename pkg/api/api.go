@@ -0,0 +1,113 @@
+// Package api provides a local JSON API for enrollment and authentication,
+// served over a Unix socket. It lets applications such as display managers
+// embed FacePass without shelling out to the CLI.
+//
+// All operations are versioned under /v1:
+//
+//	POST /v1/enroll        EnrollRequest       -> UserInfo
+//	POST /v1/add-face      AddFaceRequest      -> UserInfo
+//	POST /v1/authenticate  AuthenticateRequest -> AuthenticateResponse
+//	GET  /v1/users                             -> ListResponse
+//	POST /v1/remove        RemoveRequest       -> empty
+//	GET  /v1/camera                            -> camera.CameraCapabilities
+//
+// Failed requests return an ErrorResponse with a matching HTTP status.
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Version is the API version prefix of every path.
+const Version = "v1"
+
+// Operation paths.
+const (
+	PathEnroll       = "/" + Version + "/enroll"
+	PathAddFace      = "/" + Version + "/add-face"
+	PathAuthenticate = "/" + Version + "/authenticate"
+	PathUsers        = "/" + Version + "/users"
+	PathRemove       = "/" + Version + "/remove"
+	PathCamera       = "/" + Version + "/camera"
+)
+
+// Error codes returned in ErrorResponse.Code, in addition to the
+// pam.ErrorCode values for capture failures.
+const (
+	CodeInvalidRequest     = "INVALID_REQUEST"
+	CodeUserExists         = "USER_EXISTS"
+	CodeDuplicateEmbedding = "DUPLICATE_EMBEDDING"
+	CodeInternal           = "INTERNAL"
+)
+
+// DefaultAngle labels faces captured without an explicit angle.
+const DefaultAngle = "front"
+
+// EnrollRequest enrolls a new user with a single captured face. Clients
+// prompt the user and call AddFace for further angles.
+type EnrollRequest struct {
+	Username string            `json:"username"`
+	Angle    string            `json:"angle,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// AddFaceRequest captures another face for an enrolled user.
+type AddFaceRequest struct {
+	Username string `json:"username"`
+	Angle    string `json:"angle,omitempty"`
+}
+
+// AuthenticateRequest runs face authentication for a user.
+type AuthenticateRequest struct {
+	Username string `json:"username"`
+}
+
+// AuthenticateResponse is the outcome of an authentication. Code and
+// Message are set on failure.
+type AuthenticateResponse struct {
+	Success    bool    `json:"success"`
+	Code       string  `json:"code,omitempty"`
+	Message    string  `json:"message,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	Profile    string  `json:"profile,omitempty"`
+	Attempts   int     `json:"attempts"`
+	DurationMs int64   `json:"duration_ms"`
+}
+
+// RemoveRequest deletes a user's face data.
+type RemoveRequest struct {
+	Username string `json:"username"`
+}
+
+// UserInfo summarizes an enrolled user.
+type UserInfo struct {
+	Username   string    `json:"username"`
+	Embeddings int       `json:"embeddings"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+	LastUsed   time.Time `json:"last_used"`
+	Disabled   bool      `json:"disabled,omitempty"`
+}
+
+// ListResponse lists the enrolled users.
+type ListResponse struct {
+	Users []UserInfo `json:"users"`
+}
+
+// ErrorResponse is returned for failed requests.
+type ErrorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// DefaultSocketPath returns $XDG_RUNTIME_DIR/facepass.sock, or a path in
+// the temporary directory if XDG_RUNTIME_DIR is not set.
+func DefaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "facepass.sock")
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+)
+
+// Error is returned by Client for failed requests.
+type Error struct {
+	Status  int    // HTTP status
+	Code    string // ErrorResponse.Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// Client calls the API over a Unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the server listening on socketPath.
+// Authentication and capture can take several seconds, so the client sets
+// no timeout of its own.
+func NewClient(socketPath string) *Client {
+	return &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}}
+}
+
+// Enroll enrolls username with a face captured at angle. metadata is stored
+// with the user's face data and may be nil.
+func (c *Client) Enroll(username, angle string, metadata map[string]string) (*UserInfo, error) {
+	var user UserInfo
+	req := EnrollRequest{Username: username, Angle: angle, Metadata: metadata}
+	if err := c.do(http.MethodPost, PathEnroll, req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AddFace adds a face captured at angle to an enrolled user.
+func (c *Client) AddFace(username, angle string) (*UserInfo, error) {
+	var user UserInfo
+	if err := c.do(http.MethodPost, PathAddFace, AddFaceRequest{Username: username, Angle: angle}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Authenticate runs face authentication for username. A failed
+// authentication is reported in the response, not as an error.
+func (c *Client) Authenticate(username string) (*AuthenticateResponse, error) {
+	var resp AuthenticateResponse
+	if err := c.do(http.MethodPost, PathAuthenticate, AuthenticateRequest{Username: username}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// List returns the enrolled users.
+func (c *Client) List() ([]UserInfo, error) {
+	var resp ListResponse
+	if err := c.do(http.MethodGet, PathUsers, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Users, nil
+}
+
+// Camera returns the capabilities of the server's camera.
+func (c *Client) Camera() (*camera.CameraCapabilities, error) {
+	var caps camera.CameraCapabilities
+	if err := c.do(http.MethodGet, PathCamera, nil, &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// Remove deletes the face data of username.
+func (c *Client) Remove(username string) error {
+	return c.do(http.MethodPost, PathRemove, RemoveRequest{Username: username}, nil)
+}
+
+// do sends req as JSON and decodes the response into resp.
+func (c *Client) do(method, path string, req, resp interface{}) error {
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequest(method, "http://facepass"+path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to reach facepass API: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode >= 400 {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(httpResp.Body).Decode(&errResp); err != nil {
+			return &Error{Status: httpResp.StatusCode, Code: CodeInternal, Message: httpResp.Status}
+		}
+		return &Error{Status: httpResp.StatusCode, Code: errResp.Code, Message: errResp.Error}
+	}
+	if resp == nil || httpResp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/metrics"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+// Authenticator is the part of pam.PAMAuthenticator used by the server.
+type Authenticator interface {
+	Authenticate(username string) pam.AuthResult
+	CaptureEmbedding(angle string) (*recognition.Embedding, error)
+	CameraCapabilities() camera.CameraCapabilities
+}
+
+var _ Authenticator = (*pam.PAMAuthenticator)(nil)
+
+// Server serves the API. Requests are handled one at a time since they
+// share the camera.
+type Server struct {
+	auth     Authenticator
+	store    storage.Backend
+	recorder *metrics.Recorder
+
+	mu         sync.Mutex
+	httpServer *http.Server
+	socketPath string
+}
+
+// NewServer creates a server that captures and authenticates with auth and
+// keeps face data in store.
+func NewServer(auth Authenticator, store storage.Backend) *Server {
+	return &Server{auth: auth, store: store}
+}
+
+// SetRecorder records the outcome of every authentication in r.
+func (s *Server) SetRecorder(r *metrics.Recorder) {
+	s.recorder = r
+}
+
+// Handler returns the HTTP handler for the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathEnroll, s.post(s.handleEnroll))
+	mux.HandleFunc(PathAddFace, s.post(s.handleAddFace))
+	mux.HandleFunc(PathAuthenticate, s.post(s.handleAuthenticate))
+	mux.HandleFunc(PathRemove, s.post(s.handleRemove))
+	mux.HandleFunc(PathUsers, s.get(s.handleList))
+	mux.HandleFunc(PathCamera, s.get(s.handleCamera))
+	return mux
+}
+
+// Serve listens on the Unix socket at socketPath and serves the API until
+// Close is called. A stale socket file is replaced. The socket is only
+// accessible to the owner, since the API can enroll and remove any user.
+func (s *Server) Serve(socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	// The socket is created with the umask applied, so mask everything but
+	// the owner until it exists instead of relying on the chmod below alone
+	oldMask := syscall.Umask(0077)
+	listener, err := net.Listen("unix", socketPath)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	server := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	s.mu.Lock()
+	s.httpServer = server
+	s.socketPath = socketPath
+	s.mu.Unlock()
+
+	logging.Infof("API listening on %s", socketPath)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server and removes the socket.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	server, socketPath := s.httpServer, s.socketPath
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	err := server.Close()
+	_ = os.Remove(socketPath)
+	return err
+}
+
+// post decodes the JSON body of POST requests into a request value and
+// calls handle with the server lock held.
+func (s *Server) post(handle func(w http.ResponseWriter, body *json.Decoder)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, CodeInvalidRequest, "method not allowed")
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handle(w, json.NewDecoder(r.Body))
+	}
+}
+
+// get calls handle for GET requests with the server lock held.
+func (s *Server) get(handle func(w http.ResponseWriter)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, CodeInvalidRequest, "method not allowed")
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handle(w)
+	}
+}
+
+func (s *Server) handleEnroll(w http.ResponseWriter, body *json.Decoder) {
+	var req EnrollRequest
+	if !decode(w, body, &req) || !validUsername(w, req.Username) {
+		return
+	}
+	if s.store.UserExists(req.Username) {
+		writeError(w, http.StatusConflict, CodeUserExists, fmt.Sprintf("user '%s' is already enrolled", req.Username))
+		return
+	}
+
+	embedding, ok := s.capture(w, req.Angle)
+	if !ok {
+		return
+	}
+
+	metadata := map[string]string{"enrolled_by": "api"}
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	if err := s.store.CreateUser(req.Username, []recognition.Embedding{*embedding}, metadata); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	logging.Infof("Enrolled %s via API", req.Username)
+	s.writeUser(w, req.Username)
+}
+
+func (s *Server) handleAddFace(w http.ResponseWriter, body *json.Decoder) {
+	var req AddFaceRequest
+	if !decode(w, body, &req) || !validUsername(w, req.Username) {
+		return
+	}
+	if !s.store.UserExists(req.Username) {
+		writeStorageError(w, storage.ErrUserNotFound)
+		return
+	}
+
+	embedding, ok := s.capture(w, req.Angle)
+	if !ok {
+		return
+	}
+	if err := s.store.AddEmbedding(req.Username, *embedding); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	s.writeUser(w, req.Username)
+}
+
+func (s *Server) handleAuthenticate(w http.ResponseWriter, body *json.Decoder) {
+	var req AuthenticateRequest
+	if !decode(w, body, &req) || !validUsername(w, req.Username) {
+		return
+	}
+
+	result := s.auth.Authenticate(req.Username)
+	if s.recorder != nil {
+		s.recorder.ObserveAuth(result)
+	}
+
+	resp := AuthenticateResponse{
+		Success:    result.Success,
+		Reason:     result.Reason,
+		Confidence: result.Confidence,
+		Profile:    result.Profile,
+		Attempts:   result.Attempts,
+		DurationMs: result.Duration.Milliseconds(),
+	}
+	if result.Error != nil {
+		var authErr *pam.AuthError
+		if errors.As(result.Error, &authErr) {
+			resp.Code = string(authErr.Code)
+		}
+		resp.Message = result.Error.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, body *json.Decoder) {
+	var req RemoveRequest
+	if !decode(w, body, &req) || !validUsername(w, req.Username) {
+		return
+	}
+	if !s.store.UserExists(req.Username) {
+		writeStorageError(w, storage.ErrUserNotFound)
+		return
+	}
+	if err := s.store.DeleteUser(req.Username); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	logging.Infof("Removed %s via API", req.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleList(w http.ResponseWriter) {
+	usernames, err := s.store.ListUsers()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	resp := ListResponse{Users: make([]UserInfo, 0, len(usernames))}
+	for _, username := range usernames {
+		user, err := s.store.LoadUser(username)
+		if err != nil {
+			logging.Warnf("Failed to load user %s: %v", username, err)
+			continue
+		}
+		resp.Users = append(resp.Users, userInfo(user))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCamera(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, s.auth.CameraCapabilities())
+}
+
+// capture captures an embedding, writing an error response on failure.
+func (s *Server) capture(w http.ResponseWriter, angle string) (*recognition.Embedding, bool) {
+	if angle == "" {
+		angle = DefaultAngle
+	}
+	embedding, err := s.auth.CaptureEmbedding(angle)
+	if err == nil {
+		return embedding, true
+	}
+
+	code := pam.ErrCodeCamera
+	switch {
+	case errors.Is(err, recognition.ErrNoFaceDetected), errors.Is(err, recognition.ErrFaceTooSmall),
+		errors.Is(err, recognition.ErrFaceAtEdge):
+		code = pam.ErrCodeNoFace
+	case errors.Is(err, recognition.ErrMultipleFaces):
+		code = pam.ErrCodeMultipleFaces
+	}
+	writeError(w, http.StatusUnprocessableEntity, string(code), err.Error())
+	return nil, false
+}
+
+// writeUser responds with the stored summary of username.
+func (s *Server) writeUser(w http.ResponseWriter, username string) {
+	user, err := s.store.LoadUser(username)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userInfo(user))
+}
+
+func userInfo(user *storage.UserFaceData) UserInfo {
+	return UserInfo{
+		Username:   user.Username,
+		Embeddings: len(user.Embeddings),
+		EnrolledAt: user.EnrolledAt,
+		LastUsed:   user.LastUsed,
+		Disabled:   user.Disabled,
+	}
+}
+
+func decode(w http.ResponseWriter, body *json.Decoder, v interface{}) bool {
+	if err := body.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func validUsername(w http.ResponseWriter, username string) bool {
+	if err := storage.ValidateUsername(username); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, string(pam.ErrCodeNotEnrolled), err.Error())
+	case errors.Is(err, storage.ErrUserExists):
+		writeError(w, http.StatusConflict, CodeUserExists, err.Error())
+	case errors.Is(err, storage.ErrDuplicateEmbedding):
+		writeError(w, http.StatusConflict, CodeDuplicateEmbedding, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, ErrorResponse{Code: code, Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Warnf("Failed to write API response: %v", err)
+	}
+}
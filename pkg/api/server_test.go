@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/camera"
+	"github.com/MrCodeEU/facepass/pkg/metrics"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+	"github.com/MrCodeEU/facepass/pkg/storage"
+)
+
+type fakeAuthenticator struct {
+	captureErr error
+	result     pam.AuthResult
+	angles     []string
+	caps       camera.CameraCapabilities
+}
+
+func (f *fakeAuthenticator) Authenticate(username string) pam.AuthResult {
+	result := f.result
+	result.Username = username
+	return result
+}
+
+func (f *fakeAuthenticator) CaptureEmbedding(angle string) (*recognition.Embedding, error) {
+	f.angles = append(f.angles, angle)
+	if f.captureErr != nil {
+		return nil, f.captureErr
+	}
+	// A distinct vector per capture, duplicates are rejected by storage
+	return &recognition.Embedding{Vector: recognition.Descriptor{float32(len(f.angles))}, Angle: angle, Quality: 0.9}, nil
+}
+
+func (f *fakeAuthenticator) CameraCapabilities() camera.CameraCapabilities {
+	return f.caps
+}
+
+// startServer serves the API on a socket in a short temporary directory;
+// Unix socket paths are limited to about 100 bytes.
+func startServer(t *testing.T, auth Authenticator) (*Server, *Client, string) {
+	t.Helper()
+	store, err := storage.NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("", "fp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "api.sock")
+
+	server := NewServer(auth, store)
+	errc := make(chan error, 1)
+	go func() { errc <- server.Serve(socketPath) }()
+	t.Cleanup(func() {
+		_ = server.Close()
+		if err := <-errc; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return server, NewClient(socketPath), socketPath
+}
+
+func TestServer_EnrollAndManage(t *testing.T) {
+	auth := &fakeAuthenticator{}
+	_, client, socketPath := startServer(t, auth)
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+
+	user, err := client.Enroll("alice", "", map[string]string{"source": "greeter"})
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if user.Username != "alice" || user.Embeddings != 1 {
+		t.Errorf("Enroll() = %+v", user)
+	}
+
+	var apiErr *Error
+	if _, err := client.Enroll("alice", "front", nil); !errors.As(err, &apiErr) || apiErr.Code != CodeUserExists {
+		t.Errorf("Enroll() of an enrolled user error = %v, want %s", err, CodeUserExists)
+	}
+
+	if user, err = client.AddFace("alice", "left"); err != nil {
+		t.Fatalf("AddFace() error = %v", err)
+	}
+	if user.Embeddings != 2 {
+		t.Errorf("AddFace() embeddings = %d, want 2", user.Embeddings)
+	}
+	if strings.Join(auth.angles, ",") != "front,left" {
+		t.Errorf("captured angles = %v, want [front left]", auth.angles)
+	}
+
+	if _, err := client.AddFace("bob", ""); !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Errorf("AddFace() for an unknown user error = %v, want 404", err)
+	}
+
+	users, err := client.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("List() = %+v", users)
+	}
+
+	if err := client.Remove("alice"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := client.Remove("alice"); !errors.As(err, &apiErr) || apiErr.Code != string(pam.ErrCodeNotEnrolled) {
+		t.Errorf("second Remove() error = %v, want %s", err, pam.ErrCodeNotEnrolled)
+	}
+	if users, _ := client.List(); len(users) != 0 {
+		t.Errorf("List() after Remove() = %+v", users)
+	}
+}
+
+func TestServer_CaptureErrors(t *testing.T) {
+	auth := &fakeAuthenticator{captureErr: recognition.ErrMultipleFaces}
+	_, client, _ := startServer(t, auth)
+
+	var apiErr *Error
+	_, err := client.Enroll("alice", "", nil)
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Enroll() error = %v, want *Error", err)
+	}
+	if apiErr.Status != http.StatusUnprocessableEntity || apiErr.Code != string(pam.ErrCodeMultipleFaces) {
+		t.Errorf("Enroll() error = %+v", apiErr)
+	}
+
+	if _, err := client.Enroll("../root", "", nil); !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidRequest {
+		t.Errorf("Enroll() with an invalid username error = %v, want %s", err, CodeInvalidRequest)
+	}
+}
+
+func TestServer_Authenticate(t *testing.T) {
+	auth := &fakeAuthenticator{result: pam.AuthResult{
+		Error:    pam.NewAuthError(pam.ErrCodeLiveness, true),
+		Reason:   "no blink",
+		Attempts: 2,
+		Duration: 1500 * time.Millisecond,
+	}}
+	server, client, _ := startServer(t, auth)
+	recorder := metrics.NewRecorder()
+	server.SetRecorder(recorder)
+
+	resp, err := client.Authenticate("alice")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if resp.Success || resp.Code != string(pam.ErrCodeLiveness) || resp.Reason != "no blink" {
+		t.Errorf("Authenticate() = %+v", resp)
+	}
+	if resp.Attempts != 2 || resp.DurationMs != 1500 {
+		t.Errorf("Authenticate() attempts/duration = %d/%d", resp.Attempts, resp.DurationMs)
+	}
+
+	auth.result = pam.AuthResult{Success: true, Confidence: 0.7, Profile: "glasses", Attempts: 1}
+	if resp, err = client.Authenticate("alice"); err != nil || !resp.Success || resp.Confidence != 0.7 || resp.Profile != "glasses" {
+		t.Errorf("Authenticate() = %+v, %v", resp, err)
+	}
+
+	rec := httptest.NewRecorder()
+	recorder.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metrics.Path, nil))
+	for _, want := range []string{"facepass_auth_attempts_total 2", "facepass_liveness_rejects_total 1"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestServer_Camera(t *testing.T) {
+	auth := &fakeAuthenticator{caps: camera.CameraCapabilities{
+		Device:      "/dev/video2",
+		IR:          true,
+		IREmitter:   true,
+		EmitterTool: "sysfs",
+		Formats: []camera.FormatCapability{{
+			FourCC:      "GREY",
+			PixelFormat: camera.PixelFormatGrey,
+			Resolutions: []camera.Resolution{{Width: 640, Height: 360}},
+		}},
+	}}
+	_, client, socketPath := startServer(t, auth)
+
+	caps, err := client.Camera()
+	if err != nil {
+		t.Fatalf("Camera() error = %v", err)
+	}
+	if !reflect.DeepEqual(*caps, auth.caps) {
+		t.Errorf("Camera() = %+v, want %+v", *caps, auth.caps)
+	}
+
+	httpClient := NewClient(socketPath).http
+	resp, err := httpClient.Post("http://facepass"+PathCamera, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST %s status = %d", PathCamera, resp.StatusCode)
+	}
+}
+
+func TestClient_ServerUnavailable(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := client.List(); err == nil {
+		t.Error("List() without a server should fail")
+	}
+}
@@ -0,0 +1,132 @@
+package camera
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// busyMessage is how ffmpeg and the kernel report EBUSY.
+const busyMessage = "Device or resource busy"
+
+// busyWait is how long streamError waits for ffmpeg's stderr after the
+// stream ended.
+const busyWait = 200 * time.Millisecond
+
+// procDir is where cameraHolders looks for processes.
+var procDir = "/proc"
+
+// BusyHint explains how to find and stop whatever holds device after a
+// capture failed with ErrCameraBusy. It names the holding processes the
+// current user can see.
+func BusyHint(device string) string {
+	return busyHint(device, cameraHolders(device))
+}
+
+// busyHint builds the hint for device held by holders.
+func busyHint(device string, holders []string) string {
+	if len(holders) > 0 {
+		return fmt.Sprintf("the camera is held by %s; close it or stop its video and try again",
+			strings.Join(holders, ", "))
+	}
+	return fmt.Sprintf("another application is using the camera, usually a browser tab, a meeting app "+
+		"(Zoom, Teams, Slack), OBS or a stuck ffmpeg; find it with: sudo fuser -v %s", device)
+}
+
+// cameraHolders returns the processes that have device open, as
+// "name (pid N)". Without root only the current user's processes are
+// visible.
+func cameraHolders(device string) []string {
+	target, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return nil
+	}
+	fds, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "fd", "*"))
+	if err != nil {
+		return nil
+	}
+
+	self := strconv.Itoa(os.Getpid())
+	seen := make(map[string]bool)
+	var holders []string
+	for _, fd := range fds {
+		pid := filepath.Base(filepath.Dir(filepath.Dir(fd)))
+		if pid == self || seen[pid] {
+			continue
+		}
+		if link, err := os.Readlink(fd); err != nil || link != target {
+			continue
+		}
+		seen[pid] = true
+		name := "unknown"
+		if comm, err := os.ReadFile(filepath.Join(procDir, pid, "comm")); err == nil {
+			name = strings.TrimSpace(string(comm))
+		}
+		holders = append(holders, fmt.Sprintf("%s (pid %s)", name, pid))
+	}
+	sort.Strings(holders)
+	return holders
+}
+
+// stderrTailSize is how much of ffmpeg's stderr stderrTail keeps.
+const stderrTailSize = 4096
+
+// stderrTail keeps the end of ffmpeg's stderr to tell why it failed. It may
+// be read while ffmpeg is still writing.
+type stderrTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailSize {
+		t.buf = t.buf[len(t.buf)-stderrTailSize:]
+	}
+	return len(p), nil
+}
+
+// busy reports whether ffmpeg failed because the device is busy.
+func (t *stderrTail) busy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return bytes.Contains(t.buf, []byte(busyMessage))
+}
+
+// busyError returns ErrCameraBusy for a capture from the camera's device.
+// Like the error of Open, it wraps a *fs.PathError naming the device.
+func (c *V4L2Camera) busyError() error {
+	return fmt.Errorf("%w: %w", ErrCameraBusy, &fs.PathError{Op: "capture", Path: c.device, Err: syscall.EBUSY})
+}
+
+// streamError returns ErrCameraBusy for a failed stream read if ffmpeg
+// gave up because the device is busy, and err otherwise.
+func (c *V4L2Camera) streamError(err error) error {
+	if c.streamStderr == nil || c.network {
+		return err
+	}
+	// stdout may reach EOF before the reason has been copied from stderr
+	ended := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	deadline := time.Now().Add(busyWait)
+	for {
+		if c.streamStderr.busy() {
+			return c.busyError()
+		}
+		if !ended || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -10,10 +10,14 @@ import (
 	"image"
 	"image/jpeg"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/MrCodeEU/facepass/pkg/logging"
@@ -27,8 +31,46 @@ type Frame struct {
 	Data      []byte
 	Width     int
 	Height    int
-	Format    string // "JPEG", "RGB", "GRAY"
+	Format    string // FormatJPEG, FormatRGB, FormatGray, FormatY16 or FormatYUYV
 	Timestamp time.Time
+
+	// Y16 holds the raw little-endian 16-bit samples of captures with
+	// PixelFormatY16, for IR analysis; Data is then an 8-bit JPEG of them.
+	Y16 []byte
+}
+
+// Frame formats. Raw formats are tightly packed, row by row.
+const (
+	FormatJPEG = "JPEG"
+	FormatRGB  = "RGB"  // 8-bit R, G, B per pixel
+	FormatGray = "GRAY" // 8-bit luminance (V4L2 GREY)
+	FormatY16  = "Y16"  // 16-bit little-endian luminance (V4L2 Y16)
+	FormatYUYV = "YUYV" // 4:2:2 Y0 U Y1 V per pixel pair (V4L2 YUYV, YUY2)
+)
+
+// Capture pixel formats selectable via camera.pixel_format. PixelFormatAuto
+// lets the driver pick, which is wrong on some cameras that expose an IR and
+// a color stream through the same node.
+const (
+	PixelFormatAuto  = "auto"
+	PixelFormatMJPEG = "mjpeg"
+	PixelFormatYUYV  = "yuyv"
+	PixelFormatGrey  = "grey"
+	PixelFormatY16   = "y16" // 16-bit IR/depth sensors; see Frame.Y16
+)
+
+// pixelFormat is the ffmpeg input format and V4L2 fourcc of a capture
+// pixel format.
+type pixelFormat struct {
+	ffmpeg string
+	fourcc string
+}
+
+var pixelFormats = map[string]pixelFormat{
+	PixelFormatMJPEG: {ffmpeg: "mjpeg", fourcc: "MJPG"},
+	PixelFormatYUYV:  {ffmpeg: "yuyv422", fourcc: "YUYV"},
+	PixelFormatGrey:  {ffmpeg: "gray", fourcc: "GREY"},
+	PixelFormatY16:   {ffmpeg: "gray16le", fourcc: "Y16 "},
 }
 
 // DeviceInfo contains information about a camera device.
@@ -38,11 +80,19 @@ type DeviceInfo struct {
 	Driver     string
 	IsIR       bool
 	HasEmitter bool
+	Busy       bool // in use by another process
 }
 
 // ErrCameraNotFound is returned when the camera device is not found.
 var ErrCameraNotFound = errors.New("camera device not found")
 
+// ErrNoCameras is returned by ListCameras when there are no V4L2 devices at
+// all, e.g. in a container or with the camera disabled in the firmware.
+var ErrNoCameras = errors.New("no camera devices found")
+
+// videoDevicePattern matches the V4L2 device nodes listed by ListCameras.
+var videoDevicePattern = "/dev/video*"
+
 // ErrCameraNotOpen is returned when trying to capture from a closed camera.
 var ErrCameraNotOpen = errors.New("camera not open")
 
@@ -52,19 +102,65 @@ var ErrNoFrame = errors.New("failed to capture frame")
 // ErrCaptureTimeout is returned when frame capture times out.
 var ErrCaptureTimeout = errors.New("capture timeout")
 
-// V4L2Camera implements camera access using v4l2 tools.
+// ErrCameraBusy is returned when another process holds the camera,
+// typically a browser or a meeting app. See BusyHint.
+var ErrCameraBusy = errors.New("camera is in use by another process")
+
+// ErrInvalidPixelFormat is returned for unknown capture pixel formats.
+var ErrInvalidPixelFormat = errors.New("invalid pixel format")
+
+// ErrInvalidJPEGQuality is returned for JPEG qualities outside the range
+// ffmpeg accepts.
+var ErrInvalidJPEGQuality = errors.New("invalid JPEG quality")
+
+// JPEG qualities of captured frames, as ffmpeg's -q:v: lower is better and
+// larger. DefaultJPEGQuality keeps nearly all detail.
+const (
+	MinJPEGQuality     = 1
+	MaxJPEGQuality     = 31
+	DefaultJPEGQuality = 2
+)
+
+// networkSchemes are the URL schemes of network streams that are opened
+// with ffmpeg instead of V4L2.
+var networkSchemes = map[string]bool{"rtsp": true, "rtsps": true, "http": true, "https": true}
+
+// IsNetworkDevice reports whether device is the URL of a network stream,
+// such as rtsp://camera.local/stream, rather than a V4L2 device node.
+func IsNetworkDevice(device string) bool {
+	u, err := url.Parse(device)
+	return err == nil && networkSchemes[strings.ToLower(u.Scheme)] && u.Host != ""
+}
+
+// RedactDevice returns device with any password in a stream URL masked, for
+// logs and stored metadata.
+func RedactDevice(device string) string {
+	if !IsNetworkDevice(device) {
+		return device
+	}
+	u, _ := url.Parse(device)
+	return u.Redacted()
+}
+
+// V4L2Camera implements camera access using v4l2 tools. Network streams
+// (see IsNetworkDevice) are read with ffmpeg as well; V4L2-specific probing
+// and the IR emitter are skipped for them.
 type V4L2Camera struct {
-	device     string
-	width      int
-	height     int
-	isOpen     bool
-	irEmitter  *IREmitter
-	deviceInfo DeviceInfo
+	device      string
+	network     bool
+	width       int
+	height      int
+	pixelFormat string
+	jpegQuality int
+	isOpen      bool
+	irEmitter   *IREmitter
+	deviceInfo  DeviceInfo
 
 	// Streaming fields
 	streamCmd    *exec.Cmd
 	streamStdout io.ReadCloser
 	streamReader *bufio.Reader
+	streamStderr *stderrTail
 	isStreaming  bool
 }
 
@@ -79,19 +175,35 @@ type IREmitter struct {
 // NewCamera creates a new V4L2Camera instance.
 func NewCamera() *V4L2Camera {
 	return &V4L2Camera{
-		width:  640,
-		height: 480,
+		width:       640,
+		height:      480,
+		jpegQuality: DefaultJPEGQuality,
 	}
 }
 
-// Open opens the camera device.
+// Open opens the camera device, a V4L2 device node or a network stream URL.
 func (c *V4L2Camera) Open(device string) error {
-	// Check if device exists
+	if IsNetworkDevice(device) {
+		return c.openNetwork(device)
+	}
+
+	// Check if device exists and can be opened: ffmpeg would only report a
+	// generic failure later
 	if _, err := os.Stat(device); os.IsNotExist(err) {
-		return ErrCameraNotFound
+		return fmt.Errorf("%w: %s", ErrCameraNotFound, device)
+	}
+	if f, err := os.OpenFile(device, os.O_RDWR, 0); err == nil {
+		_ = f.Close()
+	} else if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w %s: %w", ErrCameraPermission, device, err)
+	} else if errors.Is(err, syscall.EBUSY) {
+		return fmt.Errorf("%w: %w", ErrCameraBusy, err)
+	} else {
+		logging.Debugf("Probing camera %s failed: %v", device, err)
 	}
 
 	c.device = device
+	c.network = false
 	c.isOpen = true
 
 	// Get device info
@@ -108,6 +220,19 @@ func (c *V4L2Camera) Open(device string) error {
 	return nil
 }
 
+// openNetwork opens a network stream. The stream is only connected to on
+// capture, by ffmpeg.
+func (c *V4L2Camera) openNetwork(device string) error {
+	c.device = device
+	c.network = true
+	c.isOpen = true
+	c.deviceInfo = DeviceInfo{Path: RedactDevice(device), Name: "Network stream"}
+	c.irEmitter = &IREmitter{}
+
+	logging.Infof("Opened network camera: %s", RedactDevice(device))
+	return nil
+}
+
 // Close closes the camera device.
 func (c *V4L2Camera) Close() error {
 	if c.irEmitter != nil && c.irEmitter.Enabled {
@@ -130,6 +255,47 @@ func (c *V4L2Camera) SetResolution(width, height int) error {
 	return nil
 }
 
+// SetPixelFormat forces the capture pixel format: PixelFormatMJPEG,
+// PixelFormatYUYV, PixelFormatGrey or PixelFormatY16. PixelFormatAuto or ""
+// leaves the choice to the driver.
+func (c *V4L2Camera) SetPixelFormat(format string) error {
+	if format == "" || format == PixelFormatAuto {
+		c.pixelFormat = ""
+		return nil
+	}
+	if _, ok := pixelFormats[format]; !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidPixelFormat, format)
+	}
+	c.pixelFormat = format
+	return nil
+}
+
+// SetJPEGQuality sets the quality of the JPEG frames ffmpeg encodes, from
+// MinJPEGQuality (best, slowest to decode) to MaxJPEGQuality. Y16 frames are
+// not affected.
+func (c *V4L2Camera) SetJPEGQuality(quality int) error {
+	if quality < MinJPEGQuality || quality > MaxJPEGQuality {
+		return fmt.Errorf("%w: %d (must be between %d and %d)", ErrInvalidJPEGQuality, quality, MinJPEGQuality, MaxJPEGQuality)
+	}
+	c.jpegQuality = quality
+	return nil
+}
+
+// inputArgs returns the ffmpeg arguments that open the device, with extra
+// input options such as the frame rate placed before -i. Network streams
+// take no V4L2 input options; they are scaled to the configured resolution
+// instead, which the frames are reported with.
+func (c *V4L2Camera) inputArgs(extra ...string) []string {
+	if c.network {
+		return []string{"-i", c.device, "-vf", fmt.Sprintf("scale=%d:%d", c.width, c.height)}
+	}
+	args := append([]string{"-f", "v4l2"}, extra...)
+	if format, ok := pixelFormats[c.pixelFormat]; ok {
+		args = append(args, "-input_format", format.ffmpeg)
+	}
+	return append(args, "-video_size", fmt.Sprintf("%dx%d", c.width, c.height), "-i", c.device)
+}
+
 // GetDeviceInfo returns information about the camera device.
 func (c *V4L2Camera) GetDeviceInfo() DeviceInfo {
 	return c.deviceInfo
@@ -183,6 +349,11 @@ func (c *V4L2Camera) Capture() (*Frame, error) {
 		_ = c.triggerIREmitter()
 	}
 
+	// JPEG would clip 16-bit samples to 8 bits
+	if c.pixelFormat == PixelFormatY16 {
+		return c.captureY16()
+	}
+
 	// Create temporary file for captured frame
 	tmpDir := os.TempDir()
 	tmpFile := filepath.Join(tmpDir, fmt.Sprintf("facepass_frame_%d.jpg", time.Now().UnixNano()))
@@ -192,18 +363,19 @@ func (c *V4L2Camera) Capture() (*Frame, error) {
 
 	// Use ffmpeg to capture a single frame
 	// This is more reliable than direct v4l2 access in Go
-	cmd := execCommand("ffmpeg",
-		"-f", "v4l2",
-		"-video_size", fmt.Sprintf("%dx%d", c.width, c.height),
-		"-i", c.device,
+	args := append(c.inputArgs(),
 		"-frames:v", "1",
+		"-q:v", strconv.Itoa(c.jpegQuality),
 		"-y", // Overwrite output file
 		tmpFile,
 	)
+	cmd := execCommand("ffmpeg", args...)
 
-	// Suppress ffmpeg output
+	// Suppress ffmpeg output, keeping the end of stderr to tell a busy
+	// device from other failures
+	var stderr stderrTail
 	cmd.Stdout = nil
-	cmd.Stderr = nil
+	cmd.Stderr = &stderr
 
 	// Run with timeout
 	done := make(chan error, 1)
@@ -214,6 +386,12 @@ func (c *V4L2Camera) Capture() (*Frame, error) {
 	select {
 	case err := <-done:
 		if err != nil {
+			if c.network {
+				return nil, fmt.Errorf("%w from %s: %v", ErrNoFrame, RedactDevice(c.device), err)
+			}
+			if stderr.busy() {
+				return nil, c.busyError()
+			}
 			// Try alternative method using v4l2-ctl + convert
 			return c.captureAlternative()
 		}
@@ -240,7 +418,7 @@ func (c *V4L2Camera) Capture() (*Frame, error) {
 		Data:      data,
 		Width:     bounds.Dx(),
 		Height:    bounds.Dy(),
-		Format:    "JPEG",
+		Format:    FormatJPEG,
 		Timestamp: time.Now(),
 	}, nil
 }
@@ -258,9 +436,13 @@ func (c *V4L2Camera) captureAlternative() (*Frame, error) {
 	}()
 
 	// Try using v4l2-ctl to capture a raw frame
+	fourcc := "YUYV"
+	if format, ok := pixelFormats[c.pixelFormat]; ok {
+		fourcc = format.fourcc
+	}
 	cmd := execCommand("v4l2-ctl",
 		"-d", c.device,
-		"--set-fmt-video=width="+fmt.Sprintf("%d", c.width)+",height="+fmt.Sprintf("%d", c.height)+",pixelformat=YUYV",
+		"--set-fmt-video=width="+fmt.Sprintf("%d", c.width)+",height="+fmt.Sprintf("%d", c.height)+",pixelformat="+fourcc,
 		"--stream-mmap",
 		"--stream-count=1",
 		"--stream-to="+tmpFile,
@@ -285,7 +467,7 @@ func (c *V4L2Camera) captureAlternative() (*Frame, error) {
 		Data:      data,
 		Width:     c.width,
 		Height:    c.height,
-		Format:    "JPEG",
+		Format:    FormatJPEG,
 		Timestamp: time.Now(),
 	}, nil
 }
@@ -391,24 +573,28 @@ func (c *V4L2Camera) StartStreaming() error {
 	// -f image2pipe -vcodec mjpeg -q:v 2 -
 	// We use 20 fps to capture over a medium duration (1.5s for 30 frames)
 	// to better detect 3D micro-movements while keeping auth fast
-	cmd := execCommand("ffmpeg",
-		"-f", "v4l2",
-		"-framerate", "20",
-		"-video_size", fmt.Sprintf("%dx%d", c.width, c.height),
-		"-i", c.device,
-		"-f", "image2pipe",
-		"-vcodec", "mjpeg",
-		"-q:v", "2", // High quality
-		"-",
-	)
+	args := c.inputArgs("-framerate", "20")
+	if c.pixelFormat == PixelFormatY16 {
+		args = append(args, c.y16OutputArgs()...)
+	} else {
+		args = append(args,
+			"-f", "image2pipe",
+			"-vcodec", "mjpeg",
+			"-q:v", strconv.Itoa(c.jpegQuality),
+			"-",
+		)
+	}
+	cmd := execCommand("ffmpeg", args...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
 
-	// Suppress stderr
-	cmd.Stderr = nil
+	// Keep the end of stderr in case the stream ends because the device
+	// is busy
+	stderr := &stderrTail{}
+	cmd.Stderr = stderr
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start ffmpeg: %w", err)
@@ -417,6 +603,7 @@ func (c *V4L2Camera) StartStreaming() error {
 	c.streamCmd = cmd
 	c.streamStdout = stdout
 	c.streamReader = bufio.NewReaderSize(stdout, 1024*1024) // 1MB buffer
+	c.streamStderr = stderr
 	c.isStreaming = true
 
 	logging.Debug("Camera streaming started")
@@ -437,6 +624,7 @@ func (c *V4L2Camera) StopStreaming() error {
 	c.streamCmd = nil
 	c.streamStdout = nil
 	c.streamReader = nil
+	c.streamStderr = nil
 	c.isStreaming = false
 
 	logging.Debug("Camera streaming stopped")
@@ -448,73 +636,20 @@ func (c *V4L2Camera) ReadFrame() (*Frame, error) {
 	if !c.isStreaming {
 		return c.Capture() // Fallback to single capture
 	}
-
-	// Optimized JPEG reading from MJPEG stream
-	// We look for SOI (FF D8) and EOI (FF D9)
-
-	// Read until we find SOI
-	// Using ReadSlice is faster than ReadByte loop
-	for {
-		// Read until 0xFF
-		_, err := c.streamReader.ReadSlice(0xFF)
-		if err != nil {
-			if err == bufio.ErrBufferFull {
-				continue
-			}
-			return nil, err
-		}
-
-		// Check if next byte is 0xD8
-		b, err := c.streamReader.ReadByte()
-		if err != nil {
-			return nil, err
-		}
-
-		if b == 0xD8 {
-			break // Found SOI
-		}
-		// If not D8, continue searching (the 0xFF was part of data)
+	if c.pixelFormat == PixelFormatY16 {
+		return c.readY16Frame()
 	}
 
-	// We found SOI, start buffer with FF D8
-	jpegData := make([]byte, 0, 1024*50) // Pre-allocate 50KB
-	jpegData = append(jpegData, 0xFF, 0xD8)
-
-	// Read until EOI (FF D9)
-	// We read chunks and check for the marker
-	// Note: This is a simplified parser. A robust one would handle escaped FFs.
-	// But for ffmpeg mjpeg output, FF D9 is reliable as EOI.
-
-	for {
-		// Read until next 0xFF
-		slice, err := c.streamReader.ReadSlice(0xFF)
-		if err != nil {
-			// If buffer is full (ErrBufferFull), we append and continue
-			if err == bufio.ErrBufferFull {
-				jpegData = append(jpegData, slice...)
-				continue
-			}
-			return nil, err
-		}
-		jpegData = append(jpegData, slice...)
-
-		// Check next byte
-		b, err := c.streamReader.ReadByte()
-		if err != nil {
-			return nil, err
-		}
-		jpegData = append(jpegData, b)
-
-		if b == 0xD9 {
-			break // Found EOI
-		}
+	jpegData, err := readJPEG(c.streamReader)
+	if err != nil {
+		return nil, c.streamError(err)
 	}
 
 	return &Frame{
 		Data:      jpegData,
 		Width:     c.width,
 		Height:    c.height,
-		Format:    "JPEG",
+		Format:    FormatJPEG,
 		Timestamp: time.Now(),
 	}, nil
 }
@@ -551,29 +686,119 @@ func detectIREmitter() *IREmitter {
 	return emitter
 }
 
-// ListCameras returns a list of available camera devices.
+// ListCameras returns a list of available camera devices. It returns
+// ErrNoCameras if there are no video devices, and the permission error if
+// there are some but none can be accessed.
 func ListCameras() ([]DeviceInfo, error) {
 	var cameras []DeviceInfo
 
 	// List video devices
-	devices, err := filepath.Glob("/dev/video*")
+	devices, err := filepath.Glob(videoDevicePattern)
 	if err != nil {
 		return nil, err
 	}
+	if len(devices) == 0 {
+		return nil, ErrNoCameras
+	}
 
+	var permErr error
 	for _, device := range devices {
 		cam := NewCamera()
 		if err := cam.Open(device); err != nil {
+			if errors.Is(err, ErrCameraPermission) && permErr == nil {
+				permErr = err
+			}
+			// v4l2-ctl can still describe a device that is in use
+			if errors.Is(err, ErrCameraBusy) {
+				cam.device = device
+				info := cam.getDeviceInfo()
+				info.Busy = true
+				cameras = append(cameras, info)
+			}
 			continue
 		}
 		cameras = append(cameras, cam.GetDeviceInfo())
 		_ = cam.Close()
 	}
+	if len(cameras) == 0 && permErr != nil {
+		return nil, permErr
+	}
 
 	return cameras, nil
 }
 
-// ToImage converts a Frame to a Go image.Image.
+// ToImage converts a Frame to a Go image.Image. Raw frames keep their
+// native depth: GRAY becomes *image.Gray, Y16 *image.Gray16 and YUYV a 4:2:2
+// *image.YCbCr. Frames without a format are decoded as JPEG.
 func (f *Frame) ToImage() (image.Image, error) {
-	return jpeg.Decode(bytes.NewReader(f.Data))
+	rect := image.Rect(0, 0, f.Width, f.Height)
+
+	switch f.Format {
+	case FormatRGB:
+		if err := f.checkSize(3); err != nil {
+			return nil, err
+		}
+		img := image.NewRGBA(rect)
+		for i, j := 0, 0; i < len(f.Data); i, j = i+3, j+4 {
+			img.Pix[j] = f.Data[i]
+			img.Pix[j+1] = f.Data[i+1]
+			img.Pix[j+2] = f.Data[i+2]
+			img.Pix[j+3] = 0xff
+		}
+		return img, nil
+
+	case FormatGray:
+		if err := f.checkSize(1); err != nil {
+			return nil, err
+		}
+		img := image.NewGray(rect)
+		copy(img.Pix, f.Data)
+		return img, nil
+
+	case FormatY16:
+		if err := f.checkSize(2); err != nil {
+			return nil, err
+		}
+		// image.Gray16 stores big-endian samples
+		img := image.NewGray16(rect)
+		for i := 0; i < len(f.Data); i += 2 {
+			img.Pix[i] = f.Data[i+1]
+			img.Pix[i+1] = f.Data[i]
+		}
+		return img, nil
+
+	case FormatYUYV:
+		if err := f.checkSize(2); err != nil {
+			return nil, err
+		}
+		if f.Width%2 != 0 {
+			return nil, fmt.Errorf("invalid %s frame: odd width %d", f.Format, f.Width)
+		}
+		img := image.NewYCbCr(rect, image.YCbCrSubsampleRatio422)
+		for y := 0; y < f.Height; y++ {
+			row := f.Data[y*f.Width*2 : (y+1)*f.Width*2]
+			for x := 0; x < f.Width; x += 2 {
+				p := row[x*2 : x*2+4]
+				img.Y[y*img.YStride+x] = p[0]
+				img.Y[y*img.YStride+x+1] = p[2]
+				img.Cb[y*img.CStride+x/2] = p[1]
+				img.Cr[y*img.CStride+x/2] = p[3]
+			}
+		}
+		return img, nil
+
+	case FormatJPEG, "":
+		return jpeg.Decode(bytes.NewReader(f.Data))
+
+	default:
+		return nil, fmt.Errorf("unsupported frame format: %q", f.Format)
+	}
+}
+
+// checkSize verifies that a raw frame holds Width*Height pixels of the given size.
+func (f *Frame) checkSize(bytesPerPixel int) error {
+	if f.Width <= 0 || f.Height <= 0 || len(f.Data) != f.Width*f.Height*bytesPerPixel {
+		return fmt.Errorf("invalid %s frame: %d bytes for %dx%d", f.Format, len(f.Data), f.Width, f.Height)
+	}
+	return nil
 }
@@ -0,0 +1,136 @@
+package camera
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// CameraCapabilities describes what an opened camera supports, for
+// integrators choosing settings at runtime.
+type CameraCapabilities struct {
+	Device      string `json:"device"`
+	Name        string `json:"name,omitempty"`
+	Driver      string `json:"driver,omitempty"`
+	Network     bool   `json:"network,omitempty"`
+	IR          bool   `json:"ir"`         // IR camera, guessed from the name
+	IREmitter   bool   `json:"ir_emitter"` // see HasIREmitter
+	EmitterTool string `json:"emitter_tool,omitempty"`
+
+	// Formats lists the pixel formats the device offers. It is empty for
+	// network streams and if v4l2-ctl is missing or fails.
+	Formats []FormatCapability `json:"formats,omitempty"`
+}
+
+// FormatCapability is a pixel format offered by a device.
+type FormatCapability struct {
+	FourCC      string       `json:"fourcc"`
+	Description string       `json:"description,omitempty"`
+	PixelFormat string       `json:"pixel_format,omitempty"` // camera.pixel_format value; empty if FacePass cannot capture it
+	Resolutions []Resolution `json:"resolutions,omitempty"`
+}
+
+// Resolution is a frame size. For stepwise and continuous sizes only the
+// largest is listed.
+type Resolution struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (r Resolution) String() string {
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
+
+// Format returns the capability of pixel format (a camera.pixel_format
+// value such as PixelFormatMJPEG), if the device offers it.
+func (c CameraCapabilities) Format(format string) (FormatCapability, bool) {
+	for _, f := range c.Formats {
+		if f.PixelFormat != "" && f.PixelFormat == format {
+			return f, true
+		}
+	}
+	return FormatCapability{}, false
+}
+
+// SupportsMJPEG reports whether the device offers MJPEG, the cheapest
+// format to capture.
+func (c CameraCapabilities) SupportsMJPEG() bool {
+	_, ok := c.Format(PixelFormatMJPEG)
+	return ok
+}
+
+// Capabilities reports the device, IR emitter and format support of the
+// opened camera. Formats are queried with v4l2-ctl on every call.
+func (c *V4L2Camera) Capabilities() CameraCapabilities {
+	caps := CameraCapabilities{
+		Device:    c.deviceInfo.Path,
+		Name:      c.deviceInfo.Name,
+		Driver:    c.deviceInfo.Driver,
+		Network:   c.network,
+		IR:        c.deviceInfo.IsIR,
+		IREmitter: c.HasIREmitter(),
+	}
+	if caps.IREmitter {
+		caps.EmitterTool = c.irEmitter.Tool
+	}
+	if !c.isOpen || c.network {
+		return caps
+	}
+
+	output, err := execCommand("v4l2-ctl", "-d", c.device, "--list-formats-ext").Output()
+	if err != nil {
+		logging.Debugf("Listing formats of %s failed: %v", c.device, err)
+		return caps
+	}
+	caps.Formats = parseFormats(string(output))
+	return caps
+}
+
+// parseFormats parses the output of v4l2-ctl --list-formats-ext:
+//
+//	[0]: 'MJPG' (Motion-JPEG, compressed)
+//		Size: Discrete 640x480
+//			Interval: Discrete 0.033s (30.000 fps)
+//		Size: Stepwise 16x16 - 1920x1080 with step 2/2
+func parseFormats(output string) []FormatCapability {
+	fourccs := make(map[string]string, len(pixelFormats))
+	for name, f := range pixelFormats {
+		fourccs[strings.TrimSpace(f.fourcc)] = name
+	}
+
+	var formats []FormatCapability
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "["):
+			start := strings.Index(line, "'")
+			end := strings.LastIndex(line, "'")
+			if start < 0 || end <= start {
+				continue
+			}
+			f := FormatCapability{FourCC: strings.TrimSpace(line[start+1 : end])}
+			f.PixelFormat = fourccs[f.FourCC]
+			if desc := strings.TrimSpace(line[end+1:]); strings.HasPrefix(desc, "(") {
+				f.Description = strings.TrimSuffix(strings.TrimPrefix(desc, "("), ")")
+			}
+			formats = append(formats, f)
+		case strings.HasPrefix(line, "Size:") && len(formats) > 0:
+			// The largest size is the last WxH field
+			var res Resolution
+			for _, field := range strings.Fields(line)[1:] {
+				var w, h int
+				if _, err := fmt.Sscanf(field, "%dx%d", &w, &h); err == nil {
+					res = Resolution{Width: w, Height: h}
+				}
+			}
+			if res.Width > 0 && res.Height > 0 {
+				last := &formats[len(formats)-1]
+				last.Resolutions = append(last.Resolutions, res)
+			}
+		}
+	}
+	return formats
+}
@@ -0,0 +1,68 @@
+package camera
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	execCommand = fakeExecCommand
+	defer func() { execCommand = exec.Command }()
+
+	c := NewCamera()
+	c.device = "/dev/video2"
+	c.isOpen = true
+	c.deviceInfo = DeviceInfo{Path: "/dev/video2", Name: "Integrated IR Camera", Driver: "uvcvideo", IsIR: true}
+	c.irEmitter = &IREmitter{Available: true, Tool: "linux-enable-ir-emitter"}
+
+	caps := c.Capabilities()
+	if caps.Device != "/dev/video2" || caps.Name != "Integrated IR Camera" || !caps.IR {
+		t.Errorf("unexpected device fields: %+v", caps)
+	}
+	if !caps.IREmitter || caps.EmitterTool != "linux-enable-ir-emitter" {
+		t.Errorf("IREmitter = %v, EmitterTool = %q", caps.IREmitter, caps.EmitterTool)
+	}
+
+	want := []FormatCapability{
+		{FourCC: "MJPG", Description: "Motion-JPEG, compressed", PixelFormat: PixelFormatMJPEG,
+			Resolutions: []Resolution{{640, 480}, {1280, 720}}},
+		{FourCC: "YUYV", Description: "YUYV 4:2:2", PixelFormat: PixelFormatYUYV,
+			Resolutions: []Resolution{{640, 480}}},
+		{FourCC: "Y16", Description: "16-bit Greyscale", PixelFormat: PixelFormatY16,
+			Resolutions: []Resolution{{640, 360}}},
+		{FourCC: "H264", Description: "H.264, compressed",
+			Resolutions: []Resolution{{1920, 1080}}},
+	}
+	if !reflect.DeepEqual(caps.Formats, want) {
+		t.Errorf("Formats = %+v, want %+v", caps.Formats, want)
+	}
+	if !caps.SupportsMJPEG() {
+		t.Error("SupportsMJPEG should be true")
+	}
+	if _, ok := caps.Format(PixelFormatGrey); ok {
+		t.Error("GREY is not offered")
+	}
+}
+
+func TestCapabilities_NoFormats(t *testing.T) {
+	execCommand = func(string, ...string) *exec.Cmd { return exec.Command("false") }
+	defer func() { execCommand = exec.Command }()
+
+	c := NewCamera()
+	c.device = "/dev/video0"
+	c.isOpen = true
+	c.irEmitter = &IREmitter{}
+	caps := c.Capabilities()
+	if caps.IREmitter || caps.EmitterTool != "" || caps.Formats != nil {
+		t.Errorf("unexpected capabilities without v4l2-ctl: %+v", caps)
+	}
+
+	if err := c.Open("rtsp://camera.local/stream"); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	caps = c.Capabilities()
+	if !caps.Network || caps.Formats != nil || caps.SupportsMJPEG() {
+		t.Errorf("unexpected network capabilities: %+v", caps)
+	}
+}
@@ -0,0 +1,75 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// SaturationLevel is the 8-bit luminance at or above which a pixel counts as
+// saturated.
+const SaturationLevel = 250
+
+// ErrOverexposed is returned for frames in which too much of the image is
+// saturated, e.g. an IR sensor in direct sunlight. Faces in such frames are
+// washed out and cannot be detected.
+var ErrOverexposed = errors.New("frame overexposed (too much light)")
+
+// SaturatedFraction returns the fraction of pixels in img whose luminance is
+// at least SaturationLevel.
+func SaturatedFraction(img image.Image) float64 {
+	b := img.Bounds()
+	if b.Empty() {
+		return 0
+	}
+
+	saturated := 0
+	switch img := img.(type) {
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+			for _, v := range row {
+				if v >= SaturationLevel {
+					saturated++
+				}
+			}
+		}
+	case *image.YCbCr:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := img.Y[img.YOffset(b.Min.X, y) : img.YOffset(b.Max.X-1, y)+1]
+			for _, v := range row {
+				if v >= SaturationLevel {
+					saturated++
+				}
+			}
+		}
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y >= SaturationLevel {
+					saturated++
+				}
+			}
+		}
+	}
+
+	return float64(saturated) / float64(b.Dx()*b.Dy())
+}
+
+// CheckExposure returns ErrOverexposed if more than maxSaturated of the
+// frame's pixels are saturated. A maxSaturated of zero or less disables the
+// check.
+func (f *Frame) CheckExposure(maxSaturated float64) error {
+	if maxSaturated <= 0 {
+		return nil
+	}
+	img, err := f.ToImage()
+	if err != nil {
+		return err
+	}
+	if fraction := SaturatedFraction(img); fraction > maxSaturated {
+		return fmt.Errorf("%w: %.0f%% of pixels saturated", ErrOverexposed, fraction*100)
+	}
+	return nil
+}
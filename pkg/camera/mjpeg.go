@@ -0,0 +1,163 @@
+package camera
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JPEG markers needed to split an MJPEG stream into frames.
+const (
+	markerSOI  = 0xD8 // start of image
+	markerEOI  = 0xD9 // end of image
+	markerSOS  = 0xDA // start of scan, followed by entropy-coded data
+	markerTEM  = 0x01
+	markerRST0 = 0xD0
+	markerRST7 = 0xD7
+)
+
+// maxJPEGSize bounds a single MJPEG frame, so a stream that never ends a
+// frame cannot grow the buffer without limit.
+const maxJPEGSize = 16 << 20
+
+// ErrMalformedJPEG is returned when an MJPEG stream does not follow the JPEG
+// segment structure.
+var ErrMalformedJPEG = errors.New("malformed JPEG frame")
+
+// readJPEG reads the next JPEG image from an MJPEG stream, skipping any bytes
+// before its start. Marker segments are skipped by their length, so an FF D9
+// inside an EXIF thumbnail or a comment does not end the frame early; only
+// an EOI marker outside the segments and the entropy-coded data does.
+func readJPEG(r *bufio.Reader) ([]byte, error) {
+	if err := skipToSOI(r); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, 1024*50) // Pre-allocate 50KB
+	data = append(data, 0xFF, markerSOI)
+
+	marker, err := readMarker(r)
+	for {
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxJPEGSize {
+			return nil, fmt.Errorf("%w: larger than %d bytes", ErrMalformedJPEG, maxJPEGSize)
+		}
+		data = append(data, 0xFF, marker)
+
+		switch {
+		case marker == markerEOI:
+			return data, nil
+		case marker == markerTEM || (marker >= markerRST0 && marker <= markerRST7):
+			// Markers without a segment
+			marker, err = readMarker(r)
+			continue
+		}
+
+		if data, err = readSegment(r, data); err != nil {
+			return nil, err
+		}
+		if marker == markerSOS {
+			data, marker, err = readScan(r, data)
+		} else {
+			marker, err = readMarker(r)
+		}
+	}
+}
+
+// skipToSOI discards bytes up to and including the next SOI marker.
+func skipToSOI(r *bufio.Reader) error {
+	for {
+		// ReadSlice is faster than a ReadByte loop
+		if _, err := r.ReadSlice(0xFF); err != nil {
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			return err
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == markerSOI {
+			return nil
+		}
+		if b == 0xFF {
+			_ = r.UnreadByte()
+		}
+	}
+}
+
+// readMarker reads a marker that must follow at the current position and
+// returns its code, skipping fill bytes.
+func readMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, fmt.Errorf("%w: expected marker, got 0x%02X", ErrMalformedJPEG, b)
+	}
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// readSegment appends the length field and payload of a marker segment.
+func readSegment(r *bufio.Reader, data []byte) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := int(length[0])<<8 | int(length[1])
+	if n < 2 {
+		return nil, fmt.Errorf("%w: segment length %d", ErrMalformedJPEG, n)
+	}
+
+	data = append(data, length[:]...)
+	start := len(data)
+	data = append(data, make([]byte, n-2)...)
+	if _, err := io.ReadFull(r, data[start:]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readScan appends entropy-coded data up to the next marker, which it
+// returns. In the scan, 0xFF bytes are followed by 0x00 (stuffing) or a
+// restart marker, which both belong to the data.
+func readScan(r *bufio.Reader, data []byte) ([]byte, byte, error) {
+	for {
+		if len(data) > maxJPEGSize {
+			return nil, 0, fmt.Errorf("%w: larger than %d bytes", ErrMalformedJPEG, maxJPEGSize)
+		}
+		slice, err := r.ReadSlice(0xFF)
+		if err == bufio.ErrBufferFull {
+			data = append(data, slice...)
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		// The 0xFF is appended with the byte after it
+		data = append(data, slice[:len(slice)-1]...)
+
+		b, err := r.ReadByte()
+		for err == nil && b == 0xFF {
+			b, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if b == 0x00 || (b >= markerRST0 && b <= markerRST7) {
+			data = append(data, 0xFF, b)
+			continue
+		}
+		return data, b, nil
+	}
+}
@@ -0,0 +1,71 @@
+//go:build integration
+
+package camera
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// loadRecognizer loads the dlib models from FACEPASS_MODEL_PATH, a list of
+// directories separated like PATH, or skips the test.
+func loadRecognizer(t *testing.T) recognition.Engine {
+	t.Helper()
+	paths := filepath.SplitList(os.Getenv("FACEPASS_MODEL_PATH"))
+	if len(paths) == 0 {
+		t.Skip("FACEPASS_MODEL_PATH not set")
+	}
+	engine, err := recognition.NewEngine(recognition.Options{ModelPaths: paths})
+	if err != nil {
+		t.Skipf("models not available: %v", err)
+	}
+	t.Cleanup(func() { _ = engine.Close() })
+	return engine
+}
+
+func TestRecordedMJPEG_NoFace(t *testing.T) {
+	engine := loadRecognizer(t)
+
+	for i, frame := range streamFrames(t, "testdata/noface.mjpeg") {
+		if _, err := engine.DetectFaces(frame.Data); !errors.Is(err, recognition.ErrNoFaceDetected) {
+			t.Errorf("frame %d: DetectFaces() error = %v, want ErrNoFaceDetected", i, err)
+		}
+	}
+}
+
+// TestRecordedMJPEG_Face needs a recording of a single face in
+// FACEPASS_TEST_FACE_MJPEG or testdata/face.mjpeg, e.g. made with
+// 'facepass capture --count 10' and 'cat frame-*.jpg > face.mjpeg'.
+func TestRecordedMJPEG_Face(t *testing.T) {
+	path := os.Getenv("FACEPASS_TEST_FACE_MJPEG")
+	if path == "" {
+		path = "testdata/face.mjpeg"
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("no face recording: %v", err)
+	}
+	engine := loadRecognizer(t)
+
+	frames := streamFrames(t, path)
+	detected := 0
+	for i, frame := range frames {
+		faces, err := engine.DetectFaces(frame.Data)
+		switch {
+		case errors.Is(err, recognition.ErrNoFaceDetected):
+		case err != nil:
+			t.Errorf("frame %d: DetectFaces() error = %v", i, err)
+		case len(faces) != 1:
+			t.Errorf("frame %d: detected %d faces, want 1", i, len(faces))
+		default:
+			detected++
+		}
+	}
+	// Blur or a blink may hide the face in single frames
+	if detected*2 < len(frames) {
+		t.Errorf("face detected in %d of %d frames", detected, len(frames))
+	}
+}
@@ -0,0 +1,138 @@
+package camera
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// replayMJPEG makes the fake ffmpeg stream the MJPEG file at path.
+func replayMJPEG(t *testing.T, path string) {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cmd := fakeExecCommand(command, args...)
+		cmd.Env = append(cmd.Env, "FACEPASS_TEST_MJPEG="+abs)
+		return cmd
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+}
+
+// streamFrames reads every frame of a replayed MJPEG file through the
+// streaming path.
+func streamFrames(t *testing.T, path string) []*Frame {
+	t.Helper()
+	replayMJPEG(t, path)
+
+	c := NewCamera()
+	if err := c.SetResolution(160, 120); err != nil {
+		t.Fatal(err)
+	}
+	c.device = "/dev/video0"
+	c.isOpen = true
+	if err := c.StartStreaming(); err != nil {
+		t.Fatalf("StartStreaming() error = %v", err)
+	}
+	defer func() { _ = c.StopStreaming() }()
+
+	var frames []*Frame
+	for {
+		frame, err := c.ReadFrame()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame() after %d frames error = %v", len(frames), err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestReadFrame_RecordedMJPEG(t *testing.T) {
+	const path = "testdata/noface.mjpeg"
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := streamFrames(t, path)
+	if len(frames) != 8 {
+		t.Fatalf("read %d frames, want 8", len(frames))
+	}
+
+	// The fixture has nothing between frames, so they must add up to the
+	// whole file: a truncated frame would leave its tail to the next one.
+	var got bytes.Buffer
+	for i, frame := range frames {
+		got.Write(frame.Data)
+		img, err := jpeg.Decode(bytes.NewReader(frame.Data))
+		if err != nil {
+			t.Fatalf("frame %d does not decode: %v", i, err)
+		}
+		if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 120 {
+			t.Errorf("frame %d is %dx%d, want 160x120", i, b.Dx(), b.Dy())
+		}
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("frames add up to %d bytes, want the %d bytes of %s", got.Len(), len(want), path)
+	}
+}
+
+func TestReadJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	frame := encoded.Bytes()
+	// SOI, a DRI segment, and a scan with stuffing, a restart marker and
+	// fill bytes before EOI
+	restart := []byte{
+		0xFF, 0xD8,
+		0xFF, 0xDD, 0x00, 0x04, 0x00, 0x01,
+		0xFF, 0xDA, 0x00, 0x02,
+		0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56,
+		0xFF, 0xFF, 0xD9,
+	}
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "frame", stream: frame, want: frame},
+		{name: "garbage before frame", stream: append([]byte{0x00, 0xFF, 0xFF, 0x12}, frame...), want: frame},
+		{name: "restart markers and fill bytes", stream: restart, want: append(restart[:19:19], 0xFF, 0xD9)},
+		{name: "not a marker after SOI", stream: []byte{0xFF, 0xD8, 'f', 'a', 'k', 'e', 0xFF, 0xD9}, wantErr: ErrMalformedJPEG},
+		{name: "invalid segment length", stream: []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x01}, wantErr: ErrMalformedJPEG},
+		{name: "truncated", stream: frame[:len(frame)/2], wantErr: io.EOF},
+		{name: "empty", stream: nil, wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readJPEG(bufio.NewReader(bytes.NewReader(tt.stream)))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) && !(tt.wantErr == io.EOF && errors.Is(err, io.ErrUnexpectedEOF)) {
+					t.Errorf("readJPEG() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readJPEG() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("readJPEG() = % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
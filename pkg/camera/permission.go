@@ -0,0 +1,81 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// ErrCameraPermission is returned by Open when the camera device exists but
+// the current user may not open it.
+var ErrCameraPermission = errors.New("no permission to access the camera")
+
+// defaultCameraGroup is the group udev gives V4L2 devices on most distributions.
+const defaultCameraGroup = "video"
+
+// PermissionHint explains how to get access to device after Open failed
+// with ErrCameraPermission, based on the group owning the device and the
+// groups of the current user.
+func PermissionHint(device string) string {
+	group, gid := deviceGroup(device)
+	return permissionHint(group, gid != "" && userInGroup(gid))
+}
+
+// permissionHint builds the hint for a device owned by group. inGroup is
+// whether the user is already a member, in which case the membership only
+// needs a new login to take effect.
+func permissionHint(group string, inGroup bool) string {
+	switch {
+	case group == "root":
+		return fmt.Sprintf("the camera is only accessible to root; give it to the '%s' group with a udev rule, e.g.\n"+
+			"  SUBSYSTEM==\"video4linux\", GROUP=\"%s\", MODE=\"0660\"\n"+
+			"and add your user to that group: sudo usermod -aG %s $USER",
+			defaultCameraGroup, defaultCameraGroup, defaultCameraGroup)
+	case inGroup:
+		return fmt.Sprintf("your user is in the '%s' group, but not in this session yet: log out and back in (or run 'newgrp %s')",
+			group, group)
+	default:
+		return fmt.Sprintf("your user needs to be in the '%s' group: sudo usermod -aG %s $USER (then log out and back in)",
+			group, group)
+	}
+}
+
+// deviceGroup returns the name and ID of the group owning device, falling
+// back to the video group if it cannot be determined.
+func deviceGroup(device string) (name, gid string) {
+	info, err := os.Stat(device)
+	if err != nil {
+		return defaultCameraGroup, ""
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return defaultCameraGroup, ""
+	}
+	gid = strconv.FormatUint(uint64(stat.Gid), 10)
+	if group, err := user.LookupGroupId(gid); err == nil {
+		return group.Name, gid
+	}
+	return defaultCameraGroup, gid
+}
+
+// userInGroup reports whether the current user is a member of group gid
+// according to the group database.
+func userInGroup(gid string) bool {
+	u, err := user.Current()
+	if err != nil {
+		return false
+	}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return false
+	}
+	for _, g := range groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
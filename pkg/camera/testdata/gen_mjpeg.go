@@ -0,0 +1,79 @@
+//go:build ignore
+
+// gen_mjpeg writes the MJPEG fixtures used by the camera tests:
+//
+//	go run gen_mjpeg.go
+//
+// noface.mjpeg is a face-free 160x120 grayscale scene with a bar moving
+// across it. Every frame carries an APP1 (EXIF) segment with an embedded
+// JPEG thumbnail and a comment segment; both contain FF D9, which a parser
+// looking only for that marker mistakes for the end of the frame.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"os"
+)
+
+const (
+	width, height = 160, 120
+	frames        = 8
+)
+
+func main() {
+	var stream bytes.Buffer
+	for i := 0; i < frames; i++ {
+		stream.Write(withSegments(encode(scene(i), 75)))
+	}
+	if err := os.WriteFile("noface.mjpeg", stream.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// scene renders a diagonal gradient with a bright bar at a position that
+// depends on the frame number.
+func scene(frame int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			luma := uint8((x + y) * 255 / (width + height))
+			if bar := 20 + frame*15; x >= bar && x < bar+10 {
+				luma = 240
+			}
+			img.SetGray(x, y, color.Gray{Y: luma})
+		}
+	}
+	return img
+}
+
+func encode(img image.Image, quality int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		log.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withSegments inserts an APP1 segment holding a thumbnail and a COM
+// segment ending in FF D9 right after the SOI marker of a JPEG.
+func withSegments(frame []byte) []byte {
+	thumb := image.NewGray(image.Rect(0, 0, 16, 12))
+	exif := append([]byte("Exif\x00\x00"), encode(thumb, 50)...)
+	comment := []byte("facepass fixture \xFF\xD9")
+
+	out := append([]byte{}, frame[:2]...)
+	out = append(out, segment(0xE1, exif)...)
+	out = append(out, segment(0xFE, comment)...)
+	return append(out, frame[2:]...)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
@@ -0,0 +1,139 @@
+package camera
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"time"
+)
+
+// y16JPEGQuality is the quality of the 8-bit JPEG made from Y16 frames.
+// Grayscale JPEGs have no chroma subsampling, so little detail is lost.
+const y16JPEGQuality = 95
+
+// y16OutputArgs makes ffmpeg write raw little-endian 16-bit frames of the
+// configured size to stdout.
+func (c *V4L2Camera) y16OutputArgs() []string {
+	return []string{
+		"-vf", fmt.Sprintf("scale=%d:%d", c.width, c.height),
+		"-f", "rawvideo",
+		"-pix_fmt", "gray16le",
+		"-",
+	}
+}
+
+// y16FrameSize is the number of bytes of one raw Y16 frame.
+func (c *V4L2Camera) y16FrameSize() int {
+	return c.width * c.height * 2
+}
+
+// captureY16 captures a single raw 16-bit frame.
+func (c *V4L2Camera) captureY16() (*Frame, error) {
+	args := append(c.inputArgs(), "-frames:v", "1")
+	cmd := execCommand("ffmpeg", append(args, c.y16OutputArgs()...)...)
+	var stdout bytes.Buffer
+	var stderr stderrTail
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	done := make(chan error, 1)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if stderr.busy() && !c.network {
+				return nil, c.busyError()
+			}
+			return nil, fmt.Errorf("%w: Y16 capture failed: %v", ErrNoFrame, err)
+		}
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		return nil, ErrCaptureTimeout
+	}
+
+	if stdout.Len() < c.y16FrameSize() {
+		return nil, fmt.Errorf("%w: Y16 capture returned %d of %d bytes", ErrNoFrame, stdout.Len(), c.y16FrameSize())
+	}
+	return newY16Frame(stdout.Bytes()[:c.y16FrameSize()], c.width, c.height)
+}
+
+// readY16Frame reads the next raw 16-bit frame from the stream.
+func (c *V4L2Camera) readY16Frame() (*Frame, error) {
+	raw := make([]byte, c.y16FrameSize())
+	if _, err := io.ReadFull(c.streamReader, raw); err != nil {
+		return nil, c.streamError(err)
+	}
+	return newY16Frame(raw, c.width, c.height)
+}
+
+// newY16Frame builds a frame from raw little-endian 16-bit samples. Data
+// holds an 8-bit JPEG for face detection, with the used range of the samples
+// stretched to the full scale (IR sensors often fill only 10 or 12 bits);
+// Y16 keeps the raw samples for IR analysis.
+func newY16Frame(raw []byte, width, height int) (*Frame, error) {
+	frame := &Frame{Data: raw, Width: width, Height: height, Format: FormatY16}
+	if err := frame.checkSize(2); err != nil {
+		return nil, err
+	}
+
+	lo, hi := uint16(0xffff), uint16(0)
+	for i := 0; i < len(raw); i += 2 {
+		v := uint16(raw[i]) | uint16(raw[i+1])<<8
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	if span := uint32(hi) - uint32(lo); span > 0 {
+		for i := 0; i < len(raw); i += 2 {
+			v := uint32(uint16(raw[i]) | uint16(raw[i+1])<<8)
+			gray.Pix[i/2] = uint8((v - uint32(lo)) * 255 / span)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gray, &jpeg.Options{Quality: y16JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode Y16 frame: %w", err)
+	}
+	return &Frame{
+		Data:      buf.Bytes(),
+		Y16:       raw,
+		Width:     width,
+		Height:    height,
+		Format:    FormatJPEG,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// IRHistogram returns the histogram of the raw 16-bit samples of a Y16
+// capture in the given number of bins, or nil for other frames. The bins
+// span the sensor's bit depth, taken as the bits needed for the brightest
+// sample (at least 8), so a 10-bit sensor fills all bins rather than the
+// lowest 1/64 of them.
+func (f *Frame) IRHistogram(bins int) []int {
+	if len(f.Y16) < 2 || bins <= 0 {
+		return nil
+	}
+
+	var hi uint16
+	for i := 0; i+1 < len(f.Y16); i += 2 {
+		hi = max(hi, uint16(f.Y16[i])|uint16(f.Y16[i+1])<<8)
+	}
+	depth := 8
+	for depth < 16 && hi>>depth != 0 {
+		depth++
+	}
+
+	histogram := make([]int, bins)
+	for i := 0; i+1 < len(f.Y16); i += 2 {
+		v := uint64(uint16(f.Y16[i]) | uint16(f.Y16[i+1])<<8)
+		histogram[v*uint64(bins)>>depth]++
+	}
+	return histogram
+}
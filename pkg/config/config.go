@@ -1,88 +1,210 @@
 // Package config provides configuration management for FacePass.
-// It loads configuration from YAML files with sensible defaults.
+// It loads configuration from YAML or TOML files with sensible defaults.
 package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds all FacePass configuration.
 type Config struct {
-	Camera      CameraConfig      `yaml:"camera"`
-	Recognition RecognitionConfig `yaml:"recognition"`
-	Liveness    LivenessConfig    `yaml:"liveness_detection"`
-	Auth        AuthConfig        `yaml:"auth"`
-	Storage     StorageConfig     `yaml:"storage"`
-	Logging     LoggingConfig     `yaml:"logging"`
+	Camera       CameraConfig       `yaml:"camera" toml:"camera"`
+	Recognition  RecognitionConfig  `yaml:"recognition" toml:"recognition"`
+	Liveness     LivenessConfig     `yaml:"liveness_detection" toml:"liveness_detection"`
+	Auth         AuthConfig         `yaml:"auth" toml:"auth"`
+	Storage      StorageConfig      `yaml:"storage" toml:"storage"`
+	Logging      LoggingConfig      `yaml:"logging" toml:"logging"`
+	Acceleration AccelerationConfig `yaml:"acceleration" toml:"acceleration"`
+	Metrics      MetricsConfig      `yaml:"metrics" toml:"metrics"`
 }
 
 // CameraConfig holds camera settings.
 type CameraConfig struct {
-	Device           string `yaml:"device"`
-	Width            int    `yaml:"width"`
-	Height           int    `yaml:"height"`
-	FPS              int    `yaml:"fps"`
-	PreferIR         bool   `yaml:"prefer_ir"`
-	IRDevice         string `yaml:"ir_device"`
-	RGBDevice        string `yaml:"rgb_device"`
-	IREmitterEnabled bool   `yaml:"ir_emitter_enabled"`
-	IREmitterTool    string `yaml:"ir_emitter_tool"`
+	Device           string  `yaml:"device" toml:"device"` // Device node or rtsp:// / http:// stream URL
+	Width            int     `yaml:"width" toml:"width"`
+	Height           int     `yaml:"height" toml:"height"`
+	FPS              int     `yaml:"fps" toml:"fps"`
+	PreferIR         bool    `yaml:"prefer_ir" toml:"prefer_ir"`
+	IRDevice         string  `yaml:"ir_device" toml:"ir_device"`
+	RGBDevice        string  `yaml:"rgb_device" toml:"rgb_device"`
+	IREmitterEnabled bool    `yaml:"ir_emitter_enabled" toml:"ir_emitter_enabled"`
+	IREmitterTool    string  `yaml:"ir_emitter_tool" toml:"ir_emitter_tool"`
+	WarmupFrames     int     `yaml:"warmup_frames" toml:"warmup_frames"`   // Frames discarded before each enrollment capture
+	PixelFormat      string  `yaml:"pixel_format" toml:"pixel_format"`     // "auto", "mjpeg", "yuyv", "grey" or "y16"
+	MaxSaturation    float64 `yaml:"max_saturation" toml:"max_saturation"` // Fraction of saturated pixels that makes a frame overexposed (0 = off)
+	JPEGQuality      int     `yaml:"jpeg_quality" toml:"jpeg_quality"`     // ffmpeg -q:v of captured frames: 1 (best) to 31 (fastest to decode)
 }
 
 // RecognitionConfig holds face recognition settings.
 type RecognitionConfig struct {
-	ConfidenceThreshold float64 `yaml:"confidence_threshold"`
-	Tolerance           float64 `yaml:"tolerance"`
-	ModelPath           string  `yaml:"model_path"`
+	Backend             string   `yaml:"backend" toml:"backend"`   // "dlib" or "onnx"
+	Detector            string   `yaml:"detector" toml:"detector"` // Face detector: "hog" or "cnn" (slower, more robust)
+	ConfidenceThreshold float64  `yaml:"confidence_threshold" toml:"confidence_threshold"`
+	Tolerance           float64  `yaml:"tolerance" toml:"tolerance"`
+	ModelPath           PathList `yaml:"model_path" toml:"model_path"`                       // Model search paths, tried in order for each model file
+	MinEmbeddingQuality float64  `yaml:"min_embedding_quality" toml:"min_embedding_quality"` // Skip enrolled embeddings below this quality (0 = off)
+	NormalizeEmbeddings bool     `yaml:"normalize_embeddings" toml:"normalize_embeddings"`   // L2-normalize embeddings before storing and matching
+	MinFacePx           int      `yaml:"min_face_px" toml:"min_face_px"`                     // Ignore faces smaller than this (0 = off)
+	Padding             float64  `yaml:"padding" toml:"padding"`                             // Padding around the aligned face chip
+	Jitter              int      `yaml:"jitter" toml:"jitter"`                               // Jittered samples per descriptor during enrollment (0 = off)
+	EdgeMargin          int      `yaml:"edge_margin" toml:"edge_margin"`                     // Reject faces within this many pixels of the frame border (0 = off)
+	LandmarkModel       string   `yaml:"landmark_model" toml:"landmark_model"`               // Landmark predictor file name searched for in model_path
+	RecognitionModel    string   `yaml:"recognition_model" toml:"recognition_model"`         // Recognition network file name searched for in model_path
+	Workers             int      `yaml:"workers" toml:"workers"`                             // Frames analyzed in parallel by 'facepass test' (0 = min(CPUs, 4))
+	MaxProcessFPS       int      `yaml:"max_process_fps" toml:"max_process_fps"`             // Frames handed to the workers per second (0 = unlimited)
+	OutlierDistance     float64  `yaml:"outlier_distance" toml:"outlier_distance"`           // Drop frame embeddings this far from the median before averaging (0 = off)
+	IdentityDistance    float64  `yaml:"identity_distance" toml:"identity_distance"`         // Reject a capture whose frames move this far from the first face (0 = off)
+	Preprocess          string   `yaml:"preprocess" toml:"preprocess"`                       // Frame preprocessing before detection: "none" or "clahe"; changing it requires re-enrollment
 }
 
 // LivenessConfig holds liveness detection settings.
 type LivenessConfig struct {
-	Level             string             `yaml:"level"`
-	BlinkRequired     bool               `yaml:"blink_required"`
-	ConsistencyCheck  bool               `yaml:"consistency_check"`
-	ChallengeResponse bool               `yaml:"challenge_response"`
-	IRAnalysis        bool               `yaml:"ir_analysis"`
-	TextureAnalysis   bool               `yaml:"texture_analysis"`
-	MinLivenessScore  float64            `yaml:"min_liveness_score"`
-	MaxAuthTime       int                `yaml:"max_authentication_time"`
-	Thresholds        LivenessThresholds `yaml:"thresholds"`
+	Level             string             `yaml:"level" toml:"level"`
+	BlinkRequired     bool               `yaml:"blink_required" toml:"blink_required"`
+	ConsistencyCheck  bool               `yaml:"consistency_check" toml:"consistency_check"`
+	ChallengeResponse bool               `yaml:"challenge_response" toml:"challenge_response"`
+	IRAnalysis        bool               `yaml:"ir_analysis" toml:"ir_analysis"`
+	TextureAnalysis   bool               `yaml:"texture_analysis" toml:"texture_analysis"`
+	MinLivenessScore  float64            `yaml:"min_liveness_score" toml:"min_liveness_score"`
+	MaxAuthTime       int                `yaml:"max_authentication_time" toml:"max_authentication_time"`
+	DebugSaveSpoofDir string             `yaml:"debug_save_spoof_dir" toml:"debug_save_spoof_dir"` // Save frames of detected spoofs here (empty = off)
+	CrossCheck        bool               `yaml:"cross_check" toml:"cross_check"`                   // Require the face in both ir_device and rgb_device
+	Thresholds        LivenessThresholds `yaml:"thresholds" toml:"thresholds"`
 }
 
 // LivenessThresholds holds specific thresholds for liveness checks.
 type LivenessThresholds struct {
-	Movement    float64 `yaml:"movement"`    // Min movement to not be a static image
-	Depth       float64 `yaml:"depth"`       // Min variance for 3D depth check
-	Consistency float64 `yaml:"consistency"` // Max variance for consistency check
+	Movement    float64 `yaml:"movement" toml:"movement"`         // Min movement to not be a static image
+	Depth       float64 `yaml:"depth" toml:"depth"`               // Min variance for 3D depth check
+	Consistency float64 `yaml:"consistency" toml:"consistency"`   // Max variance for consistency check
+	CrossOffset float64 `yaml:"cross_offset" toml:"cross_offset"` // Max IR/RGB face center offset for cross_check, relative to the frame size
 }
 
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
-	Enabled         bool `yaml:"enabled"`
-	Timeout         int  `yaml:"timeout"`
-	MaxAttempts     int  `yaml:"max_attempts"`
-	FallbackEnabled bool `yaml:"fallback_enabled"`
+	Enabled         bool                 `yaml:"enabled" toml:"enabled"`
+	Timeout         int                  `yaml:"timeout" toml:"timeout"`
+	MaxAttempts     int                  `yaml:"max_attempts" toml:"max_attempts"`
+	RetryDelayMS    int                  `yaml:"retry_delay_ms" toml:"retry_delay_ms"` // Pause between attempts (0 = none)
+	RetryPrompt     bool                 `yaml:"retry_prompt" toml:"retry_prompt"`     // Ask the user to reposition between attempts
+	FallbackEnabled bool                 `yaml:"fallback_enabled" toml:"fallback_enabled"`
+	TemplateUpdate  TemplateUpdateConfig `yaml:"template_update" toml:"template_update"`
+
+	// MinConfidenceMargin rejects matches unless their distance is below
+	// recognition.tolerance minus this margin (0 = off)
+	MinConfidenceMargin float64 `yaml:"min_confidence_margin" toml:"min_confidence_margin"`
+
+	// MinMatchingEmbeddings is how many of the user's embeddings must be
+	// within tolerance, capped at the number enrolled (1 = best match only)
+	MinMatchingEmbeddings int `yaml:"min_matching_embeddings" toml:"min_matching_embeddings"`
+
+	// CaptureFrames is how many frames each attempt captures for liveness
+	// detection and recognition
+	CaptureFrames int `yaml:"capture_frames" toml:"capture_frames"`
+
+	// CameraGraceSeconds keeps the camera and IR emitter on this long after a
+	// successful authentication, so a quick follow-up skips their startup
+	// (0 = release immediately). Only long-running processes such as
+	// facepass serve and watch keep it; the PAM helper exits after each
+	// authentication.
+	CameraGraceSeconds int `yaml:"camera_grace_seconds" toml:"camera_grace_seconds"`
+}
+
+// TemplateUpdateConfig holds settings for automatic re-enrollment after successful authentication.
+type TemplateUpdateConfig struct {
+	Enabled       bool    `yaml:"enabled" toml:"enabled"`
+	Margin        float64 `yaml:"margin" toml:"margin"`                 // Distance must be below tolerance - margin
+	MaxEmbeddings int     `yaml:"max_embeddings" toml:"max_embeddings"` // Oldest embeddings are evicted beyond this
 }
 
 // StorageConfig holds storage settings.
 type StorageConfig struct {
-	DataDir           string `yaml:"data_dir"`
-	EncryptionEnabled bool   `yaml:"encryption_enabled"`
+	Backend           string `yaml:"backend" toml:"backend"` // "file" or "sqlite"
+	DataDir           string `yaml:"data_dir" toml:"data_dir"`
+	EncryptionEnabled bool   `yaml:"encryption_enabled" toml:"encryption_enabled"`
+	KeySource         string `yaml:"key_source" toml:"key_source"`                 // "machine", "file", or "env"
+	KeyFile           string `yaml:"key_file" toml:"key_file"`                     // Used when key_source is "file"
+	Compress          bool   `yaml:"compress" toml:"compress"`                     // Gzip user data before encryption
+	LastUsedInterval  int    `yaml:"last_used_interval" toml:"last_used_interval"` // Seconds between last-used writes (0 = every auth)
+}
+
+// AccelerationConfig holds GPU/NPU acceleration settings for the ONNX backend.
+type AccelerationConfig struct {
+	Backend         string `yaml:"backend" toml:"backend"`                 // "auto", "cpu", "rocm", "cuda", or "openvino"
+	FallbackToCPU   bool   `yaml:"fallback_to_cpu" toml:"fallback_to_cpu"` // Use dlib if the ONNX engine cannot be initialized
+	DeviceIndex     int    `yaml:"device_index" toml:"device_index"`
+	EnableProfiling bool   `yaml:"enable_profiling" toml:"enable_profiling"`
+	ONNXModelPath   string `yaml:"onnx_model_path" toml:"onnx_model_path"`
+}
+
+// MetricsConfig holds settings for the Prometheus metrics endpoint.
+type MetricsConfig struct {
+	Listen string `yaml:"listen" toml:"listen"` // host:port serving /metrics; empty disables the endpoint
 }
 
 // LoggingConfig holds logging settings.
 type LoggingConfig struct {
-	Level string `yaml:"level"`
-	File  string `yaml:"file"`
+	Level      string `yaml:"level" toml:"level"`
+	Format     string `yaml:"format" toml:"format"`
+	Output     string `yaml:"output" toml:"output"` // "stderr", "file" or "syslog"; empty: file for the CLI, syslog for the PAM helper
+	File       string `yaml:"file" toml:"file"`
+	MaxSizeMB  int    `yaml:"max_size_mb" toml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups"`
+	MaxAgeDays int    `yaml:"max_age_days" toml:"max_age_days"`
+}
+
+// Low-power defaults for single-board computers such as the Raspberry Pi,
+// where analyzing 30 frames of 640x480 takes several seconds per attempt.
+// Faces need to be closer to the camera at the lower resolution.
+const (
+	lowPowerWidth         = 320
+	lowPowerHeight        = 240
+	lowPowerCaptureFrames = 15
+	lowPowerMaxCPUs       = 2
+)
+
+// minCaptureFrames is the fewest frames per attempt that still give the
+// liveness checks, e.g. blink detection, something to work with.
+const minCaptureFrames = 10
+
+// maxCameraGraceSeconds bounds how long the camera, and with it the camera
+// LED and IR emitter, may stay on after an authentication.
+const maxCameraGraceSeconds = 60
+
+// lowPowerHost reports whether DefaultConfig picks the low-power defaults:
+// on ARM, or with at most lowPowerMaxCPUs CPUs. A variable for tests.
+var lowPowerHost = func() bool {
+	return runtime.GOARCH == "arm64" || runtime.GOARCH == "arm" || runtime.NumCPU() <= lowPowerMaxCPUs
 }
 
-// DefaultConfig returns the default configuration.
+// LowPowerDefaults reports whether DefaultConfig uses the lighter defaults
+// for low-power hosts (smaller capture resolution, fewer frames).
+func LowPowerDefaults() bool {
+	return lowPowerHost()
+}
+
+// DefaultConfig returns the default configuration. On low-power hosts (see
+// LowPowerDefaults) it captures fewer, smaller frames.
 func DefaultConfig() *Config {
+	config := defaultConfig()
+	if lowPowerHost() {
+		config.Camera.Width = lowPowerWidth
+		config.Camera.Height = lowPowerHeight
+		config.Auth.CaptureFrames = lowPowerCaptureFrames
+	}
+	return config
+}
+
+// defaultConfig returns the defaults for regular hosts.
+func defaultConfig() *Config {
 	homeDir, _ := os.UserHomeDir()
 	return &Config{
 		Camera: CameraConfig{
@@ -95,11 +217,23 @@ func DefaultConfig() *Config {
 			RGBDevice:        "/dev/video0",
 			IREmitterEnabled: true,
 			IREmitterTool:    "linux-enable-ir-emitter",
+			WarmupFrames:     3,
+			PixelFormat:      "auto",
+			MaxSaturation:    0.3,
+			JPEGQuality:      2,
 		},
 		Recognition: RecognitionConfig{
+			Backend:             "dlib",
+			Detector:            "hog",
 			ConfidenceThreshold: 0.6,
 			Tolerance:           0.4,
-			ModelPath:           filepath.Join(homeDir, ".local/share/facepass/models"),
+			ModelPath:           PathList{filepath.Join(homeDir, ".local/share/facepass/models")},
+			Padding:             0.25,
+			LandmarkModel:       "shape_predictor_5_face_landmarks.dat",
+			RecognitionModel:    "dlib_face_recognition_resnet_model_v1.dat",
+			OutlierDistance:     0.3,
+			IdentityDistance:    0.6,
+			Preprocess:          "none",
 		},
 		Liveness: LivenessConfig{
 			Level:             "standard",
@@ -112,28 +246,51 @@ func DefaultConfig() *Config {
 			MaxAuthTime:       10,
 			Thresholds: LivenessThresholds{
 				Movement:    0.08,
-				Depth:       0.0001,
+				Depth:       0.00005,
 				Consistency: 0.1,
+				CrossOffset: 0.15,
 			},
 		},
 		Auth: AuthConfig{
 			Enabled:         true,
 			Timeout:         10,
 			MaxAttempts:     3,
+			RetryDelayMS:    500,
+			RetryPrompt:     true,
 			FallbackEnabled: true,
+			TemplateUpdate: TemplateUpdateConfig{
+				Enabled:       false,
+				Margin:        0.15,
+				MaxEmbeddings: 20,
+			},
+			MinMatchingEmbeddings: 1,
+			CaptureFrames:         30,
 		},
 		Storage: StorageConfig{
+			Backend:           "file",
 			DataDir:           filepath.Join(homeDir, ".local/share/facepass"),
 			EncryptionEnabled: true,
+			KeySource:         "machine",
+			LastUsedInterval:  60,
 		},
 		Logging: LoggingConfig{
-			Level: "info",
-			File:  filepath.Join(homeDir, ".local/share/facepass/facepass.log"),
+			Level:      "info",
+			Format:     "text",
+			File:       filepath.Join(homeDir, ".local/share/facepass/facepass.log"),
+			MaxSizeMB:  10,
+			MaxBackups: 3,
+			MaxAgeDays: 28,
+		},
+		Acceleration: AccelerationConfig{
+			Backend:       "auto",
+			FallbackToCPU: true,
+			ONNXModelPath: "/usr/share/facepass/models/onnx",
 		},
 	}
 }
 
-// Load loads configuration from the specified file.
+// Load loads configuration from the specified file. Files ending in .toml
+// are parsed as TOML, anything else as YAML.
 func Load(path string) (*Config, error) {
 	config := DefaultConfig()
 
@@ -142,33 +299,128 @@ func Load(path string) (*Config, error) {
 		return config, err
 	}
 
-	if err := yaml.Unmarshal(data, config); err != nil {
+	if err := unmarshal(path, data, config); err != nil {
 		return config, err
 	}
 
 	return config, nil
 }
 
-// LoadDefault tries to load configuration from default locations.
-func LoadDefault() (*Config, error) {
-	// Try system config first
-	if _, err := os.Stat("/etc/facepass/facepass.yaml"); err == nil {
-		return Load("/etc/facepass/facepass.yaml")
+// unmarshal decodes data into config in the format given by the extension
+// of path: TOML for .toml, otherwise YAML (.yaml, .yml or none).
+func unmarshal(path string, data []byte, config *Config) error {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return toml.Unmarshal(data, config)
 	}
+	return yaml.Unmarshal(data, config)
+}
+
+// maxMovementThreshold is the movement at which the liveness detector treats
+// frames as a face swap instead of head movement.
+const maxMovementThreshold = 0.6
 
-	// Try user config
+// SystemConfigPath is the location of the system-wide configuration file.
+const SystemConfigPath = "/etc/facepass/facepass.yaml"
+
+// UserConfigPath returns the location of the per-user configuration file.
+func UserConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return DefaultConfig(), nil
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config/facepass/facepass.yaml"), nil
+}
+
+// LoadDefault loads the system config and merges the user config on top of
+// it, so the user file only needs the settings it changes. Missing files are
+// skipped; with neither present the defaults are returned.
+func LoadDefault() (*Config, error) {
+	paths := []string{SystemConfigPath}
+	if userConfig, err := UserConfigPath(); err == nil {
+		paths = append(paths, userConfig)
+	}
+	return LoadLayered(paths...)
+}
+
+// LoadLayered applies each existing config file in order on top of the
+// defaults. Settings absent from a file keep their previous value.
+func LoadLayered(paths ...string) (*Config, error) {
+	config := DefaultConfig()
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return config, err
+		}
+		if err := unmarshal(path, data, config); err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return config, nil
+}
+
+// PathList is a list of search paths. In YAML and TOML it may be written as
+// a single string or as a list of strings.
+type PathList []string
+
+// UnmarshalYAML accepts either a scalar path or a sequence of paths.
+func (p *PathList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var path string
+		if err := value.Decode(&path); err != nil {
+			return err
+		}
+		*p = PathList{path}
+		return nil
+	}
+
+	var paths []string
+	if err := value.Decode(&paths); err != nil {
+		return err
+	}
+	*p = paths
+	return nil
+}
+
+// UnmarshalTOML accepts either a string path or an array of paths.
+func (p *PathList) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*p = PathList{v}
+	case []interface{}:
+		paths := make(PathList, 0, len(v))
+		for _, item := range v {
+			path, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("path list entries must be strings, got %T", item)
+			}
+			paths = append(paths, path)
+		}
+		*p = paths
+	default:
+		return fmt.Errorf("path list must be a string or an array of strings, got %T", value)
 	}
+	return nil
+}
 
-	userConfig := filepath.Join(homeDir, ".config/facepass/facepass.yaml")
-	if _, err := os.Stat(userConfig); err == nil {
-		return Load(userConfig)
+// MarshalYAML writes a single path as a scalar for readability.
+func (p PathList) MarshalYAML() (interface{}, error) {
+	if len(p) == 1 {
+		return p[0], nil
 	}
+	return []string(p), nil
+}
 
-	// Return defaults
-	return DefaultConfig(), nil
+// Primary returns the first path, which is used when writing files.
+func (p PathList) Primary() string {
+	if len(p) == 0 {
+		return ""
+	}
+	return p[0]
 }
 
 // ExpandPath expands ~ and environment variables in a path.
@@ -191,14 +443,75 @@ func (c *Config) Validate() error {
 	if c.Camera.FPS <= 0 {
 		return fmt.Errorf("invalid camera FPS: %d", c.Camera.FPS)
 	}
+	if c.Camera.WarmupFrames < 0 || c.Camera.WarmupFrames > 100 {
+		return fmt.Errorf("warmup_frames must be between 0 and 100, got %d", c.Camera.WarmupFrames)
+	}
+	if c.Camera.MaxSaturation < 0 || c.Camera.MaxSaturation > 1 {
+		return fmt.Errorf("max_saturation must be between 0 and 1, got %f", c.Camera.MaxSaturation)
+	}
+	if c.Camera.JPEGQuality < 1 || c.Camera.JPEGQuality > 31 {
+		return fmt.Errorf("jpeg_quality must be between 1 and 31, got %d", c.Camera.JPEGQuality)
+	}
+	switch c.Camera.PixelFormat {
+	case "auto", "mjpeg", "yuyv", "grey", "y16":
+	default:
+		return fmt.Errorf("invalid camera pixel_format: %s (must be auto, mjpeg, yuyv, grey or y16)", c.Camera.PixelFormat)
+	}
 
 	// Validate recognition settings
+	if c.Recognition.Backend != "dlib" && c.Recognition.Backend != "onnx" {
+		return fmt.Errorf("invalid recognition backend: %s (must be dlib or onnx)", c.Recognition.Backend)
+	}
+	if c.Recognition.Detector != "hog" && c.Recognition.Detector != "cnn" {
+		return fmt.Errorf("invalid recognition detector: %s (must be hog or cnn)", c.Recognition.Detector)
+	}
+	if c.Recognition.Preprocess != "none" && c.Recognition.Preprocess != "clahe" {
+		return fmt.Errorf("invalid recognition preprocess: %s (must be none or clahe)", c.Recognition.Preprocess)
+	}
 	if c.Recognition.ConfidenceThreshold < 0 || c.Recognition.ConfidenceThreshold > 1 {
 		return fmt.Errorf("confidence_threshold must be between 0 and 1, got %f", c.Recognition.ConfidenceThreshold)
 	}
 	if c.Recognition.Tolerance < 0 || c.Recognition.Tolerance > 1 {
 		return fmt.Errorf("tolerance must be between 0 and 1, got %f", c.Recognition.Tolerance)
 	}
+	if len(c.Recognition.ModelPath) == 0 {
+		return fmt.Errorf("model_path must contain at least one directory")
+	}
+	if c.Recognition.MinEmbeddingQuality < 0 || c.Recognition.MinEmbeddingQuality > 1 {
+		return fmt.Errorf("min_embedding_quality must be between 0 and 1, got %f", c.Recognition.MinEmbeddingQuality)
+	}
+	if c.Recognition.MinFacePx < 0 {
+		return fmt.Errorf("min_face_px must not be negative, got %d", c.Recognition.MinFacePx)
+	}
+	if c.Recognition.Padding < 0 || c.Recognition.Padding > 1 {
+		return fmt.Errorf("padding must be between 0 and 1, got %f", c.Recognition.Padding)
+	}
+	if c.Recognition.Jitter < 0 || c.Recognition.Jitter > 100 {
+		return fmt.Errorf("jitter must be between 0 and 100, got %d", c.Recognition.Jitter)
+	}
+	if c.Recognition.EdgeMargin < 0 {
+		return fmt.Errorf("edge_margin must not be negative, got %d", c.Recognition.EdgeMargin)
+	}
+	if c.Recognition.Workers < 0 {
+		return fmt.Errorf("workers must not be negative, got %d", c.Recognition.Workers)
+	}
+	if c.Recognition.MaxProcessFPS < 0 {
+		return fmt.Errorf("max_process_fps must not be negative, got %d", c.Recognition.MaxProcessFPS)
+	}
+	if c.Recognition.OutlierDistance < 0 {
+		return fmt.Errorf("outlier_distance must not be negative, got %f", c.Recognition.OutlierDistance)
+	}
+	if c.Recognition.IdentityDistance < 0 {
+		return fmt.Errorf("identity_distance must not be negative, got %f", c.Recognition.IdentityDistance)
+	}
+	for key, name := range map[string]string{
+		"landmark_model":    c.Recognition.LandmarkModel,
+		"recognition_model": c.Recognition.RecognitionModel,
+	} {
+		if name == "" || name != filepath.Base(name) {
+			return fmt.Errorf("%s must be a file name inside model_path, got %q", key, name)
+		}
+	}
 
 	// Validate liveness settings
 	validLevels := map[string]bool{"basic": true, "standard": true, "strict": true, "paranoid": true}
@@ -208,6 +521,25 @@ func (c *Config) Validate() error {
 	if c.Liveness.MinLivenessScore < 0 || c.Liveness.MinLivenessScore > 1 {
 		return fmt.Errorf("min_liveness_score must be between 0 and 1, got %f", c.Liveness.MinLivenessScore)
 	}
+	if c.Liveness.MaxAuthTime <= 0 {
+		return fmt.Errorf("max_authentication_time must be positive, got %d", c.Liveness.MaxAuthTime)
+	}
+	// Movement above 0.6 is rejected as a face swap, so the threshold must stay below it
+	if t := c.Liveness.Thresholds.Movement; t < 0 || t >= maxMovementThreshold {
+		return fmt.Errorf("thresholds.movement must be between 0 and %.1f, got %f", maxMovementThreshold, t)
+	}
+	if t := c.Liveness.Thresholds.Depth; t < 0 || t > 1 {
+		return fmt.Errorf("thresholds.depth must be between 0 and 1, got %f", t)
+	}
+	if t := c.Liveness.Thresholds.Consistency; t < 0 || t > 1 {
+		return fmt.Errorf("thresholds.consistency must be between 0 and 1, got %f", t)
+	}
+	if t := c.Liveness.Thresholds.CrossOffset; t < 0 || t > 1 {
+		return fmt.Errorf("thresholds.cross_offset must be between 0 and 1, got %f", t)
+	}
+	if c.Liveness.CrossCheck && (c.Camera.IRDevice == "" || c.Camera.RGBDevice == "" || c.Camera.IRDevice == c.Camera.RGBDevice) {
+		return fmt.Errorf("cross_check needs two cameras: set camera.ir_device and camera.rgb_device to different devices")
+	}
 
 	// Validate auth settings
 	if c.Auth.Timeout <= 0 {
@@ -216,24 +548,168 @@ func (c *Config) Validate() error {
 	if c.Auth.MaxAttempts <= 0 {
 		return fmt.Errorf("max_attempts must be positive, got %d", c.Auth.MaxAttempts)
 	}
+	if c.Auth.MinConfidenceMargin < 0 || c.Auth.MinConfidenceMargin >= c.Recognition.Tolerance {
+		return fmt.Errorf("min_confidence_margin must be between 0 and tolerance (%.2f), got %f", c.Recognition.Tolerance, c.Auth.MinConfidenceMargin)
+	}
+	if c.Auth.MinMatchingEmbeddings < 1 {
+		return fmt.Errorf("min_matching_embeddings must be at least 1, got %d", c.Auth.MinMatchingEmbeddings)
+	}
+	if c.Auth.CaptureFrames < minCaptureFrames {
+		return fmt.Errorf("capture_frames must be at least %d, got %d", minCaptureFrames, c.Auth.CaptureFrames)
+	}
+	if c.Auth.CameraGraceSeconds < 0 || c.Auth.CameraGraceSeconds > maxCameraGraceSeconds {
+		return fmt.Errorf("camera_grace_seconds must be between 0 and %d, got %d", maxCameraGraceSeconds, c.Auth.CameraGraceSeconds)
+	}
+	if c.Auth.RetryDelayMS < 0 {
+		return fmt.Errorf("retry_delay_ms must not be negative, got %d", c.Auth.RetryDelayMS)
+	}
+	if c.Auth.TemplateUpdate.Enabled {
+		if c.Auth.TemplateUpdate.Margin < 0 || c.Auth.TemplateUpdate.Margin >= c.Recognition.Tolerance {
+			return fmt.Errorf("template_update.margin must be between 0 and tolerance (%.2f), got %f", c.Recognition.Tolerance, c.Auth.TemplateUpdate.Margin)
+		}
+		if c.Auth.TemplateUpdate.MaxEmbeddings <= 0 {
+			return fmt.Errorf("template_update.max_embeddings must be positive, got %d", c.Auth.TemplateUpdate.MaxEmbeddings)
+		}
+	}
+
+	// Validate storage settings
+	if c.Storage.Backend != "file" && c.Storage.Backend != "sqlite" {
+		return fmt.Errorf("invalid storage backend: %s (must be file or sqlite)", c.Storage.Backend)
+	}
+	validKeySources := map[string]bool{"machine": true, "file": true, "env": true}
+	if !validKeySources[c.Storage.KeySource] {
+		return fmt.Errorf("invalid key_source: %s (must be machine, file, or env)", c.Storage.KeySource)
+	}
+	if c.Storage.KeySource == "file" && c.Storage.KeyFile == "" {
+		return fmt.Errorf("key_file is required when key_source is file")
+	}
+	if c.Storage.LastUsedInterval < 0 {
+		return fmt.Errorf("last_used_interval must not be negative, got %d", c.Storage.LastUsedInterval)
+	}
+
+	// Validate acceleration settings
+	validAccelBackends := map[string]bool{"auto": true, "cpu": true, "rocm": true, "cuda": true, "openvino": true}
+	if !validAccelBackends[c.Acceleration.Backend] {
+		return fmt.Errorf("invalid acceleration backend: %s (must be auto, cpu, rocm, cuda, or openvino)", c.Acceleration.Backend)
+	}
+	if c.Acceleration.DeviceIndex < 0 {
+		return fmt.Errorf("device_index must not be negative, got %d", c.Acceleration.DeviceIndex)
+	}
+
+	// Validate metrics settings
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			return fmt.Errorf("invalid metrics listen address: %s (must be host:port)", c.Metrics.Listen)
+		}
+	}
 
 	// Validate logging level
 	validLogLevels := map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
 	if !validLogLevels[c.Logging.Level] {
 		return fmt.Errorf("invalid log level: %s (must be debug, info, warn, or error)", c.Logging.Level)
 	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		return fmt.Errorf("invalid log format: %s (must be text or json)", c.Logging.Format)
+	}
+	switch c.Logging.Output {
+	case "", "stderr", "file", "syslog":
+	default:
+		return fmt.Errorf("invalid log output: %s (must be stderr, file or syslog)", c.Logging.Output)
+	}
+	if c.Logging.MaxSizeMB < 0 || c.Logging.MaxBackups < 0 || c.Logging.MaxAgeDays < 0 {
+		return fmt.Errorf("log rotation settings must not be negative")
+	}
 
 	return nil
 }
 
-// ExpandPaths expands all paths in the configuration.
+// Warnings returns non-fatal configuration problems, such as camera devices
+// that do not exist on this machine. Paths should be expanded first.
+func (c *Config) Warnings() []string {
+	var warnings []string
+
+	if c.Camera.PreferIR && c.Camera.IRDevice != "" {
+		if _, err := os.Stat(c.Camera.IRDevice); err != nil {
+			warnings = append(warnings, fmt.Sprintf("prefer_ir is set but ir_device %s does not exist", c.Camera.IRDevice))
+		}
+	}
+	seen := map[string]bool{c.Camera.IRDevice: c.Camera.PreferIR}
+	for _, device := range []string{c.Camera.Device, c.Camera.RGBDevice} {
+		if device == "" || seen[device] {
+			continue
+		}
+		seen[device] = true
+		if isStreamURL(device) {
+			continue
+		}
+		if _, err := os.Stat(device); err != nil {
+			warnings = append(warnings, fmt.Sprintf("camera device %s does not exist", device))
+		}
+	}
+
+	if lowPowerHost() && c.Camera.Width*c.Camera.Height > defaultConfig().Camera.Width*defaultConfig().Camera.Height {
+		warnings = append(warnings, fmt.Sprintf("capture resolution %dx%d is slow to analyze on this low-power host; %dx%d is recommended",
+			c.Camera.Width, c.Camera.Height, lowPowerWidth, lowPowerHeight))
+	}
+
+	return warnings
+}
+
+// PAMWarnings returns Warnings plus the problems that only matter to the
+// PAM helper, which runs once per authentication.
+func (c *Config) PAMWarnings() []string {
+	warnings := c.Warnings()
+	if c.Auth.CameraGraceSeconds > 0 {
+		warnings = append(warnings, "camera_grace_seconds has no effect on PAM authentication; "+
+			"it only applies to facepass serve and watch")
+	}
+	return warnings
+}
+
+// ResolveDataDir returns the absolute data directory and whether it lies in
+// the home directory of the user running FacePass. Such a directory depends
+// on who runs the command: data enrolled with sudo ends up under /root and is
+// not found by the user, and data enrolled as the user is not found by PAM
+// running as root.
+func (c *Config) ResolveDataDir() (string, bool) {
+	dir := ExpandPath(c.Storage.DataDir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil || homeDir == "" {
+		return dir, false
+	}
+	rel, err := filepath.Rel(homeDir, dir)
+	if err != nil {
+		return dir, false
+	}
+	return dir, rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isStreamURL reports whether a camera device is a network stream URL such
+// as rtsp://camera.local/stream rather than a device node.
+func isStreamURL(device string) bool {
+	return strings.Contains(device, "://")
+}
+
+// ExpandPaths expands all paths in the configuration. Stream URLs are kept
+// as is, so a "$" in a password is not taken for a variable.
 func (c *Config) ExpandPaths() {
-	c.Camera.Device = ExpandPath(c.Camera.Device)
+	if !isStreamURL(c.Camera.Device) {
+		c.Camera.Device = ExpandPath(c.Camera.Device)
+	}
 	c.Camera.IRDevice = ExpandPath(c.Camera.IRDevice)
 	c.Camera.RGBDevice = ExpandPath(c.Camera.RGBDevice)
-	c.Recognition.ModelPath = ExpandPath(c.Recognition.ModelPath)
+	for i, path := range c.Recognition.ModelPath {
+		c.Recognition.ModelPath[i] = ExpandPath(path)
+	}
 	c.Storage.DataDir = ExpandPath(c.Storage.DataDir)
+	c.Storage.KeyFile = ExpandPath(c.Storage.KeyFile)
 	c.Logging.File = ExpandPath(c.Logging.File)
+	c.Liveness.DebugSaveSpoofDir = ExpandPath(c.Liveness.DebugSaveSpoofDir)
+	c.Acceleration.ONNXModelPath = ExpandPath(c.Acceleration.ONNXModelPath)
 }
 
 // EnsureDirectories creates necessary directories for storage and logging.
@@ -249,9 +725,11 @@ func (c *Config) EnsureDirectories() error {
 		return fmt.Errorf("failed to create users directory: %w", err)
 	}
 
-	// Create models directory
-	if err := os.MkdirAll(c.Recognition.ModelPath, 0755); err != nil {
-		return fmt.Errorf("failed to create models directory: %w", err)
+	// Create the primary models directory
+	if modelDir := c.Recognition.ModelPath.Primary(); modelDir != "" {
+		if err := os.MkdirAll(modelDir, 0755); err != nil {
+			return fmt.Errorf("failed to create models directory: %w", err)
+		}
 	}
 
 	// Create log directory
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of environment variables that override config fields.
+const EnvPrefix = "FACEPASS_"
+
+// ApplyEnvOverrides sets config fields from environment variables named
+// FACEPASS_<SECTION>_<FIELD>, using the upper-cased YAML keys, e.g.
+// FACEPASS_RECOGNITION_TOLERANCE=0.45 or
+// FACEPASS_LIVENESS_DETECTION_THRESHOLDS_MOVEMENT=0.1. Path lists are split
+// on ':'. If any override was applied the result is validated.
+//
+// The PAM helper must not call this: its environment may be controlled by
+// the user being authenticated.
+func (c *Config) ApplyEnvOverrides() error {
+	applied, err := applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix)
+	if err != nil {
+		return err
+	}
+	if applied {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid environment override: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyEnv walks the yaml-tagged fields of the struct v and applies matching
+// environment variables. It reports whether any variable was applied.
+func applyEnv(v reflect.Value, prefix string) (bool, error) {
+	applied := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(tag)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			ok, err := applyEnv(field, name+"_")
+			if err != nil {
+				return false, err
+			}
+			applied = applied || ok
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return false, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		applied = true
+	}
+	return applied, nil
+}
+
+// setField parses value into field according to its kind.
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		parts := strings.Split(value, ":")
+		list := reflect.MakeSlice(field.Type(), 0, len(parts))
+		for _, part := range parts {
+			if part != "" {
+				list = reflect.Append(list, reflect.ValueOf(part))
+			}
+		}
+		field.Set(list)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrConfigExists is returned by WriteFile when the target file already exists.
+var ErrConfigExists = errors.New("config file already exists")
+
+// configHeader is written at the top of generated config files.
+const configHeader = `# FacePass Configuration
+#
+# Generated by 'facepass config init'. Values are the built-in defaults;
+# remove a setting to keep following the default.
+
+`
+
+// fieldComments documents each setting in generated config files, keyed by
+// the dotted YAML path.
+var fieldComments = map[string]string{
+	"camera":                    "Camera settings",
+	"camera.device":             "Camera device used when no IR/RGB preference applies, or an rtsp:// / http:// stream URL",
+	"camera.width":              "Capture resolution and frame rate",
+	"camera.prefer_ir":          "Prefer the IR camera when available",
+	"camera.ir_device":          "IR camera device (usually video2 on laptops with IR)",
+	"camera.rgb_device":         "Regular camera fallback",
+	"camera.ir_emitter_enabled": "Turn on the IR emitter before capturing",
+	"camera.ir_emitter_tool":    "IR emitter control: linux-enable-ir-emitter or sysfs",
+	"camera.warmup_frames":      "Frames discarded before each enrollment capture so exposure can settle",
+	"camera.pixel_format":       "Capture pixel format: auto, mjpeg, yuyv, grey or y16 (forces IR or color on shared nodes)",
+	"camera.max_saturation":     "Report frames with more saturated pixels than this fraction as too bright (0 = off)",
+	"camera.jpeg_quality":       "JPEG quality of captured frames: 1 (best) to 31 (fastest to decode)",
+
+	"recognition":                       "Recognition settings",
+	"recognition.backend":               "Recognition engine: dlib or onnx (see acceleration)",
+	"recognition.detector":              "Face detector: hog (fast) or cnn (more robust on IR and odd angles, ~10-20x slower)",
+	"recognition.confidence_threshold":  "Lower = more strict (less false positives)",
+	"recognition.tolerance":             "Distance tolerance for face matching",
+	"recognition.model_path":            "Directory with dlib models, or a list of directories searched in order",
+	"recognition.min_embedding_quality": "Ignore enrolled embeddings with quality below this (0-1, 0 = off)",
+	"recognition.normalize_embeddings":  "L2-normalize embeddings before storing and comparing",
+	"recognition.min_face_px":           "Ignore faces smaller than this many pixels (0 = off)",
+	"recognition.padding":               "Padding around the aligned face chip used for descriptors",
+	"recognition.jitter":                "Jittered copies averaged per descriptor during enrollment (0 = off)",
+	"recognition.edge_margin":           "Reject faces within this many pixels of the frame border (0 = off)",
+	"recognition.landmark_model":        "Landmark predictor file in model_path (5- or 68-point)",
+	"recognition.recognition_model":     "Face recognition network file in model_path",
+	"recognition.workers":               "Frames analyzed in parallel by 'facepass test' (0 = min(CPUs, 4))",
+	"recognition.max_process_fps":       "Frames handed to the workers per second (0 = unlimited)",
+	"recognition.outlier_distance":      "Drop frame embeddings this far from the median before averaging (0 = off)",
+	"recognition.identity_distance":     "Fail a capture whose frames move this far from the first face (0 = off)",
+	"recognition.preprocess":            "Frame preprocessing before detection: none or clahe (for dim rooms); changing it requires re-enrolling",
+
+	"liveness_detection":                         "Liveness detection settings",
+	"liveness_detection.level":                   "Levels: basic, standard, strict, paranoid",
+	"liveness_detection.blink_required":          "Require a blink during authentication",
+	"liveness_detection.consistency_check":       "Check that the face stays consistent across frames",
+	"liveness_detection.challenge_response":      "Ask the user to perform a random action",
+	"liveness_detection.ir_analysis":             "Analyze IR reflection (IR cameras only)",
+	"liveness_detection.texture_analysis":        "Analyze skin texture to detect printed photos",
+	"liveness_detection.min_liveness_score":      "Minimum combined liveness score (0-1)",
+	"liveness_detection.max_authentication_time": "Seconds allowed for the liveness checks",
+	"liveness_detection.debug_save_spoof_dir":    "Save the frames of detected spoofs here for review (empty = off)",
+	"liveness_detection.cross_check":             "Require the face at the same place in ir_device and rgb_device (dual cameras only)",
+	"liveness_detection.thresholds":              "Fine-tuning for individual liveness checks",
+	"liveness_detection.thresholds.movement":     "Minimum movement to not be a static image",
+	"liveness_detection.thresholds.depth":        "Minimum variance for the 3D depth check",
+	"liveness_detection.thresholds.consistency":  "Maximum variance for the consistency check",
+	"liveness_detection.thresholds.cross_offset": "Maximum IR/RGB face center offset for cross_check, relative to the frame size",
+
+	"auth":                                "Authentication settings",
+	"auth.enabled":                        "Enable/Disable face authentication",
+	"auth.timeout":                        "Seconds before fallback to password",
+	"auth.max_attempts":                   "Max face recognition attempts",
+	"auth.retry_delay_ms":                 "Pause between attempts in milliseconds (0 = none)",
+	"auth.retry_prompt":                   "Ask the user to reposition between attempts",
+	"auth.fallback_enabled":               "Allow password fallback",
+	"auth.template_update":                "Automatically add fresh embeddings after confident matches",
+	"auth.template_update.margin":         "Distance must be below tolerance minus this margin",
+	"auth.template_update.max_embeddings": "Oldest embeddings are evicted beyond this count",
+	"auth.min_confidence_margin":          "Require distance below tolerance minus this margin (0 = off)",
+	"auth.min_matching_embeddings":        "Enrolled embeddings that must be within tolerance (1 = best match only)",
+	"auth.capture_frames":                 "Frames captured per attempt for liveness and recognition",
+	"auth.camera_grace_seconds":           "Seconds the camera stays on after a success in serve and watch (0 = release immediately)",
+
+	"storage":                    "Storage settings",
+	"storage.backend":            "Storage backend: file or sqlite",
+	"storage.data_dir":           "Per-user storage location",
+	"storage.encryption_enabled": "Encrypt face embeddings at rest",
+	"storage.key_source":         "Encryption key source: machine, file (key_file) or env (FACEPASS_KEY)",
+	"storage.key_file":           "Key file used when key_source is file (32 raw bytes or 64 hex characters)",
+	"storage.compress":           "Gzip face data before encryption",
+	"storage.last_used_interval": "Only rewrite the last-used timestamp if it is older than this (seconds)",
+
+	"acceleration":                  "GPU/NPU acceleration for the onnx recognition backend",
+	"acceleration.backend":          "Execution provider: auto, cpu, rocm, cuda or openvino",
+	"acceleration.fallback_to_cpu":  "Fall back to dlib on the CPU if the ONNX engine cannot be initialized",
+	"acceleration.device_index":     "GPU device index for multi-GPU systems (see 'facepass accel')",
+	"acceleration.enable_profiling": "Enable performance profiling (debug)",
+	"acceleration.onnx_model_path":  "Directory with the ONNX models",
+
+	"logging":              "Logging",
+	"logging.level":        "Log levels: debug, info, warn, error",
+	"logging.format":       "Log format: text, or json for log aggregation (Loki, ELK)",
+	"logging.output":       "Log output: stderr, file or syslog (empty = file for the CLI, syslog for PAM)",
+	"logging.file":         "Log file location",
+	"logging.max_size_mb":  "Rotate the log file when it reaches this size (0 = never rotate)",
+	"logging.max_backups":  "Rotated log files to keep (0 = keep all)",
+	"logging.max_age_days": "Delete rotated log files older than this (0 = keep regardless of age)",
+}
+
+// MarshalCommented returns the configuration as YAML with a comment above
+// each documented setting.
+func (c *Config) MarshalCommented() ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return nil, err
+	}
+	annotateNode(&doc, "")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	// Separate the top-level sections with a blank line
+	body := bytes.ReplaceAll(buf.Bytes(), []byte("\n# "), []byte("\n\n# "))
+	return append([]byte(configHeader), body...), nil
+}
+
+// MarshalJSON encodes the configuration with the same keys as the YAML file.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic map[string]interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// annotateNode attaches fieldComments to the keys of a mapping node.
+func annotateNode(node *yaml.Node, prefix string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := prefix + key.Value
+		if comment, ok := fieldComments[path]; ok {
+			key.HeadComment = comment
+		}
+		annotateNode(value, path+".")
+	}
+}
+
+// WriteFile writes the commented configuration to path, creating parent
+// directories. An existing file is only replaced if force is set.
+func (c *Config) WriteFile(path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%w: %s", ErrConfigExists, path)
+	}
+
+	data, err := c.MarshalCommented()
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
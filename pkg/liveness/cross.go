@@ -0,0 +1,59 @@
+package liveness
+
+import "github.com/MrCodeEU/facepass/pkg/logging"
+
+// DefaultCrossOffset is the default largest distance between the face
+// centers of a frame and its Cross frame, relative to the frame size. The
+// IR and RGB sensors of a dual camera sit a few centimeters apart, so the
+// face is never at exactly the same place in both.
+const DefaultCrossOffset = 0.15
+
+// Box is a face bounding box in fractions of the frame size, so boxes from
+// cameras with different resolutions can be compared.
+type Box struct {
+	X, Y, Width, Height float64
+}
+
+// NewBox converts a face bounding box in pixels to a Box.
+func NewBox(x, y, width, height, frameWidth, frameHeight int) Box {
+	if frameWidth <= 0 || frameHeight <= 0 {
+		return Box{}
+	}
+	fw, fh := float64(frameWidth), float64(frameHeight)
+	return Box{X: float64(x) / fw, Y: float64(y) / fh, Width: float64(width) / fw, Height: float64(height) / fh}
+}
+
+// Center returns the center of the box.
+func (b Box) Center() Point {
+	return Point{X: b.X + b.Width/2, Y: b.Y + b.Height/2}
+}
+
+// CheckCrossCamera reports whether the faces of a dual IR/RGB camera agree:
+// a printed photo is found by the RGB camera but looks wrong in IR, and a
+// phone screen is black in IR. Only frames with a Cross frame in which at
+// least one camera found a face are considered; available is false if there
+// are none. A frame passes if both cameras found the face and its centers
+// are at most the configured offset apart, and the check passes if most
+// frames do.
+func (d *LivenessDetector) CheckCrossCamera(frames []Frame) (live, available bool) {
+	checked, passed := 0, 0
+	for _, frame := range frames {
+		if frame.Cross == nil || (!frame.FaceFound && !frame.Cross.FaceFound) {
+			continue
+		}
+		checked++
+		if !frame.FaceFound || !frame.Cross.FaceFound {
+			logging.Debugf("Cross-camera check: face found by one camera only (this: %v, other: %v)", frame.FaceFound, frame.Cross.FaceFound)
+			continue
+		}
+		offset := distance(frame.FaceBox.Center(), frame.Cross.FaceBox.Center())
+		if offset <= d.config.CrossOffset {
+			passed++
+		}
+		logging.Debugf("Cross-camera check: offset=%.3f, max=%.3f", offset, d.config.CrossOffset)
+	}
+	if checked == 0 {
+		return false, false
+	}
+	return passed*2 > checked, true
+}
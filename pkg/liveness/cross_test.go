@@ -0,0 +1,98 @@
+package liveness
+
+import "testing"
+
+// withCross pairs each frame with a frame from the other camera, seeing
+// the face if found, offset by dx from the frame's face.
+func withCross(frames []Frame, found bool, dx float64) []Frame {
+	for i := range frames {
+		frames[i].FaceBox = Box{X: 0.4, Y: 0.3, Width: 0.2, Height: 0.3}
+		cross := &Frame{FaceFound: found}
+		if found {
+			cross.FaceBox = frames[i].FaceBox
+			cross.FaceBox.X += dx
+		}
+		frames[i].Cross = cross
+	}
+	return frames
+}
+
+func TestNewBox(t *testing.T) {
+	box := NewBox(160, 120, 320, 240, 640, 480)
+	if box != (Box{X: 0.25, Y: 0.25, Width: 0.5, Height: 0.5}) {
+		t.Errorf("NewBox() = %+v", box)
+	}
+	if c := box.Center(); c != (Point{X: 0.5, Y: 0.5}) {
+		t.Errorf("Center() = %+v, want the middle of the frame", c)
+	}
+	if box := NewBox(1, 2, 3, 4, 0, 0); box != (Box{}) {
+		t.Errorf("NewBox() without a frame size = %+v, want zero", box)
+	}
+}
+
+func TestCheckCrossCamera(t *testing.T) {
+	detector := NewDetector(DefaultConfig())
+
+	// One camera sees nothing in half of the frames
+	half := withCross(createFramesWithLandmarks(6, 0.1), true, 0.05)
+	for i := 0; i < 3; i++ {
+		half[i].Cross.FaceFound = false
+	}
+	// Neither camera sees a face: left to face_present
+	empty := withCross(createFramesWithLandmarks(5, 0.1), false, 0)
+	for i := range empty {
+		empty[i].FaceFound = false
+	}
+
+	tests := []struct {
+		name          string
+		frames        []Frame
+		wantLive      bool
+		wantAvailable bool
+	}{
+		{name: "same face", frames: withCross(createFramesWithLandmarks(5, 0.1), true, 0.05), wantLive: true, wantAvailable: true},
+		{name: "other camera sees nothing", frames: withCross(createFramesWithLandmarks(5, 0.1), false, 0), wantAvailable: true},
+		{name: "different place", frames: withCross(createFramesWithLandmarks(5, 0.1), true, 0.3), wantAvailable: true},
+		{name: "half the frames", frames: half, wantAvailable: true},
+		{name: "no faces", frames: empty},
+		{name: "one camera", frames: createFramesWithLandmarks(5, 0.1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live, available := detector.CheckCrossCamera(tt.frames)
+			if live != tt.wantLive || available != tt.wantAvailable {
+				t.Errorf("CheckCrossCamera() = (%v, %v), want (%v, %v)", live, available, tt.wantLive, tt.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestDetector_Detect_CrossCamera(t *testing.T) {
+	cfg := ConfigFromLevel(LevelStandard)
+	cfg.EnableCrossCheck = true
+	detector := NewDetector(cfg)
+
+	result := detector.Detect(withCross(createFramesWithLandmarks(10, 0.1), true, 0.05))
+	if !result.IsLive || !result.Checks["cross_camera"] {
+		t.Errorf("expected a live result with a passed cross_camera check, got %+v", result)
+	}
+
+	// Every other check passes, but a face one camera cannot see is not live
+	result = detector.Detect(withCross(createFramesWithLandmarks(10, 0.1), false, 0))
+	if result.IsLive || result.RequiresRetry {
+		t.Errorf("expected a final rejection, got %+v", result)
+	}
+	if live, ok := result.Checks["cross_camera"]; !ok || live {
+		t.Errorf("expected a failed cross_camera check, got %v", result.Checks)
+	}
+	if live, _ := detector.QuickCheck(withCross(createFramesWithLandmarks(10, 0.1), false, 0)); live {
+		t.Error("QuickCheck() should apply the cross-check as well")
+	}
+
+	// Without the flag the other camera is ignored
+	result = NewDetector(ConfigFromLevel(LevelStandard)).Detect(withCross(createFramesWithLandmarks(10, 0.1), false, 0))
+	if _, ok := result.Checks["cross_camera"]; ok || !result.IsLive {
+		t.Errorf("cross_camera should only run when enabled, got %+v", result)
+	}
+}
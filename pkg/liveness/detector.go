@@ -4,10 +4,13 @@
 package liveness
 
 import (
+	"crypto/rand"
 	"errors"
 	"math"
+	"math/big"
 	"time"
 
+	"github.com/MrCodeEU/facepass/pkg/config"
 	"github.com/MrCodeEU/facepass/pkg/logging"
 	"github.com/MrCodeEU/facepass/pkg/recognition"
 )
@@ -30,11 +33,13 @@ type Config struct {
 	RequireChallenge     bool
 	EnableIRAnalysis     bool
 	EnableTexture        bool
+	EnableCrossCheck     bool // Require agreeing faces in frames with a Cross frame
 	MinScore             float64
 	MaxTime              int // seconds
 	MovementThreshold    float64
 	DepthThreshold       float64
 	ConsistencyThreshold float64
+	CrossOffset          float64 // See DefaultCrossOffset
 }
 
 // DefaultConfig returns a default liveness configuration.
@@ -51,6 +56,7 @@ func DefaultConfig() Config {
 		MovementThreshold:    0.08,
 		DepthThreshold:       0.00005,
 		ConsistencyThreshold: 0.1,
+		CrossOffset:          DefaultCrossOffset,
 	}
 }
 
@@ -100,10 +106,48 @@ type Result struct {
 
 // Challenge represents a challenge-response request.
 type Challenge struct {
-	Action string  // "turn_left", "turn_right", "look_up", "look_down", "blink"
+	Action string  // One of ChallengeActions
 	Angle  float64 // Expected angle in degrees (for head movements)
 }
 
+// ChallengeActions are the actions PerformChallenge can verify.
+var ChallengeActions = []string{
+	"turn_left", "turn_right", "look_up", "look_down", "blink",
+	ActionLookTopLeft, ActionLookTopRight, ActionLookBottomLeft, ActionLookBottomRight,
+}
+
+// challengeInstructions are shown to the user for each challenge action.
+var challengeInstructions = map[string]string{
+	"turn_left":  "Turn your head to the left",
+	"turn_right": "Turn your head to the right",
+	"look_up":    "Look up",
+	"look_down":  "Look down",
+	"blink":      "Blink repeatedly",
+
+	ActionLookTopLeft:     "Keep your head still and look at the top-left corner of the screen",
+	ActionLookTopRight:    "Keep your head still and look at the top-right corner of the screen",
+	ActionLookBottomLeft:  "Keep your head still and look at the bottom-left corner of the screen",
+	ActionLookBottomRight: "Keep your head still and look at the bottom-right corner of the screen",
+}
+
+// RandomChallenge picks one of ChallengeActions at random. The choice uses
+// crypto/rand so it cannot be predicted from earlier challenges.
+func RandomChallenge() Challenge {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(ChallengeActions))))
+	if err != nil {
+		return Challenge{Action: "blink"}
+	}
+	return Challenge{Action: ChallengeActions[n.Int64()]}
+}
+
+// Instruction returns the prompt for the challenge.
+func (c Challenge) Instruction() string {
+	if text, ok := challengeInstructions[c.Action]; ok {
+		return text
+	}
+	return c.Action
+}
+
 // Frame represents a captured frame for liveness analysis.
 type Frame struct {
 	Data           []byte
@@ -113,6 +157,12 @@ type Frame struct {
 	Timestamp      time.Time
 	FaceFound      bool
 	EyeAspectRatio float64
+	IRHistogram    []int // IRHistogramBins bins of 16-bit IR samples; nil for 8-bit frames
+	FaceBox        Box   // Where the face is, if FaceFound
+
+	// Cross is the frame captured at the same time by the other camera of a
+	// dual IR/RGB camera, with FaceFound and FaceBox set; nil without one
+	Cross *Frame
 }
 
 // Point represents a 2D point.
@@ -168,6 +218,9 @@ func NewDetector(cfg Config) *LivenessDetector {
 	if cfg.ConsistencyThreshold == 0 {
 		cfg.ConsistencyThreshold = 0.1
 	}
+	if cfg.CrossOffset == 0 {
+		cfg.CrossOffset = DefaultCrossOffset
+	}
 
 	return &LivenessDetector{
 		config:            cfg,
@@ -178,6 +231,19 @@ func NewDetector(cfg Config) *LivenessDetector {
 	}
 }
 
+// NewDetectorFromConfig creates a LivenessDetector for the configured
+// liveness level and thresholds. The CLI and the PAM authenticator both use
+// it, so 'facepass test' checks exactly what authentication checks.
+func NewDetectorFromConfig(cfg *config.Config) *LivenessDetector {
+	livenessCfg := ConfigFromLevel(Level(cfg.Liveness.Level))
+	livenessCfg.MovementThreshold = cfg.Liveness.Thresholds.Movement
+	livenessCfg.DepthThreshold = cfg.Liveness.Thresholds.Depth
+	livenessCfg.ConsistencyThreshold = cfg.Liveness.Thresholds.Consistency
+	livenessCfg.EnableCrossCheck = cfg.Liveness.CrossCheck
+	livenessCfg.CrossOffset = cfg.Liveness.Thresholds.CrossOffset
+	return NewDetector(livenessCfg)
+}
+
 // Detect performs comprehensive liveness detection on a sequence of frames.
 func (d *LivenessDetector) Detect(frames []Frame) Result {
 	startTime := time.Now()
@@ -246,6 +312,39 @@ func (d *LivenessDetector) Detect(frames []Frame) Result {
 	}
 	totalWeight += 0.2
 
+	// Check 5: IR reflectance (weight: 0.2), with IR analysis enabled and
+	// 16-bit IR frames to analyze
+	if d.config.EnableIRAnalysis {
+		if irLive, ok := d.CheckIRReflectance(frames); ok {
+			result.Checks["ir_reflectance"] = irLive
+			if irLive {
+				scores = append(scores, 1.0*0.2)
+			} else {
+				scores = append(scores, 0.0)
+			}
+			totalWeight += 0.2
+			logging.Debugf("IR reflectance check: %v", irLive)
+		}
+	}
+
+	// Check 6: IR/RGB cross-check (weight: 0.2), with frames from a dual
+	// camera. Unlike the other checks it cannot be outweighed: a face that
+	// only one camera sees is never live.
+	crossFailed := false
+	if d.config.EnableCrossCheck {
+		if crossLive, ok := d.CheckCrossCamera(frames); ok {
+			result.Checks["cross_camera"] = crossLive
+			if crossLive {
+				scores = append(scores, 1.0*0.2)
+			} else {
+				scores = append(scores, 0.0)
+				crossFailed = true
+			}
+			totalWeight += 0.2
+			logging.Debugf("Cross-camera check: %v", crossLive)
+		}
+	}
+
 	// Calculate final score
 	var totalScore float64
 	for _, s := range scores {
@@ -256,14 +355,17 @@ func (d *LivenessDetector) Detect(frames []Frame) Result {
 	}
 
 	// Determine if live
-	result.IsLive = result.Score >= d.config.MinScore
+	result.IsLive = result.Score >= d.config.MinScore && !crossFailed
 	result.Duration = time.Since(startTime)
 
 	// Smart Liveness Override:
 	// If we have strong movement AND consistency, we can override a missing blink
 	if !result.IsLive {
-		// Determine reason for failure
-		if !result.Checks["3d_geometry"] {
+		// Determine reason for failure. A face seen by one camera only is
+		// not retried: it also fails face_present, but it is a spoof.
+		if crossFailed {
+			result.Reason = "IR and RGB cameras do not see the same face (possible screen or print)"
+		} else if !result.Checks["3d_geometry"] {
 			result.Reason = "face lacks 3D depth/movement (possible 2D photo)"
 		} else if !result.Checks["consistency"] {
 			result.Reason = "inconsistent face data (possible photo attack)"
@@ -272,6 +374,8 @@ func (d *LivenessDetector) Detect(frames []Frame) Result {
 		} else if !result.Checks["face_present"] {
 			result.Reason = "face not consistently visible"
 			result.RequiresRetry = true
+		} else if irLive, ok := result.Checks["ir_reflectance"]; ok && !irLive {
+			result.Reason = "IR reflectance does not match a face (possible screen or print)"
 		} else {
 			result.Reason = "liveness score below threshold"
 		}
@@ -586,11 +690,16 @@ func (d *LivenessDetector) CheckFacePresence(frames []Frame) bool {
 	return ratio >= 0.7
 }
 
-// PerformChallenge verifies user response to a challenge.
+// PerformChallenge verifies user response to a challenge. Gaze challenges
+// (look_top_left etc.) compare the pupil positions estimated by
+// EstimateGaze; the other actions compare embeddings.
 func (d *LivenessDetector) PerformChallenge(challenge Challenge, beforeFrames, afterFrames []Frame) bool {
 	if len(beforeFrames) == 0 || len(afterFrames) == 0 {
 		return false
 	}
+	if target, ok := gazeTargets[challenge.Action]; ok {
+		return checkGaze(target, beforeFrames, afterFrames)
+	}
 
 	beforeEmb := extractEmbeddings(beforeFrames)
 	afterEmb := extractEmbeddings(afterFrames)
@@ -640,6 +749,13 @@ func (d *LivenessDetector) QuickCheck(frames []Frame) (bool, float64) {
 	// Quick face presence check
 	facePresent := d.CheckFacePresence(frames)
 
+	// The cross-check is as cheap as it is strong, so it applies here too
+	if d.config.EnableCrossCheck {
+		if crossLive, ok := d.CheckCrossCamera(frames); ok && !crossLive {
+			return false, 0.0
+		}
+	}
+
 	score := 0.0
 	if consistent {
 		score += 0.4
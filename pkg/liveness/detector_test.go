@@ -5,9 +5,27 @@ import (
 	"testing"
 	"time"
 
+	"github.com/MrCodeEU/facepass/pkg/config"
 	"github.com/MrCodeEU/facepass/pkg/recognition"
 )
 
+// The thresholds in the configuration file default to the detector's own
+// defaults, so leaving them out of the YAML changes nothing.
+func TestDefaultConfig_MatchesAppConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	thresholds := config.DefaultConfig().Liveness.Thresholds
+
+	if thresholds.Movement != cfg.MovementThreshold {
+		t.Errorf("config movement threshold %f, detector default %f", thresholds.Movement, cfg.MovementThreshold)
+	}
+	if thresholds.Depth != cfg.DepthThreshold {
+		t.Errorf("config depth threshold %f, detector default %f", thresholds.Depth, cfg.DepthThreshold)
+	}
+	if thresholds.Consistency != cfg.ConsistencyThreshold {
+		t.Errorf("config consistency threshold %f, detector default %f", thresholds.Consistency, cfg.ConsistencyThreshold)
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	cfg := DefaultConfig()
 
@@ -71,6 +89,25 @@ func TestNewDetector(t *testing.T) {
 	}
 }
 
+func TestNewDetectorFromConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Liveness.Level = "strict"
+	cfg.Liveness.Thresholds.Movement = 0.12
+	cfg.Liveness.Thresholds.Consistency = 0.2
+
+	detector := NewDetectorFromConfig(cfg)
+	if detector.config.Level != LevelStrict || !detector.config.RequireChallenge {
+		t.Errorf("expected the strict level with challenges, got %+v", detector.config)
+	}
+	if detector.movementThreshold != 0.12 || detector.consistencyMaxVar != 0.2 {
+		t.Errorf("expected configured thresholds, got movement %f, consistency %f",
+			detector.movementThreshold, detector.consistencyMaxVar)
+	}
+	if detector.config.DepthThreshold != cfg.Liveness.Thresholds.Depth {
+		t.Errorf("expected depth threshold %f, got %f", cfg.Liveness.Thresholds.Depth, detector.config.DepthThreshold)
+	}
+}
+
 func TestDetector_Detect_InsufficientFrames(t *testing.T) {
 	detector := NewDetector(DefaultConfig())
 
@@ -667,6 +704,20 @@ func TestDetector_Detect_Full(t *testing.T) {
 	}
 }
 
+func TestRandomChallenge(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		c := RandomChallenge()
+		if c.Instruction() == c.Action {
+			t.Fatalf("RandomChallenge() = %q has no instruction", c.Action)
+		}
+		seen[c.Action] = true
+	}
+	if len(seen) != len(ChallengeActions) {
+		t.Errorf("RandomChallenge() produced %d of %d actions", len(seen), len(ChallengeActions))
+	}
+}
+
 func TestDetector_PerformChallenge(t *testing.T) {
 	detector := NewDetector(DefaultConfig())
 
@@ -0,0 +1,193 @@
+package liveness
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/jpeg" // frames from the camera stream are JPEG
+	"math"
+	"sort"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// Gaze challenge actions: the user looks at a corner of the screen without
+// turning the head. A photo moved in front of the camera can fake a head
+// turn, but not pupils moving relative to the eye corners.
+const (
+	ActionLookTopLeft     = "look_top_left"
+	ActionLookTopRight    = "look_top_right"
+	ActionLookBottomLeft  = "look_bottom_left"
+	ActionLookBottomRight = "look_bottom_right"
+)
+
+// gazeTargets is the expected gaze direction of each gaze action, in the
+// user's frame of reference as returned by EstimateGaze.
+var gazeTargets = map[string]Point{
+	ActionLookTopLeft:     {X: -1, Y: 1},
+	ActionLookTopRight:    {X: 1, Y: 1},
+	ActionLookBottomLeft:  {X: -1, Y: -1},
+	ActionLookBottomRight: {X: 1, Y: -1},
+}
+
+const (
+	// minGazeShift is the minimum change of each gaze component towards the
+	// target for a gaze challenge to pass.
+	minGazeShift = 0.12
+	// pupilFraction is the darkest fraction of the eye region taken as the
+	// pupil and iris.
+	pupilFraction = 0.12
+	// eyeHeightRatio is the height of the searched eye region relative to
+	// the distance between the eye corners.
+	eyeHeightRatio = 0.6
+)
+
+// ErrGazeUnavailable is returned when the gaze cannot be estimated from a
+// frame, e.g. without a face, eye landmarks or decodable image data.
+var ErrGazeUnavailable = errors.New("gaze cannot be estimated")
+
+// EstimateGaze estimates where the user looks from the position of the
+// pupils between the eye corners, averaged over both eyes. gx is positive
+// when the user looks to their right and gy when they look up; both are
+// relative to half the eye width, so roughly within [-1, 1], and 0 when
+// looking straight ahead.
+//
+// The pupil is taken as the darkest part of each eye region, so this needs
+// dark-pupil images. IR cameras with the emitter right next to the lens can
+// show bright pupils and give unreliable estimates.
+func EstimateGaze(frame Frame) (gx, gy float64, err error) {
+	if !frame.FaceFound {
+		return 0, 0, ErrGazeUnavailable
+	}
+	eyes := eyeCorners(frame.Landmarks)
+	if eyes == nil {
+		return 0, 0, ErrGazeUnavailable
+	}
+	img, _, err := image.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		return 0, 0, ErrGazeUnavailable
+	}
+
+	n := 0
+	for _, eye := range eyes {
+		x, y, ok := eyeGaze(img, eye[0], eye[1])
+		if !ok {
+			continue
+		}
+		gx += x
+		gy += y
+		n++
+	}
+	if n == 0 {
+		return 0, 0, ErrGazeUnavailable
+	}
+	return gx / float64(n), gy / float64(n), nil
+}
+
+// eyeCorners returns the two corners of each eye for 5-point (corner pairs
+// 0-1 and 2-3) and 68-point (36/39 and 42/45) landmarks.
+func eyeCorners(landmarks []Point) [][2]Point {
+	switch {
+	case len(landmarks) >= 68:
+		return [][2]Point{{landmarks[36], landmarks[39]}, {landmarks[42], landmarks[45]}}
+	case len(landmarks) >= 4:
+		return [][2]Point{{landmarks[0], landmarks[1]}, {landmarks[2], landmarks[3]}}
+	}
+	return nil
+}
+
+// eyeGaze locates the pupil of the eye between corners a and b and returns
+// its offset from the eye center along and across the eye axis, relative to
+// half the eye width.
+func eyeGaze(img image.Image, a, b Point) (gx, gy float64, ok bool) {
+	width := distance(a, b)
+	if width < 4 {
+		return 0, 0, false
+	}
+	// Unit vectors along the eye towards image right, and across it
+	// towards image bottom
+	ux, uy := (b.X-a.X)/width, (b.Y-a.Y)/width
+	if ux < 0 {
+		ux, uy = -ux, -uy
+	}
+	vx, vy := -uy, ux
+	cx, cy := (a.X+b.X)/2, (a.Y+b.Y)/2
+
+	type sample struct {
+		along, across float64
+		luma          uint8
+	}
+	var samples []sample
+	half := width / 2
+	bounds := img.Bounds()
+	for s := -half; s <= half; s++ {
+		for t := -half * eyeHeightRatio; t <= half*eyeHeightRatio; t++ {
+			x := int(math.Round(cx + s*ux + t*vx))
+			y := int(math.Round(cy + s*uy + t*vy))
+			if !image.Pt(x, y).In(bounds) {
+				continue
+			}
+			luma := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			samples = append(samples, sample{along: s, across: t, luma: luma})
+		}
+	}
+	if len(samples) == 0 {
+		return 0, 0, false
+	}
+
+	// The pupil is the centroid of the darkest pixels
+	sort.Slice(samples, func(i, j int) bool { return samples[i].luma < samples[j].luma })
+	dark := samples[:max(1, int(float64(len(samples))*pupilFraction))]
+	if dark[len(dark)-1].luma == samples[len(samples)-1].luma {
+		// Uniform region: no pupil to find
+		return 0, 0, false
+	}
+	var along, across float64
+	for _, s := range dark {
+		along += s.along
+		across += s.across
+	}
+	along /= float64(len(dark))
+	across /= float64(len(dark))
+
+	// The camera faces the user, so image left is the user's right, and
+	// image down is down
+	return -along / half, -across / half, true
+}
+
+// averageGaze returns the mean gaze of the frames it can be estimated for.
+func averageGaze(frames []Frame) (Point, bool) {
+	var sum Point
+	n := 0
+	for _, frame := range frames {
+		gx, gy, err := EstimateGaze(frame)
+		if err != nil {
+			continue
+		}
+		sum.X += gx
+		sum.Y += gy
+		n++
+	}
+	if n == 0 {
+		return Point{}, false
+	}
+	return Point{X: sum.X / float64(n), Y: sum.Y / float64(n)}, true
+}
+
+// checkGaze reports whether the gaze moved from beforeFrames to afterFrames
+// towards target on both axes.
+func checkGaze(target Point, beforeFrames, afterFrames []Frame) bool {
+	before, ok := averageGaze(beforeFrames)
+	if !ok {
+		return false
+	}
+	after, ok := averageGaze(afterFrames)
+	if !ok {
+		return false
+	}
+
+	dx, dy := (after.X-before.X)*target.X, (after.Y-before.Y)*target.Y
+	logging.Debugf("Gaze challenge: before=(%.2f, %.2f), after=(%.2f, %.2f)", before.X, before.Y, after.X, after.Y)
+	return dx >= minGazeShift && dy >= minGazeShift
+}
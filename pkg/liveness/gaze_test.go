@@ -0,0 +1,107 @@
+package liveness
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// createGazeFrame renders two eyes with the pupils shifted by (dx, dy)
+// pixels in image coordinates and returns a frame with 5-point landmarks.
+func createGazeFrame(t *testing.T, dx, dy float64) Frame {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 200, 120))
+	landmarks := []Point{{X: 160, Y: 60}, {X: 120, Y: 60}, {X: 80, Y: 60}, {X: 40, Y: 60}, {X: 100, Y: 90}}
+
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 200; x++ {
+			luma := uint8(170) // skin
+			for _, cx := range []float64{60, 140} {
+				ex, ey := (float64(x)-cx)/20, (float64(y)-60)/9
+				px, py := float64(x)-(cx+dx), float64(y)-(60+dy)
+				switch {
+				case px*px+py*py <= 16:
+					luma = 15 // pupil
+				case px*px+py*py <= 49 && ex*ex+ey*ey <= 1:
+					luma = 70 // iris
+				case ex*ex+ey*ey <= 1:
+					luma = 235 // sclera
+				}
+			}
+			img.SetGray(x, y, color.Gray{Y: luma})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return Frame{Data: buf.Bytes(), Landmarks: landmarks, FaceFound: true}
+}
+
+func TestEstimateGaze(t *testing.T) {
+	tests := []struct {
+		name   string
+		dx, dy float64
+		wantX  int // sign of gx
+		wantY  int // sign of gy
+	}{
+		{name: "straight", dx: 0, dy: 0},
+		{name: "user's right and up", dx: -8, dy: -4, wantX: 1, wantY: 1},
+		{name: "user's left and down", dx: 8, dy: 4, wantX: -1, wantY: -1},
+	}
+	sign := func(v float64) int {
+		switch {
+		case v > 0.1:
+			return 1
+		case v < -0.1:
+			return -1
+		}
+		return 0
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gx, gy, err := EstimateGaze(createGazeFrame(t, tt.dx, tt.dy))
+			if err != nil {
+				t.Fatalf("EstimateGaze() error = %v", err)
+			}
+			if sign(gx) != tt.wantX || sign(gy) != tt.wantY {
+				t.Errorf("EstimateGaze() = (%.2f, %.2f), want signs (%d, %d)", gx, gy, tt.wantX, tt.wantY)
+			}
+		})
+	}
+
+	for name, frame := range map[string]Frame{
+		"no face":      {Landmarks: createGazeFrame(t, 0, 0).Landmarks},
+		"no landmarks": {Data: createGazeFrame(t, 0, 0).Data, FaceFound: true},
+		"no image":     {Landmarks: createGazeFrame(t, 0, 0).Landmarks, FaceFound: true},
+	} {
+		if _, _, err := EstimateGaze(frame); !errors.Is(err, ErrGazeUnavailable) {
+			t.Errorf("%s: EstimateGaze() error = %v, want ErrGazeUnavailable", name, err)
+		}
+	}
+}
+
+func TestDetector_PerformChallenge_Gaze(t *testing.T) {
+	detector := NewDetector(DefaultConfig())
+	straight := []Frame{createGazeFrame(t, 0, 0), createGazeFrame(t, 0, 0)}
+	topRight := []Frame{createGazeFrame(t, -8, -4), createGazeFrame(t, -7, -4)}
+
+	if !detector.PerformChallenge(Challenge{Action: ActionLookTopRight}, straight, topRight) {
+		t.Error("look_top_right should pass when the pupils move up and to the user's right")
+	}
+	if detector.PerformChallenge(Challenge{Action: ActionLookTopLeft}, straight, topRight) {
+		t.Error("look_top_left should fail when the user looks to the right")
+	}
+	if detector.PerformChallenge(Challenge{Action: ActionLookBottomRight}, straight, straight) {
+		t.Error("gaze challenge should fail without eye movement")
+	}
+	// Frames without a usable image, e.g. from a photo without eye detail
+	if detector.PerformChallenge(Challenge{Action: ActionLookTopRight}, straight, createFramesWithLandmarks(3, 0)) {
+		t.Error("gaze challenge should fail when the gaze cannot be estimated")
+	}
+}
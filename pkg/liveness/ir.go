@@ -0,0 +1,70 @@
+package liveness
+
+import "github.com/MrCodeEU/facepass/pkg/logging"
+
+// IRHistogramBins is the number of bins of Frame.IRHistogram.
+const IRHistogramBins = 64
+
+const (
+	// minIRSpread is the minimum distance between the 10th and the 90th
+	// percentile of an IR histogram, relative to the sensor range. Paper
+	// reflects IR evenly, so printed photos look flat.
+	minIRSpread = 0.15
+	// maxIRDarkFraction is the largest share of samples in the darkest
+	// eighth of the sensor range. Screens emit no near-infrared light, so a
+	// replayed face is mostly black.
+	maxIRDarkFraction = 0.85
+)
+
+// CheckIRReflectance reports whether the IR histograms of the frames look
+// like a face lit by the IR emitter rather than a screen or a print. Only
+// frames with an IRHistogram (16-bit IR captures) are considered; available
+// is false if there are none. The check passes if most of them do.
+func (d *LivenessDetector) CheckIRReflectance(frames []Frame) (live, available bool) {
+	checked, passed := 0, 0
+	for _, frame := range frames {
+		if len(frame.IRHistogram) == 0 {
+			continue
+		}
+		checked++
+		spread, dark := irHistogramStats(frame.IRHistogram)
+		if spread >= minIRSpread && dark <= maxIRDarkFraction {
+			passed++
+		}
+		logging.Debugf("IR histogram: spread=%.2f, dark=%.2f", spread, dark)
+	}
+	if checked == 0 {
+		return false, false
+	}
+	return passed*2 > checked, true
+}
+
+// irHistogramStats returns the distance between the 10th and 90th
+// percentile and the share of samples in the darkest eighth of the range,
+// both relative to the histogram size.
+func irHistogramStats(histogram []int) (spread, dark float64) {
+	total := 0
+	for _, n := range histogram {
+		total += n
+	}
+	if total == 0 {
+		return 0, 1
+	}
+
+	p10, p90 := -1, -1
+	darkBins := max(1, len(histogram)/8)
+	sum, darkSum := 0, 0
+	for i, n := range histogram {
+		sum += n
+		if i < darkBins {
+			darkSum += n
+		}
+		if p10 < 0 && sum*10 >= total {
+			p10 = i
+		}
+		if p90 < 0 && sum*10 >= total*9 {
+			p90 = i
+		}
+	}
+	return float64(p90-p10) / float64(len(histogram)), float64(darkSum) / float64(total)
+}
@@ -0,0 +1,62 @@
+package liveness
+
+import "testing"
+
+// irHistogram spreads total samples evenly over bins [from, to).
+func irHistogram(from, to, total int) []int {
+	histogram := make([]int, IRHistogramBins)
+	for i := from; i < to; i++ {
+		histogram[i] = total / (to - from)
+	}
+	return histogram
+}
+
+func TestCheckIRReflectance(t *testing.T) {
+	detector := NewDetector(ConfigFromLevel(LevelStrict))
+	withHistogram := func(histogram []int, n int) []Frame {
+		frames := createFramesWithLandmarks(n, 0.1)
+		for i := range frames {
+			frames[i].IRHistogram = histogram
+		}
+		return frames
+	}
+
+	tests := []struct {
+		name          string
+		frames        []Frame
+		wantLive      bool
+		wantAvailable bool
+	}{
+		{name: "lit face", frames: withHistogram(irHistogram(4, 40, 3600), 5), wantLive: true, wantAvailable: true},
+		{name: "flat print", frames: withHistogram(irHistogram(30, 34, 3600), 5), wantAvailable: true},
+		{name: "dark screen", frames: withHistogram(irHistogram(0, 6, 3600), 5), wantAvailable: true},
+		{name: "8-bit frames", frames: createFramesWithLandmarks(5, 0.1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live, available := detector.CheckIRReflectance(tt.frames)
+			if live != tt.wantLive || available != tt.wantAvailable {
+				t.Errorf("CheckIRReflectance() = (%v, %v), want (%v, %v)", live, available, tt.wantLive, tt.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestDetector_Detect_IRReflectance(t *testing.T) {
+	frames := createFramesWithLandmarks(10, 0.1)
+	for i := range frames {
+		frames[i].IRHistogram = irHistogram(0, 6, 3600)
+	}
+
+	result := NewDetector(ConfigFromLevel(LevelStrict)).Detect(frames)
+	if live, ok := result.Checks["ir_reflectance"]; !ok || live {
+		t.Errorf("expected a failed ir_reflectance check, got %v", result.Checks)
+	}
+
+	// Without IR analysis the histograms are ignored
+	result = NewDetector(ConfigFromLevel(LevelStandard)).Detect(frames)
+	if _, ok := result.Checks["ir_reflectance"]; ok {
+		t.Errorf("ir_reflectance should only run with IR analysis, got %v", result.Checks)
+	}
+}
@@ -3,16 +3,29 @@
 package logging
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-// Logger is the application-wide logger instance.
+// Logger is the application-wide logger instance. Use SetLogger to replace
+// it while other goroutines may be logging.
 var Logger *logrus.Logger
 
+var (
+	// mu guards Logger and logFile.
+	mu sync.RWMutex
+	// logFile is the file opened by Initialize, closed by Close.
+	logFile io.WriteCloser
+	// syslogHook is the hook added by Initialize for OutputSyslog.
+	syslogHook *SyslogHook
+)
+
 // Fields is an alias for logrus.Fields for convenience.
 type Fields = logrus.Fields
 
@@ -20,16 +33,79 @@ func init() {
 	Logger = logrus.New()
 	Logger.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp:   true,
-		TimestampFormat: "2006-01-02 15:04:05",
+		TimestampFormat: timestampFormat,
 	})
 	Logger.SetOutput(os.Stderr)
 	Logger.SetLevel(logrus.InfoLevel)
+	Logger.AddHook(&RedactHook{})
+}
+
+// Rotation configures size-based rotation of the log file.
+type Rotation struct {
+	MaxSizeMB  int // Rotate when the file reaches this size; 0 disables rotation
+	MaxBackups int // Rotated files to keep; 0 keeps all
+	MaxAgeDays int // Delete rotated files older than this; 0 keeps them regardless of age
+}
+
+// DefaultRotation returns the default log rotation settings.
+func DefaultRotation() Rotation {
+	return Rotation{
+		MaxSizeMB:  10,
+		MaxBackups: 3,
+		MaxAgeDays: 28,
+	}
+}
+
+// Log output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Log outputs. An empty Output behaves like OutputFile.
+const (
+	OutputStderr = "stderr" // stderr only
+	OutputFile   = "file"   // File in addition to stderr, or stderr alone if File is empty
+	OutputSyslog = "syslog" // syslog/journald only; nothing is written to stderr
+)
+
+// timestampFormat is used by both formatters.
+const timestampFormat = "2006-01-02 15:04:05"
+
+// Options configures Initialize.
+type Options struct {
+	Level    string // debug, info (default), warn or error
+	Format   string // FormatText (default) or FormatJSON
+	Output   string // OutputFile (default), OutputStderr or OutputSyslog
+	File     string // Log file written in addition to stderr; empty for stderr only
+	Rotation Rotation
 }
 
-// Init initializes the logger with the specified configuration.
-func Init(level string, logFile string) error {
+// Initialize configures the logger. It is the single entry point used by
+// the CLI and the PAM helper; an error means the log file or syslog could
+// not be opened, in which case logging continues on stderr.
+func Initialize(opts Options) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Never write biometric data, even if Logger was replaced
+	ensureRedaction(Logger)
+
+	// Set output format
+	switch opts.Format {
+	case FormatJSON:
+		Logger.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: timestampFormat,
+		})
+	default:
+		Logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: timestampFormat,
+		})
+	}
+
 	// Set log level
-	switch level {
+	switch opts.Level {
 	case "debug":
 		Logger.SetLevel(logrus.DebugLevel)
 	case "info":
@@ -42,107 +118,191 @@ func Init(level string, logFile string) error {
 		Logger.SetLevel(logrus.InfoLevel)
 	}
 
+	removeSyslogHook()
+	switch opts.Output {
+	case OutputStderr:
+		Logger.SetOutput(os.Stderr)
+		return closeLogFile()
+	case OutputSyslog:
+		Logger.SetOutput(os.Stderr)
+		_ = closeLogFile()
+		writer, err := dialSyslog()
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		syslogHook = &SyslogHook{writer: writer}
+		Logger.AddHook(syslogHook)
+		Logger.SetOutput(io.Discard)
+		return nil
+	}
+
 	// Set up file logging if specified
-	if logFile != "" {
+	if opts.File != "" {
 		// Ensure directory exists
-		logDir := filepath.Dir(logFile)
+		logDir := filepath.Dir(opts.File)
 		if err := os.MkdirAll(logDir, 0755); err != nil {
-			return err
+			return fmt.Errorf("failed to create log directory: %w", err)
 		}
 
-		// Open log file
-		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		file, err := openLogFile(opts.File, opts.Rotation)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to open log file: %w", err)
 		}
 
 		// Write to both file and stderr
 		Logger.SetOutput(io.MultiWriter(os.Stderr, file))
+		closeLogFile()
+		logFile = file
 	}
 
 	return nil
 }
 
+// Close flushes and closes the log file or syslog connection opened by
+// Initialize; logging continues on stderr. Call it before the process exits.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if syslogHook != nil {
+		removeSyslogHook()
+		Logger.SetOutput(os.Stderr)
+	}
+	if logFile == nil {
+		return nil
+	}
+	Logger.SetOutput(os.Stderr)
+	return closeLogFile()
+}
+
+// closeLogFile syncs and closes logFile. mu must be held.
+func closeLogFile() error {
+	if logFile == nil {
+		return nil
+	}
+	if f, ok := logFile.(*os.File); ok {
+		_ = f.Sync()
+	}
+	err := logFile.Close()
+	logFile = nil
+	return err
+}
+
+// SetLogger replaces the application-wide logger.
+func SetLogger(l *logrus.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	Logger = l
+}
+
+// current returns the application-wide logger.
+func current() *logrus.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Logger
+}
+
+// openLogFile opens path for appending, rotating it by size if enabled.
+func openLogFile(path string, rotation Rotation) (io.WriteCloser, error) {
+	if rotation.MaxSizeMB <= 0 {
+		return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+
+	// lumberjack opens the file on the first write; check now that it is writable
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    rotation.MaxSizeMB,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAgeDays,
+	}, nil
+}
+
 // SetLevel sets the logging level.
 func SetLevel(level string) {
 	switch level {
 	case "debug":
-		Logger.SetLevel(logrus.DebugLevel)
+		current().SetLevel(logrus.DebugLevel)
 	case "info":
-		Logger.SetLevel(logrus.InfoLevel)
+		current().SetLevel(logrus.InfoLevel)
 	case "warn":
-		Logger.SetLevel(logrus.WarnLevel)
+		current().SetLevel(logrus.WarnLevel)
 	case "error":
-		Logger.SetLevel(logrus.ErrorLevel)
+		current().SetLevel(logrus.ErrorLevel)
 	}
 }
 
 // Debug logs a debug message.
 func Debug(args ...interface{}) {
-	Logger.Debug(args...)
+	current().Debug(args...)
 }
 
 // Debugf logs a formatted debug message.
 func Debugf(format string, args ...interface{}) {
-	Logger.Debugf(format, args...)
+	current().Debugf(format, args...)
 }
 
 // Info logs an info message.
 func Info(args ...interface{}) {
-	Logger.Info(args...)
+	current().Info(args...)
 }
 
 // Infof logs a formatted info message.
 func Infof(format string, args ...interface{}) {
-	Logger.Infof(format, args...)
+	current().Infof(format, args...)
 }
 
 // Warn logs a warning message.
 func Warn(args ...interface{}) {
-	Logger.Warn(args...)
+	current().Warn(args...)
 }
 
 // Warnf logs a formatted warning message.
 func Warnf(format string, args ...interface{}) {
-	Logger.Warnf(format, args...)
+	current().Warnf(format, args...)
 }
 
 // Error logs an error message.
 func Error(args ...interface{}) {
-	Logger.Error(args...)
+	current().Error(args...)
 }
 
 // Errorf logs a formatted error message.
 func Errorf(format string, args ...interface{}) {
-	Logger.Errorf(format, args...)
+	current().Errorf(format, args...)
 }
 
 // Fatal logs a fatal message and exits.
 func Fatal(args ...interface{}) {
-	Logger.Fatal(args...)
+	current().Fatal(args...)
 }
 
 // Fatalf logs a formatted fatal message and exits.
 func Fatalf(format string, args ...interface{}) {
-	Logger.Fatalf(format, args...)
+	current().Fatalf(format, args...)
 }
 
 // WithFields returns an entry with fields attached.
 func WithFields(fields Fields) *logrus.Entry {
-	return Logger.WithFields(fields)
+	return current().WithFields(fields)
 }
 
 // WithField returns an entry with a single field attached.
 func WithField(key string, value interface{}) *logrus.Entry {
-	return Logger.WithField(key, value)
+	return current().WithField(key, value)
 }
 
 // WithError returns an entry with an error attached.
 func WithError(err error) *logrus.Entry {
-	return Logger.WithError(err)
+	return current().WithError(err)
 }
 
 // Component returns a logger entry for a specific component.
 func Component(name string) *logrus.Entry {
-	return Logger.WithField("component", name)
+	return current().WithField("component", name)
 }
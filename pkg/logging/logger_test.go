@@ -2,15 +2,18 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/sirupsen/logrus"
 )
 
-func TestInit(t *testing.T) {
+func TestInitialize(t *testing.T) {
 	// Reset logger before tests
 	Logger = logrus.New()
 
@@ -55,22 +58,22 @@ func TestInit(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			Logger = logrus.New()
-			err := Init(tt.level, tt.logFile)
+			err := Initialize(Options{Level: tt.level, Format: FormatText, File: tt.logFile})
 			if (err != nil) != tt.wantErr {
-				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Initialize() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestInit_WithLogFile(t *testing.T) {
+func TestInitialize_WithLogFile(t *testing.T) {
 	Logger = logrus.New()
 	tmpDir := t.TempDir()
 	logFile := filepath.Join(tmpDir, "test.log")
 
-	err := Init("info", logFile)
+	err := Initialize(Options{Level: "info", File: logFile, Rotation: DefaultRotation()})
 	if err != nil {
-		t.Fatalf("Init with log file failed: %v", err)
+		t.Fatalf("Initialize with log file failed: %v", err)
 	}
 
 	// Check log file was created
@@ -79,14 +82,14 @@ func TestInit_WithLogFile(t *testing.T) {
 	}
 }
 
-func TestInit_CreateDirectory(t *testing.T) {
+func TestInitialize_CreateDirectory(t *testing.T) {
 	Logger = logrus.New()
 	tmpDir := t.TempDir()
 	logFile := filepath.Join(tmpDir, "subdir", "nested", "test.log")
 
-	err := Init("info", logFile)
+	err := Initialize(Options{Level: "info", File: logFile, Rotation: DefaultRotation()})
 	if err != nil {
-		t.Fatalf("Init with nested log file failed: %v", err)
+		t.Fatalf("Initialize with nested log file failed: %v", err)
 	}
 
 	// Check directories and file were created
@@ -95,6 +98,140 @@ func TestInit_CreateDirectory(t *testing.T) {
 	}
 }
 
+func TestInitialize_Format(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+
+	if err := Initialize(Options{Level: "info", Format: FormatJSON}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	var buf bytes.Buffer
+	Logger.SetOutput(&buf)
+	WithFields(Fields{"user": "alice"}).Info("authenticated")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["user"] != "alice" || entry["msg"] != "authenticated" || entry["level"] != "info" {
+		t.Errorf("unexpected JSON entry: %v", entry)
+	}
+
+	if err := Initialize(Options{Level: "info", Format: FormatText}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if _, ok := Logger.Formatter.(*logrus.TextFormatter); !ok {
+		t.Errorf("expected text formatter, got %T", Logger.Formatter)
+	}
+}
+
+func TestInitialize_UnwritableFile(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+
+	// A directory cannot be opened as the log file
+	err := Initialize(Options{Level: "info", File: t.TempDir(), Rotation: DefaultRotation()})
+	if err == nil {
+		t.Fatal("expected error for unwritable log file")
+	}
+	if Logger.Out != os.Stderr {
+		t.Error("expected logging to stay on stderr")
+	}
+}
+
+func TestClose(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+	logFile := filepath.Join(t.TempDir(), "test.log")
+
+	if err := Initialize(Options{Level: "info", File: logFile}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	Info("before close")
+	if err := Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil || !strings.Contains(string(data), "before close") {
+		t.Errorf("expected message in log file, got %q (%v)", data, err)
+	}
+	if Logger.Out != os.Stderr {
+		t.Error("expected logging to continue on stderr after Close")
+	}
+
+	// Closing again is a no-op
+	if err := Close(); err != nil {
+		t.Errorf("second Close failed: %v", err)
+	}
+}
+
+func TestSetLogger_Concurrent(t *testing.T) {
+	defer SetLogger(logrus.New())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l := logrus.New()
+				l.SetOutput(io.Discard)
+				SetLogger(l)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Debugf("message %d", j)
+				Component("test").Debug("component message")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOpenLogFile_Rotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "facepass.log")
+
+	w, err := openLogFile(logFile, Rotation{MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("openLogFile failed: %v", err)
+	}
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	info, err := os.Stat(logFile)
+	if err != nil {
+		t.Fatalf("log file missing: %v", err)
+	}
+	if info.Size() > 1024*1024 {
+		t.Errorf("log file not rotated, size %d", info.Size())
+	}
+	backups, _ := filepath.Glob(filepath.Join(tmpDir, "facepass-*.log"))
+	if len(backups) == 0 {
+		t.Error("expected a rotated backup file")
+	}
+}
+
+func TestOpenLogFile_NoRotation(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "facepass.log")
+
+	w, err := openLogFile(logFile, Rotation{})
+	if err != nil {
+		t.Fatalf("openLogFile failed: %v", err)
+	}
+	if _, ok := w.(*os.File); !ok {
+		t.Errorf("expected plain file without rotation, got %T", w)
+	}
+	_ = w.(*os.File).Close()
+}
+
 func TestSetLevel(t *testing.T) {
 	Logger = logrus.New()
 
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactedKeys are substrings of field names that carry biometric-derived
+// data. Matching fields are replaced before an entry is written.
+var redactedKeys = []string{"embedding", "vector", "descriptor", "landmark"}
+
+// maxLoggedBytes is the number of bytes of a byte slice field that is kept.
+const maxLoggedBytes = 16
+
+// Redacted replaces the value of redacted fields.
+const Redacted = "[REDACTED]"
+
+// RedactHook scrubs biometric data from log entries: fields named like
+// embeddings, vectors, descriptors or landmarks are replaced and byte slices
+// (e.g. frame data) are truncated. The package logger installs it by default.
+type RedactHook struct{}
+
+// Levels returns all levels; every entry is scrubbed.
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the fields of entry.
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		if isRedactedKey(key) {
+			entry.Data[key] = Redacted
+			continue
+		}
+		if data, ok := value.([]byte); ok && len(data) > maxLoggedBytes {
+			entry.Data[key] = fmt.Sprintf("%x... (%d bytes)", data[:maxLoggedBytes], len(data))
+		}
+	}
+	return nil
+}
+
+// isRedactedKey reports whether a field name refers to biometric data.
+func isRedactedKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range redactedKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureRedaction adds a RedactHook to l unless it already has one.
+func ensureRedaction(l *logrus.Logger) {
+	for _, hook := range l.Hooks[logrus.InfoLevel] {
+		if _, ok := hook.(*RedactHook); ok {
+			return
+		}
+	}
+	l.AddHook(&RedactHook{})
+}
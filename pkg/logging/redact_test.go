@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactHook(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.JSONFormatter{})
+	l.AddHook(&RedactHook{})
+
+	frame := bytes.Repeat([]byte{0xab}, 1000)
+	l.WithFields(Fields{
+		"user":         "alice",
+		"embedding":    []float32{0.1, 0.2},
+		"probeVector":  "0.1,0.2",
+		"Descriptor":   [128]float32{},
+		"landmarks":    []int{1, 2},
+		"data":         frame,
+		"short_data":   []byte{1, 2},
+		"distance":     0.35,
+		"faces_found":  1,
+		"component":    "recognition",
+		"frame_number": 3,
+	}).Info("matched")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON log line %q: %v", buf.String(), err)
+	}
+
+	for _, key := range []string{"embedding", "probeVector", "Descriptor", "landmarks"} {
+		if entry[key] != Redacted {
+			t.Errorf("field %s = %v, want %s", key, entry[key], Redacted)
+		}
+	}
+	data, _ := entry["data"].(string)
+	if !strings.HasSuffix(data, "(1000 bytes)") || len(data) > 64 {
+		t.Errorf("data not truncated: %q", data)
+	}
+	if entry["user"] != "alice" || entry["distance"] != 0.35 || entry["component"] != "recognition" {
+		t.Errorf("unrelated fields changed: %v", entry)
+	}
+	if entry["short_data"] == nil || entry["short_data"] == Redacted {
+		t.Errorf("short byte slices should be kept: %v", entry["short_data"])
+	}
+}
+
+func TestInitialize_InstallsRedactHook(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+
+	for i := 0; i < 2; i++ {
+		if err := Initialize(Options{Level: "info"}); err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+	}
+
+	var hooks int
+	for _, hook := range Logger.Hooks[logrus.InfoLevel] {
+		if _, ok := hook.(*RedactHook); ok {
+			hooks++
+		}
+	}
+	if hooks != 1 {
+		t.Errorf("expected exactly one RedactHook, got %d", hooks)
+	}
+
+	var buf bytes.Buffer
+	Logger.SetOutput(&buf)
+	WithField("embedding", []float32{0.5}).Info("enrolled")
+	if strings.Contains(buf.String(), "0.5") {
+		t.Errorf("embedding leaked into log: %q", buf.String())
+	}
+}
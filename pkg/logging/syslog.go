@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"log/syslog"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyslogTag identifies FacePass messages in syslog and the journal.
+const SyslogTag = "facepass"
+
+// syslogWriter is the part of *syslog.Writer used by SyslogHook.
+type syslogWriter interface {
+	Crit(m string) error
+	Err(m string) error
+	Warning(m string) error
+	Info(m string) error
+	Debug(m string) error
+	Close() error
+}
+
+// dialSyslog connects to the local syslog daemon; tests replace it.
+var dialSyslog = func() (syslogWriter, error) {
+	return syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, SyslogTag)
+}
+
+// SyslogHook sends log entries to syslog (journald on most systems) under
+// the authpriv facility, mapping logrus levels to syslog severities.
+type SyslogHook struct {
+	writer syslogWriter
+}
+
+// Levels returns all levels; the logger level does the filtering.
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire writes the formatted entry at the matching syslog severity.
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return h.writer.Crit(line)
+	case logrus.ErrorLevel:
+		return h.writer.Err(line)
+	case logrus.WarnLevel:
+		return h.writer.Warning(line)
+	case logrus.InfoLevel:
+		return h.writer.Info(line)
+	default:
+		return h.writer.Debug(line)
+	}
+}
+
+// removeSyslogHook detaches and closes the hook added by Initialize. mu
+// must be held.
+func removeSyslogHook() {
+	if syslogHook == nil {
+		return
+	}
+	hooks := make(logrus.LevelHooks)
+	for level, levelHooks := range Logger.Hooks {
+		for _, hook := range levelHooks {
+			if hook != syslogHook {
+				hooks[level] = append(hooks[level], hook)
+			}
+		}
+	}
+	Logger.ReplaceHooks(hooks)
+	_ = syslogHook.writer.Close()
+	syslogHook = nil
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeSyslog struct {
+	messages []string
+	closed   bool
+}
+
+func (f *fakeSyslog) record(severity, m string) error {
+	f.messages = append(f.messages, severity+": "+m)
+	return nil
+}
+
+func (f *fakeSyslog) Crit(m string) error    { return f.record("crit", m) }
+func (f *fakeSyslog) Err(m string) error     { return f.record("err", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.record("warning", m) }
+func (f *fakeSyslog) Info(m string) error    { return f.record("info", m) }
+func (f *fakeSyslog) Debug(m string) error   { return f.record("debug", m) }
+func (f *fakeSyslog) Close() error           { f.closed = true; return nil }
+
+func useFakeSyslog(t *testing.T) *fakeSyslog {
+	t.Helper()
+	fake := &fakeSyslog{}
+	orig := dialSyslog
+	dialSyslog = func() (syslogWriter, error) { return fake, nil }
+	t.Cleanup(func() { dialSyslog = orig })
+	return fake
+}
+
+func TestInitialize_Syslog(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+	fake := useFakeSyslog(t)
+
+	if err := Initialize(Options{Level: "info", Output: OutputSyslog, File: "/nonexistent/facepass.log"}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if Logger.Out != io.Discard {
+		t.Error("syslog output should not write to stderr")
+	}
+
+	Info("auth ok")
+	WithField("embedding", []float32{1, 2}).Warn("leak?")
+	Debug("filtered")
+
+	if len(fake.messages) != 2 {
+		t.Fatalf("syslog messages = %q, want 2", fake.messages)
+	}
+	if !strings.HasPrefix(fake.messages[0], "info: ") || !strings.Contains(fake.messages[0], "auth ok") {
+		t.Errorf("unexpected info message %q", fake.messages[0])
+	}
+	if !strings.HasPrefix(fake.messages[1], "warning: ") || !strings.Contains(fake.messages[1], Redacted) {
+		t.Errorf("warning message not redacted: %q", fake.messages[1])
+	}
+
+	if err := Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !fake.closed || Logger.Out != os.Stderr {
+		t.Error("Close should close syslog and continue on stderr")
+	}
+	Info("after close")
+	if len(fake.messages) != 2 {
+		t.Error("syslog hook still attached after Close")
+	}
+}
+
+func TestInitialize_SyslogUnavailable(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+	orig := dialSyslog
+	dialSyslog = func() (syslogWriter, error) { return nil, errors.New("no /dev/log") }
+	defer func() { dialSyslog = orig }()
+
+	if err := Initialize(Options{Output: OutputSyslog}); err == nil {
+		t.Fatal("expected error when syslog is unavailable")
+	}
+	if Logger.Out != os.Stderr {
+		t.Error("expected logging to stay on stderr")
+	}
+}
+
+func TestInitialize_StderrOutput(t *testing.T) {
+	Logger = logrus.New()
+	defer func() { Logger = logrus.New() }()
+	logFile := t.TempDir() + "/facepass.log"
+
+	if err := Initialize(Options{Output: OutputStderr, File: logFile}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	Info("stderr only")
+	if _, err := os.Stat(logFile); !os.IsNotExist(err) {
+		t.Error("stderr output should not create the log file")
+	}
+}
@@ -0,0 +1,122 @@
+// Package metrics exposes authentication metrics in the Prometheus format
+// for long-running FacePass processes.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is the HTTP path the metrics are served on.
+const Path = "/metrics"
+
+// codeUnknown labels failures whose error is not a *pam.AuthError.
+const codeUnknown = "UNKNOWN"
+
+// Recorder collects authentication metrics from AuthResults.
+type Recorder struct {
+	registry        *prometheus.Registry
+	attempts        prometheus.Counter
+	successes       prometheus.Counter
+	failures        *prometheus.CounterVec
+	livenessRejects prometheus.Counter
+	duration        prometheus.Histogram
+	distance        prometheus.Histogram
+}
+
+// NewRecorder creates a recorder with its own registry.
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		registry: prometheus.NewRegistry(),
+		attempts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "facepass_auth_attempts_total",
+			Help: "Authentication attempts.",
+		}),
+		successes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "facepass_auth_successes_total",
+			Help: "Successful authentications.",
+		}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "facepass_auth_failures_total",
+			Help: "Failed authentications by error code.",
+		}, []string{"code"}),
+		livenessRejects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "facepass_liveness_rejects_total",
+			Help: "Authentications rejected by the liveness checks.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "facepass_auth_duration_seconds",
+			Help:    "Time taken by an authentication.",
+			Buckets: []float64{0.25, 0.5, 1, 2, 3, 5, 8, 13},
+		}),
+		distance: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "facepass_match_distance",
+			Help:    "Embedding distance of successful matches.",
+			Buckets: prometheus.LinearBuckets(0.1, 0.05, 10),
+		}),
+	}
+	r.registry.MustRegister(r.attempts, r.successes, r.failures, r.livenessRejects, r.duration, r.distance)
+	return r
+}
+
+// ObserveAuth records the outcome of an authentication. The match distance
+// is derived from the result's confidence, which is only set on success.
+func (r *Recorder) ObserveAuth(result pam.AuthResult) {
+	r.attempts.Inc()
+	r.duration.Observe(result.Duration.Seconds())
+
+	if result.Success {
+		r.successes.Inc()
+		r.distance.Observe(1.0 - result.Confidence)
+		return
+	}
+
+	code := codeUnknown
+	var authErr *pam.AuthError
+	if errors.As(result.Error, &authErr) {
+		code = string(authErr.Code)
+	}
+	r.failures.WithLabelValues(code).Inc()
+	if code == string(pam.ErrCodeLiveness) {
+		r.livenessRejects.Inc()
+	}
+}
+
+// Handler returns the HTTP handler serving the metrics.
+func (r *Recorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// Serve listens on addr and serves the recorder's metrics on Path in the
+// background. The returned server's Addr is the address actually listened
+// on; stop it with Close or Shutdown.
+func Serve(addr string, r *Recorder) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, r.Handler())
+	server := &http.Server{
+		Addr:              listener.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+	logging.Infof("Serving metrics on http://%s%s", server.Addr, Path)
+	return server, nil
+}
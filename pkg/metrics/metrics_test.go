@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/pam"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecorder_ObserveAuth(t *testing.T) {
+	r := NewRecorder()
+
+	r.ObserveAuth(pam.AuthResult{Success: true, Confidence: 0.7, Duration: 800 * time.Millisecond})
+	r.ObserveAuth(pam.AuthResult{Error: pam.NewAuthError(pam.ErrCodeLiveness, false), Duration: time.Second})
+	r.ObserveAuth(pam.AuthResult{Error: pam.NewAuthError(pam.ErrCodeNotRecognized, false)})
+	r.ObserveAuth(pam.AuthResult{Error: errors.New("boom")})
+
+	if got := testutil.ToFloat64(r.attempts); got != 4 {
+		t.Errorf("attempts = %v, want 4", got)
+	}
+	if got := testutil.ToFloat64(r.successes); got != 1 {
+		t.Errorf("successes = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(r.livenessRejects); got != 1 {
+		t.Errorf("liveness rejects = %v, want 1", got)
+	}
+	for code, want := range map[string]float64{"LIVENESS_FAILED": 1, "NOT_RECOGNIZED": 1, codeUnknown: 1} {
+		if got := testutil.ToFloat64(r.failures.WithLabelValues(code)); got != want {
+			t.Errorf("failures{code=%q} = %v, want %v", code, got, want)
+		}
+	}
+	if n := testutil.CollectAndCount(r.distance); n != 1 {
+		t.Errorf("distance histogram collected %d metrics, want 1", n)
+	}
+}
+
+func TestServe(t *testing.T) {
+	r := NewRecorder()
+	r.ObserveAuth(pam.AuthResult{Success: true, Confidence: 0.6})
+
+	server, err := Serve("127.0.0.1:0", r)
+	if err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	defer server.Close()
+
+	if _, err := Serve("bad address", r); err == nil {
+		t.Error("Serve() with an invalid address should fail")
+	}
+
+	resp, err := http.Get("http://" + server.Addr + Path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", Path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{"facepass_auth_attempts_total 1", "facepass_match_distance_count 1"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
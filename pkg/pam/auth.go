@@ -3,11 +3,20 @@
 package pam
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
 	"github.com/MrCodeEU/facepass/pkg/camera"
 	"github.com/MrCodeEU/facepass/pkg/config"
 	"github.com/MrCodeEU/facepass/pkg/liveness"
@@ -25,6 +34,7 @@ type AuthResult struct {
 	Reason     string
 	Username   string
 	Confidence float64
+	Profile    string // Enrollment profile of the matched embedding
 }
 
 // ErrorCode represents a specific authentication error type.
@@ -38,14 +48,39 @@ const (
 	ErrCodeCamera        ErrorCode = "CAMERA_ERROR"
 	ErrCodeTimeout       ErrorCode = "TIMEOUT"
 	ErrCodeNotEnrolled   ErrorCode = "NOT_ENROLLED"
+	ErrCodeIncompatible  ErrorCode = "INCOMPATIBLE_ENROLLMENT"
+	ErrCodeOverexposed   ErrorCode = "OVEREXPOSED"
+	ErrCodeDisabled      ErrorCode = "USER_DISABLED"
 )
 
+// MarshalJSON encodes the result for bug reports. The error is encoded with
+// its code and details if it is an *AuthError, or as its message otherwise.
+func (r AuthResult) MarshalJSON() ([]byte, error) {
+	var authErr interface{}
+	var structured *AuthError
+	if errors.As(r.Error, &structured) {
+		authErr = structured
+	} else if r.Error != nil {
+		authErr = map[string]string{"message": r.Error.Error()}
+	}
+	return json.Marshal(struct {
+		Success    bool        `json:"success"`
+		Username   string      `json:"username"`
+		Attempts   int         `json:"attempts"`
+		DurationMS int64       `json:"duration_ms"`
+		Confidence float64     `json:"confidence"`
+		Profile    string      `json:"profile,omitempty"`
+		Reason     string      `json:"reason,omitempty"`
+		Error      interface{} `json:"error,omitempty"`
+	}{r.Success, r.Username, r.Attempts, r.Duration.Milliseconds(), r.Confidence, r.Profile, r.Reason, authErr})
+}
+
 // AuthError is a structured authentication error.
 type AuthError struct {
-	Code    ErrorCode
-	Message string
-	Retry   bool
-	Details map[string]interface{}
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Retry   bool                   `json:"retry"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 func (e *AuthError) Error() string {
@@ -73,6 +108,9 @@ var errorMessages = map[ErrorCode]string{
 	ErrCodeCamera:        "Camera error. Please check your camera connection",
 	ErrCodeTimeout:       "Face recognition timed out. Please enter your password",
 	ErrCodeNotEnrolled:   "No face data enrolled for this user",
+	ErrCodeIncompatible:  "Face data was enrolled with an incompatible model. Please re-enroll",
+	ErrCodeOverexposed:   "Too much light on the camera. Move away from the window or bright light",
+	ErrCodeDisabled:      "Face authentication is disabled for this user",
 }
 
 // GetErrorMessage returns a user-friendly message for an error code.
@@ -93,12 +131,35 @@ func NewAuthError(code ErrorCode, retry bool) *AuthError {
 	}
 }
 
+// newCameraBusyError reports that another application holds the camera, so
+// no attempt can capture until it is closed.
+func newCameraBusyError(err error) *AuthError {
+	authErr := NewAuthError(ErrCodeCamera, false)
+	authErr.Message = "The camera is in use by another application. Close it and try again"
+	authErr.Details["camera_busy"] = err.Error()
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		hint := camera.BusyHint(pathErr.Path)
+		authErr.Details["hint"] = hint
+		logging.Errorf("Camera busy: %v; %s", err, hint)
+	}
+	return authErr
+}
+
 // ErrAuthFailed is returned when authentication fails.
 var ErrAuthFailed = errors.New("authentication failed")
 
 // ErrUserNotEnrolled is returned when user has no face data.
 var ErrUserNotEnrolled = errors.New("user not enrolled")
 
+// ErrIdentityChanged is returned when the face changes to a different
+// person during a capture.
+var ErrIdentityChanged = errors.New("a different face appeared during capture")
+
+// ErrUserDisabled is returned when face authentication is disabled for the
+// user with 'facepass disable'.
+var ErrUserDisabled = errors.New("face authentication disabled for user")
+
 // ErrTimeout is returned when authentication times out.
 var ErrTimeout = errors.New("authentication timeout")
 
@@ -115,6 +176,7 @@ type Camera interface {
 	Open(device string) error
 	SetResolution(width, height int) error
 	GetDeviceInfo() camera.DeviceInfo
+	Capabilities() camera.CameraCapabilities
 }
 
 // Recognizer defines the interface for face recognition.
@@ -124,6 +186,7 @@ type Recognizer interface {
 	LoadModels(path string) error
 	SetTolerance(tolerance float64)
 	DetectSingleFace(data []byte) (*recognition.Face, error)
+	DetectFacesBatch(images [][]byte) ([][]recognition.Face, error)
 	GetEmbedding(face *recognition.Face, label string) recognition.Embedding
 }
 
@@ -132,6 +195,7 @@ type Storage interface {
 	UserExists(username string) bool
 	LoadUser(username string) (*storage.UserFaceData, error)
 	UpdateLastUsed(username string) error
+	AddEmbeddingToProfile(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error
 }
 
 // LivenessChecker defines the interface for liveness detection.
@@ -148,8 +212,20 @@ type PAMAuthenticator struct {
 	camera     Camera
 	liveness   LivenessChecker
 
+	// crossCamera is the other camera of a dual IR/RGB camera, capturing
+	// alongside camera for liveness_detection.cross_check; nil without it
+	crossCamera Camera
+
 	timeout     time.Duration
 	maxAttempts int
+	retryDelay  time.Duration
+	prompt      func(message string)
+
+	// cameraGrace keeps the camera on after a successful authentication;
+	// hold is the running hold, guarded by holdMu
+	cameraGrace time.Duration
+	holdMu      sync.Mutex
+	hold        *cameraHold
 }
 
 // NewPAMAuthenticator creates a new PAM authenticator.
@@ -158,24 +234,67 @@ func NewPAMAuthenticator(cfg *config.Config) (*PAMAuthenticator, error) {
 		config:      cfg,
 		timeout:     time.Duration(cfg.Auth.Timeout) * time.Second,
 		maxAttempts: cfg.Auth.MaxAttempts,
+		retryDelay:  time.Duration(cfg.Auth.RetryDelayMS) * time.Millisecond,
+		cameraGrace: time.Duration(cfg.Auth.CameraGraceSeconds) * time.Second,
 	}
 
 	// Initialize storage
-	store, err := storage.NewFileStorage(cfg.Storage.DataDir, cfg.Storage.EncryptionEnabled)
+	store, err := storage.NewBackend(storage.Options{
+		Backend:           cfg.Storage.Backend,
+		DataDir:           cfg.Storage.DataDir,
+		EncryptionEnabled: cfg.Storage.EncryptionEnabled,
+		KeySource:         storage.KeySource(cfg.Storage.KeySource),
+		KeyFile:           cfg.Storage.KeyFile,
+		Compress:          cfg.Storage.Compress,
+		LastUsedInterval:  time.Duration(cfg.Storage.LastUsedInterval) * time.Second,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 	auth.storage = store
 
-	// Initialize recognizer
-	auth.recognizer = recognition.NewRecognizer()
-	if err := auth.recognizer.LoadModels(cfg.Recognition.ModelPath); err != nil {
+	// Initialize recognizer. Jittering is too slow for authentication, it
+	// only applies to enrollment.
+	rec, err := recognition.NewEngine(recognition.Options{
+		Backend:    cfg.Recognition.Backend,
+		ModelPaths: cfg.Recognition.ModelPath,
+		ModelNames: recognition.ModelNames{
+			ShapePredictor: cfg.Recognition.LandmarkModel,
+			Recognition:    cfg.Recognition.RecognitionModel,
+		},
+		ONNX: acceleration.ONNXConfig{
+			Backend:         acceleration.Backend(cfg.Acceleration.Backend),
+			ModelPath:       cfg.Acceleration.ONNXModelPath,
+			DeviceIndex:     cfg.Acceleration.DeviceIndex,
+			EnableProfiling: cfg.Acceleration.EnableProfiling,
+		},
+		FallbackToDlib: cfg.Acceleration.FallbackToCPU,
+		Tolerance:      cfg.Recognition.Tolerance,
+		MinQuality:     cfg.Recognition.MinEmbeddingQuality,
+		Normalize:      cfg.Recognition.NormalizeEmbeddings,
+		MinFaceSize:    cfg.Recognition.MinFacePx,
+		Padding:        cfg.Recognition.Padding,
+		Detector:       cfg.Recognition.Detector,
+		Preprocess:     cfg.Recognition.Preprocess,
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to load recognition models: %w", err)
 	}
-	auth.recognizer.SetTolerance(cfg.Recognition.Tolerance)
+	// Pay for the first, slower inference now instead of in the first attempt
+	if err := rec.WarmUp(); err != nil {
+		logging.Warnf("Recognition warm-up failed: %v", err)
+	}
+	auth.recognizer = rec
 
 	// Initialize camera
-	auth.camera = camera.NewCamera()
+	cam := camera.NewCamera()
+	if err := cam.SetPixelFormat(cfg.Camera.PixelFormat); err != nil {
+		return nil, err
+	}
+	if err := cam.SetJPEGQuality(cfg.Camera.JPEGQuality); err != nil {
+		return nil, err
+	}
+	auth.camera = cam
 	if err := auth.camera.Open(cfg.Camera.Device); err != nil {
 		return nil, fmt.Errorf("failed to open camera: %w", err)
 	}
@@ -183,23 +302,50 @@ func NewPAMAuthenticator(cfg *config.Config) (*PAMAuthenticator, error) {
 		logging.Warnf("Failed to set camera resolution: %v", err)
 	}
 
+	// The second camera captures in its own native format
+	if cfg.Liveness.CrossCheck {
+		cross := camera.NewCamera()
+		if err := cross.SetJPEGQuality(cfg.Camera.JPEGQuality); err != nil {
+			return nil, err
+		}
+		device := crossCheckDevice(cfg)
+		if err := cross.Open(device); err != nil {
+			_ = auth.camera.Close()
+			return nil, fmt.Errorf("failed to open cross-check camera %s: %w", device, err)
+		}
+		if err := cross.SetResolution(cfg.Camera.Width, cfg.Camera.Height); err != nil {
+			logging.Warnf("Failed to set cross-check camera resolution: %v", err)
+		}
+		auth.crossCamera = cross
+	}
+
 	// Initialize liveness detector
-	livenessLevel := liveness.Level(cfg.Liveness.Level)
-	livenessCfg := liveness.ConfigFromLevel(livenessLevel)
-	// Apply configured thresholds
-	livenessCfg.MovementThreshold = cfg.Liveness.Thresholds.Movement
-	livenessCfg.DepthThreshold = cfg.Liveness.Thresholds.Depth
-	livenessCfg.ConsistencyThreshold = cfg.Liveness.Thresholds.Consistency
-	auth.liveness = liveness.NewDetector(livenessCfg)
+	auth.liveness = liveness.NewDetectorFromConfig(cfg)
 
 	return auth, nil
 }
 
+// crossCheckDevice returns the camera paired with camera.device for
+// liveness_detection.cross_check: rgb_device if camera.device is the IR
+// camera, ir_device otherwise.
+func crossCheckDevice(cfg *config.Config) string {
+	if cfg.Camera.Device == cfg.Camera.IRDevice {
+		return cfg.Camera.RGBDevice
+	}
+	return cfg.Camera.IRDevice
+}
+
 // Close releases all resources.
 func (a *PAMAuthenticator) Close() {
 	if a.camera != nil {
+		if a.takeHold() {
+			a.releaseCamera()
+		}
 		_ = a.camera.Close()
 	}
+	if a.crossCamera != nil {
+		_ = a.crossCamera.Close()
+	}
 	if a.recognizer != nil {
 		_ = a.recognizer.Close()
 	}
@@ -215,6 +361,19 @@ func (a *PAMAuthenticator) SetMaxAttempts(attempts int) {
 	a.maxAttempts = attempts
 }
 
+// SetPrompt sets the function that shows messages to the user during
+// authentication. The retry prompt is only shown when auth.retry_prompt is
+// enabled.
+func (a *PAMAuthenticator) SetPrompt(prompt func(message string)) {
+	a.prompt = prompt
+}
+
+// CameraCapabilities reports the IR emitter and format support of the
+// camera used for authentication.
+func (a *PAMAuthenticator) CameraCapabilities() camera.CameraCapabilities {
+	return a.camera.Capabilities()
+}
+
 // Authenticate performs face recognition authentication.
 func (a *PAMAuthenticator) Authenticate(username string) AuthResult {
 	startTime := time.Now()
@@ -234,38 +393,106 @@ func (a *PAMAuthenticator) Authenticate(username string) AuthResult {
 	}
 
 	// Load user embeddings
+	userData, err := a.loadUser(username)
+	if err != nil {
+		result.Error, result.Reason = loadUserError(err)
+		return result
+	}
+
+	return a.authenticate(result, startTime, map[string]*storage.UserFaceData{username: userData})
+}
+
+// loadUser loads a user's face data and checks that the user is enabled and
+// the embeddings can be matched. An enrollment made with an incompatible
+// model would otherwise fail every authentication without saying why.
+func (a *PAMAuthenticator) loadUser(username string) (*storage.UserFaceData, error) {
 	userData, err := a.storage.LoadUser(username)
 	if err != nil {
+		return nil, err
+	}
+	if userData.Disabled {
+		return nil, fmt.Errorf("%w: %s", ErrUserDisabled, username)
+	}
+	if err := recognition.ValidateEmbeddings(userData.Embeddings); err != nil {
+		return nil, fmt.Errorf("%s: %w", username, err)
+	}
+	return userData, nil
+}
+
+// loadUserError converts a loadUser error into the result error and reason.
+func loadUserError(err error) (*AuthError, string) {
+	if errors.Is(err, ErrUserDisabled) {
+		logging.Warnf("Face authentication is disabled: %v", err)
+		return NewAuthError(ErrCodeDisabled, false), "user disabled"
+	}
+	if errors.Is(err, recognition.ErrIncompatibleEmbedding) {
+		logging.Errorf("Enrollment cannot be used: %v", err)
+		return NewAuthError(ErrCodeIncompatible, false), err.Error()
+	}
+	logging.Errorf("Failed to load user data: %v", err)
+	return NewAuthError(ErrCodeNotEnrolled, false), "failed to load user data"
+}
+
+// Identify authenticates whoever is in front of the camera against the
+// enrolled users in usernames, with the same liveness checks and retries as
+// Authenticate. On success result.Username is the matched user.
+func (a *PAMAuthenticator) Identify(usernames []string) AuthResult {
+	startTime := time.Now()
+	result := AuthResult{Success: false}
+
+	galleries := make(map[string]*storage.UserFaceData, len(usernames))
+	for _, username := range usernames {
+		userData, err := a.loadUser(username)
+		if err != nil {
+			logging.Warnf("Skipping %s for identification: %v", username, err)
+			continue
+		}
+		galleries[username] = userData
+	}
+	if len(galleries) == 0 {
 		result.Error = NewAuthError(ErrCodeNotEnrolled, false)
-		result.Reason = "failed to load user data"
+		result.Reason = "no enrolled users"
 		return result
 	}
 
-	// Enable IR emitter if available
-	if a.camera.HasIREmitter() {
-		if err := a.camera.EnableIREmitter(); err != nil {
-			logging.Warnf("Failed to enable IR emitter: %v", err)
-		}
+	logging.Infof("Starting identification against %d user(s)", len(galleries))
+	return a.authenticate(result, startTime, galleries)
+}
+
+// authenticate captures frames until a live face matches one of the
+// galleries, keyed by username, or the attempts or time run out.
+func (a *PAMAuthenticator) authenticate(result AuthResult, startTime time.Time, galleries map[string]*storage.UserFaceData) AuthResult {
+	// Enable IR emitter if available and start streaming for faster capture.
+	// When the emitter is expected but fails to trigger, frames will be dark
+	// and every attempt would fail as "not recognized", so report a camera
+	// error instead.
+	streaming, err := a.acquireCamera(true)
+	if err != nil {
+		a.releaseCamera()
+		logging.Errorf("Failed to enable IR emitter: %v", err)
+		authErr := NewAuthError(ErrCodeCamera, false)
+		authErr.Message = "IR emitter could not be enabled. Please check your IR emitter setup"
+		authErr.Details["ir_emitter"] = err.Error()
+		result.Error = authErr
+		result.Reason = fmt.Sprintf("IR emitter failed to activate: %v", err)
+		result.Duration = time.Since(startTime)
+		return result
 	}
 	defer func() {
-		_ = a.camera.DisableIREmitter()
+		a.finishCamera(streaming, result.Success)
 	}()
 
 	// Authentication loop with timeout and retries
 	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
 	defer cancel()
 
-	// Start streaming for faster capture
-	if err := a.camera.StartStreaming(); err != nil {
-		logging.Warnf("Failed to start streaming, falling back to single capture: %v", err)
-	}
-	defer func() {
-		_ = a.camera.StopStreaming()
-	}()
-
+	weakMatches, sparseMatches, identityChanges, overexposed := 0, 0, 0, false
 	for attempt := 1; attempt <= a.maxAttempts; attempt++ {
 		result.Attempts = attempt
 		logging.Debugf("Authentication attempt %d/%d", attempt, a.maxAttempts)
+		if attempt > 1 {
+			a.pauseBeforeRetry(ctx)
+		}
 
 		// Check for timeout
 		select {
@@ -277,8 +504,8 @@ func (a *PAMAuthenticator) Authenticate(username string) AuthResult {
 		default:
 		}
 
-		// Capture 30 frames (approx 1.5s at 20fps) for liveness detection
-		frames, err := a.captureFramesForLiveness(ctx, 30)
+		// Capture frames (30 by default, approx 1.5s at 20fps) for liveness detection
+		frames, err := a.captureFramesForLiveness(ctx, a.config.Auth.CaptureFrames)
 		if err != nil {
 			if ctx.Err() != nil {
 				result.Error = NewAuthError(ErrCodeTimeout, false)
@@ -286,6 +513,19 @@ func (a *PAMAuthenticator) Authenticate(username string) AuthResult {
 				result.Duration = time.Since(startTime)
 				return result
 			}
+			// Retrying cannot help while another application holds the camera
+			if errors.Is(err, camera.ErrCameraBusy) {
+				result.Error = newCameraBusyError(err)
+				result.Reason = err.Error()
+				result.Duration = time.Since(startTime)
+				return result
+			}
+			overexposed = overexposed || errors.Is(err, camera.ErrOverexposed)
+			if errors.Is(err, ErrIdentityChanged) {
+				logging.Warnf("SECURITY: rejecting attempt %d: %v", attempt, err)
+				identityChanges++
+				continue
+			}
 			logging.Warnf("Frame capture failed on attempt %d: %v", attempt, err)
 			continue
 		}
@@ -298,6 +538,7 @@ func (a *PAMAuthenticator) Authenticate(username string) AuthResult {
 			if !livenessResult.RequiresRetry {
 				// Definite failure (e.g., photo attack)
 				logging.Errorf("SECURITY ALERT: Liveness check failed - potential spoofing attempt detected: %s", livenessResult.Reason)
+				a.saveSpoofFrames(result.Username, frames, livenessResult)
 				result.Duration = time.Since(startTime)
 				return result
 			}
@@ -313,63 +554,390 @@ func (a *PAMAuthenticator) Authenticate(username string) AuthResult {
 		}
 
 		// Compare with stored embeddings
-		idx, distance, matched := a.recognizer.FindBestMatch(*embedding, userData.Embeddings)
+		username, idx, distance, matched := a.matchGalleries(*embedding, galleries)
+		tolerance := a.userTolerance(galleries[username])
+		if matched && !a.confidentMatch(distance, tolerance) {
+			logging.Warnf("Rejecting weak match for %s (distance: %.4f, required below: %.4f)",
+				username, distance, a.requiredDistance(tolerance))
+			weakMatches++
+			continue
+		}
 		if matched {
+			if count, required, ok := a.enoughMatches(*embedding, galleries[username]); !ok {
+				logging.Warnf("Rejecting match for %s: %d of %d required enrolled embeddings within tolerance",
+					username, count, required)
+				sparseMatches++
+				continue
+			}
+
 			result.Success = true
+			result.Username = username
 			result.Confidence = 1.0 - distance
+			result.Profile = galleries[username].ProfileAt(idx)
 			result.Duration = time.Since(startTime)
-			logging.Infof("Authentication successful for %s (match index: %d, distance: %.4f)",
-				username, idx, distance)
+			logging.Infof("Authentication successful for %s (profile: %s, match index: %d, distance: %.4f)",
+				username, result.Profile, idx, distance)
 
 			// Update last used timestamp
 			if err := a.storage.UpdateLastUsed(username); err != nil {
 				logging.Warnf("Failed to update last used timestamp: %v", err)
 			}
 
+			a.updateTemplate(username, result.Profile, *embedding, distance, tolerance)
+
 			return result
 		}
 
-		logging.Debugf("Face not matched (distance: %.4f, threshold: %.4f)", distance, a.config.Recognition.Tolerance)
+		logging.Debugf("Face not matched (distance: %.4f, threshold: %.4f)", distance, tolerance)
 	}
 
 	// All attempts failed
 	result.Error = NewAuthError(ErrCodeNotRecognized, false)
 	result.Reason = "face not recognized after maximum attempts"
+	switch {
+	case weakMatches > 0:
+		result.Reason = fmt.Sprintf("face matched %d time(s) but below the required confidence margin", weakMatches)
+	case sparseMatches > 0:
+		result.Reason = fmt.Sprintf("face matched %d time(s) but too few enrolled embeddings were within tolerance", sparseMatches)
+	case identityChanges > 0:
+		result.Error = NewAuthError(ErrCodeMultipleFaces, true)
+		result.Reason = fmt.Sprintf("a different face appeared during capture in %d attempt(s)", identityChanges)
+	case overexposed:
+		result.Error = NewAuthError(ErrCodeOverexposed, true)
+		result.Reason = "no face found in overexposed frames (too much light)"
+	}
 	result.Duration = time.Since(startTime)
 	return result
 }
 
+// userTolerance returns the match tolerance for user: the user's override
+// if set, otherwise recognition.tolerance.
+func (a *PAMAuthenticator) userTolerance(user *storage.UserFaceData) float64 {
+	return user.MatchTolerance(a.config.Recognition.Tolerance)
+}
+
+// userMatch applies the user's tolerance override, if any, to a
+// FindBestMatch result, which was decided with the global tolerance.
+func userMatch(user *storage.UserFaceData, distance float64, matched bool) bool {
+	if user.Tolerance == nil {
+		return matched
+	}
+	return distance < *user.Tolerance
+}
+
+// requiredDistance returns the distance a match must stay below to be
+// accepted: tolerance minus auth.min_confidence_margin.
+func (a *PAMAuthenticator) requiredDistance(tolerance float64) float64 {
+	return tolerance - a.config.Auth.MinConfidenceMargin
+}
+
+// confidentMatch reports whether a match at distance is far enough below
+// tolerance to be accepted. Without a margin every match is accepted.
+func (a *PAMAuthenticator) confidentMatch(distance, tolerance float64) bool {
+	return a.config.Auth.MinConfidenceMargin <= 0 || distance < a.requiredDistance(tolerance)
+}
+
+// enoughMatches reports whether at least auth.min_matching_embeddings of the
+// user's gallery, capped at its size, are within the user's tolerance of the
+// probe. It returns the number of matches and the number required.
+func (a *PAMAuthenticator) enoughMatches(probe recognition.Embedding, user *storage.UserFaceData) (int, int, bool) {
+	gallery := user.Embeddings
+	required := min(a.config.Auth.MinMatchingEmbeddings, len(gallery))
+	if required <= 1 {
+		return 1, required, true
+	}
+	if a.config.Recognition.NormalizeEmbeddings {
+		probe = recognition.NormalizeEmbedding(probe)
+		normalized := make([]recognition.Embedding, len(gallery))
+		for i, emb := range gallery {
+			normalized[i] = recognition.NormalizeEmbedding(emb)
+		}
+		gallery = normalized
+	}
+	count := recognition.CountMatches(probe, gallery, a.userTolerance(user))
+	return count, required, count >= required
+}
+
+// spoofReport is written next to the frames saved by saveSpoofFrames.
+type spoofReport struct {
+	Time     time.Time         `json:"time"`
+	Username string            `json:"username"`
+	Reason   string            `json:"reason"`
+	Score    float64           `json:"score"`
+	Checks   map[string]bool   `json:"checks,omitempty"`
+	Frames   []spoofReportItem `json:"frames"`
+}
+
+type spoofReportItem struct {
+	File      string    `json:"file"`
+	FaceFound bool      `json:"face_found"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// saveSpoofFrames writes the frames of a detected spoof attempt and a
+// spoof.json report to a new subdirectory of
+// liveness_detection.debug_save_spoof_dir, if set. Failures are only logged:
+// they must not change the authentication result.
+func (a *PAMAuthenticator) saveSpoofFrames(username string, frames []liveness.Frame, result liveness.Result) {
+	base := a.config.Liveness.DebugSaveSpoofDir
+	if base == "" {
+		return
+	}
+
+	now := time.Now().UTC()
+	// The name is only used in the directory name, so it must be safe there;
+	// identification mode has no username yet
+	name := username
+	if storage.ValidateUsername(name) != nil {
+		name = "unknown-user"
+	}
+	dir := filepath.Join(base, fmt.Sprintf("%s-%s", now.Format("20060102T150405.000Z"), name))
+	if err := os.MkdirAll(base, 0700); err != nil {
+		logging.Warnf("Failed to save spoof frames: %v", err)
+		return
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		logging.Warnf("Failed to save spoof frames: %v", err)
+		return
+	}
+
+	report := spoofReport{Time: now, Username: username, Reason: result.Reason, Score: result.Score, Checks: result.Checks}
+	for i, frame := range frames {
+		ext := ".raw"
+		if bytes.HasPrefix(frame.Data, []byte{0xFF, 0xD8}) {
+			ext = ".jpg"
+		}
+		file := fmt.Sprintf("frame-%02d%s", i, ext)
+		if err := os.WriteFile(filepath.Join(dir, file), frame.Data, 0600); err != nil {
+			logging.Warnf("Failed to save spoof frame: %v", err)
+			return
+		}
+		report.Frames = append(report.Frames, spoofReportItem{File: file, FaceFound: frame.FaceFound, Timestamp: frame.Timestamp})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "spoof.json"), data, 0600)
+	}
+	if err != nil {
+		logging.Warnf("Failed to save spoof report: %v", err)
+		return
+	}
+	logging.Warnf("Saved %d frames of the spoof attempt to %s", len(frames), dir)
+}
+
+// retryPrompt is shown between attempts when auth.retry_prompt is enabled.
+const retryPrompt = "Adjust your position and hold still..."
+
+// pauseBeforeRetry gives the user a moment to reposition after a failed
+// attempt. It returns early when ctx is done.
+func (a *PAMAuthenticator) pauseBeforeRetry(ctx context.Context) {
+	if a.prompt != nil && a.config.Auth.RetryPrompt {
+		a.prompt(retryPrompt)
+	}
+	if a.retryDelay <= 0 {
+		return
+	}
+	timer := time.NewTimer(a.retryDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// matchGalleries returns the user whose gallery contains the closest match
+// for embedding. Users are compared in sorted order so ties are stable. The
+// index refers to the user's flattened Embeddings, which span all profiles.
+func (a *PAMAuthenticator) matchGalleries(embedding recognition.Embedding, galleries map[string]*storage.UserFaceData) (string, int, float64, bool) {
+	usernames := make([]string, 0, len(galleries))
+	for username := range galleries {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	best, bestIdx, bestDistance, bestMatched := "", -1, math.MaxFloat64, false
+	for _, username := range usernames {
+		idx, distance, matched := a.recognizer.FindBestMatch(embedding, galleries[username].Embeddings)
+		matched = userMatch(galleries[username], distance, matched)
+		if best == "" || distance < bestDistance {
+			best, bestIdx, bestDistance, bestMatched = username, idx, distance, matched
+		}
+	}
+	return best, bestIdx, bestDistance, bestMatched
+}
+
+// updateTemplate appends a fresh embedding to the matched profile when the match
+// was comfortably within tolerance, so enrollment follows gradual appearance changes.
+func (a *PAMAuthenticator) updateTemplate(username, profile string, embedding recognition.Embedding, distance, tolerance float64) {
+	update := a.config.Auth.TemplateUpdate
+	if !update.Enabled {
+		return
+	}
+
+	if distance >= tolerance-update.Margin {
+		logging.Debugf("Skipping template update (distance: %.4f, required below: %.4f)",
+			distance, tolerance-update.Margin)
+		return
+	}
+
+	embedding.Angle = "auto"
+	embedding.MarkCaptured(camera.RedactDevice(a.config.Camera.Device))
+	if profile == "" {
+		profile = storage.DefaultProfile
+	}
+	err := a.storage.AddEmbeddingToProfile(username, profile, embedding, update.MaxEmbeddings)
+	if errors.Is(err, storage.ErrDuplicateEmbedding) {
+		logging.Debugf("Skipping template update for %s: embedding already enrolled", username)
+		return
+	}
+	if err != nil {
+		logging.Warnf("Failed to update face template: %v", err)
+		return
+	}
+
+	logging.Infof("Updated face template for %s, profile %s (distance: %.4f)", username, profile, distance)
+}
+
+// CaptureEmbedding captures a single face for enrollment and returns its
+// embedding labelled with angle. camera.warmup_frames frames are discarded
+// first so exposure and the IR emitter can settle.
+func (a *PAMAuthenticator) CaptureEmbedding(angle string) (*recognition.Embedding, error) {
+	// A camera kept on after authentication is restarted below as usual
+	a.takeHold()
+	if a.camera.HasIREmitter() && a.config.Camera.IREmitterEnabled {
+		if err := a.camera.EnableIREmitter(); err != nil {
+			logging.Warnf("Failed to enable IR emitter: %v", err)
+		}
+		defer func() {
+			_ = a.camera.DisableIREmitter()
+		}()
+	}
+
+	if err := a.camera.StartStreaming(); err != nil {
+		logging.Warnf("Failed to start streaming, falling back to single capture: %v", err)
+	}
+	defer func() {
+		_ = a.camera.StopStreaming()
+	}()
+
+	for k := 0; k < a.config.Camera.WarmupFrames; k++ {
+		_, _ = a.camera.ReadFrame()
+	}
+	frame, err := a.camera.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("capture failed: %w", err)
+	}
+
+	face, err := a.recognizer.DetectSingleFace(frame.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := recognition.CheckFaceInFrame(face, frame.Width, frame.Height, a.config.Recognition.EdgeMargin); err != nil {
+		return nil, err
+	}
+
+	embedding := a.recognizer.GetEmbedding(face, angle)
+	embedding.MarkCaptured(camera.RedactDevice(a.config.Camera.Device))
+	return &embedding, nil
+}
+
 // captureFramesForLiveness captures multiple frames for liveness detection.
+// Frames are captured first and then handed to the recognizer as one batch.
+// With a cross-check camera every frame is paired with one of its frames.
 func (a *PAMAuthenticator) captureFramesForLiveness(ctx context.Context, count int) ([]liveness.Frame, error) {
-	var frames []liveness.Frame
+	var captured, crossCaptured []*camera.Frame
 
 	for i := 0; i < count; i++ {
 		// Check for context cancellation
 		select {
 		case <-ctx.Done():
-			return frames, ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 
 		// Capture frame (uses ReadFrame which handles streaming or fallback)
 		camFrame, err := a.camera.ReadFrame()
+		if errors.Is(err, camera.ErrCameraBusy) {
+			return nil, err
+		}
 		if err != nil {
 			logging.Warnf("Failed to capture frame %d: %v", i, err)
 			continue
 		}
+		captured = append(captured, camFrame)
 
+		// A missing frame of the other camera fails the cross-check
+		if a.crossCamera != nil {
+			crossFrame, err := a.crossCamera.ReadFrame()
+			if errors.Is(err, camera.ErrCameraBusy) {
+				return nil, err
+			}
+			if err != nil {
+				logging.Warnf("Failed to capture cross-check frame %d: %v", i, err)
+				crossFrame = nil
+			}
+			crossCaptured = append(crossCaptured, crossFrame)
+		}
+
+		// No sleep needed when streaming
+	}
+
+	if len(captured) < 5 {
+		return nil, fmt.Errorf("insufficient frames captured: %d", len(captured))
+	}
+
+	images := make([][]byte, len(captured))
+	for i, camFrame := range captured {
+		images[i] = camFrame.Data
+	}
+	// Frames of the other camera follow in the same batch
+	crossIndex := make([]int, len(crossCaptured))
+	for i, crossFrame := range crossCaptured {
+		crossIndex[i] = -1
+		if crossFrame != nil {
+			crossIndex[i] = len(images)
+			images = append(images, crossFrame.Data)
+		}
+	}
+
+	// Detect faces and get embeddings for all frames at once
+	detected, err := a.recognizer.DetectFacesBatch(images)
+	if err != nil {
+		return nil, fmt.Errorf("face detection failed: %w", err)
+	}
+
+	isIR := a.camera.GetDeviceInfo().IsIR
+	faceFound := false
+	frames := make([]liveness.Frame, 0, len(captured))
+	for i, camFrame := range captured {
 		// Convert to liveness frame
 		liveFrame := liveness.Frame{
-			Data:      camFrame.Data,
-			IsIR:      a.camera.GetDeviceInfo().IsIR,
-			Timestamp: camFrame.Timestamp,
-			FaceFound: false,
+			Data:        camFrame.Data,
+			IsIR:        isIR,
+			Timestamp:   camFrame.Timestamp,
+			FaceFound:   false,
+			IRHistogram: camFrame.IRHistogram(liveness.IRHistogramBins),
+		}
+		if a.crossCamera != nil {
+			liveFrame.Cross = &liveness.Frame{}
+			if k := crossIndex[i]; k >= 0 && len(detected[k]) == 1 {
+				box := detected[k][0].BoundingBox
+				liveFrame.Cross.FaceFound = true
+				liveFrame.Cross.FaceBox = liveness.NewBox(box.X, box.Y, box.Width, box.Height, crossCaptured[i].Width, crossCaptured[i].Height)
+			}
 		}
 
-		// Detect face and get embedding
-		face, err := a.recognizer.DetectSingleFace(camFrame.Data)
-		if err == nil {
-			liveFrame.FaceFound = true
+		// Exactly one face is required, as with DetectSingleFace
+		if len(detected[i]) == 1 {
+			face := &detected[i][0]
+			if err := recognition.CheckFaceInFrame(face, camFrame.Width, camFrame.Height, a.config.Recognition.EdgeMargin); err != nil {
+				logging.Debugf("Ignoring frame %d: %v", i, err)
+				frames = append(frames, liveFrame)
+				continue
+			}
+			liveFrame.FaceFound, faceFound = true, true
+			liveFrame.FaceBox = liveness.NewBox(face.BoundingBox.X, face.BoundingBox.Y, face.BoundingBox.Width, face.BoundingBox.Height, camFrame.Width, camFrame.Height)
 			liveFrame.Embedding = a.recognizer.GetEmbedding(face, "auth")
 
 			// Convert landmarks
@@ -391,17 +959,60 @@ func (a *PAMAuthenticator) captureFramesForLiveness(ctx context.Context, count i
 		}
 
 		frames = append(frames, liveFrame)
-
-		// No sleep needed when streaming
 	}
 
-	if len(frames) < 5 {
-		return nil, fmt.Errorf("insufficient frames captured: %d", len(frames))
+	// A saturated sensor washes faces out; report that instead of no face
+	if !faceFound {
+		if err := captured[len(captured)/2].CheckExposure(a.config.Camera.MaxSaturation); errors.Is(err, camera.ErrOverexposed) {
+			return nil, err
+		}
 	}
 
+	if err := a.dropIdentityChanges(frames); err != nil {
+		return nil, err
+	}
 	return frames, nil
 }
 
+// maxIdentityChangeFrames is how many frames dropIdentityChanges may drop
+// before the capture counts as showing two people. A single frame is more
+// likely a misdetection than a swap.
+const maxIdentityChangeFrames = 1
+
+// dropIdentityChanges marks frames whose face is farther than
+// recognition.identity_distance from the face seen so far in the capture as
+// having no face, so they count for neither liveness nor the averaged
+// embedding. If more than maxIdentityChangeFrames are dropped someone else
+// stepped in front of the camera, and ErrIdentityChanged is returned.
+func (a *PAMAuthenticator) dropIdentityChanges(frames []liveness.Frame) error {
+	var indexes []int
+	var embeddings []recognition.Embedding
+	for i, frame := range frames {
+		if !frame.FaceFound {
+			continue
+		}
+		embedding := frame.Embedding
+		if a.config.Recognition.NormalizeEmbeddings {
+			embedding = recognition.NormalizeEmbedding(embedding)
+		}
+		indexes = append(indexes, i)
+		embeddings = append(embeddings, embedding)
+	}
+
+	changed := recognition.IdentityChanges(embeddings, a.config.Recognition.IdentityDistance)
+	for _, k := range changed {
+		frame := &frames[indexes[k]]
+		frame.FaceFound, frame.Embedding, frame.Landmarks, frame.EyeAspectRatio = false, recognition.Embedding{}, nil, 0
+	}
+	if len(changed) > maxIdentityChangeFrames {
+		return fmt.Errorf("%w: %d of %d frames", ErrIdentityChanged, len(changed), len(embeddings))
+	}
+	if len(changed) > 0 {
+		logging.Debugf("Dropped %d frame(s) with a different face", len(changed))
+	}
+	return nil
+}
+
 // getBestEmbedding extracts the best quality embedding from frames.
 func (a *PAMAuthenticator) getBestEmbedding(frames []liveness.Frame) (*recognition.Embedding, error) {
 	var embeddings []recognition.Embedding
@@ -416,7 +1027,13 @@ func (a *PAMAuthenticator) getBestEmbedding(frames []liveness.Frame) (*recogniti
 		return nil, errors.New("no face embeddings found")
 	}
 
-	// Use averaged embedding for better accuracy
+	// Use averaged embedding for better accuracy, without the frames where
+	// detection drifted
+	embeddings = recognition.RejectOutliers(embeddings, a.config.Recognition.OutlierDistance)
+	if a.config.Recognition.NormalizeEmbeddings {
+		avgEmb := recognition.AverageNormalizedEmbedding(embeddings)
+		return &avgEmb, nil
+	}
 	avgEmb := recognition.AverageEmbedding(embeddings)
 	return &avgEmb, nil
 }
@@ -439,26 +1056,49 @@ func (a *PAMAuthenticator) AuthenticateQuick(username string) AuthResult {
 	}
 
 	// Load user embeddings
-	userData, err := a.storage.LoadUser(username)
+	userData, err := a.loadUser(username)
 	if err != nil {
-		result.Error = NewAuthError(ErrCodeNotEnrolled, false)
-		result.Reason = "failed to load user data"
+		result.Error, result.Reason = loadUserError(err)
 		return result
 	}
 
+	// Start streaming for faster capture, or reuse the camera kept open by
+	// the previous authentication
+	streaming, _ := a.acquireCamera(false)
+	result = a.quickCheck(context.Background(), result, startTime, userData)
+	a.finishCamera(streaming, result.Success)
+	return result
+}
+
+// quickCheck captures a few frames from the running stream and runs the
+// quick liveness check and a match against all profiles of userData.
+func (a *PAMAuthenticator) quickCheck(parent context.Context, result AuthResult, startTime time.Time, userData *storage.UserFaceData) AuthResult {
+	username := result.Username
+
 	// Capture a few frames
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(parent, 3*time.Second)
 	defer cancel()
 
-	// Start streaming for faster capture
-	if err := a.camera.StartStreaming(); err != nil {
-		logging.Warnf("Failed to start streaming, falling back to single capture: %v", err)
-	}
-	defer func() {
-		_ = a.camera.StopStreaming()
-	}()
-
 	frames, err := a.captureFramesForLiveness(ctx, 10)
+	if errors.Is(err, camera.ErrOverexposed) {
+		result.Error = NewAuthError(ErrCodeOverexposed, true)
+		result.Reason = err.Error()
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	if errors.Is(err, ErrIdentityChanged) {
+		logging.Warnf("SECURITY: rejecting quick authentication: %v", err)
+		result.Error = NewAuthError(ErrCodeMultipleFaces, true)
+		result.Reason = err.Error()
+		result.Duration = time.Since(startTime)
+		return result
+	}
+	if errors.Is(err, camera.ErrCameraBusy) {
+		result.Error = newCameraBusyError(err)
+		result.Reason = err.Error()
+		result.Duration = time.Since(startTime)
+		return result
+	}
 	if err != nil {
 		result.Error = NewAuthError(ErrCodeCamera, true)
 		result.Reason = "failed to capture frames"
@@ -486,11 +1126,26 @@ func (a *PAMAuthenticator) AuthenticateQuick(username string) AuthResult {
 
 	// Match
 	idx, distance, matched := a.recognizer.FindBestMatch(*embedding, userData.Embeddings)
+	matched = userMatch(userData, distance, matched)
+	if matched && !a.confidentMatch(distance, a.userTolerance(userData)) {
+		result.Error = NewAuthError(ErrCodeNotRecognized, true)
+		result.Reason = fmt.Sprintf("match below the required confidence margin (distance: %.4f)", distance)
+		result.Duration = time.Since(startTime)
+		return result
+	}
 	if matched {
+		if count, required, ok := a.enoughMatches(*embedding, userData); !ok {
+			result.Error = NewAuthError(ErrCodeNotRecognized, true)
+			result.Reason = fmt.Sprintf("only %d of %d required enrolled embeddings within tolerance", count, required)
+			result.Duration = time.Since(startTime)
+			return result
+		}
+
 		result.Success = true
 		result.Confidence = 1.0 - distance
+		result.Profile = userData.ProfileAt(idx)
 		result.Duration = time.Since(startTime)
-		logging.Debugf("Quick auth successful for %s (idx: %d, dist: %.4f)", username, idx, distance)
+		logging.Debugf("Quick auth successful for %s (profile: %s, idx: %d, dist: %.4f)", username, result.Profile, idx, distance)
 		return result
 	}
 
@@ -499,3 +1154,67 @@ func (a *PAMAuthenticator) AuthenticateQuick(username string) AuthResult {
 	result.Duration = time.Since(startTime)
 	return result
 }
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	Interval time.Duration // Pause between checks
+	Debounce time.Duration // How long the user must go unmatched before onMatch fires again
+}
+
+// Watch repeatedly runs the quick liveness and match checks of
+// AuthenticateQuick for username until ctx is done, keeping the camera
+// streaming in between. onMatch is called when the user appears: on the
+// first match, and again only after the user went unmatched for at least
+// opts.Debounce. observe, if not nil, receives every check result.
+func (a *PAMAuthenticator) Watch(ctx context.Context, username string, opts WatchOptions, onMatch, observe func(AuthResult)) error {
+	if !a.storage.UserExists(username) {
+		return fmt.Errorf("%w: %s", ErrUserNotEnrolled, username)
+	}
+	userData, err := a.loadUser(username)
+	if err != nil {
+		return fmt.Errorf("failed to load user data: %w", err)
+	}
+
+	a.takeHold()
+	if a.camera.HasIREmitter() && a.config.Camera.IREmitterEnabled {
+		if err := a.camera.EnableIREmitter(); err != nil {
+			logging.Warnf("Failed to enable IR emitter: %v", err)
+		}
+		defer func() {
+			_ = a.camera.DisableIREmitter()
+		}()
+	}
+	if err := a.camera.StartStreaming(); err != nil {
+		logging.Warnf("Failed to start streaming, falling back to single capture: %v", err)
+	}
+	defer func() {
+		_ = a.camera.StopStreaming()
+	}()
+	a.startCrossCamera()
+	defer a.stopCrossCamera()
+
+	var lastSeen time.Time
+	for {
+		startTime := time.Now()
+		result := a.quickCheck(ctx, AuthResult{Username: username, Attempts: 1}, startTime, userData)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if observe != nil {
+			observe(result)
+		}
+
+		if result.Success {
+			if lastSeen.IsZero() || startTime.Sub(lastSeen) >= opts.Debounce {
+				onMatch(result)
+			}
+			lastSeen = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
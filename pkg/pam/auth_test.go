@@ -1,7 +1,18 @@
 package pam
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -331,6 +342,87 @@ func TestAuthenticate(t *testing.T) {
 		}
 	})
 
+	t.Run("IREmitterFailure", func(t *testing.T) {
+		mockStorage := &MockStorage{
+			UserExistsFunc: func(username string) bool { return true },
+			LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+				return &storage.UserFaceData{Username: username}, nil
+			},
+		}
+		captured := false
+		mockCamera := &MockCamera{
+			HasIREmitterFunc: func() bool { return true },
+			EnableIREmitterFunc: func() error {
+				return errors.New("emitter not configured")
+			},
+			CaptureFunc: func() (*camera.Frame, error) {
+				captured = true
+				return &camera.Frame{Data: []byte("face")}, nil
+			},
+		}
+
+		auth := &PAMAuthenticator{
+			config:      cfg,
+			storage:     mockStorage,
+			camera:      mockCamera,
+			timeout:     1 * time.Second,
+			maxAttempts: 1,
+		}
+
+		result := auth.Authenticate("testuser")
+		if result.Success {
+			t.Error("expected failure")
+		}
+		authErr, ok := result.Error.(*AuthError)
+		if !ok {
+			t.Fatalf("expected AuthError, got %T", result.Error)
+		}
+		if authErr.Code != ErrCodeCamera {
+			t.Errorf("expected ErrCodeCamera, got %s", authErr.Code)
+		}
+		if !contains(result.Reason, "IR emitter") {
+			t.Errorf("expected reason to mention IR emitter, got %q", result.Reason)
+		}
+		if captured {
+			t.Error("expected no frames to be captured after emitter failure")
+		}
+	})
+
+	t.Run("IREmitterDisabledInConfig", func(t *testing.T) {
+		noIRCfg := config.DefaultConfig()
+		noIRCfg.Camera.IREmitterEnabled = false
+
+		mockStorage := &MockStorage{
+			UserExistsFunc: func(username string) bool { return true },
+			LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+				return &storage.UserFaceData{Username: username}, nil
+			},
+		}
+		mockCamera := &MockCamera{
+			HasIREmitterFunc: func() bool { return true },
+			EnableIREmitterFunc: func() error {
+				t.Error("emitter should not be enabled when disabled in config")
+				return nil
+			},
+			CaptureFunc: func() (*camera.Frame, error) {
+				return nil, camera.ErrNoFrame
+			},
+		}
+
+		auth := &PAMAuthenticator{
+			config:      noIRCfg,
+			storage:     mockStorage,
+			camera:      mockCamera,
+			timeout:     1 * time.Second,
+			maxAttempts: 1,
+		}
+
+		result := auth.Authenticate("testuser")
+		if result.Error.(*AuthError).Code != ErrCodeNotRecognized {
+			t.Errorf("expected ErrCodeNotRecognized, got %s", result.Error.(*AuthError).Code)
+		}
+	})
+
 	t.Run("LivenessPassNoEmbeddings", func(t *testing.T) {
 		mockStorage := &MockStorage{
 			UserExistsFunc: func(username string) bool { return true },
@@ -378,6 +470,844 @@ func TestAuthenticate(t *testing.T) {
 	})
 }
 
+func TestAuthenticate_TemplateUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		distance   float64
+		wantUpdate bool
+	}{
+		{name: "disabled", enabled: false, distance: 0.1, wantUpdate: false},
+		{name: "confident match", enabled: true, distance: 0.1, wantUpdate: true},
+		{name: "borderline match", enabled: true, distance: 0.3, wantUpdate: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Recognition.Tolerance = 0.4
+			cfg.Auth.TemplateUpdate.Enabled = tt.enabled
+			cfg.Auth.TemplateUpdate.Margin = 0.15
+			cfg.Auth.TemplateUpdate.MaxEmbeddings = 10
+
+			updated := false
+			mockStorage := &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{
+						Username: username,
+						Profiles: map[string][]recognition.Embedding{"glasses": {{Angle: "front"}}},
+					}, nil
+				},
+				AddEmbeddingToProfileFunc: func(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error {
+					updated = true
+					if profile != "glasses" {
+						t.Errorf("expected matched profile 'glasses', got %q", profile)
+					}
+					if maxEmbeddings != 10 {
+						t.Errorf("expected max embeddings 10, got %d", maxEmbeddings)
+					}
+					if embedding.Angle != "auto" {
+						t.Errorf("expected angle 'auto', got %s", embedding.Angle)
+					}
+					return nil
+				},
+			}
+			mockCamera := &MockCamera{
+				CaptureFunc: func() (*camera.Frame, error) {
+					return &camera.Frame{Data: []byte("face")}, nil
+				},
+			}
+			mockLiveness := &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result {
+					return liveness.Result{IsLive: true}
+				},
+			}
+			mockRecognizer := &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+					return &recognition.Face{}, nil
+				},
+				GetEmbeddingFunc: func(face *recognition.Face, label string) recognition.Embedding {
+					return recognition.Embedding{Vector: recognition.Descriptor{1}}
+				},
+				FindBestMatchFunc: func(embedding recognition.Embedding, knownEmbeddings []recognition.Embedding) (int, float64, bool) {
+					return 0, tt.distance, true
+				},
+			}
+
+			auth := &PAMAuthenticator{
+				config:      cfg,
+				storage:     mockStorage,
+				camera:      mockCamera,
+				liveness:    mockLiveness,
+				recognizer:  mockRecognizer,
+				timeout:     1 * time.Second,
+				maxAttempts: 1,
+			}
+
+			result := auth.Authenticate("testuser")
+			if !result.Success {
+				t.Fatalf("expected success, got error: %v", result.Error)
+			}
+			if updated != tt.wantUpdate {
+				t.Errorf("template update = %v, want %v", updated, tt.wantUpdate)
+			}
+		})
+	}
+}
+
+func TestCaptureEmbedding(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Camera.WarmupFrames = 3
+
+	reads := 0
+	mockCamera := &MockCamera{
+		ReadFrameFunc: func() (*camera.Frame, error) {
+			reads++
+			return &camera.Frame{Data: []byte("face")}, nil
+		},
+	}
+	detectErr := error(nil)
+	mockRecognizer := &MockRecognizer{
+		DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+			return &recognition.Face{}, detectErr
+		},
+		GetEmbeddingFunc: func(face *recognition.Face, label string) recognition.Embedding {
+			return recognition.Embedding{Angle: label}
+		},
+	}
+	auth := &PAMAuthenticator{config: cfg, camera: mockCamera, recognizer: mockRecognizer}
+
+	embedding, err := auth.CaptureEmbedding("left")
+	if err != nil {
+		t.Fatalf("CaptureEmbedding() error = %v", err)
+	}
+	if embedding.Angle != "left" {
+		t.Errorf("Angle = %q, want left", embedding.Angle)
+	}
+	if reads != 4 {
+		t.Errorf("read %d frames, want 3 warmup frames plus 1", reads)
+	}
+
+	detectErr = recognition.ErrNoFaceDetected
+	if _, err := auth.CaptureEmbedding("front"); !errors.Is(err, recognition.ErrNoFaceDetected) {
+		t.Errorf("CaptureEmbedding() error = %v, want ErrNoFaceDetected", err)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	cfg := config.DefaultConfig()
+	galleries := map[string][]recognition.Embedding{
+		"alice": {{Angle: "alice"}},
+		"bob":   {{Angle: "bob"}},
+	}
+	distances := map[string]float64{"alice": 0.45, "bob": 0.2}
+
+	lastUsed := ""
+	mockStorage := &MockStorage{
+		LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+			embeddings, ok := galleries[username]
+			if !ok {
+				return nil, storage.ErrUserNotFound
+			}
+			return &storage.UserFaceData{Username: username, Embeddings: embeddings}, nil
+		},
+		UpdateLastUsedFunc: func(username string) error {
+			lastUsed = username
+			return nil
+		},
+	}
+	mockRecognizer := &MockRecognizer{
+		DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+			return &recognition.Face{}, nil
+		},
+		GetEmbeddingFunc: func(face *recognition.Face, label string) recognition.Embedding {
+			return recognition.Embedding{Vector: recognition.Descriptor{1}}
+		},
+		FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+			d := distances[known[0].Angle]
+			return 0, d, d < 0.5
+		},
+	}
+	auth := &PAMAuthenticator{
+		config:      cfg,
+		storage:     mockStorage,
+		camera:      &MockCamera{CaptureFunc: func() (*camera.Frame, error) { return &camera.Frame{Data: []byte("face")}, nil }},
+		liveness:    &MockLiveness{DetectFunc: func(frames []liveness.Frame) liveness.Result { return liveness.Result{IsLive: true} }},
+		recognizer:  mockRecognizer,
+		timeout:     time.Second,
+		maxAttempts: 1,
+	}
+
+	result := auth.Identify([]string{"alice", "bob", "carol"})
+	if !result.Success || result.Username != "bob" {
+		t.Fatalf("Identify() = %+v, want bob", result)
+	}
+	if lastUsed != "bob" {
+		t.Errorf("last used updated for %q, want bob", lastUsed)
+	}
+
+	result = auth.Identify([]string{"carol"})
+	if result.Success || result.Error.(*AuthError).Code != ErrCodeNotEnrolled {
+		t.Errorf("Identify() without enrolled users = %+v", result)
+	}
+}
+
+func TestAuthenticate_IncompatibleEnrollment(t *testing.T) {
+	nan := recognition.Embedding{}
+	nan.Vector[0] = float32(math.NaN())
+
+	for name, load := range map[string]func(string) (*storage.UserFaceData, error){
+		"Dimensions": func(username string) (*storage.UserFaceData, error) {
+			return nil, fmt.Errorf("failed to unmarshal user data: %w", recognition.ErrIncompatibleEmbedding)
+		},
+		"NaN": func(username string) (*storage.UserFaceData, error) {
+			return &storage.UserFaceData{Username: username, Embeddings: []recognition.Embedding{nan}}, nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			auth := &PAMAuthenticator{
+				config: config.DefaultConfig(),
+				storage: &MockStorage{
+					UserExistsFunc: func(username string) bool { return true },
+					LoadUserFunc:   load,
+				},
+			}
+
+			result := auth.Authenticate("alice")
+			if result.Success || result.Error.(*AuthError).Code != ErrCodeIncompatible {
+				t.Errorf("Authenticate() = %+v, want %s", result, ErrCodeIncompatible)
+			}
+			if !strings.Contains(result.Reason, "incompatible") {
+				t.Errorf("Reason = %q, want it to name the incompatible model", result.Reason)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_Disabled(t *testing.T) {
+	// No camera: a disabled user must be rejected before it is used
+	auth := &PAMAuthenticator{
+		config: config.DefaultConfig(),
+		storage: &MockStorage{
+			UserExistsFunc: func(username string) bool { return true },
+			LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+				return &storage.UserFaceData{
+					Username:   username,
+					Embeddings: []recognition.Embedding{{Vector: recognition.Descriptor{1}}},
+					Disabled:   true,
+				}, nil
+			},
+		},
+	}
+
+	for name, authenticate := range map[string]func(string) AuthResult{
+		"Authenticate":      auth.Authenticate,
+		"AuthenticateQuick": auth.AuthenticateQuick,
+	} {
+		result := authenticate("alice")
+		if result.Success || result.Error.(*AuthError).Code != ErrCodeDisabled {
+			t.Errorf("%s() = %+v, want %s", name, result, ErrCodeDisabled)
+		}
+	}
+
+	if result := auth.Identify([]string{"alice"}); result.Success || result.Error.(*AuthError).Code != ErrCodeNotEnrolled {
+		t.Errorf("Identify() with only disabled users = %+v, want %s", result, ErrCodeNotEnrolled)
+	}
+	if err := auth.Watch(context.Background(), "alice", WatchOptions{}, nil, nil); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Watch() error = %v, want ErrUserDisabled", err)
+	}
+}
+
+func TestAuthenticate_RetryDelay(t *testing.T) {
+	newAuth := func(cfg *config.Config, timeout time.Duration) (*PAMAuthenticator, *[]string) {
+		var prompts []string
+		auth := &PAMAuthenticator{
+			config: cfg,
+			storage: &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{Username: username}, nil
+				},
+			},
+			camera: &MockCamera{
+				HasIREmitterFunc: func() bool { return false },
+				CaptureFunc: func() (*camera.Frame, error) {
+					return &camera.Frame{Data: []byte("face")}, nil
+				},
+			},
+			liveness: &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result {
+					return liveness.Result{IsLive: true}
+				},
+			},
+			recognizer: &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+					return &recognition.Face{}, nil
+				},
+				FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+					return 0, 0.9, false
+				},
+			},
+			timeout:     timeout,
+			maxAttempts: 3,
+			retryDelay:  time.Duration(cfg.Auth.RetryDelayMS) * time.Millisecond,
+		}
+		auth.SetPrompt(func(message string) { prompts = append(prompts, message) })
+		return auth, &prompts
+	}
+
+	t.Run("PausesBetweenAttempts", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.Auth.RetryDelayMS = 50
+		auth, prompts := newAuth(cfg, 5*time.Second)
+
+		result := auth.Authenticate("alice")
+		if result.Success || result.Attempts != 3 {
+			t.Fatalf("Authenticate() = %+v, want 3 failed attempts", result)
+		}
+		if result.Duration < 100*time.Millisecond {
+			t.Errorf("Duration = %v, want at least two 50ms pauses", result.Duration)
+		}
+		if len(*prompts) != 2 || (*prompts)[0] != retryPrompt {
+			t.Errorf("prompts = %q, want two retry prompts", *prompts)
+		}
+	})
+
+	t.Run("PromptDisabled", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.Auth.RetryDelayMS = 0
+		cfg.Auth.RetryPrompt = false
+		auth, prompts := newAuth(cfg, 5*time.Second)
+
+		if result := auth.Authenticate("alice"); result.Attempts != 3 {
+			t.Fatalf("Attempts = %d, want 3", result.Attempts)
+		}
+		if len(*prompts) != 0 {
+			t.Errorf("prompts = %q, want none", *prompts)
+		}
+	})
+
+	t.Run("TimeoutDuringPause", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.Auth.RetryDelayMS = 10000
+		auth, _ := newAuth(cfg, 100*time.Millisecond)
+
+		result := auth.Authenticate("alice")
+		if result.Error.(*AuthError).Code != ErrCodeTimeout {
+			t.Errorf("Authenticate() = %+v, want %s", result, ErrCodeTimeout)
+		}
+		if result.Duration > 2*time.Second {
+			t.Errorf("Duration = %v, the pause should end at the timeout", result.Duration)
+		}
+	})
+}
+
+func TestAuthenticate_MinConfidenceMargin(t *testing.T) {
+	newAuth := func(margin float64) *PAMAuthenticator {
+		cfg := config.DefaultConfig()
+		cfg.Recognition.Tolerance = 0.4
+		cfg.Auth.MinConfidenceMargin = margin
+		cfg.Auth.RetryDelayMS = 0
+		return &PAMAuthenticator{
+			config: cfg,
+			storage: &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{Username: username}, nil
+				},
+				UpdateLastUsedFunc: func(username string) error { return nil },
+			},
+			camera: &MockCamera{
+				HasIREmitterFunc: func() bool { return false },
+				CaptureFunc: func() (*camera.Frame, error) {
+					return &camera.Frame{Data: []byte("face")}, nil
+				},
+			},
+			liveness: &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result {
+					return liveness.Result{IsLive: true}
+				},
+				QuickCheckFunc: func(frames []liveness.Frame) (bool, float64) { return true, 1 },
+			},
+			recognizer: &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+					return &recognition.Face{}, nil
+				},
+				FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+					return 0, 0.35, true
+				},
+			},
+			timeout:     5 * time.Second,
+			maxAttempts: 2,
+		}
+	}
+
+	if result := newAuth(0).Authenticate("alice"); !result.Success {
+		t.Errorf("Authenticate() without margin = %+v, want success", result)
+	}
+
+	result := newAuth(0.1).Authenticate("alice")
+	if result.Success || result.Error.(*AuthError).Code != ErrCodeNotRecognized {
+		t.Fatalf("Authenticate() with margin = %+v, want %s", result, ErrCodeNotRecognized)
+	}
+	if !strings.Contains(result.Reason, "confidence margin") || result.Attempts != 2 {
+		t.Errorf("Reason = %q after %d attempts, want a weak match on both", result.Reason, result.Attempts)
+	}
+
+	if result := newAuth(0.1).AuthenticateQuick("alice"); result.Success || !strings.Contains(result.Reason, "confidence margin") {
+		t.Errorf("AuthenticateQuick() with margin = %+v, want a weak match", result)
+	}
+	if result := newAuth(0.04).AuthenticateQuick("alice"); !result.Success {
+		t.Errorf("AuthenticateQuick() with a small margin = %+v, want success", result)
+	}
+}
+
+func TestAuthenticate_UserTolerance(t *testing.T) {
+	// The recognizer decides with recognition.tolerance (0.4)
+	newAuth := func(distance float64, tolerance *float64) *PAMAuthenticator {
+		cfg := config.DefaultConfig()
+		cfg.Recognition.Tolerance = 0.4
+		cfg.Auth.RetryDelayMS = 0
+		return &PAMAuthenticator{
+			config: cfg,
+			storage: &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{Username: username, Tolerance: tolerance}, nil
+				},
+				UpdateLastUsedFunc: func(username string) error { return nil },
+			},
+			camera: &MockCamera{
+				HasIREmitterFunc: func() bool { return false },
+				CaptureFunc: func() (*camera.Frame, error) {
+					return &camera.Frame{Data: []byte("face")}, nil
+				},
+			},
+			liveness: &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result {
+					return liveness.Result{IsLive: true}
+				},
+				QuickCheckFunc: func(frames []liveness.Frame) (bool, float64) { return true, 1 },
+			},
+			recognizer: &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+					return &recognition.Face{}, nil
+				},
+				FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+					return 0, distance, distance < 0.4
+				},
+			},
+			timeout:     5 * time.Second,
+			maxAttempts: 2,
+		}
+	}
+	strict, loose := 0.3, 0.45
+
+	for name, auth := range map[string]*PAMAuthenticator{
+		"global":   newAuth(0.35, nil),
+		"stricter": newAuth(0.35, &strict),
+		"looser":   newAuth(0.42, &loose),
+	} {
+		want := name != "stricter"
+		if result := auth.Authenticate("alice"); result.Success != want {
+			t.Errorf("Authenticate() with %s tolerance = %+v, want success %t", name, result, want)
+		}
+		if result := auth.AuthenticateQuick("alice"); result.Success != want {
+			t.Errorf("AuthenticateQuick() with %s tolerance = %+v, want success %t", name, result, want)
+		}
+	}
+
+	// The confidence margin is taken off the override
+	auth := newAuth(0.25, &strict)
+	auth.config.Auth.MinConfidenceMargin = 0.1
+	if result := auth.Authenticate("alice"); result.Success || !strings.Contains(result.Reason, "confidence margin") {
+		t.Errorf("Authenticate() within margin of the override = %+v, want a weak match", result)
+	}
+}
+
+func TestAuthenticate_MinMatchingEmbeddings(t *testing.T) {
+	// Only the first of three enrolled embeddings is close to the probe
+	gallery := []recognition.Embedding{
+		{Vector: recognition.Descriptor{0.1}},
+		{Vector: recognition.Descriptor{0.3}},
+		{Vector: recognition.Descriptor{0.9}},
+	}
+	newAuth := func(minMatches int) *PAMAuthenticator {
+		cfg := config.DefaultConfig()
+		cfg.Recognition.Tolerance = 0.4
+		cfg.Auth.MinMatchingEmbeddings = minMatches
+		cfg.Auth.RetryDelayMS = 0
+		return &PAMAuthenticator{
+			config: cfg,
+			storage: &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{Username: username, Embeddings: gallery}, nil
+				},
+				UpdateLastUsedFunc: func(username string) error { return nil },
+			},
+			camera: &MockCamera{
+				HasIREmitterFunc: func() bool { return false },
+				CaptureFunc: func() (*camera.Frame, error) {
+					return &camera.Frame{Data: []byte("face")}, nil
+				},
+			},
+			liveness: &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result {
+					return liveness.Result{IsLive: true}
+				},
+				QuickCheckFunc: func(frames []liveness.Frame) (bool, float64) { return true, 1 },
+			},
+			recognizer: &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+					return &recognition.Face{}, nil
+				},
+				FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+					return 0, 0.1, true
+				},
+			},
+			timeout:     5 * time.Second,
+			maxAttempts: 2,
+		}
+	}
+
+	if result := newAuth(2).Authenticate("alice"); !result.Success {
+		t.Errorf("Authenticate() with two matches required = %+v, want success", result)
+	}
+
+	result := newAuth(3).Authenticate("alice")
+	if result.Success || !strings.Contains(result.Reason, "too few enrolled embeddings") || result.Attempts != 2 {
+		t.Errorf("Authenticate() with three matches required = %+v, want too few matches on both attempts", result)
+	}
+	if result := newAuth(3).AuthenticateQuick("alice"); result.Success || !strings.Contains(result.Reason, "2 of 3") {
+		t.Errorf("AuthenticateQuick() with three matches required = %+v, want 2 of 3", result)
+	}
+
+	// The requirement is capped at the number of enrolled embeddings
+	gallery = gallery[:1]
+	if result := newAuth(3).Authenticate("alice"); !result.Success {
+		t.Errorf("Authenticate() with a single enrolled embedding = %+v, want success", result)
+	}
+}
+
+func TestAuthenticate_IdentityChange(t *testing.T) {
+	alice := recognition.Embedding{Vector: recognition.Descriptor{0.1}}
+	bob := recognition.Embedding{Vector: recognition.Descriptor{1.1}}
+
+	// newAuth returns an authenticator whose capture shows bob in the frames
+	// from swapAt on (counted across attempts) and the probe it matched
+	newAuth := func(swapAt, swapFrames int) (*PAMAuthenticator, *recognition.Embedding) {
+		cfg := config.DefaultConfig()
+		cfg.Auth.RetryDelayMS = 0
+		cfg.Auth.CaptureFrames = 30 // Not the low-power default
+		frame := 0
+		var probe recognition.Embedding
+		return &PAMAuthenticator{
+			config: cfg,
+			storage: &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{Username: username, Embeddings: []recognition.Embedding{alice}}, nil
+				},
+				UpdateLastUsedFunc: func(username string) error { return nil },
+			},
+			camera: &MockCamera{
+				CaptureFunc: func() (*camera.Frame, error) { return &camera.Frame{Data: []byte("face")}, nil },
+			},
+			liveness: &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result { return liveness.Result{IsLive: true} },
+			},
+			recognizer: &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) { return &recognition.Face{}, nil },
+				GetEmbeddingFunc: func(face *recognition.Face, label string) recognition.Embedding {
+					frame++
+					if frame > swapAt && frame <= swapAt+swapFrames {
+						return bob
+					}
+					return alice
+				},
+				FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+					probe = embedding
+					d := recognition.EuclideanDistance(embedding.Vector, known[0].Vector)
+					return 0, d, d < cfg.Recognition.Tolerance
+				},
+			},
+			timeout:     5 * time.Second,
+			maxAttempts: 2,
+		}, &probe
+	}
+
+	// Bob takes over half-way through the first attempt and stays
+	auth, _ := newAuth(15, 1000)
+	result := auth.Authenticate("alice")
+	if result.Success || result.Error.(*AuthError).Code != ErrCodeMultipleFaces {
+		t.Errorf("Authenticate() with a swap = %+v, want %s", result, ErrCodeMultipleFaces)
+	}
+
+	// A swap in the first attempt only fails that attempt
+	auth, _ = newAuth(15, 10)
+	if result := auth.Authenticate("alice"); !result.Success || result.Attempts != 2 {
+		t.Errorf("Authenticate() with a swap in the first attempt = %+v, want success on attempt 2", result)
+	}
+
+	// A single odd frame is dropped without failing, and not averaged in
+	auth, probe := newAuth(15, 1)
+	if result := auth.Authenticate("alice"); !result.Success || result.Attempts != 1 {
+		t.Errorf("Authenticate() with one odd frame = %+v, want success on attempt 1", result)
+	}
+	if recognition.EuclideanDistance(probe.Vector, alice.Vector) > 1e-6 {
+		t.Errorf("probe = %v, want alice's embedding without the odd frame", probe.Vector[:1])
+	}
+
+	auth, _ = newAuth(5, 1000)
+	auth.liveness = &MockLiveness{QuickCheckFunc: func(frames []liveness.Frame) (bool, float64) { return true, 1 }}
+	if result := auth.AuthenticateQuick("alice"); result.Success || result.Error.(*AuthError).Code != ErrCodeMultipleFaces {
+		t.Errorf("AuthenticateQuick() with a swap = %+v, want %s", result, ErrCodeMultipleFaces)
+	}
+
+	// The check can be turned off
+	auth, _ = newAuth(15, 1000)
+	auth.config.Recognition.IdentityDistance = 0
+	if result := auth.Authenticate("alice"); result.Success || result.Error.(*AuthError).Code == ErrCodeMultipleFaces {
+		t.Errorf("Authenticate() without the check = %+v, want a plain mismatch", result)
+	}
+}
+
+func TestAuthenticate_SaveSpoofFrames(t *testing.T) {
+	newAuth := func(dir string) *PAMAuthenticator {
+		cfg := config.DefaultConfig()
+		cfg.Liveness.DebugSaveSpoofDir = dir
+		return &PAMAuthenticator{
+			config: cfg,
+			storage: &MockStorage{
+				UserExistsFunc: func(username string) bool { return true },
+				LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+					return &storage.UserFaceData{Username: username}, nil
+				},
+			},
+			camera: &MockCamera{
+				HasIREmitterFunc: func() bool { return false },
+				CaptureFunc: func() (*camera.Frame, error) {
+					return &camera.Frame{Data: []byte{0xFF, 0xD8, 0xFF, 0xD9}}, nil
+				},
+			},
+			liveness: &MockLiveness{
+				DetectFunc: func(frames []liveness.Frame) liveness.Result {
+					return liveness.Result{IsLive: false, Reason: "static image detected", RequiresRetry: false}
+				},
+			},
+			recognizer: &MockRecognizer{
+				DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+					return &recognition.Face{}, nil
+				},
+			},
+			timeout:     5 * time.Second,
+			maxAttempts: 1,
+		}
+	}
+
+	base := filepath.Join(t.TempDir(), "spoofs")
+	if result := newAuth(base).Authenticate("alice"); result.Success {
+		t.Fatal("Authenticate() should fail on a spoof")
+	}
+	attempts, err := os.ReadDir(base)
+	if err != nil || len(attempts) != 1 || !strings.HasSuffix(attempts[0].Name(), "-alice") {
+		t.Fatalf("spoof directory entries = %v, %v, want one attempt for alice", attempts, err)
+	}
+	dir := filepath.Join(base, attempts[0].Name())
+
+	data, err := os.ReadFile(filepath.Join(dir, "spoof.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report spoofReport
+	if err := json.Unmarshal(data, &report); err != nil || report.Reason != "static image detected" || len(report.Frames) == 0 {
+		t.Fatalf("spoof report = %+v, %v", report, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, report.Frames[0].File))
+	if err != nil || info.Mode().Perm() != 0600 || filepath.Ext(info.Name()) != ".jpg" {
+		t.Errorf("saved frame = %v, %v, want a private .jpg", info, err)
+	}
+
+	// Nothing is written unless configured
+	if result := newAuth("").Authenticate("alice"); result.Success {
+		t.Fatal("Authenticate() should fail on a spoof")
+	}
+}
+
+func TestAuthenticate_Overexposed(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Auth.RetryDelayMS = 0
+	bright := bytes.Repeat([]byte{255}, 16)
+	auth := &PAMAuthenticator{
+		config: cfg,
+		storage: &MockStorage{
+			UserExistsFunc: func(username string) bool { return true },
+			LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+				return &storage.UserFaceData{Username: username}, nil
+			},
+		},
+		camera: &MockCamera{
+			HasIREmitterFunc: func() bool { return false },
+			CaptureFunc: func() (*camera.Frame, error) {
+				return &camera.Frame{Data: bright, Width: 4, Height: 4, Format: camera.FormatGray}, nil
+			},
+		},
+		liveness: &MockLiveness{},
+		recognizer: &MockRecognizer{
+			DetectFacesBatchFunc: func(images [][]byte) ([][]recognition.Face, error) {
+				return make([][]recognition.Face, len(images)), nil
+			},
+		},
+		timeout:     5 * time.Second,
+		maxAttempts: 2,
+	}
+
+	result := auth.Authenticate("alice")
+	if result.Success || result.Error.(*AuthError).Code != ErrCodeOverexposed {
+		t.Errorf("Authenticate() = %+v, want %s", result, ErrCodeOverexposed)
+	}
+	if result := auth.AuthenticateQuick("alice"); result.Error.(*AuthError).Code != ErrCodeOverexposed {
+		t.Errorf("AuthenticateQuick() = %+v, want %s", result, ErrCodeOverexposed)
+	}
+
+	// Without the check the frames are just faceless
+	cfg.Camera.MaxSaturation = 0
+	if result := auth.Authenticate("alice"); result.Error.(*AuthError).Code == ErrCodeOverexposed {
+		t.Errorf("Authenticate() without max_saturation = %+v", result)
+	}
+}
+
+func TestCaptureFramesForLiveness_CrossCamera(t *testing.T) {
+	// The same face in a 640x480 IR frame and a 1280x960 RGB frame
+	faces := map[string]recognition.Rectangle{
+		"ir":  {X: 280, Y: 200, Width: 80, Height: 80},
+		"rgb": {X: 560, Y: 400, Width: 160, Height: 160},
+	}
+	batchSize := 0
+	crossReads := 0
+	auth := &PAMAuthenticator{
+		config: config.DefaultConfig(),
+		camera: &MockCamera{
+			ReadFrameFunc: func() (*camera.Frame, error) {
+				return &camera.Frame{Data: []byte("ir"), Width: 640, Height: 480}, nil
+			},
+		},
+		crossCamera: &MockCamera{
+			ReadFrameFunc: func() (*camera.Frame, error) {
+				crossReads++
+				if crossReads == 2 {
+					return nil, errors.New("device busy")
+				}
+				return &camera.Frame{Data: []byte("rgb"), Width: 1280, Height: 960}, nil
+			},
+		},
+		recognizer: &MockRecognizer{
+			DetectFacesBatchFunc: func(images [][]byte) ([][]recognition.Face, error) {
+				batchSize = len(images)
+				detected := make([][]recognition.Face, len(images))
+				for i, data := range images {
+					detected[i] = []recognition.Face{{BoundingBox: faces[string(data)]}}
+				}
+				return detected, nil
+			},
+		},
+	}
+
+	frames, err := auth.captureFramesForLiveness(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("captureFramesForLiveness() error = %v", err)
+	}
+	if batchSize != 9 {
+		t.Errorf("batch of %d images, want 5 frames and 4 cross-check frames", batchSize)
+	}
+	for i, frame := range frames {
+		if frame.Cross == nil {
+			t.Fatalf("frame %d has no cross-check frame", i)
+		}
+		if i == 1 {
+			if frame.Cross.FaceFound {
+				t.Error("a cross-check frame that failed to capture should have no face")
+			}
+			continue
+		}
+		if !frame.FaceFound || !frame.Cross.FaceFound || frame.FaceBox != frame.Cross.FaceBox {
+			t.Errorf("frame %d: face %v at %+v, cross-check face %v at %+v, want the same box",
+				i, frame.FaceFound, frame.FaceBox, frame.Cross.FaceFound, frame.Cross.FaceBox)
+		}
+	}
+
+	// Without a cross-check camera frames are not paired
+	auth.crossCamera = nil
+	if frames, err := auth.captureFramesForLiveness(context.Background(), 5); err != nil || frames[0].Cross != nil {
+		t.Errorf("captureFramesForLiveness() without a cross-check camera = %+v, %v", frames[0], err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Present, present, gone for longer than the debounce, back, present
+	presence := []bool{true, true, false, true, true}
+	checks := 0
+	mockRecognizer := &MockRecognizer{
+		DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+			return &recognition.Face{}, nil
+		},
+		GetEmbeddingFunc: func(face *recognition.Face, label string) recognition.Embedding {
+			return recognition.Embedding{Vector: recognition.Descriptor{1}}
+		},
+		FindBestMatchFunc: func(embedding recognition.Embedding, known []recognition.Embedding) (int, float64, bool) {
+			present := presence[checks]
+			checks++
+			if !present {
+				time.Sleep(40 * time.Millisecond)
+			}
+			if checks == len(presence) {
+				cancel()
+			}
+			return 0, 0.3, present
+		},
+	}
+	auth := &PAMAuthenticator{
+		config: cfg,
+		storage: &MockStorage{
+			UserExistsFunc: func(username string) bool { return username == "alice" },
+			LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+				return &storage.UserFaceData{Username: username}, nil
+			},
+		},
+		camera:     &MockCamera{CaptureFunc: func() (*camera.Frame, error) { return &camera.Frame{Data: []byte("face")}, nil }},
+		liveness:   &MockLiveness{QuickCheckFunc: func(frames []liveness.Frame) (bool, float64) { return true, 1 }},
+		recognizer: mockRecognizer,
+	}
+
+	opts := WatchOptions{Interval: time.Millisecond, Debounce: 20 * time.Millisecond}
+	fired, observed := 0, 0
+	err := auth.Watch(ctx, "alice", opts, func(result AuthResult) {
+		fired++
+		if result.Username != "alice" || !result.Success {
+			t.Errorf("onMatch() result = %+v", result)
+		}
+	}, func(AuthResult) { observed++ })
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if fired != 2 {
+		t.Errorf("onMatch fired %d times, want 2 (first match and return)", fired)
+	}
+	if observed < len(presence)-1 {
+		t.Errorf("observed %d results, want at least %d", observed, len(presence)-1)
+	}
+
+	if err := auth.Watch(ctx, "bob", opts, func(AuthResult) {}, nil); !errors.Is(err, ErrUserNotEnrolled) {
+		t.Errorf("Watch() for an unknown user error = %v, want ErrUserNotEnrolled", err)
+	}
+}
+
 func TestSettersAndClose(t *testing.T) {
 	mockCamera := &MockCamera{
 		CloseFunc: func() error { return nil },
@@ -461,6 +1391,161 @@ func TestAuthenticateQuick_Original(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_CameraBusy(t *testing.T) {
+	reads := 0
+	auth := &PAMAuthenticator{
+		config: config.DefaultConfig(),
+		storage: &MockStorage{
+			UserExistsFunc: func(username string) bool { return true },
+			LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+				return &storage.UserFaceData{Username: username, Embeddings: []recognition.Embedding{{}}}, nil
+			},
+		},
+		camera: &MockCamera{
+			HasIREmitterFunc:   func() bool { return false },
+			StartStreamingFunc: func() error { return nil },
+			StopStreamingFunc:  func() error { return nil },
+			ReadFrameFunc: func() (*camera.Frame, error) {
+				reads++
+				return nil, fmt.Errorf("%w: %w", camera.ErrCameraBusy,
+					&fs.PathError{Op: "capture", Path: "/dev/video2", Err: syscall.EBUSY})
+			},
+		},
+		liveness:    &MockLiveness{},
+		recognizer:  &MockRecognizer{},
+		timeout:     1 * time.Second,
+		maxAttempts: 3,
+	}
+
+	// Every attempt would fail the same way, so the first one reports it
+	result := auth.Authenticate("testuser")
+	authErr, ok := result.Error.(*AuthError)
+	if result.Success || !ok || authErr.Code != ErrCodeCamera || authErr.Retry {
+		t.Fatalf("expected a final camera error, got %+v", result)
+	}
+	if result.Attempts != 1 || reads != 1 {
+		t.Errorf("gave up after %d attempt(s) and %d read(s), want 1 of each", result.Attempts, reads)
+	}
+	if !strings.Contains(authErr.Message, "in use by another application") {
+		t.Errorf("Message = %q, want it to say the camera is in use", authErr.Message)
+	}
+	if hint, _ := authErr.Details["hint"].(string); !strings.Contains(hint, "/dev/video2") {
+		t.Errorf("hint = %q, want it to name the device", hint)
+	}
+
+	result = auth.AuthenticateQuick("testuser")
+	if authErr, ok := result.Error.(*AuthError); !ok || authErr.Code != ErrCodeCamera || authErr.Retry {
+		t.Errorf("AuthenticateQuick() = %+v, want a final camera error", result)
+	}
+}
+
+func TestAuthenticateQuick_CameraGrace(t *testing.T) {
+	cfg := config.DefaultConfig()
+	mockStorage := &MockStorage{
+		UserExistsFunc: func(username string) bool { return true },
+		LoadUserFunc: func(username string) (*storage.UserFaceData, error) {
+			return &storage.UserFaceData{Username: username}, nil
+		},
+		UpdateLastUsedFunc: func(username string) error { return nil },
+	}
+	var starts, stops, reads, emitterOff atomic.Int32
+	mockCamera := &MockCamera{
+		HasIREmitterFunc: func() bool { return false },
+		ReadFrameFunc: func() (*camera.Frame, error) {
+			reads.Add(1)
+			time.Sleep(time.Millisecond)
+			return &camera.Frame{Data: []byte("real_face")}, nil
+		},
+		StartStreamingFunc:   func() error { starts.Add(1); return nil },
+		StopStreamingFunc:    func() error { stops.Add(1); return nil },
+		DisableIREmitterFunc: func() error { emitterOff.Add(1); return nil },
+	}
+	mockRecognizer := &MockRecognizer{
+		DetectSingleFaceFunc: func(data []byte) (*recognition.Face, error) {
+			return &recognition.Face{Confidence: 0.99, Landmarks: make([]recognition.Point, 5)}, nil
+		},
+		GetEmbeddingFunc: func(face *recognition.Face, label string) recognition.Embedding {
+			return recognition.Embedding{Vector: recognition.Descriptor{1, 2, 3}}
+		},
+		FindBestMatchFunc: func(embedding recognition.Embedding, knownEmbeddings []recognition.Embedding) (int, float64, bool) {
+			return 0, 0.1, true
+		},
+	}
+
+	auth := &PAMAuthenticator{
+		config:  cfg,
+		storage: mockStorage,
+		camera:  mockCamera,
+		liveness: &MockLiveness{
+			QuickCheckFunc: func(frames []liveness.Frame) (bool, float64) { return true, 0.9 },
+		},
+		recognizer:  mockRecognizer,
+		timeout:     time.Second,
+		maxAttempts: 1,
+	}
+	auth.SetCameraGrace(200 * time.Millisecond)
+
+	if result := auth.AuthenticateQuick("testuser"); !result.Success {
+		t.Fatalf("first authentication failed: %v", result.Error)
+	}
+	if stops.Load() != 0 {
+		t.Fatal("camera released despite the grace period")
+	}
+
+	// Frames buffered during the grace period are drained
+	readsAfterFirst := reads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if reads.Load() == readsAfterFirst {
+		t.Error("expected frames to be drained during the grace period")
+	}
+
+	if result := auth.AuthenticateQuick("testuser"); !result.Success {
+		t.Fatalf("second authentication failed: %v", result.Error)
+	}
+	if got := starts.Load(); got != 1 {
+		t.Errorf("expected the second authentication to reuse the stream, started %d times", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for stops.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stops.Load() != 1 || emitterOff.Load() != 1 {
+		t.Errorf("expected the camera and emitter to be released once after the grace period, got %d stops and %d emitter disables",
+			stops.Load(), emitterOff.Load())
+	}
+
+	// Without a grace period the camera is released right away
+	auth.SetCameraGrace(0)
+	if result := auth.AuthenticateQuick("testuser"); !result.Success {
+		t.Fatalf("third authentication failed: %v", result.Error)
+	}
+	if stops.Load() != 2 {
+		t.Errorf("expected an immediate release without a grace period, got %d stops", stops.Load())
+	}
+}
+
+func TestClose_ReleasesHeldCamera(t *testing.T) {
+	var stops, emitterOff atomic.Int32
+	mockCamera := &MockCamera{
+		ReadFrameFunc: func() (*camera.Frame, error) {
+			time.Sleep(time.Millisecond)
+			return &camera.Frame{}, nil
+		},
+		StopStreamingFunc:    func() error { stops.Add(1); return nil },
+		DisableIREmitterFunc: func() error { emitterOff.Add(1); return nil },
+	}
+	auth := &PAMAuthenticator{config: config.DefaultConfig(), camera: mockCamera}
+	auth.SetCameraGrace(time.Minute)
+
+	auth.finishCamera(true, true)
+	auth.Close()
+	if stops.Load() != 1 || emitterOff.Load() != 1 {
+		t.Errorf("expected Close to release the held camera, got %d stops and %d emitter disables",
+			stops.Load(), emitterOff.Load())
+	}
+}
+
 func TestErrorCodes(t *testing.T) {
 	// Verify all error codes are distinct
 	codes := []ErrorCode{
@@ -471,6 +1556,9 @@ func TestErrorCodes(t *testing.T) {
 		ErrCodeCamera,
 		ErrCodeTimeout,
 		ErrCodeNotEnrolled,
+		ErrCodeIncompatible,
+		ErrCodeOverexposed,
+		ErrCodeDisabled,
 	}
 
 	seen := make(map[ErrorCode]bool)
@@ -494,6 +1582,9 @@ func TestGetErrorMessage(t *testing.T) {
 		{ErrCodeCamera, "Camera"},
 		{ErrCodeTimeout, "timed out"},
 		{ErrCodeNotEnrolled, "enrolled"},
+		{ErrCodeIncompatible, "re-enroll"},
+		{ErrCodeOverexposed, "light"},
+		{ErrCodeDisabled, "disabled"},
 	}
 
 	for _, tt := range tests {
@@ -593,6 +1684,9 @@ func TestErrorMessages_AllCovered(t *testing.T) {
 		ErrCodeCamera,
 		ErrCodeTimeout,
 		ErrCodeNotEnrolled,
+		ErrCodeIncompatible,
+		ErrCodeOverexposed,
+		ErrCodeDisabled,
 	}
 
 	for _, code := range codes {
@@ -616,6 +1710,33 @@ func TestAuthError_WithDetails(t *testing.T) {
 	}
 }
 
+func TestAuthResult_MarshalJSON(t *testing.T) {
+	authErr := NewAuthError(ErrCodeLiveness, true)
+	authErr.Details["score"] = 0.3
+	result := AuthResult{
+		Error:    fmt.Errorf("attempt 2: %w", authErr),
+		Duration: 1500 * time.Millisecond,
+		Attempts: 2,
+		Reason:   "no blink detected",
+		Username: "alice",
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"success":false`, `"duration_ms":1500`, `"code":"LIVENESS_FAILED"`, `"details":{"score":0.3}`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s does not contain %s", data, want)
+		}
+	}
+
+	result.Error = errors.New("camera unplugged")
+	if data, _ := json.Marshal(result); !strings.Contains(string(data), `"error":{"message":"camera unplugged"}`) {
+		t.Errorf("plain error encoded as %s", data)
+	}
+}
+
 // Test that standard errors are defined
 func TestStandardErrors(t *testing.T) {
 	if ErrAuthFailed == nil {
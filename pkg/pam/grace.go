@@ -0,0 +1,151 @@
+package pam
+
+import (
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// cameraHold keeps the stream and IR emitter running after a successful
+// authentication, so a follow-up within the grace period starts without
+// restarting ffmpeg or the emitter.
+type cameraHold struct {
+	stop chan struct{} // closed when the next authentication takes over
+	done chan struct{} // closed when the drain goroutine has exited
+}
+
+// SetCameraGrace sets how long the camera stays on after a successful
+// authentication. Zero releases it immediately.
+func (a *PAMAuthenticator) SetCameraGrace(grace time.Duration) {
+	a.cameraGrace = grace
+}
+
+// acquireCamera takes over a camera held by holdCamera, or enables the IR
+// emitter if configured and starts streaming. It reports whether streaming
+// runs; without it frames are captured one at a time. The emitter error is
+// returned if it was expected but could not be enabled, in which case the
+// caller releases the camera.
+func (a *PAMAuthenticator) acquireCamera(emitter bool) (streaming bool, err error) {
+	held := a.takeHold()
+
+	// A quick authentication may have held the camera without the emitter
+	if emitter && a.camera.HasIREmitter() && a.config.Camera.IREmitterEnabled {
+		if err := a.camera.EnableIREmitter(); err != nil {
+			return held, err
+		}
+	}
+	if held {
+		logging.Debug("Reusing camera kept open from the previous authentication")
+		return true, nil
+	}
+	a.startCrossCamera()
+	if err := a.camera.StartStreaming(); err != nil {
+		logging.Warnf("Failed to start streaming, falling back to single capture: %v", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// finishCamera keeps a running stream for the grace period after a
+// successful authentication and releases the camera otherwise.
+func (a *PAMAuthenticator) finishCamera(streaming, success bool) {
+	if streaming && success && a.cameraGrace > 0 {
+		a.holdCamera()
+		return
+	}
+	a.releaseCamera()
+}
+
+// releaseCamera stops the stream and turns the IR emitter off.
+func (a *PAMAuthenticator) releaseCamera() {
+	_ = a.camera.StopStreaming()
+	_ = a.camera.DisableIREmitter()
+	a.stopCrossCamera()
+}
+
+// startCrossCamera starts the cross-check camera alongside the main one. If
+// it fails, its frames are captured one at a time; frames it cannot
+// deliver at all fail the cross-check.
+func (a *PAMAuthenticator) startCrossCamera() {
+	if a.crossCamera == nil {
+		return
+	}
+	if a.crossCamera.HasIREmitter() && a.config.Camera.IREmitterEnabled {
+		if err := a.crossCamera.EnableIREmitter(); err != nil {
+			logging.Warnf("Failed to enable IR emitter of the cross-check camera: %v", err)
+		}
+	}
+	if err := a.crossCamera.StartStreaming(); err != nil {
+		logging.Warnf("Failed to start cross-check camera streaming: %v", err)
+	}
+}
+
+// stopCrossCamera stops the cross-check camera, if any.
+func (a *PAMAuthenticator) stopCrossCamera() {
+	if a.crossCamera == nil {
+		return
+	}
+	_ = a.crossCamera.StopStreaming()
+	_ = a.crossCamera.DisableIREmitter()
+}
+
+// holdCamera keeps the camera running for the grace period. Frames are read
+// and discarded meanwhile, so the next authentication gets current frames
+// instead of ones buffered while nobody was looking.
+func (a *PAMAuthenticator) holdCamera() {
+	h := &cameraHold{stop: make(chan struct{}), done: make(chan struct{})}
+	a.holdMu.Lock()
+	a.hold = h
+	a.holdMu.Unlock()
+
+	go func() {
+		defer close(h.done)
+		expired := time.After(a.cameraGrace)
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-expired:
+				logging.Debug("Camera grace period expired")
+				a.releaseHold(h)
+				return
+			default:
+			}
+			if _, err := a.camera.ReadFrame(); err != nil {
+				logging.Debugf("Camera stream ended during grace period: %v", err)
+				a.releaseHold(h)
+				return
+			}
+			if a.crossCamera != nil {
+				_, _ = a.crossCamera.ReadFrame()
+			}
+		}
+	}()
+}
+
+// releaseHold releases the camera unless the next authentication has
+// already taken h over.
+func (a *PAMAuthenticator) releaseHold(h *cameraHold) {
+	a.holdMu.Lock()
+	defer a.holdMu.Unlock()
+	if a.hold != h {
+		return
+	}
+	a.hold = nil
+	a.releaseCamera()
+}
+
+// takeHold ends a running hold and reports whether the camera is still on.
+// It waits for the drain goroutine, so the caller owns the camera afterwards.
+func (a *PAMAuthenticator) takeHold() bool {
+	a.holdMu.Lock()
+	h := a.hold
+	a.hold = nil
+	a.holdMu.Unlock()
+	if h == nil {
+		return false
+	}
+	close(h.stop)
+	<-h.done
+	return true
+}
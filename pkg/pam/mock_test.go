@@ -17,6 +17,7 @@ type MockCamera struct {
 	OpenFunc             func(device string) error
 	SetResolutionFunc    func(width, height int) error
 	GetDeviceInfoFunc    func() camera.DeviceInfo
+	CapabilitiesFunc     func() camera.CameraCapabilities
 	StartStreamingFunc   func() error
 	StopStreamingFunc    func() error
 	ReadFrameFunc        func() (*camera.Frame, error)
@@ -103,6 +104,13 @@ func (m *MockCamera) GetDeviceInfo() camera.DeviceInfo {
 	return camera.DeviceInfo{}
 }
 
+func (m *MockCamera) Capabilities() camera.CameraCapabilities {
+	if m.CapabilitiesFunc != nil {
+		return m.CapabilitiesFunc()
+	}
+	return camera.CameraCapabilities{}
+}
+
 // MockRecognizer implements Recognizer interface for testing
 type MockRecognizer struct {
 	FindBestMatchFunc    func(embedding recognition.Embedding, knownEmbeddings []recognition.Embedding) (int, float64, bool)
@@ -110,6 +118,7 @@ type MockRecognizer struct {
 	LoadModelsFunc       func(path string) error
 	SetToleranceFunc     func(tolerance float64)
 	DetectSingleFaceFunc func(data []byte) (*recognition.Face, error)
+	DetectFacesBatchFunc func(images [][]byte) ([][]recognition.Face, error)
 	GetEmbeddingFunc     func(face *recognition.Face, label string) recognition.Embedding
 }
 
@@ -147,6 +156,21 @@ func (m *MockRecognizer) DetectSingleFace(data []byte) (*recognition.Face, error
 	return nil, nil
 }
 
+// DetectFacesBatch defaults to calling DetectSingleFace for each image.
+func (m *MockRecognizer) DetectFacesBatch(images [][]byte) ([][]recognition.Face, error) {
+	if m.DetectFacesBatchFunc != nil {
+		return m.DetectFacesBatchFunc(images)
+	}
+	results := make([][]recognition.Face, len(images))
+	for i, data := range images {
+		face, err := m.DetectSingleFace(data)
+		if err == nil && face != nil {
+			results[i] = []recognition.Face{*face}
+		}
+	}
+	return results, nil
+}
+
 func (m *MockRecognizer) GetEmbedding(face *recognition.Face, label string) recognition.Embedding {
 	if m.GetEmbeddingFunc != nil {
 		return m.GetEmbeddingFunc(face, label)
@@ -156,9 +180,10 @@ func (m *MockRecognizer) GetEmbedding(face *recognition.Face, label string) reco
 
 // MockStorage implements Storage interface for testing
 type MockStorage struct {
-	UserExistsFunc     func(username string) bool
-	LoadUserFunc       func(username string) (*storage.UserFaceData, error)
-	UpdateLastUsedFunc func(username string) error
+	UserExistsFunc            func(username string) bool
+	LoadUserFunc              func(username string) (*storage.UserFaceData, error)
+	UpdateLastUsedFunc        func(username string) error
+	AddEmbeddingToProfileFunc func(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error
 }
 
 func (m *MockStorage) UserExists(username string) bool {
@@ -182,6 +207,13 @@ func (m *MockStorage) UpdateLastUsed(username string) error {
 	return nil
 }
 
+func (m *MockStorage) AddEmbeddingToProfile(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error {
+	if m.AddEmbeddingToProfileFunc != nil {
+		return m.AddEmbeddingToProfileFunc(username, profile, embedding, maxEmbeddings)
+	}
+	return nil
+}
+
 // MockLiveness implements LivenessChecker interface for testing
 type MockLiveness struct {
 	DetectFunc     func(frames []liveness.Frame) liveness.Result
@@ -0,0 +1,65 @@
+package recognition
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
+)
+
+// Benchmark runs detection and embedding matching on the same image for the
+// given number of iterations and reports the average time per stage.
+//
+// For dlib, detection and descriptor computation happen in one pass, so
+// DetectionTimeMs includes the descriptor and RecognitionTimeMs only covers
+// embedding conversion and matching.
+func Benchmark(engine Engine, imageData []byte, iterations int) (*acceleration.BenchmarkResult, error) {
+	if !engine.IsLoaded() {
+		return nil, ErrModelNotLoaded
+	}
+	if iterations <= 0 {
+		return nil, errors.New("iterations must be positive")
+	}
+
+	var detection, recognition time.Duration
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		faces, err := engine.DetectFaces(imageData)
+		if err != nil {
+			return nil, err
+		}
+		detection += time.Since(start)
+		if len(faces) == 0 {
+			return nil, ErrNoFaceDetected
+		}
+
+		start = time.Now()
+		embedding := engine.GetEmbedding(&faces[0], "bench")
+		engine.FindBestMatch(embedding, []Embedding{embedding})
+		recognition += time.Since(start)
+	}
+
+	result := &acceleration.BenchmarkResult{
+		Backend:           engineBackend(engine),
+		Iterations:        iterations,
+		DetectionTimeMs:   durationMs(detection) / float64(iterations),
+		RecognitionTimeMs: durationMs(recognition) / float64(iterations),
+	}
+	result.TotalTimeMs = result.DetectionTimeMs + result.RecognitionTimeMs
+	if result.TotalTimeMs > 0 {
+		result.FPS = 1000 / result.TotalTimeMs
+	}
+	return result, nil
+}
+
+// engineBackend returns the execution provider an engine runs on.
+func engineBackend(engine Engine) acceleration.Backend {
+	if r, ok := engine.(*ONNXRecognizer); ok {
+		return r.backend
+	}
+	return acceleration.BackendCPU
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,52 @@
+package recognition
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/Kagami/go-face"
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
+)
+
+func TestBenchmark(t *testing.T) {
+	calls := 0
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) {
+		return &MockFaceEngine{
+			RecognizeFunc: func(data []byte) ([]face.Face, error) {
+				calls++
+				if string(data) == "empty" {
+					return nil, nil
+				}
+				return []face.Face{{Rectangle: image.Rect(0, 0, 100, 100)}}, nil
+			},
+		}, nil
+	}
+
+	if _, err := Benchmark(r, []byte("frame"), 3); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("Benchmark() before LoadModels error = %v, want ErrModelNotLoaded", err)
+	}
+	_ = r.LoadModels("dummy")
+
+	result, err := Benchmark(r, []byte("frame"), 3)
+	if err != nil {
+		t.Fatalf("Benchmark() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("detection ran %d times, want 3", calls)
+	}
+	if result.Backend != acceleration.BackendCPU || result.Iterations != 3 {
+		t.Errorf("Benchmark() = %+v", result)
+	}
+	if result.TotalTimeMs != result.DetectionTimeMs+result.RecognitionTimeMs {
+		t.Errorf("TotalTimeMs = %v, want sum of stages", result.TotalTimeMs)
+	}
+
+	if _, err := Benchmark(r, []byte("empty"), 1); !errors.Is(err, ErrNoFaceDetected) {
+		t.Errorf("Benchmark() without face error = %v, want ErrNoFaceDetected", err)
+	}
+	if _, err := Benchmark(r, []byte("frame"), 0); err == nil {
+		t.Error("Benchmark() with zero iterations should fail")
+	}
+}
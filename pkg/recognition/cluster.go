@@ -0,0 +1,117 @@
+package recognition
+
+import "sort"
+
+// DefaultIdentityDistance is the average distance between two groups of
+// embeddings above which ClusterEmbeddings keeps them apart. It is dlib's
+// usual same-person threshold: captures of one face from different angles
+// stay well below it, different people are usually above.
+const DefaultIdentityDistance = 0.6
+
+// ClusterEmbeddings groups embeddings by average-linkage agglomerative
+// clustering: starting from one cluster per embedding, the two clusters with
+// the smallest mean pairwise distance are merged until that distance exceeds
+// maxDistance. Each cluster lists embedding indexes in ascending order; the
+// clusters are sorted by size, largest first, and by first index on ties.
+func ClusterEmbeddings(embeddings []Embedding, maxDistance float64) [][]int {
+	n := len(embeddings)
+	distances := make([][]float64, n)
+	for i := range distances {
+		distances[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			d := EuclideanDistance(embeddings[i].Vector, embeddings[j].Vector)
+			distances[i][j], distances[j][i] = d, d
+		}
+	}
+
+	clusters := make([][]int, n)
+	for i := range clusters {
+		clusters[i] = []int{i}
+	}
+	for len(clusters) > 1 {
+		bestA, bestB, best := -1, -1, maxDistance
+		for a := range clusters {
+			for b := a + 1; b < len(clusters); b++ {
+				if d := linkage(distances, clusters[a], clusters[b]); d <= best {
+					bestA, bestB, best = a, b, d
+				}
+			}
+		}
+		if bestA < 0 {
+			break
+		}
+		clusters[bestA] = append(clusters[bestA], clusters[bestB]...)
+		clusters = append(clusters[:bestB], clusters[bestB+1:]...)
+	}
+
+	for _, c := range clusters {
+		sort.Ints(c)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
+
+// ClusterDistance returns the mean pairwise distance between the embeddings
+// of clusters a and b, as used by ClusterEmbeddings.
+func ClusterDistance(embeddings []Embedding, a, b []int) float64 {
+	var sum float64
+	for _, i := range a {
+		for _, j := range b {
+			sum += EuclideanDistance(embeddings[i].Vector, embeddings[j].Vector)
+		}
+	}
+	return sum / float64(len(a)*len(b))
+}
+
+// linkage is the mean distance between clusters a and b.
+func linkage(distances [][]float64, a, b []int) float64 {
+	var sum float64
+	for _, i := range a {
+		for _, j := range b {
+			sum += distances[i][j]
+		}
+	}
+	return sum / float64(len(a)*len(b))
+}
+
+// IdentityChanges follows the face through the embeddings of one capture,
+// in capture order, and returns the indexes of those that look like a
+// different person: farther than maxDistance from the running centroid of
+// the embeddings accepted so far. The first embedding seeds the centroid,
+// and rejected embeddings do not move it, so a person stepping in front of
+// the camera mid-capture cannot drag the average towards their face.
+// Nothing is rejected if maxDistance is not positive.
+func IdentityChanges(embeddings []Embedding, maxDistance float64) []int {
+	if maxDistance <= 0 || len(embeddings) < 2 {
+		return nil
+	}
+
+	var sum [DescriptorSize]float64
+	accepted := 0
+	accept := func(e Embedding) {
+		for i, v := range e.Vector {
+			sum[i] += float64(v)
+		}
+		accepted++
+	}
+	accept(embeddings[0])
+
+	var changed []int
+	for idx, e := range embeddings[1:] {
+		var centroid Descriptor
+		for i := range centroid {
+			centroid[i] = float32(sum[i] / float64(accepted))
+		}
+		if EuclideanDistance(e.Vector, centroid) > maxDistance {
+			changed = append(changed, idx+1)
+			continue
+		}
+		accept(e)
+	}
+	return changed
+}
@@ -0,0 +1,69 @@
+package recognition
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClusterEmbeddings(t *testing.T) {
+	// Two people: captures of each lie within 0.2 of one another, the
+	// people are about 1.0 apart
+	alice := []Descriptor{{0, 0, 0}, {0.1, 0, 0}, {0, 0.1, 0}, {0.1, 0.1, 0}}
+	bob := []Descriptor{{1, 0, 0}, {1.1, 0, 0}}
+	var embeddings []Embedding
+	for _, v := range []Descriptor{alice[0], bob[0], alice[1], alice[2], bob[1], alice[3]} {
+		embeddings = append(embeddings, Embedding{Vector: v})
+	}
+
+	tests := []struct {
+		name        string
+		embeddings  []Embedding
+		maxDistance float64
+		want        [][]int
+	}{
+		{name: "two identities", embeddings: embeddings, maxDistance: DefaultIdentityDistance, want: [][]int{{0, 2, 3, 5}, {1, 4}}},
+		{name: "loose threshold", embeddings: embeddings, maxDistance: 2, want: [][]int{{0, 1, 2, 3, 4, 5}}},
+		{name: "one person", embeddings: embeddings[2:4], maxDistance: DefaultIdentityDistance, want: [][]int{{0, 1}}},
+		{name: "tie on size", embeddings: []Embedding{{Vector: bob[0]}, {Vector: alice[0]}}, maxDistance: 0.5, want: [][]int{{0}, {1}}},
+		{name: "empty", embeddings: nil, maxDistance: DefaultIdentityDistance, want: [][]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClusterEmbeddings(tt.embeddings, tt.maxDistance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ClusterEmbeddings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if d := ClusterDistance(embeddings, []int{0}, []int{1, 4}); d < 1 || d > 1.1 {
+		t.Errorf("ClusterDistance() = %.3f, want between 1 and 1.1", d)
+	}
+}
+
+func TestIdentityChanges(t *testing.T) {
+	alice := func(x float32) Embedding { return Embedding{Vector: Descriptor{x, 0, 0}} }
+	bob := func(x float32) Embedding { return Embedding{Vector: Descriptor{1 + x, 0, 0}} }
+
+	tests := []struct {
+		name        string
+		embeddings  []Embedding
+		maxDistance float64
+		want        []int
+	}{
+		{name: "same person", embeddings: []Embedding{alice(0), alice(0.1), alice(0.05)}, maxDistance: DefaultIdentityDistance},
+		{name: "swap mid-capture", embeddings: []Embedding{alice(0), alice(0.1), bob(0), bob(0.1), alice(0.05)}, maxDistance: DefaultIdentityDistance, want: []int{2, 3}},
+		{name: "swap for the rest of the capture", embeddings: []Embedding{alice(0), alice(0.1), bob(0), bob(0.1), bob(0.05)}, maxDistance: DefaultIdentityDistance, want: []int{2, 3, 4}},
+		// Half-way frames do not pull the centroid far enough to let the other person in
+		{name: "gradual drift", embeddings: []Embedding{alice(0), alice(0.1), alice(0.5), bob(0), bob(0.1)}, maxDistance: DefaultIdentityDistance, want: []int{3, 4}},
+		{name: "off", embeddings: []Embedding{alice(0), bob(0)}, maxDistance: 0},
+		{name: "single", embeddings: []Embedding{alice(0)}, maxDistance: DefaultIdentityDistance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IdentityChanges(tt.embeddings, tt.maxDistance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IdentityChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
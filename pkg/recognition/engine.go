@@ -0,0 +1,130 @@
+package recognition
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// Recognition backends selectable via recognition.backend.
+const (
+	BackendDlib = "dlib"
+	BackendONNX = "onnx"
+)
+
+// Engine is implemented by face recognition backends. Detection and
+// embedding extraction are backend specific; matching works on the
+// resulting embeddings.
+type Engine interface {
+	LoadModels(modelPath string) error
+	IsLoaded() bool
+	WarmUp() error
+	Close() error
+	SetTolerance(tolerance float64)
+	DetectFaces(imageData []byte) ([]Face, error)
+	DetectSingleFace(imageData []byte) (*Face, error)
+	DetectFacesBatch(images [][]byte) ([][]Face, error)
+	DetectFacesImage(img image.Image) ([]Face, error)
+	RecognizeImage(img image.Image, angle string) (*Embedding, error)
+	GetEmbedding(f *Face, angle string) Embedding
+	CompareFaces(emb1, emb2 Embedding) float64
+	FindBestMatch(probe Embedding, gallery []Embedding) (int, float64, bool)
+}
+
+var (
+	_ Engine      = (*DlibRecognizer)(nil)
+	_ Engine      = (*ONNXRecognizer)(nil)
+	_ ImageEngine = (*onnxFaceEngine)(nil)
+)
+
+// Options configures NewEngine.
+type Options struct {
+	Backend        string   // "dlib" (default) or "onnx"
+	ModelPaths     []string // dlib model search paths
+	ONNX           acceleration.ONNXConfig
+	FallbackToDlib bool // Use dlib if the ONNX engine cannot be initialized
+
+	Tolerance   float64 // Zero keeps the recognizer default
+	MinQuality  float64
+	Normalize   bool
+	MinFaceSize int
+	Padding     float64
+	Jitter      int
+	ModelNames  ModelNames // dlib model file names; empty names use the defaults
+	Detector    string     // DetectorHOG (default) or DetectorCNN
+	Preprocess  string     // PreprocessNone (default) or PreprocessCLAHE
+}
+
+// newDlibRecognizer creates the dlib engine; tests replace it to avoid
+// loading real models.
+var newDlibRecognizer = NewRecognizer
+
+// NewEngine creates the engine selected by opts.Backend and loads its models.
+func NewEngine(opts Options) (Engine, error) {
+	switch opts.Backend {
+	case BackendDlib, "":
+		return loadDlibEngine(opts)
+	case BackendONNX:
+		r, err := loadONNXEngine(opts)
+		if err != nil {
+			if !opts.FallbackToDlib {
+				return nil, err
+			}
+			logging.Warnf("ONNX engine unavailable, falling back to dlib: %v", err)
+			return loadDlibEngine(opts)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown recognition backend: %s", opts.Backend)
+	}
+}
+
+// loadONNXEngine selects the execution provider and device through the
+// acceleration manager, then creates an ONNX recognizer and loads its models.
+func loadONNXEngine(opts Options) (Engine, error) {
+	manager := acceleration.GetManager()
+	if err := manager.Initialize(acceleration.Config{
+		PreferredBackend: opts.ONNX.Backend,
+		FallbackToCPU:    opts.FallbackToDlib,
+		DeviceIndex:      opts.ONNX.DeviceIndex,
+		EnableProfiling:  opts.ONNX.EnableProfiling,
+		ModelPath:        opts.ONNX.ModelPath,
+	}); err != nil {
+		return nil, err
+	}
+
+	onnxCfg := opts.ONNX
+	onnxCfg.Backend = manager.GetActiveBackend()
+	r := NewONNXRecognizer(onnxCfg)
+	configureRecognizer(r.DlibRecognizer, opts)
+	if err := r.LoadModels(onnxCfg.ModelPath); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// loadDlibEngine creates a dlib recognizer and loads its models.
+func loadDlibEngine(opts Options) (Engine, error) {
+	r := newDlibRecognizer()
+	configureRecognizer(r, opts)
+	if err := r.LoadModelsFromPaths(opts.ModelPaths); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// configureRecognizer applies the tuning options before models are loaded.
+func configureRecognizer(r *DlibRecognizer, opts Options) {
+	if opts.Tolerance > 0 {
+		r.SetTolerance(opts.Tolerance)
+	}
+	r.SetMinQuality(opts.MinQuality)
+	r.SetNormalize(opts.Normalize)
+	r.SetMinFaceSize(opts.MinFaceSize)
+	r.SetDescriptorOptions(opts.Padding, opts.Jitter)
+	r.SetModelNames(opts.ModelNames)
+	r.SetDetector(opts.Detector)
+	r.SetPreprocess(opts.Preprocess)
+}
@@ -0,0 +1,158 @@
+package recognition
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
+)
+
+// useMockDlib makes NewEngine build dlib recognizers with a mock engine.
+func useMockDlib(t *testing.T) {
+	t.Helper()
+	orig := newDlibRecognizer
+	newDlibRecognizer = func() *DlibRecognizer {
+		r := NewRecognizer()
+		r.factory = func(path string) (FaceEngine, error) { return &MockFaceEngine{}, nil }
+		return r
+	}
+	t.Cleanup(func() { newDlibRecognizer = orig })
+}
+
+func TestNewEngine_Dlib(t *testing.T) {
+	useMockDlib(t)
+	modelDir := t.TempDir()
+	writeModelFiles(t, modelDir, ModelFiles...)
+
+	engine, err := NewEngine(Options{ModelPaths: []string{modelDir}, Tolerance: 0.5})
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	r, ok := engine.(*DlibRecognizer)
+	if !ok {
+		t.Fatalf("NewEngine() = %T, want *DlibRecognizer", engine)
+	}
+	if !r.IsLoaded() || r.tolerance != 0.5 {
+		t.Error("dlib engine should be loaded and configured")
+	}
+
+	if _, err := NewEngine(Options{Backend: "tflite"}); err == nil {
+		t.Error("NewEngine() with unknown backend should fail")
+	}
+}
+
+func TestNewEngine_ONNXFallback(t *testing.T) {
+	useMockDlib(t)
+	modelDir := t.TempDir()
+	writeModelFiles(t, modelDir, ModelFiles...)
+
+	opts := Options{
+		Backend:    BackendONNX,
+		ModelPaths: []string{modelDir},
+		ONNX:       acceleration.ONNXConfig{ModelPath: filepath.Join(t.TempDir(), "missing")},
+	}
+
+	if _, err := NewEngine(opts); err == nil {
+		t.Error("NewEngine() without fallback should fail when ONNX models are missing")
+	}
+
+	opts.FallbackToDlib = true
+	engine, err := NewEngine(opts)
+	if err != nil {
+		t.Fatalf("NewEngine() with fallback error = %v", err)
+	}
+	if _, ok := engine.(*DlibRecognizer); !ok {
+		t.Errorf("NewEngine() with fallback = %T, want *DlibRecognizer", engine)
+	}
+}
+
+// Model files that ONNX Runtime cannot use (or a build without the onnx
+// tag) make the ONNX engine fail to initialize and fall back to dlib.
+func TestNewEngine_ONNXInvalidModels(t *testing.T) {
+	useMockDlib(t)
+	modelDir := t.TempDir()
+	writeModelFiles(t, modelDir, ModelFiles...)
+	onnxDir := t.TempDir()
+	writeModelFiles(t, onnxDir, "face_detector.onnx", "face_recognizer.onnx", "face_landmarks.onnx")
+
+	engine, err := NewEngine(Options{
+		Backend:        BackendONNX,
+		ModelPaths:     []string{modelDir},
+		ONNX:           acceleration.ONNXConfig{ModelPath: onnxDir},
+		FallbackToDlib: true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if _, ok := engine.(*DlibRecognizer); !ok {
+		t.Errorf("NewEngine() = %T, want *DlibRecognizer", engine)
+	}
+}
+
+type fakeInference struct {
+	detections []acceleration.FaceDetection
+	dims       int
+	cropSizes  [][2]int
+}
+
+func (f *fakeInference) DetectFaces(imageData []byte, width, height int) ([]acceleration.FaceDetection, error) {
+	if len(imageData) != width*height*3 {
+		return nil, os.ErrInvalid
+	}
+	return f.detections, nil
+}
+
+func (f *fakeInference) ExtractEmbedding(faceImage []byte, width, height int) ([]float32, error) {
+	f.cropSizes = append(f.cropSizes, [2]int{width, height})
+	vector := make([]float32, f.dims)
+	vector[0] = 1
+	return vector, nil
+}
+
+func (f *fakeInference) Close() error { return nil }
+
+func TestONNXFaceEngine_Recognize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, checkerboard(100, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	inference := &fakeInference{
+		detections: []acceleration.FaceDetection{{
+			BoundingBox: acceleration.Rectangle2D{X: 10, Y: 20, Width: 40, Height: 200},
+			Landmarks:   []acceleration.Point2D{{X: 30, Y: 40}},
+		}},
+		dims: 128,
+	}
+	engine := &onnxFaceEngine{engine: inference}
+
+	faces, err := engine.Recognize(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Recognize() error = %v", err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("Recognize() returned %d faces, want 1", len(faces))
+	}
+	// The box is clipped to the image
+	if r := faces[0].Rectangle; r.Min.X != 10 || r.Min.Y != 20 || r.Dx() != 40 || r.Dy() != 80 {
+		t.Errorf("face rectangle = %v", r)
+	}
+	if inference.cropSizes[0] != [2]int{40, 80} {
+		t.Errorf("embedding crop size = %v, want 40x80", inference.cropSizes[0])
+	}
+	if faces[0].Descriptor[0] != 1 || len(faces[0].Shapes) != 1 {
+		t.Error("descriptor or landmarks not converted")
+	}
+
+	inference.dims = 512
+	if _, err := engine.Recognize(buf.Bytes()); err == nil {
+		t.Error("Recognize() should reject embeddings that are not 128-dimensional")
+	}
+
+	if _, err := engine.Recognize([]byte("not an image")); err == nil {
+		t.Error("Recognize() should fail for undecodable data")
+	}
+}
@@ -0,0 +1,55 @@
+package recognition
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+)
+
+// fingerprintStep is the quantization step of EmbeddingFingerprint. Vectors
+// whose components all round to the same multiple of it share a fingerprint,
+// so copies that went through export/import or float conversions still match,
+// while two captures of the same face do not.
+const fingerprintStep = 0.01
+
+// EmbeddingFingerprint returns a hash of the quantized embedding vector that
+// is the same on every machine. Equal fingerprints identify duplicate
+// enrollments of the same capture; quality and angle are not included.
+func EmbeddingFingerprint(e Embedding) string {
+	h := sha256.New()
+	var buf [2]byte
+	for _, v := range e.Vector {
+		q := math.Round(float64(v) / fingerprintStep)
+		if math.IsNaN(q) {
+			q = 0
+		}
+		q = math.Max(math.MinInt16, math.Min(math.MaxInt16, q))
+		binary.LittleEndian.PutUint16(buf[:], uint16(int16(q)))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// DuplicateEmbeddings groups the indices of embeddings that share a
+// fingerprint. Only groups with more than one embedding are returned, in
+// order of their first index.
+func DuplicateEmbeddings(embeddings []Embedding) [][]int {
+	groups := map[string][]int{}
+	var order []string
+	for i, e := range embeddings {
+		fp := EmbeddingFingerprint(e)
+		if _, ok := groups[fp]; !ok {
+			order = append(order, fp)
+		}
+		groups[fp] = append(groups[fp], i)
+	}
+
+	var duplicates [][]int
+	for _, fp := range order {
+		if len(groups[fp]) > 1 {
+			duplicates = append(duplicates, groups[fp])
+		}
+	}
+	return duplicates
+}
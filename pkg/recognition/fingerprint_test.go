@@ -0,0 +1,52 @@
+package recognition
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEmbeddingFingerprint(t *testing.T) {
+	a := Embedding{Quality: 0.9, Angle: "front"}
+	for i := range a.Vector {
+		a.Vector[i] = float32(i%7-3) * 0.031
+	}
+
+	// A JSON round trip and metadata changes keep the fingerprint
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var copied Embedding
+	if err := json.Unmarshal(data, &copied); err != nil {
+		t.Fatal(err)
+	}
+	copied.Quality, copied.Angle = 0.5, "left"
+	copied.Vector[3] += 0.0001
+	if EmbeddingFingerprint(a) != EmbeddingFingerprint(copied) {
+		t.Error("near-identical embeddings should share a fingerprint")
+	}
+
+	b := a
+	b.Vector[10] += 0.05
+	if EmbeddingFingerprint(a) == EmbeddingFingerprint(b) {
+		t.Error("different embeddings should not share a fingerprint")
+	}
+
+	// Fixed value: the fingerprint must not depend on the machine
+	if got := EmbeddingFingerprint(Embedding{}); got != "5341e6b2646979a70e57653007a1f310" {
+		t.Errorf("EmbeddingFingerprint(zero) = %s", got)
+	}
+}
+
+func TestDuplicateEmbeddings(t *testing.T) {
+	a := Embedding{Vector: Descriptor{0.1}}
+	b := Embedding{Vector: Descriptor{0.2}}
+
+	groups := DuplicateEmbeddings([]Embedding{a, b, a, b, {}, a})
+	if len(groups) != 2 || len(groups[0]) != 3 || groups[0][2] != 5 || len(groups[1]) != 2 {
+		t.Errorf("DuplicateEmbeddings() = %v, want [[0 2 5] [1 3]]", groups)
+	}
+	if groups := DuplicateEmbeddings([]Embedding{a, b}); len(groups) != 0 {
+		t.Errorf("DuplicateEmbeddings() without duplicates = %v", groups)
+	}
+}
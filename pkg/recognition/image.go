@@ -0,0 +1,135 @@
+package recognition
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	"github.com/Kagami/go-face"
+)
+
+// ImageEngine is implemented by face engines that accept decoded pixels.
+// Engines without it (dlib) are given a JPEG encoded once from the image.
+type ImageEngine interface {
+	RecognizeImage(img image.Image) ([]face.Face, error)
+}
+
+// dlibJPEGQuality is used when an image has to be encoded for dlib. Grayscale
+// images are encoded without chroma subsampling, so IR frames lose almost
+// nothing at this quality.
+const dlibJPEGQuality = 100
+
+// DetectFacesImage detects all faces in a decoded image, e.g. a raw GREY or
+// Y16 frame from camera.Frame.ToImage, without a JPEG round trip through the
+// camera pipeline.
+func (r *DlibRecognizer) DetectFacesImage(img image.Image) ([]Face, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.loaded {
+		return nil, ErrModelNotLoaded
+	}
+
+	return r.detectImage(toGray8(img))
+}
+
+// detectImage runs detection on a decoded image, after preprocessing it if
+// configured. Quality is scored on the original image, so preprocessing
+// does not change what min_embedding_quality filters. r.mu must be held.
+func (r *DlibRecognizer) detectImage(img image.Image) ([]Face, error) {
+	input := img
+	if r.clahe {
+		input = EqualizeCLAHE(img)
+	}
+
+	var faces []face.Face
+	var err error
+	_, cnn := r.cnnEngine()
+	if engine, ok := r.rec.(ImageEngine); ok && !cnn {
+		faces, err = engine.RecognizeImage(input)
+	} else {
+		var data []byte
+		data, err = encodeJPEG(input)
+		if err == nil {
+			faces, err = r.recognize(data)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("face detection failed: %w", err)
+	}
+
+	return r.convertFaces(faces, img)
+}
+
+// RecognizeImage detects a single face in a decoded image and returns its
+// embedding.
+func (r *DlibRecognizer) RecognizeImage(img image.Image, angle string) (*Embedding, error) {
+	faces, err := r.DetectFacesImage(img)
+	if err != nil {
+		return nil, err
+	}
+	f, err := singleFace(faces)
+	if err != nil {
+		return nil, err
+	}
+
+	embedding := r.GetEmbedding(f, angle)
+	return &embedding, nil
+}
+
+// toGray8 converts 16-bit grayscale images to 8 bits, stretching the used
+// range to the full scale: IR sensors often fill only 10 or 12 bits. Other
+// images are returned unchanged.
+func toGray8(img image.Image) image.Image {
+	src, ok := img.(*image.Gray16)
+	if !ok {
+		return img
+	}
+
+	bounds := src.Bounds()
+	lo, hi := uint16(0xffff), uint16(0)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := src.Gray16At(x, y).Y
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+	}
+
+	dst := image.NewGray(bounds)
+	span := uint32(hi) - uint32(lo)
+	if span == 0 {
+		return dst
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := uint32(src.Gray16At(x, y).Y - lo)
+			dst.Pix[dst.PixOffset(x, y)] = uint8(v * 255 / span)
+		}
+	}
+	return dst
+}
+
+// encodeJPEG encodes img for engines that only accept JPEG data. Paletted
+// and other uncommon image types are converted to RGBA first.
+func encodeJPEG(img image.Image) ([]byte, error) {
+	switch img.(type) {
+	case *image.Gray, *image.RGBA, *image.NRGBA, *image.YCbCr:
+	default:
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		img = rgba
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: dlibJPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
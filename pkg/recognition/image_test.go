@@ -0,0 +1,106 @@
+package recognition
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/Kagami/go-face"
+)
+
+// imageMockEngine records the decoded images passed to it.
+type imageMockEngine struct {
+	MockFaceEngine
+	images []image.Image
+}
+
+func (m *imageMockEngine) RecognizeImage(img image.Image) ([]face.Face, error) {
+	m.images = append(m.images, img)
+	return []face.Face{{Rectangle: image.Rect(10, 10, 110, 110)}}, nil
+}
+
+func TestDetectFacesImage_JPEGEngine(t *testing.T) {
+	var received []byte
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) {
+		return &MockFaceEngine{
+			RecognizeFunc: func(data []byte) ([]face.Face, error) {
+				received = data
+				return []face.Face{{Rectangle: image.Rect(10, 10, 110, 110)}}, nil
+			},
+		}, nil
+	}
+	_ = r.LoadModels("dummy")
+
+	faces, err := r.DetectFacesImage(checkerboard(200, 4))
+	if err != nil {
+		t.Fatalf("DetectFacesImage() error = %v", err)
+	}
+	if len(faces) != 1 || faces[0].BoundingBox.Width != 100 {
+		t.Errorf("DetectFacesImage() = %+v", faces)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(received))
+	if err != nil {
+		t.Fatalf("engine did not receive a JPEG: %v", err)
+	}
+	if _, ok := decoded.(*image.Gray); !ok {
+		t.Errorf("grayscale image should stay grayscale, got %T", decoded)
+	}
+	if faces[0].Quality == 0 {
+		t.Error("quality should be scored from the decoded image")
+	}
+}
+
+func TestRecognizeImage_ImageEngine(t *testing.T) {
+	engine := &imageMockEngine{}
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) { return engine, nil }
+
+	if _, err := r.RecognizeImage(checkerboard(200, 4), "front"); !errors.Is(err, ErrModelNotLoaded) {
+		t.Errorf("RecognizeImage() before LoadModels error = %v", err)
+	}
+	_ = r.LoadModels("dummy")
+
+	src := image.NewGray16(image.Rect(0, 0, 200, 200))
+	for i := 0; i < len(src.Pix); i += 2 {
+		src.Pix[i] = 0x0f // 12-bit samples
+	}
+	embedding, err := r.RecognizeImage(src, "front")
+	if err != nil {
+		t.Fatalf("RecognizeImage() error = %v", err)
+	}
+	if embedding.Angle != "front" {
+		t.Errorf("Angle = %q, want front", embedding.Angle)
+	}
+	if len(engine.images) != 1 {
+		t.Fatalf("engine received %d images, want 1", len(engine.images))
+	}
+	if _, ok := engine.images[0].(*image.Gray); !ok {
+		t.Errorf("Y16 image should be converted to 8 bits once, got %T", engine.images[0])
+	}
+}
+
+func TestToGray8(t *testing.T) {
+	src := image.NewGray16(image.Rect(0, 0, 3, 1))
+	src.Pix = []byte{0x01, 0x00, 0x02, 0x00, 0x03, 0x00} // 256, 512, 768
+
+	gray, ok := toGray8(src).(*image.Gray)
+	if !ok {
+		t.Fatalf("toGray8() returned %T", toGray8(src))
+	}
+	if gray.Pix[0] != 0 || gray.Pix[1] != 127 || gray.Pix[2] != 255 {
+		t.Errorf("range not stretched: %v", gray.Pix)
+	}
+
+	flat := image.NewGray16(image.Rect(0, 0, 2, 2))
+	if g := toGray8(flat).(*image.Gray); g.Pix[0] != 0 {
+		t.Errorf("flat image should map to black, got %v", g.Pix)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	if toGray8(rgba) != image.Image(rgba) {
+		t.Error("8-bit images should be returned unchanged")
+	}
+}
@@ -21,3 +21,16 @@ func (m *MockFaceEngine) Close() {
 		m.CloseFunc()
 	}
 }
+
+// MockCNNEngine is a MockFaceEngine with a CNN detector.
+type MockCNNEngine struct {
+	MockFaceEngine
+	RecognizeCNNFunc func(data []byte) ([]face.Face, error)
+}
+
+func (m *MockCNNEngine) RecognizeCNN(data []byte) ([]face.Face, error) {
+	if m.RecognizeCNNFunc != nil {
+		return m.RecognizeCNNFunc(data)
+	}
+	return nil, nil
+}
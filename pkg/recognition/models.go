@@ -0,0 +1,143 @@
+package recognition
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Model files loaded by the dlib recognizer. go-face expects all of them in
+// a single directory under exactly these names.
+const (
+	ShapePredictorModel = "shape_predictor_5_face_landmarks.dat"
+	RecognitionModel    = "dlib_face_recognition_resnet_model_v1.dat"
+	CNNDetectorModel    = "mmod_human_face_detector.dat"
+)
+
+// ShapePredictor68Model is dlib's 68-point landmark predictor. go-face can
+// load it in place of the 5-point model.
+const ShapePredictor68Model = "shape_predictor_68_face_landmarks.dat"
+
+// ModelFiles lists the model files required by LoadModels.
+var ModelFiles = []string{ShapePredictorModel, RecognitionModel, CNNDetectorModel}
+
+// ModelNames are the file names under which the dlib models are searched
+// for. Files with other names, such as ShapePredictor68Model or renamed
+// copies, are linked under the names go-face expects. Empty names use the
+// defaults.
+type ModelNames struct {
+	ShapePredictor string
+	Recognition    string
+	CNNDetector    string
+}
+
+// Files returns the configured file name of each entry of ModelFiles, in
+// the same order.
+func (n ModelNames) Files() []string {
+	files := []string{n.ShapePredictor, n.Recognition, n.CNNDetector}
+	for i, name := range files {
+		if name == "" {
+			files[i] = ModelFiles[i]
+		}
+	}
+	return files
+}
+
+// ErrModelFileMissing is returned when a model file is not found in any search path.
+var ErrModelFileMissing = errors.New("model file not found")
+
+// ResolveModelDir searches paths in order for each model file named by names
+// and returns a directory containing all of them under the names go-face
+// expects. If every file was found in the same directory under its default
+// name that directory is returned as is; otherwise the files are symlinked
+// into a temporary directory which cleanup removes. The models are read when
+// loaded, so cleanup may be called as soon as LoadModels returns.
+func ResolveModelDir(paths []string, names ModelNames) (dir string, cleanup func(), err error) {
+	cleanup = func() {}
+
+	files := names.Files()
+	found := make(map[string]string, len(ModelFiles))
+	var missing []string
+	for i, name := range files {
+		path, ok := findModelFile(name, paths)
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		found[ModelFiles[i]] = path
+	}
+	if len(missing) > 0 {
+		return "", cleanup, fmt.Errorf("%w: %s (searched: %s)",
+			ErrModelFileMissing, strings.Join(missing, ", "), strings.Join(paths, ", "))
+	}
+
+	dir = filepath.Dir(found[ModelFiles[0]])
+	inPlace := true
+	for name, path := range found {
+		if filepath.Dir(path) != dir || filepath.Base(path) != name {
+			inPlace = false
+			break
+		}
+	}
+	if inPlace {
+		return dir, cleanup, nil
+	}
+
+	dir, err = os.MkdirTemp("", "facepass-models-")
+	if err != nil {
+		return "", cleanup, fmt.Errorf("failed to create model directory: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	for name, path := range found {
+		if err := os.Symlink(path, filepath.Join(dir, name)); err != nil {
+			cleanup()
+			return "", func() {}, fmt.Errorf("failed to link model %s: %w", name, err)
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// findModelFile returns the absolute path of the first copy of name in paths.
+func findModelFile(name string, paths []string) (string, bool) {
+	for _, dir := range paths {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// SetModelNames sets the model file names searched for by
+// LoadModelsFromPaths.
+func (r *DlibRecognizer) SetModelNames(names ModelNames) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.modelNames = names
+}
+
+// LoadModelsFromPaths loads the models, searching each path in order for
+// every model file.
+func (r *DlibRecognizer) LoadModelsFromPaths(paths []string) error {
+	if r.IsLoaded() {
+		return nil
+	}
+
+	r.mu.RLock()
+	names := r.modelNames
+	r.mu.RUnlock()
+
+	dir, cleanup, err := ResolveModelDir(paths, names)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return r.LoadModels(dir)
+}
@@ -0,0 +1,114 @@
+package recognition
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeModelFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("model"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveModelDir_SingleDir(t *testing.T) {
+	empty := t.TempDir()
+	models := t.TempDir()
+	writeModelFiles(t, models, ModelFiles...)
+
+	dir, cleanup, err := ResolveModelDir([]string{empty, models}, ModelNames{})
+	if err != nil {
+		t.Fatalf("ResolveModelDir() error = %v", err)
+	}
+	defer cleanup()
+
+	if dir != models {
+		t.Errorf("ResolveModelDir() = %s, want %s", dir, models)
+	}
+}
+
+func TestResolveModelDir_SplitAcrossDirs(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	writeModelFiles(t, first, ShapePredictorModel)
+	writeModelFiles(t, second, RecognitionModel, CNNDetectorModel, ShapePredictorModel)
+
+	dir, cleanup, err := ResolveModelDir([]string{first, second}, ModelNames{})
+	if err != nil {
+		t.Fatalf("ResolveModelDir() error = %v", err)
+	}
+
+	for _, name := range ModelFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not available in resolved dir: %v", name, err)
+		}
+	}
+	// The first search path wins
+	target, err := os.Readlink(filepath.Join(dir, ShapePredictorModel))
+	if err != nil || target != filepath.Join(first, ShapePredictorModel) {
+		t.Errorf("%s links to %q, want copy from %s", ShapePredictorModel, target, first)
+	}
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("cleanup should remove the temporary model dir")
+	}
+}
+
+func TestResolveModelDir_Missing(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	writeModelFiles(t, second, ShapePredictorModel, CNNDetectorModel)
+
+	_, _, err := ResolveModelDir([]string{first, second}, ModelNames{})
+	if !errors.Is(err, ErrModelFileMissing) {
+		t.Fatalf("ResolveModelDir() error = %v, want ErrModelFileMissing", err)
+	}
+
+	msg := err.Error()
+	if !strings.Contains(msg, RecognitionModel) || strings.Contains(msg, ShapePredictorModel) {
+		t.Errorf("error should name only the missing file: %s", msg)
+	}
+	if !strings.Contains(msg, first) || !strings.Contains(msg, second) {
+		t.Errorf("error should list the searched paths: %s", msg)
+	}
+}
+
+func TestResolveModelDir_Names(t *testing.T) {
+	models := t.TempDir()
+	writeModelFiles(t, models, ShapePredictor68Model, "resnet-copy.dat", CNNDetectorModel)
+
+	names := ModelNames{ShapePredictor: ShapePredictor68Model, Recognition: "resnet-copy.dat"}
+	dir, cleanup, err := ResolveModelDir([]string{models}, names)
+	if err != nil {
+		t.Fatalf("ResolveModelDir() error = %v", err)
+	}
+	defer cleanup()
+
+	// Renamed files are linked under the names go-face expects
+	if dir == models {
+		t.Fatal("ResolveModelDir() should link renamed models into a new dir")
+	}
+	for name, want := range map[string]string{
+		ShapePredictorModel: ShapePredictor68Model,
+		RecognitionModel:    "resnet-copy.dat",
+		CNNDetectorModel:    CNNDetectorModel,
+	} {
+		target, err := os.Readlink(filepath.Join(dir, name))
+		if err != nil || target != filepath.Join(models, want) {
+			t.Errorf("%s links to %q, want %s", name, target, want)
+		}
+	}
+
+	// The default names are not searched for when others are configured
+	_, _, err = ResolveModelDir([]string{models}, ModelNames{Recognition: RecognitionModel})
+	if !errors.Is(err, ErrModelFileMissing) || !strings.Contains(err.Error(), ShapePredictorModel) {
+		t.Errorf("ResolveModelDir() with default names error = %v, want missing %s", err, ShapePredictorModel)
+	}
+}
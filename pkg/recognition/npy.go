@@ -0,0 +1,201 @@
+package recognition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Embeddings are exported as NumPy .npy files (format version 1.0) holding
+// a little-endian float32 array of shape (128,), so they can be loaded with
+// numpy.load. Angle and quality are written to a JSON sidecar next to the
+// array, e.g. face.npy and face.json:
+//
+//	{"angle": "front", "quality": 0.92, "dimensions": 128}
+
+// npyMagic starts every .npy file.
+const npyMagic = "\x93NUMPY"
+
+// ErrInvalidNPY is returned for files that are not a float32 vector of the
+// descriptor size in .npy format.
+var ErrInvalidNPY = errors.New("invalid .npy embedding")
+
+// npyHeaderPattern extracts the fields of the header dictionary written by
+// NumPy, e.g. {'descr': '<f4', 'fortran_order': False, 'shape': (128,), }.
+var npyHeaderPattern = regexp.MustCompile(
+	`^\{'descr':\s*'([^']+)',\s*'fortran_order':\s*(True|False),\s*'shape':\s*\((\d+),?\),?\s*\}`)
+
+// EmbeddingMetadata is the sidecar written next to an exported embedding.
+type EmbeddingMetadata struct {
+	Angle      string  `json:"angle"`
+	Quality    float64 `json:"quality"`
+	Dimensions int     `json:"dimensions"`
+}
+
+// SaveEmbedding writes the embedding vector to path as a .npy file and its
+// angle and quality to the JSON sidecar (see MetadataPath).
+func SaveEmbedding(path string, e Embedding) error {
+	var buf bytes.Buffer
+	if err := writeNPY(&buf, e.Vector[:]); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write embedding: %w", err)
+	}
+
+	meta, err := json.MarshalIndent(EmbeddingMetadata{
+		Angle:      e.Angle,
+		Quality:    e.Quality,
+		Dimensions: len(e.Vector),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(MetadataPath(path), append(meta, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write embedding metadata: %w", err)
+	}
+	return nil
+}
+
+// LoadEmbedding reads an embedding written by SaveEmbedding or by
+// numpy.save with a float32 or float64 vector. A missing sidecar leaves the
+// angle and quality empty.
+func LoadEmbedding(path string) (Embedding, error) {
+	var e Embedding
+
+	f, err := os.Open(path)
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+
+	vector, err := readNPY(f)
+	if err != nil {
+		return e, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(vector) != len(e.Vector) {
+		return e, fmt.Errorf("%s: %w: %d dimensions, want %d", path, ErrInvalidNPY, len(vector), len(e.Vector))
+	}
+	copy(e.Vector[:], vector)
+
+	data, err := os.ReadFile(MetadataPath(path))
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return e, fmt.Errorf("failed to read embedding metadata: %w", err)
+	}
+	var meta EmbeddingMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return e, fmt.Errorf("invalid embedding metadata: %w", err)
+	}
+	e.Angle = meta.Angle
+	e.Quality = meta.Quality
+	return e, nil
+}
+
+// MetadataPath returns the sidecar path for an exported embedding: the path
+// with its .npy extension replaced by .json.
+func MetadataPath(path string) string {
+	return strings.TrimSuffix(path, ".npy") + ".json"
+}
+
+// writeNPY writes vector as a version 1.0 .npy array of little-endian
+// float32.
+func writeNPY(w io.Writer, vector []float32) error {
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d,), }", len(vector))
+	// The magic, version, length and header are padded with spaces to a
+	// multiple of 64 bytes and terminated by a newline.
+	prefix := len(npyMagic) + 2 + 2
+	padding := 64 - (prefix+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	header += strings.Repeat(" ", padding) + "\n"
+
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	_ = binary.Write(&buf, binary.LittleEndian, vector)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readNPY reads a one-dimensional float32 or float64 .npy array in C order.
+// Format versions 1.0 to 3.0 are accepted.
+func readNPY(r io.Reader) ([]float32, error) {
+	preamble := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(r, preamble); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNPY, err)
+	}
+	if string(preamble[:len(npyMagic)]) != npyMagic {
+		return nil, fmt.Errorf("%w: missing NUMPY magic", ErrInvalidNPY)
+	}
+
+	var headerLen uint32
+	switch major := preamble[len(npyMagic)]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNPY, err)
+		}
+		headerLen = uint32(n)
+	case 2, 3:
+		if err := binary.Read(r, binary.LittleEndian, &headerLen); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNPY, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidNPY, major)
+	}
+	if headerLen > 1<<16 {
+		return nil, fmt.Errorf("%w: header too large", ErrInvalidNPY)
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNPY, err)
+	}
+	m := npyHeaderPattern.FindSubmatch(bytes.TrimSpace(header))
+	if m == nil {
+		return nil, fmt.Errorf("%w: expected a one-dimensional array, got header %q", ErrInvalidNPY, bytes.TrimSpace(header))
+	}
+	if string(m[2]) == "True" {
+		return nil, fmt.Errorf("%w: Fortran order is not supported", ErrInvalidNPY)
+	}
+	var n int
+	if _, err := fmt.Sscan(string(m[3]), &n); err != nil || n > 1<<16 {
+		return nil, fmt.Errorf("%w: invalid shape %s", ErrInvalidNPY, m[3])
+	}
+
+	vector := make([]float32, n)
+	switch descr := string(m[1]); descr {
+	case "<f4":
+		if err := binary.Read(r, binary.LittleEndian, vector); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNPY, err)
+		}
+	case "<f8":
+		wide := make([]float64, n)
+		if err := binary.Read(r, binary.LittleEndian, wide); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNPY, err)
+		}
+		for i, v := range wide {
+			if math.Abs(v) > math.MaxFloat32 {
+				return nil, fmt.Errorf("%w: value %g out of float32 range", ErrInvalidNPY, v)
+			}
+			vector[i] = float32(v)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported dtype %s (want <f4 or <f8)", ErrInvalidNPY, descr)
+	}
+	return vector, nil
+}
@@ -0,0 +1,109 @@
+package recognition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadEmbedding(t *testing.T) {
+	var e Embedding
+	for i := range e.Vector {
+		e.Vector[i] = float32(i) / 128
+	}
+	e.Angle = "left"
+	e.Quality = 0.87
+
+	path := filepath.Join(t.TempDir(), "alice-left.npy")
+	if err := SaveEmbedding(path, e); err != nil {
+		t.Fatalf("SaveEmbedding() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// numpy requires the data to start at a multiple of 64 bytes
+	headerLen := int(binary.LittleEndian.Uint16(data[8:10]))
+	if (10+headerLen)%64 != 0 || data[10+headerLen-1] != '\n' {
+		t.Errorf("header length %d is not padded to 64 bytes", headerLen)
+	}
+	if len(data) != 10+headerLen+128*4 {
+		t.Errorf("file size = %d, want header plus 512 bytes", len(data))
+	}
+
+	got, err := LoadEmbedding(path)
+	if err != nil {
+		t.Fatalf("LoadEmbedding() error = %v", err)
+	}
+	if got != e {
+		t.Errorf("LoadEmbedding() = %+v, want %+v", got, e)
+	}
+
+	// Without the sidecar only the vector is restored
+	if err := os.Remove(MetadataPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadEmbedding(path)
+	if err != nil || got.Vector != e.Vector || got.Angle != "" {
+		t.Errorf("LoadEmbedding() without sidecar = %+v, %v", got, err)
+	}
+}
+
+// npyFile builds a .npy file like numpy.save would.
+func npyFile(header string, data interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	_ = binary.Write(&buf, binary.LittleEndian, data)
+	return buf.Bytes()
+}
+
+func TestReadNPY(t *testing.T) {
+	wide := make([]float64, 128)
+	wide[3] = 0.25
+	vector, err := readNPY(bytes.NewReader(npyFile("{'descr': '<f8', 'fortran_order': False, 'shape': (128,), }\n", wide)))
+	if err != nil {
+		t.Fatalf("readNPY() float64 error = %v", err)
+	}
+	if len(vector) != 128 || vector[3] != 0.25 {
+		t.Errorf("readNPY() float64 = %v", vector[:4])
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not npy", data: []byte("PK\x03\x04 zip file")},
+		{name: "big endian", data: npyFile("{'descr': '>f4', 'fortran_order': False, 'shape': (2,), }\n", []float32{1, 2})},
+		{name: "two dimensional", data: npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (1, 2), }\n", []float32{1, 2})},
+		{name: "fortran order", data: npyFile("{'descr': '<f4', 'fortran_order': True, 'shape': (2,), }\n", []float32{1, 2})},
+		{name: "truncated", data: npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (4,), }\n", []float32{1, 2})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readNPY(bytes.NewReader(tt.data)); !errors.Is(err, ErrInvalidNPY) {
+				t.Errorf("readNPY() error = %v, want ErrInvalidNPY", err)
+			}
+		})
+	}
+}
+
+func TestLoadEmbedding_WrongDimensions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.npy")
+	var buf bytes.Buffer
+	if err := writeNPY(&buf, []float32{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEmbedding(path); !errors.Is(err, ErrInvalidNPY) {
+		t.Errorf("LoadEmbedding() error = %v, want ErrInvalidNPY", err)
+	}
+}
@@ -0,0 +1,114 @@
+package recognition
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/Kagami/go-face"
+	"github.com/MrCodeEU/facepass/pkg/acceleration"
+)
+
+// ONNXRecognizer runs face detection and embedding extraction on an ONNX
+// Runtime engine. Matching, quality filtering and normalization are shared
+// with DlibRecognizer.
+type ONNXRecognizer struct {
+	*DlibRecognizer
+	backend acceleration.Backend
+}
+
+// NewONNXRecognizer creates an ONNX-backed recognizer. LoadModels takes the
+// directory with the ONNX models and overrides cfg.ModelPath.
+func NewONNXRecognizer(cfg acceleration.ONNXConfig) *ONNXRecognizer {
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) {
+		engineCfg := cfg
+		engineCfg.ModelPath = path
+		engine, err := acceleration.NewONNXEngine(engineCfg)
+		if err != nil {
+			return nil, err
+		}
+		return &onnxFaceEngine{engine: engine}, nil
+	}
+	return &ONNXRecognizer{DlibRecognizer: r, backend: cfg.Backend}
+}
+
+// onnxInference is the part of acceleration.ONNXEngine used for recognition.
+type onnxInference interface {
+	DetectFaces(imageData []byte, width, height int) ([]acceleration.FaceDetection, error)
+	ExtractEmbedding(faceImage []byte, width, height int) ([]float32, error)
+	Close() error
+}
+
+// onnxFaceEngine adapts an ONNX inference engine to the FaceEngine interface.
+type onnxFaceEngine struct {
+	engine onnxInference
+}
+
+// Recognize decodes the image and runs RecognizeImage on it.
+func (e *onnxFaceEngine) Recognize(data []byte) ([]face.Face, error) {
+	img := decodeImage(data)
+	if img == nil {
+		return nil, errors.New("failed to decode image")
+	}
+	return e.RecognizeImage(img)
+}
+
+// RecognizeImage detects faces in decoded pixels and extracts an embedding
+// for each of them.
+func (e *onnxFaceEngine) RecognizeImage(img image.Image) ([]face.Face, error) {
+	bounds := img.Bounds()
+
+	detections, err := e.engine.DetectFaces(rgbBytes(img, bounds), bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return nil, err
+	}
+
+	faces := make([]face.Face, 0, len(detections))
+	for _, det := range detections {
+		box := det.BoundingBox
+		rect := image.Rect(
+			bounds.Min.X+int(box.X), bounds.Min.Y+int(box.Y),
+			bounds.Min.X+int(box.X+box.Width), bounds.Min.Y+int(box.Y+box.Height),
+		).Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+
+		vector, err := e.engine.ExtractEmbedding(rgbBytes(img, rect), rect.Dx(), rect.Dy())
+		if err != nil {
+			return nil, err
+		}
+		var descriptor Descriptor
+		if len(vector) != len(descriptor) {
+			return nil, fmt.Errorf("ONNX embedding has %d dimensions, want %d", len(vector), len(descriptor))
+		}
+		copy(descriptor[:], vector)
+
+		shapes := make([]image.Point, 0, len(det.Landmarks))
+		for _, p := range det.Landmarks {
+			shapes = append(shapes, image.Point{X: bounds.Min.X + int(p.X), Y: bounds.Min.Y + int(p.Y)})
+		}
+
+		faces = append(faces, face.NewWithShape(rect, shapes, descriptor))
+	}
+	return faces, nil
+}
+
+// Close releases the ONNX sessions.
+func (e *onnxFaceEngine) Close() {
+	_ = e.engine.Close()
+}
+
+// rgbBytes returns the pixels of rect as packed 8-bit RGB, the input format
+// of the ONNX engine.
+func rgbBytes(img image.Image, rect image.Rectangle) []byte {
+	buf := make([]byte, 0, rect.Dx()*rect.Dy()*3)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			buf = append(buf, byte(r>>8), byte(g>>8), byte(b>>8))
+		}
+	}
+	return buf
+}
@@ -0,0 +1,114 @@
+package recognition
+
+import (
+	"sync"
+
+	"github.com/Kagami/go-face"
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// loadDlibModels loads a dlib engine; tests replace it to avoid real models.
+var loadDlibModels = func(modelPath string, padding float64, jitter int) (FaceEngine, error) {
+	return face.NewRecognizerWithConfig(modelPath, descriptorChipSize, float32(padding), jitter)
+}
+
+// modelKey identifies a loaded dlib engine: padding and jitter are fixed
+// when the models are loaded.
+type modelKey struct {
+	path    string
+	padding float64
+	jitter  int
+}
+
+// cachedModels is a dlib engine loaded at most once per process. done is
+// closed when loading has finished.
+type cachedModels struct {
+	done   chan struct{}
+	engine FaceEngine
+	err    error
+}
+
+var (
+	modelCacheMu sync.Mutex
+	modelCache   = map[modelKey]*cachedModels{}
+)
+
+// sharedEngine wraps a preloaded engine for a recognizer. Closing the
+// recognizer leaves the models loaded for the next one; ReleaseModels frees
+// them.
+type sharedEngine struct {
+	FaceEngine
+}
+
+func (sharedEngine) Close() {}
+
+// sharedCNNEngine is a sharedEngine for engines with a CNN detector.
+type sharedCNNEngine struct {
+	sharedEngine
+	CNNEngine
+}
+
+// PreloadModels loads the dlib models in modelPath once per process, with
+// the default descriptor options. Recognizers created afterwards by
+// NewRecognizer reuse them instead of loading their own copy, which saves
+// several hundred MB and the load time in long-running processes that
+// create recognizers repeatedly. Later calls return the result of the first.
+func PreloadModels(modelPath string) error {
+	return preloadModels(modelKey{path: modelPath, padding: DefaultPadding})
+}
+
+// preloadModels loads the engine for key unless it is already cached.
+func preloadModels(key modelKey) error {
+	modelCacheMu.Lock()
+	cached, ok := modelCache[key]
+	if !ok {
+		cached = &cachedModels{done: make(chan struct{})}
+		modelCache[key] = cached
+	}
+	modelCacheMu.Unlock()
+
+	if !ok {
+		logging.Infof("Preloading face recognition models from: %s", key.path)
+		cached.engine, cached.err = loadDlibModels(key.path, key.padding, key.jitter)
+		close(cached.done)
+	}
+	<-cached.done
+	return cached.err
+}
+
+// preloadedEngine returns the preloaded engine for key, or nil if there is
+// none.
+func preloadedEngine(key modelKey) FaceEngine {
+	modelCacheMu.Lock()
+	cached, ok := modelCache[key]
+	modelCacheMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// Wait for a load in progress
+	<-cached.done
+	if cached.err != nil {
+		return nil
+	}
+	if cnn, ok := cached.engine.(CNNEngine); ok {
+		return sharedCNNEngine{sharedEngine{cached.engine}, cnn}
+	}
+	return sharedEngine{cached.engine}
+}
+
+// ReleaseModels frees all models loaded by PreloadModels. Recognizers that
+// use them must be closed first.
+func ReleaseModels() {
+	modelCacheMu.Lock()
+	cache := modelCache
+	modelCache = map[modelKey]*cachedModels{}
+	modelCacheMu.Unlock()
+
+	for _, cached := range cache {
+		<-cached.done
+		if cached.engine != nil {
+			cached.engine.Close()
+		}
+	}
+}
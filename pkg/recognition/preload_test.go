@@ -0,0 +1,100 @@
+package recognition
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// useFakeDlibModels counts model loads and engine closes instead of loading
+// real dlib models.
+func useFakeDlibModels(t *testing.T) (loads, closes *int) {
+	t.Helper()
+	loads, closes = new(int), new(int)
+	var mu sync.Mutex
+
+	orig := loadDlibModels
+	loadDlibModels = func(modelPath string, padding float64, jitter int) (FaceEngine, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if modelPath == "missing" {
+			return nil, errors.New("no models")
+		}
+		*loads++
+		return &MockFaceEngine{CloseFunc: func() { *closes++ }}, nil
+	}
+	t.Cleanup(func() {
+		ReleaseModels()
+		loadDlibModels = orig
+	})
+	return loads, closes
+}
+
+func TestPreloadModels(t *testing.T) {
+	loads, closes := useFakeDlibModels(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := PreloadModels("/models"); err != nil {
+				t.Errorf("PreloadModels() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if *loads != 1 {
+		t.Fatalf("models loaded %d times, want 1", *loads)
+	}
+
+	// Recognizers reuse the preloaded models and leave them loaded on Close
+	for i := 0; i < 2; i++ {
+		r := NewRecognizer()
+		if err := r.LoadModels("/models"); err != nil {
+			t.Fatalf("LoadModels() error = %v", err)
+		}
+		_ = r.Close()
+	}
+	if *loads != 1 || *closes != 0 {
+		t.Errorf("after two recognizers: %d loads, %d closes, want 1 and 0", *loads, *closes)
+	}
+
+	// Different descriptor options need their own models
+	r := NewRecognizer()
+	r.SetDescriptorOptions(DefaultPadding, 10)
+	if err := r.LoadModels("/models"); err != nil {
+		t.Fatalf("LoadModels() error = %v", err)
+	}
+	_ = r.Close()
+	if *loads != 2 || *closes != 1 {
+		t.Errorf("jittered recognizer: %d loads, %d closes, want 2 and 1", *loads, *closes)
+	}
+
+	ReleaseModels()
+	if *closes != 2 {
+		t.Errorf("ReleaseModels() closed %d engines in total, want 2", *closes)
+	}
+
+	// After release the models are loaded again
+	if err := PreloadModels("/models"); err != nil || *loads != 3 {
+		t.Errorf("PreloadModels() after release = %v with %d loads, want 3", err, *loads)
+	}
+}
+
+func TestPreloadModels_Error(t *testing.T) {
+	loads, _ := useFakeDlibModels(t)
+
+	if err := PreloadModels("missing"); err == nil {
+		t.Fatal("PreloadModels() should fail without models")
+	}
+	if err := PreloadModels("missing"); err == nil {
+		t.Error("PreloadModels() should keep reporting the first error")
+	}
+	if err := NewRecognizer().LoadModels("missing"); err == nil {
+		t.Error("LoadModels() should not use a failed preload")
+	}
+	if *loads != 0 {
+		t.Errorf("loads = %d, want 0", *loads)
+	}
+}
@@ -0,0 +1,124 @@
+package recognition
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Preprocessing steps applied to frames before detection, selected by
+// recognition.preprocess. Embeddings depend on the step, so it must be the
+// same at enrollment and authentication.
+const (
+	PreprocessNone  = "none"
+	PreprocessCLAHE = "clahe"
+)
+
+// CLAHE parameters: the image is split into claheTiles x claheTiles tiles,
+// and no histogram bin of a tile may exceed claheClipLimit times the average
+// bin, which limits how much noise in flat regions is amplified.
+const (
+	claheTiles     = 8
+	claheClipLimit = 2.0
+)
+
+// EqualizeCLAHE applies contrast-limited adaptive histogram equalization to
+// the brightness of img, lifting faces out of dim and unevenly lit frames.
+// Color images keep their chroma; images other than *image.Gray and
+// *image.YCbCr are converted to grayscale first.
+func EqualizeCLAHE(img image.Image) image.Image {
+	switch src := img.(type) {
+	case *image.Gray:
+		dst := image.NewGray(src.Bounds())
+		clahe(dst.Pix, src.Pix, dst.Stride, src.Stride, src.Rect.Dx(), src.Rect.Dy())
+		return dst
+	case *image.YCbCr:
+		dst := *src
+		dst.Y = make([]byte, len(src.Y))
+		clahe(dst.Y, src.Y, dst.YStride, src.YStride, src.Rect.Dx(), src.Rect.Dy())
+		return &dst
+	default:
+		gray := image.NewGray(img.Bounds())
+		draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+		return EqualizeCLAHE(gray)
+	}
+}
+
+// clahe equalizes the w x h 8-bit plane src into dst. Each tile gets its own
+// clipped histogram mapping, and every pixel blends the mappings of the four
+// nearest tile centers so no tile borders show.
+func clahe(dst, src []byte, dstStride, srcStride, w, h int) {
+	if w == 0 || h == 0 {
+		return
+	}
+	tilesX, tilesY := min(claheTiles, w), min(claheTiles, h)
+
+	luts := make([][256]uint8, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		y0, y1 := ty*h/tilesY, (ty+1)*h/tilesY
+		for tx := 0; tx < tilesX; tx++ {
+			x0, x1 := tx*w/tilesX, (tx+1)*w/tilesX
+
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				for _, v := range src[y*srcStride+x0 : y*srcStride+x1] {
+					hist[v]++
+				}
+			}
+			luts[ty*tilesX+tx] = clippedMapping(hist, (x1-x0)*(y1-y0))
+		}
+	}
+
+	// Position of a pixel between tile centers, in tiles
+	tileW, tileH := float64(w)/float64(tilesX), float64(h)/float64(tilesY)
+	neighbours := func(pos, size float64, tiles int) (int, int, float64) {
+		g := (pos+0.5)/size - 0.5
+		if g <= 0 {
+			return 0, 0, 0
+		}
+		i := int(g)
+		if i >= tiles-1 {
+			return tiles - 1, tiles - 1, 0
+		}
+		return i, i + 1, g - float64(i)
+	}
+
+	for y := 0; y < h; y++ {
+		ty0, ty1, fy := neighbours(float64(y), tileH, tilesY)
+		for x := 0; x < w; x++ {
+			tx0, tx1, fx := neighbours(float64(x), tileW, tilesX)
+			v := src[y*srcStride+x]
+			top := (1-fx)*float64(luts[ty0*tilesX+tx0][v]) + fx*float64(luts[ty0*tilesX+tx1][v])
+			bottom := (1-fx)*float64(luts[ty1*tilesX+tx0][v]) + fx*float64(luts[ty1*tilesX+tx1][v])
+			dst[y*dstStride+x] = uint8(math.Round((1-fy)*top + fy*bottom))
+		}
+	}
+}
+
+// clippedMapping clips hist at claheClipLimit times the average bin,
+// spreads the clipped counts evenly over all bins and returns the
+// equalizing mapping of the result.
+func clippedMapping(hist [256]int, pixels int) [256]uint8 {
+	limit := max(1, int(claheClipLimit*float64(pixels)/256))
+	excess := 0
+	for i, n := range hist {
+		if n > limit {
+			excess += n - limit
+			hist[i] = limit
+		}
+	}
+	for i := range hist {
+		hist[i] += excess / 256
+		if i < excess%256 {
+			hist[i]++
+		}
+	}
+
+	var lut [256]uint8
+	sum := 0
+	for i, n := range hist {
+		sum += n
+		lut[i] = uint8(sum * 255 / pixels)
+	}
+	return lut
+}
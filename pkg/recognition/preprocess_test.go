@@ -0,0 +1,142 @@
+package recognition
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/Kagami/go-face"
+)
+
+// dimTexture is a dark frame: a fine pattern using only 0-39.
+func dimTexture(w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Pix[img.PixOffset(x, y)] = uint8((x*7 + y*13) % 40)
+		}
+	}
+	return img
+}
+
+// grayRange returns the darkest and brightest value in img.
+func grayRange(img *image.Gray) (lo, hi uint8) {
+	lo = 255
+	for _, v := range img.Pix {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	return lo, hi
+}
+
+func TestEqualizeCLAHE(t *testing.T) {
+	src := dimTexture(160, 120)
+	out, ok := EqualizeCLAHE(src).(*image.Gray)
+	if !ok {
+		t.Fatalf("EqualizeCLAHE(*image.Gray) returned %T", EqualizeCLAHE(src))
+	}
+	if out.Bounds() != src.Bounds() {
+		t.Errorf("bounds = %v, want %v", out.Bounds(), src.Bounds())
+	}
+	// The clip limit caps the gain, but the contrast at least doubles
+	if lo, hi := grayRange(out); hi-lo < 80 {
+		t.Errorf("dim frame stretched to %d-%d, want at least twice 0-39", lo, hi)
+	}
+	if _, hi := grayRange(src); hi != 39 {
+		t.Errorf("source modified: max = %d", hi)
+	}
+
+	// A flat frame has nothing to stretch; clipping keeps it from
+	// turning into noise
+	flat := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range flat.Pix {
+		flat.Pix[i] = 20
+	}
+	if lo, hi := grayRange(EqualizeCLAHE(flat).(*image.Gray)); hi != lo {
+		t.Errorf("flat frame became %d-%d", lo, hi)
+	}
+}
+
+func TestEqualizeCLAHE_Color(t *testing.T) {
+	src := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Y[src.YOffset(x, y)] = uint8((x*7 + y*13) % 40)
+		}
+	}
+	for i := range src.Cb {
+		src.Cb[i], src.Cr[i] = 100, 150
+	}
+
+	out, ok := EqualizeCLAHE(src).(*image.YCbCr)
+	if !ok {
+		t.Fatalf("EqualizeCLAHE(*image.YCbCr) returned %T", EqualizeCLAHE(src))
+	}
+	if !bytes.Equal(out.Cb, src.Cb) || !bytes.Equal(out.Cr, src.Cr) {
+		t.Error("chroma should be kept")
+	}
+	luma := &image.Gray{Pix: out.Y, Stride: out.YStride, Rect: out.Rect}
+	if lo, hi := grayRange(luma); hi-lo < 80 {
+		t.Errorf("luma stretched to %d-%d, want at least twice 0-39", lo, hi)
+	}
+	if src.Y[src.YOffset(5, 0)] != 35 {
+		t.Error("source modified")
+	}
+
+	if _, ok := EqualizeCLAHE(image.NewRGBA(image.Rect(0, 0, 4, 4))).(*image.Gray); !ok {
+		t.Error("other images should become grayscale")
+	}
+}
+
+func TestDetectFaces_Preprocess(t *testing.T) {
+	var received []byte
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) {
+		return &MockFaceEngine{
+			RecognizeFunc: func(data []byte) ([]face.Face, error) {
+				received = data
+				return []face.Face{{Rectangle: image.Rect(10, 10, 110, 110)}}, nil
+			},
+		}, nil
+	}
+	_ = r.LoadModels("dummy")
+
+	var frame bytes.Buffer
+	if err := jpeg.Encode(&frame, dimTexture(200, 150), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	receivedRange := func() (uint8, uint8) {
+		t.Helper()
+		img, err := jpeg.Decode(bytes.NewReader(received))
+		if err != nil {
+			t.Fatalf("engine did not receive a JPEG: %v", err)
+		}
+		return grayRange(img.(*image.Gray))
+	}
+
+	for _, mode := range []string{"", PreprocessNone} {
+		r.SetPreprocess(mode)
+		if _, err := r.DetectFaces(frame.Bytes()); err != nil {
+			t.Fatalf("DetectFaces() error = %v", err)
+		}
+		if !bytes.Equal(received, frame.Bytes()) {
+			t.Errorf("preprocess %q: frame should be passed through unchanged", mode)
+		}
+	}
+
+	r.SetPreprocess(PreprocessCLAHE)
+	if _, err := r.DetectFaces(frame.Bytes()); err != nil {
+		t.Fatalf("DetectFaces() error = %v", err)
+	}
+	if lo, hi := receivedRange(); hi-lo < 80 {
+		t.Errorf("DetectFaces() passed a %d-%d frame, want it equalized", lo, hi)
+	}
+
+	received = nil
+	if _, err := r.DetectFacesImage(dimTexture(200, 150)); err != nil {
+		t.Fatalf("DetectFacesImage() error = %v", err)
+	}
+	if lo, hi := receivedRange(); hi-lo < 80 {
+		t.Errorf("DetectFacesImage() passed a %d-%d frame, want it equalized", lo, hi)
+	}
+}
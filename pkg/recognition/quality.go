@@ -0,0 +1,89 @@
+package recognition
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg" // Register JPEG decoder for camera frames
+	_ "image/png"  // Register PNG decoder for enrollment images
+)
+
+// Quality scoring parameters.
+const (
+	// goodFaceSize is the face width/height in pixels at which size stops
+	// limiting quality (dlib aligns faces to 150x150 chips).
+	goodFaceSize = 150.0
+	// goodSharpness is the Laplacian variance at which a face is considered sharp.
+	goodSharpness = 100.0
+)
+
+// FaceQuality scores a detected face between 0 (unusable) and 1 (good).
+// It combines the face size with the sharpness of the face region. If the
+// image cannot be decoded only the size is used.
+func FaceQuality(img image.Image, box Rectangle) float64 {
+	quality := sizeQuality(box)
+	if img != nil {
+		quality *= sharpnessQuality(img, box)
+	}
+	return quality
+}
+
+// decodeImage decodes image data for quality scoring, returning nil on failure.
+func decodeImage(data []byte) image.Image {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// sizeQuality scores the face size; small faces produce unreliable descriptors.
+func sizeQuality(box Rectangle) float64 {
+	size := float64(box.Width)
+	if box.Height < box.Width {
+		size = float64(box.Height)
+	}
+	if size <= 0 {
+		return 0
+	}
+	return clamp01(size / goodFaceSize)
+}
+
+// sharpnessQuality scores focus/motion blur using the variance of the
+// Laplacian over the face region.
+func sharpnessQuality(img image.Image, box Rectangle) float64 {
+	region := image.Rect(box.X, box.Y, box.X+box.Width, box.Y+box.Height).Intersect(img.Bounds())
+	if region.Dx() < 3 || region.Dy() < 3 {
+		return 0
+	}
+
+	gray := func(x, y int) float64 {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+	}
+
+	var sum, sumSq float64
+	var n int
+	for y := region.Min.Y + 1; y < region.Max.Y-1; y++ {
+		for x := region.Min.X + 1; x < region.Max.X-1; x++ {
+			lap := 4*gray(x, y) - gray(x-1, y) - gray(x+1, y) - gray(x, y-1) - gray(x, y+1)
+			sum += lap
+			sumSq += lap * lap
+			n++
+		}
+	}
+
+	mean := sum / float64(n)
+	variance := sumSq/float64(n) - mean*mean
+	return clamp01(variance / goodSharpness)
+}
+
+// clamp01 limits v to the range [0, 1].
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,74 @@
+package recognition
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/Kagami/go-face"
+)
+
+func checkerboard(size, cell int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if (x/cell+y/cell)%2 == 0 {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestFaceQuality(t *testing.T) {
+	sharp := checkerboard(200, 4)
+	flat := image.NewGray(image.Rect(0, 0, 200, 200))
+	box := Rectangle{X: 0, Y: 0, Width: 150, Height: 150}
+
+	if q := FaceQuality(sharp, box); q < 0.99 {
+		t.Errorf("sharp, large face quality = %f, want ~1", q)
+	}
+	if q := FaceQuality(flat, box); q != 0 {
+		t.Errorf("featureless face quality = %f, want 0", q)
+	}
+
+	small := Rectangle{X: 0, Y: 0, Width: 75, Height: 75}
+	if q := FaceQuality(sharp, small); q < 0.49 || q > 0.51 {
+		t.Errorf("half-size face quality = %f, want ~0.5", q)
+	}
+
+	// Without an image only the size is scored
+	if q := FaceQuality(nil, small); q < 0.49 || q > 0.51 {
+		t.Errorf("size-only quality = %f, want ~0.5", q)
+	}
+	if q := FaceQuality(nil, Rectangle{}); q != 0 {
+		t.Errorf("empty box quality = %f, want 0", q)
+	}
+}
+
+func TestDetectFaces_Quality(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, checkerboard(200, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) {
+		return &MockFaceEngine{
+			RecognizeFunc: func(data []byte) ([]face.Face, error) {
+				return []face.Face{{Rectangle: image.Rect(0, 0, 150, 150)}}, nil
+			},
+		}, nil
+	}
+	_ = r.LoadModels("dummy")
+
+	emb, err := r.RecognizeFace(buf.Bytes(), "front")
+	if err != nil {
+		t.Fatalf("RecognizeFace failed: %v", err)
+	}
+	if emb.Quality < 0.99 {
+		t.Errorf("embedding quality = %f, want ~1", emb.Quality)
+	}
+}
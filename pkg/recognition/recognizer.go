@@ -3,10 +3,15 @@
 package recognition
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"math"
+	"runtime"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/Kagami/go-face"
 	"github.com/MrCodeEU/facepass/pkg/logging"
@@ -17,6 +22,7 @@ type Face struct {
 	BoundingBox Rectangle
 	Landmarks   []Point
 	Confidence  float64
+	Quality     float64 // Size and sharpness score between 0 and 1, see FaceQuality
 	Descriptor  Descriptor
 }
 
@@ -34,11 +40,66 @@ type Point struct {
 // Descriptor is a 128-dimensional face descriptor from dlib.
 type Descriptor = face.Descriptor
 
+// DescriptorSize is the number of dimensions of a Descriptor.
+const DescriptorSize = len(Descriptor{})
+
 // Embedding represents a face embedding with metadata.
+//
+// CapturedAt and Device record where a stored embedding came from; they are
+// zero for embeddings enrolled before capture metadata existed.
 type Embedding struct {
-	Vector  Descriptor `json:"vector"`
-	Quality float64    `json:"quality"`
-	Angle   string     `json:"angle"` // "front", "left", "right", "up", "down"
+	Vector     Descriptor `json:"vector"`
+	Quality    float64    `json:"quality"`
+	Angle      string     `json:"angle"` // "front", "left", "right", "up", "down"
+	CapturedAt time.Time  `json:"captured_at"`
+	Device     string     `json:"device,omitempty"` // Camera device the face was captured with
+}
+
+// MarkCaptured records that e was just captured with device.
+func (e *Embedding) MarkCaptured(device string) {
+	e.CapturedAt = time.Now()
+	e.Device = device
+}
+
+// UnmarshalJSON decodes an embedding and rejects vectors that do not have
+// DescriptorSize dimensions. Decoding them into the fixed-size Descriptor
+// would silently truncate or zero-pad them, and every match would fail.
+func (e *Embedding) UnmarshalJSON(data []byte) error {
+	type plain Embedding
+	aux := struct {
+		Vector []float32 `json:"vector"`
+		*plain
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.Vector) != DescriptorSize {
+		return fmt.Errorf("%w: %d dimensions, want %d", ErrIncompatibleEmbedding, len(aux.Vector), DescriptorSize)
+	}
+	copy(e.Vector[:], aux.Vector)
+	return nil
+}
+
+// Validate reports ErrIncompatibleEmbedding for vectors that contain NaN or
+// infinite values. Their distance to anything is NaN, so they never match.
+func (e Embedding) Validate() error {
+	for _, v := range e.Vector {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Errorf("%w: vector contains non-finite values", ErrIncompatibleEmbedding)
+		}
+	}
+	return nil
+}
+
+// ValidateEmbeddings returns the first Validate error of embeddings, with
+// the index of the offending embedding.
+func ValidateEmbeddings(embeddings []Embedding) error {
+	for i, e := range embeddings {
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf("embedding %d: %w", i, err)
+		}
+	}
+	return nil
 }
 
 // ErrNoFaceDetected is returned when no face is found in the image.
@@ -50,6 +111,16 @@ var ErrMultipleFaces = errors.New("multiple faces detected")
 // ErrModelNotLoaded is returned when models are not loaded.
 var ErrModelNotLoaded = errors.New("recognition models not loaded")
 
+// ErrFaceTooSmall is returned when all detected faces are below the minimum size.
+var ErrFaceTooSmall = errors.New("face too small, move closer to the camera")
+
+// ErrFaceAtEdge is returned when a face touches the border of the frame.
+var ErrFaceAtEdge = errors.New("face at edge of frame, please center your face")
+
+// ErrIncompatibleEmbedding is returned for stored embeddings that were not
+// made by a compatible model, e.g. with a different number of dimensions.
+var ErrIncompatibleEmbedding = errors.New("embedding is incompatible with the current model (re-enroll the user)")
+
 // ErrLowQuality is returned when face quality is below threshold.
 var ErrLowQuality = errors.New("face quality too low")
 
@@ -59,6 +130,20 @@ type FaceEngine interface {
 	Close()
 }
 
+// CNNEngine is implemented by face engines that can detect faces with
+// dlib's CNN (MMOD) detector instead of the default HOG detector.
+type CNNEngine interface {
+	RecognizeCNN(data []byte) ([]face.Face, error)
+}
+
+// Face detectors selectable via recognition.detector. The CNN detector finds
+// faces at odd angles and in low-contrast IR images that HOG misses, but is
+// roughly 10-20 times slower on a CPU.
+const (
+	DetectorHOG = "hog"
+	DetectorCNN = "cnn"
+)
+
 // EngineFactory creates a new FaceEngine.
 type EngineFactory func(modelPath string) (FaceEngine, error)
 
@@ -70,16 +155,44 @@ type DlibRecognizer struct {
 	loaded    bool
 	mu        sync.RWMutex
 	tolerance float64
+
+	// minQuality excludes gallery embeddings below this quality from matching
+	minQuality float64
+	// normalize L2-normalizes embeddings before storing and comparing
+	normalize bool
+	// minFaceSize rejects detections smaller than this many pixels (0 = off)
+	minFaceSize int
+	// padding and jitter are passed to dlib when the models are loaded
+	padding float64
+	jitter  int
+	// modelNames are the file names LoadModelsFromPaths searches for
+	modelNames ModelNames
+	// cnn selects the CNN face detector instead of HOG
+	cnn bool
+	// clahe equalizes frames with EqualizeCLAHE before detection
+	clahe bool
 }
 
+// Default dlib descriptor extraction parameters.
+const (
+	descriptorChipSize = 150
+	DefaultPadding     = 0.25
+)
+
 // NewRecognizer creates a new DlibRecognizer instance.
 func NewRecognizer() *DlibRecognizer {
-	return &DlibRecognizer{
+	r := &DlibRecognizer{
 		tolerance: 0.4, // Default tolerance for face matching
-		factory: func(path string) (FaceEngine, error) {
-			return face.NewRecognizer(path)
-		},
+		padding:   DefaultPadding,
 	}
+	r.factory = func(path string) (FaceEngine, error) {
+		if engine := preloadedEngine(modelKey{path: path, padding: r.padding, jitter: r.jitter}); engine != nil {
+			logging.Debugf("Using preloaded face recognition models from: %s", path)
+			return engine, nil
+		}
+		return loadDlibModels(path, r.padding, r.jitter)
+	}
+	return r
 }
 
 // SetTolerance sets the tolerance for face matching.
@@ -90,11 +203,65 @@ func (r *DlibRecognizer) SetTolerance(tolerance float64) {
 	r.tolerance = tolerance
 }
 
+// SetMinQuality sets the minimum quality a gallery embedding needs to be
+// considered by FindBestMatch. Zero disables filtering.
+func (r *DlibRecognizer) SetMinQuality(quality float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.minQuality = quality
+}
+
+// SetNormalize enables L2 normalization of extracted embeddings and of both
+// sides of every comparison, so unnormalized enrollments keep working.
+func (r *DlibRecognizer) SetNormalize(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.normalize = enabled
+}
+
+// SetMinFaceSize sets the minimum width and height in pixels of a usable face.
+// Smaller faces produce unreliable descriptors. Zero disables the check.
+func (r *DlibRecognizer) SetMinFaceSize(pixels int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.minFaceSize = pixels
+}
+
+// SetDescriptorOptions sets the padding around the aligned face chip and the
+// number of jittered copies averaged into each descriptor. Jittering makes
+// descriptors more robust but costs roughly one extra network pass per copy,
+// so it suits enrollment rather than authentication. Must be called before
+// LoadModels.
+func (r *DlibRecognizer) SetDescriptorOptions(padding float64, jitter int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.padding = padding
+	r.jitter = jitter
+}
+
+// SetDetector selects the face detector, DetectorHOG (the default) or
+// DetectorCNN. Engines without a CNN detector, such as ONNX, ignore it.
+func (r *DlibRecognizer) SetDetector(detector string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cnn = detector == DetectorCNN
+}
+
+// SetPreprocess selects the preprocessing applied to frames before
+// detection, PreprocessNone (the default) or PreprocessCLAHE. Embeddings
+// depend on it, so enrollment and authentication must use the same step.
+func (r *DlibRecognizer) SetPreprocess(mode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clahe = mode == PreprocessCLAHE
+}
+
 // LoadModels loads the dlib face recognition models from the specified path.
-// The path should contain:
-// - shape_predictor_5_face_landmarks.dat
+// The path should contain the files in ModelFiles under exactly those names:
+// - shape_predictor_5_face_landmarks.dat (a 68-point predictor also works)
 // - dlib_face_recognition_resnet_model_v1.dat
-// - mmod_human_face_detector.dat (optional, for CNN detection)
+// - mmod_human_face_detector.dat (used by the CNN detector)
+// Use LoadModelsFromPaths with SetModelNames for other file names.
 func (r *DlibRecognizer) LoadModels(modelPath string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -138,6 +305,45 @@ func (r *DlibRecognizer) Close() error {
 	return nil
 }
 
+// warmUpWidth and warmUpHeight are the size of the synthetic WarmUp image,
+// the capture resolution used on low-power hosts.
+const (
+	warmUpWidth  = 320
+	warmUpHeight = 240
+)
+
+// WarmUp runs the face detector once on a synthetic image, so the lazy
+// allocations dlib makes on its first inference happen at startup rather
+// than during the first authentication attempt. The image contains no face,
+// so the descriptor network is not run and keeps a smaller first-use cost.
+func (r *DlibRecognizer) WarmUp() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.loaded {
+		return ErrModelNotLoaded
+	}
+
+	// A gradient rather than a flat image, so the detector has edges to scan
+	img := image.NewGray(image.Rect(0, 0, warmUpWidth, warmUpHeight))
+	for y := 0; y < warmUpHeight; y++ {
+		for x := 0; x < warmUpWidth; x++ {
+			img.Pix[img.PixOffset(x, y)] = uint8((x + y) * 255 / (warmUpWidth + warmUpHeight))
+		}
+	}
+	data, err := encodeJPEG(img)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if _, err := r.recognize(data); err != nil {
+		return fmt.Errorf("warm-up inference failed: %w", err)
+	}
+	logging.Debugf("Recognition warm-up took %v", time.Since(start))
+	return nil
+}
+
 // DetectFaces detects all faces in an image.
 // Returns a slice of Face structs with bounding boxes and descriptors.
 func (r *DlibRecognizer) DetectFaces(imageData []byte) ([]Face, error) {
@@ -148,8 +354,14 @@ func (r *DlibRecognizer) DetectFaces(imageData []byte) ([]Face, error) {
 		return nil, ErrModelNotLoaded
 	}
 
+	// Decode once for preprocessing and quality scoring of all faces
+	img := decodeImage(imageData)
+	if r.clahe && img != nil {
+		return r.detectImage(img)
+	}
+
 	// Recognize faces in the image
-	faces, err := r.rec.Recognize(imageData)
+	faces, err := r.recognize(imageData)
 	if err != nil {
 		return nil, fmt.Errorf("face detection failed: %w", err)
 	}
@@ -158,8 +370,37 @@ func (r *DlibRecognizer) DetectFaces(imageData []byte) ([]Face, error) {
 		return nil, ErrNoFaceDetected
 	}
 
-	result := make([]Face, len(faces))
-	for i, f := range faces {
+	return r.convertFaces(faces, img)
+}
+
+// recognize runs the selected face detector on a JPEG image. r.mu must be
+// held.
+func (r *DlibRecognizer) recognize(data []byte) ([]face.Face, error) {
+	if engine, ok := r.cnnEngine(); ok {
+		return engine.RecognizeCNN(data)
+	}
+	return r.rec.Recognize(data)
+}
+
+// cnnEngine returns the engine's CNN detector if it was selected and the
+// engine has one. r.mu must be held.
+func (r *DlibRecognizer) cnnEngine() (CNNEngine, bool) {
+	if !r.cnn {
+		return nil, false
+	}
+	engine, ok := r.rec.(CNNEngine)
+	return engine, ok
+}
+
+// convertFaces converts go-face detections, dropping faces below the minimum
+// size. img is used for quality scoring and may be nil. r.mu must be held.
+func (r *DlibRecognizer) convertFaces(faces []face.Face, img image.Image) ([]Face, error) {
+	if len(faces) == 0 {
+		return nil, ErrNoFaceDetected
+	}
+
+	result := make([]Face, 0, len(faces))
+	for _, f := range faces {
 		rect := f.Rectangle
 
 		// Convert landmarks
@@ -168,23 +409,82 @@ func (r *DlibRecognizer) DetectFaces(imageData []byte) ([]Face, error) {
 			landmarks = append(landmarks, Point{X: p.X, Y: p.Y})
 		}
 
-		result[i] = Face{
-			BoundingBox: Rectangle{
-				X:      rect.Min.X,
-				Y:      rect.Min.Y,
-				Width:  rect.Dx(),
-				Height: rect.Dy(),
-			},
-			Landmarks:  landmarks,
-			Descriptor: f.Descriptor,
-			Confidence: 1.0, // go-face doesn't provide confidence, assume high
+		box := Rectangle{
+			X:      rect.Min.X,
+			Y:      rect.Min.Y,
+			Width:  rect.Dx(),
+			Height: rect.Dy(),
 		}
+
+		// Skip faces too small for a reliable descriptor
+		if r.minFaceSize > 0 && (box.Width < r.minFaceSize || box.Height < r.minFaceSize) {
+			logging.Debugf("Ignoring %dx%d face below minimum size %d", box.Width, box.Height, r.minFaceSize)
+			continue
+		}
+
+		result = append(result, Face{
+			BoundingBox: box,
+			Landmarks:   landmarks,
+			Descriptor:  f.Descriptor,
+			Confidence:  1.0, // go-face doesn't provide confidence, assume high
+			Quality:     FaceQuality(img, box),
+		})
+	}
+
+	if len(result) == 0 {
+		return nil, ErrFaceTooSmall
 	}
 
 	logging.Debugf("Detected %d face(s) in image", len(result))
 	return result, nil
 }
 
+// DetectFacesBatch detects faces in several images using a bounded pool of
+// goroutines sharing the loaded models. The result has one entry per image;
+// images without a face, or that fail detection, yield a nil entry.
+func (r *DlibRecognizer) DetectFacesBatch(images [][]byte) ([][]Face, error) {
+	if !r.IsLoaded() {
+		return nil, ErrModelNotLoaded
+	}
+
+	results := make([][]Face, len(images))
+	if len(images) == 0 {
+		return results, nil
+	}
+
+	workers := runtime.NumCPU()
+	if workers > len(images) {
+		workers = len(images)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				faces, err := r.DetectFaces(images[i])
+				if err != nil {
+					if !errors.Is(err, ErrNoFaceDetected) && !errors.Is(err, ErrFaceTooSmall) {
+						logging.Debugf("Batch detection failed for image %d: %v", i, err)
+					}
+					continue
+				}
+				results[i] = faces
+			}
+		}()
+	}
+
+	for i := range images {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
 // DetectSingleFace detects exactly one face in the image.
 // Returns an error if no face or multiple faces are detected.
 func (r *DlibRecognizer) DetectSingleFace(imageData []byte) (*Face, error) {
@@ -192,7 +492,11 @@ func (r *DlibRecognizer) DetectSingleFace(imageData []byte) (*Face, error) {
 	if err != nil {
 		return nil, err
 	}
+	return singleFace(faces)
+}
 
+// singleFace returns the only face, or an error if there is not exactly one.
+func singleFace(faces []Face) (*Face, error) {
 	if len(faces) == 0 {
 		return nil, ErrNoFaceDetected
 	}
@@ -204,13 +508,37 @@ func (r *DlibRecognizer) DetectSingleFace(imageData []byte) (*Face, error) {
 	return &faces[0], nil
 }
 
+// CheckFaceInFrame returns ErrFaceAtEdge if the face's bounding box lies within
+// margin pixels of the frame border; such partially visible faces produce
+// unreliable descriptors. A non-positive margin or unknown frame size disables the check.
+func CheckFaceInFrame(f *Face, width, height, margin int) error {
+	if margin <= 0 || width <= 0 || height <= 0 {
+		return nil
+	}
+
+	box := f.BoundingBox
+	if box.X < margin || box.Y < margin ||
+		box.X+box.Width > width-margin || box.Y+box.Height > height-margin {
+		return ErrFaceAtEdge
+	}
+	return nil
+}
+
 // GetEmbedding extracts the face embedding from a detected face.
 func (r *DlibRecognizer) GetEmbedding(f *Face, angle string) Embedding {
-	return Embedding{
+	r.mu.RLock()
+	normalize := r.normalize
+	r.mu.RUnlock()
+
+	emb := Embedding{
 		Vector:  f.Descriptor,
-		Quality: f.Confidence,
+		Quality: f.Quality,
 		Angle:   angle,
 	}
+	if normalize {
+		emb = NormalizeEmbedding(emb)
+	}
+	return emb
 }
 
 // RecognizeFace detects a face and returns its embedding.
@@ -229,6 +557,13 @@ func (r *DlibRecognizer) RecognizeFace(imageData []byte, angle string) (*Embeddi
 // Returns the distance (lower = more similar).
 // Typical threshold: 0.4-0.6 (faces with distance < threshold are considered the same person)
 func (r *DlibRecognizer) CompareFaces(emb1, emb2 Embedding) float64 {
+	r.mu.RLock()
+	normalize := r.normalize
+	r.mu.RUnlock()
+
+	if normalize {
+		emb1, emb2 = NormalizeEmbedding(emb1), NormalizeEmbedding(emb2)
+	}
 	return EuclideanDistance(emb1.Vector, emb2.Vector)
 }
 
@@ -244,19 +579,40 @@ func (r *DlibRecognizer) Match(emb1, emb2 Embedding) bool {
 
 // FindBestMatch finds the best matching embedding from a list.
 // Returns the index of the best match, the distance, and whether it's within tolerance.
+// Gallery embeddings below the minimum quality are skipped, unless that would
+// leave nothing to compare against.
 func (r *DlibRecognizer) FindBestMatch(probe Embedding, gallery []Embedding) (int, float64, bool) {
 	r.mu.RLock()
 	tolerance := r.tolerance
+	minQuality := r.minQuality
 	r.mu.RUnlock()
 
 	if len(gallery) == 0 {
 		return -1, math.MaxFloat64, false
 	}
 
+	usable := make([]bool, len(gallery))
+	usableCount := 0
+	for i, emb := range gallery {
+		if emb.Quality >= minQuality {
+			usable[i] = true
+			usableCount++
+		}
+	}
+	if usableCount == 0 {
+		logging.Debugf("All %d gallery embeddings are below quality %.2f, using all", len(gallery), minQuality)
+		for i := range usable {
+			usable[i] = true
+		}
+	}
+
 	bestIdx := 0
 	bestDist := math.MaxFloat64
 
 	for i, emb := range gallery {
+		if !usable[i] {
+			continue
+		}
 		dist := r.CompareFaces(probe, emb)
 		if dist < bestDist {
 			bestDist = dist
@@ -267,6 +623,19 @@ func (r *DlibRecognizer) FindBestMatch(probe Embedding, gallery []Embedding) (in
 	return bestIdx, bestDist, bestDist < tolerance
 }
 
+// CountMatches returns how many gallery embeddings are within tolerance of
+// the probe. Requiring several matches guards against a single overfit
+// enrollment angle accepting a lookalike.
+func CountMatches(probe Embedding, gallery []Embedding, tolerance float64) int {
+	count := 0
+	for _, emb := range gallery {
+		if EuclideanDistance(probe.Vector, emb.Vector) < tolerance {
+			count++
+		}
+	}
+	return count
+}
+
 // EuclideanDistance calculates the Euclidean distance between two descriptors.
 func EuclideanDistance(d1, d2 Descriptor) float64 {
 	if len(d1) != len(d2) {
@@ -281,6 +650,30 @@ func EuclideanDistance(d1, d2 Descriptor) float64 {
 	return math.Sqrt(sum)
 }
 
+// CompareFaceSets computes the distances between every probe and gallery
+// embedding and returns the smallest and the mean distance. It is intended for
+// offline evaluation of enrollments, e.g. genuine versus impostor sets.
+// Empty sets return math.MaxFloat64 for both values.
+func CompareFaceSets(probe, gallery []Embedding) (minDist, meanDist float64) {
+	if len(probe) == 0 || len(gallery) == 0 {
+		return math.MaxFloat64, math.MaxFloat64
+	}
+
+	minDist = math.MaxFloat64
+	var sum float64
+	for _, p := range probe {
+		for _, g := range gallery {
+			dist := EuclideanDistance(p.Vector, g.Vector)
+			sum += dist
+			if dist < minDist {
+				minDist = dist
+			}
+		}
+	}
+
+	return minDist, sum / float64(len(probe)*len(gallery))
+}
+
 // AverageEmbedding computes the average of multiple embeddings.
 // This is useful for combining multiple angles of the same face.
 func AverageEmbedding(embeddings []Embedding) Embedding {
@@ -318,9 +711,90 @@ func AverageEmbedding(embeddings []Embedding) Embedding {
 	}
 	avgQuality /= float64(len(embeddings))
 
-	return Embedding{
+	// Keep the capture metadata of the most recent input
+	avg := Embedding{
 		Vector:  avgVector,
 		Quality: avgQuality,
 		Angle:   "averaged",
 	}
+	for _, emb := range embeddings {
+		if !emb.CapturedAt.Before(avg.CapturedAt) {
+			avg.CapturedAt, avg.Device = emb.CapturedAt, emb.Device
+		}
+	}
+	return avg
+}
+
+// minOutlierEmbeddings is the fewest embeddings RejectOutliers filters; with
+// two there is no majority to tell which one drifted.
+const minOutlierEmbeddings = 3
+
+// RejectOutliers drops the embeddings farther than maxDistance from the
+// component-wise median of all of them, e.g. from frames where detection
+// drifted onto the background or a partially visible face. Averaging the
+// remaining embeddings is then not dragged off by a few bad frames.
+// Embeddings are returned unchanged if maxDistance is not positive, there are
+// fewer than three, or all of them would be dropped.
+func RejectOutliers(embeddings []Embedding, maxDistance float64) []Embedding {
+	if maxDistance <= 0 || len(embeddings) < minOutlierEmbeddings {
+		return embeddings
+	}
+
+	// The median is not pulled towards the outliers like the mean is
+	var median Descriptor
+	values := make([]float32, len(embeddings))
+	for i := range median {
+		for j, emb := range embeddings {
+			values[j] = emb.Vector[i]
+		}
+		sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+		mid := len(values) / 2
+		median[i] = values[mid]
+		if len(values)%2 == 0 {
+			median[i] = (values[mid-1] + values[mid]) / 2
+		}
+	}
+
+	kept := make([]Embedding, 0, len(embeddings))
+	for _, emb := range embeddings {
+		if EuclideanDistance(emb.Vector, median) <= maxDistance {
+			kept = append(kept, emb)
+		}
+	}
+	if len(kept) == 0 {
+		return embeddings
+	}
+	if dropped := len(embeddings) - len(kept); dropped > 0 {
+		logging.Debugf("Rejected %d of %d embeddings farther than %.2f from the median", dropped, len(embeddings), maxDistance)
+	}
+	return kept
+}
+
+// NormalizeEmbedding returns a copy of the embedding scaled to unit L2 norm.
+// A zero vector is returned unchanged.
+func NormalizeEmbedding(e Embedding) Embedding {
+	var sum float64
+	for _, v := range e.Vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return e
+	}
+
+	norm := float32(math.Sqrt(sum))
+	for i := range e.Vector {
+		e.Vector[i] /= norm
+	}
+	return e
+}
+
+// AverageNormalizedEmbedding normalizes each embedding, averages them, and
+// normalizes the result. Unlike AverageEmbedding it is not biased toward
+// embeddings with longer vectors.
+func AverageNormalizedEmbedding(embeddings []Embedding) Embedding {
+	normalized := make([]Embedding, len(embeddings))
+	for i, emb := range embeddings {
+		normalized[i] = NormalizeEmbedding(emb)
+	}
+	return NormalizeEmbedding(AverageEmbedding(normalized))
 }
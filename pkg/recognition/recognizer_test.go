@@ -1,9 +1,12 @@
 package recognition
 
 import (
+	"encoding/json"
 	"errors"
 	"image"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/Kagami/go-face"
 )
@@ -73,6 +76,81 @@ func TestEuclideanDistance(t *testing.T) {
 	}
 }
 
+func TestCountMatches(t *testing.T) {
+	probe := Embedding{Vector: Descriptor{0}}
+	gallery := []Embedding{
+		{Vector: Descriptor{0.1}},
+		{Vector: Descriptor{0.3}},
+		{Vector: Descriptor{0.39}},
+		{Vector: Descriptor{0.5}},
+	}
+
+	if got := CountMatches(probe, gallery, 0.4); got != 3 {
+		t.Errorf("CountMatches() = %d, want 3", got)
+	}
+	if got := CountMatches(probe, gallery, 0.2); got != 1 {
+		t.Errorf("CountMatches() with tolerance 0.2 = %d, want 1", got)
+	}
+	if got := CountMatches(probe, nil, 0.4); got != 0 {
+		t.Errorf("CountMatches() with empty gallery = %d, want 0", got)
+	}
+}
+
+func TestEmbedding_UnmarshalJSON(t *testing.T) {
+	orig := Embedding{Quality: 0.9, Angle: "left"}
+	orig.Vector[0], orig.Vector[DescriptorSize-1] = 0.25, -0.5
+	data, err := json.Marshal(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Embedding
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded != orig {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, orig)
+	}
+
+	// Capture metadata round-trips; data written before it existed leaves it zero
+	orig.MarkCaptured("/dev/video2")
+	data, _ = json.Marshal(orig)
+	decoded = Embedding{}
+	if err := json.Unmarshal(data, &decoded); err != nil || !decoded.CapturedAt.Equal(orig.CapturedAt) || decoded.Device != "/dev/video2" {
+		t.Errorf("Unmarshal() with capture metadata = %+v, %v", decoded, err)
+	}
+	legacy, _ := json.Marshal(make([]float32, DescriptorSize))
+	decoded = Embedding{}
+	if err := json.Unmarshal([]byte(`{"vector":`+string(legacy)+`,"quality":0.9,"angle":"front"}`), &decoded); err != nil || !decoded.CapturedAt.IsZero() || decoded.Device != "" {
+		t.Errorf("Unmarshal() of legacy embedding = %+v, %v", decoded, err)
+	}
+
+	for _, dims := range []int{0, 1, 512} {
+		vector, _ := json.Marshal(make([]float32, dims))
+		data := []byte(`{"vector":` + string(vector) + `,"quality":0.9,"angle":"front"}`)
+		if err := json.Unmarshal(data, &decoded); !errors.Is(err, ErrIncompatibleEmbedding) {
+			t.Errorf("Unmarshal() with %d dimensions error = %v, want ErrIncompatibleEmbedding", dims, err)
+		}
+	}
+}
+
+func TestValidateEmbeddings(t *testing.T) {
+	valid := Embedding{Vector: Descriptor{0.1, 0.2}}
+	if err := ValidateEmbeddings([]Embedding{valid, {}}); err != nil {
+		t.Errorf("ValidateEmbeddings() error = %v", err)
+	}
+
+	invalid := valid
+	invalid.Vector[5] = float32(math.NaN())
+	if err := ValidateEmbeddings([]Embedding{valid, invalid}); !errors.Is(err, ErrIncompatibleEmbedding) {
+		t.Errorf("ValidateEmbeddings() with NaN error = %v, want ErrIncompatibleEmbedding", err)
+	}
+	invalid.Vector[5] = float32(math.Inf(1))
+	if err := invalid.Validate(); !errors.Is(err, ErrIncompatibleEmbedding) {
+		t.Errorf("Validate() with Inf error = %v, want ErrIncompatibleEmbedding", err)
+	}
+}
+
 func TestAverageEmbedding(t *testing.T) {
 	d1 := Descriptor{1, 2, 3}
 	d2 := Descriptor{3, 4, 5}
@@ -82,9 +160,10 @@ func TestAverageEmbedding(t *testing.T) {
 		d2[i] = 0
 	}
 
+	captured := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
 	embeddings := []Embedding{
-		{Vector: d1},
-		{Vector: d2},
+		{Vector: d1, CapturedAt: captured, Device: "/dev/video2"},
+		{Vector: d2, CapturedAt: captured.Add(-time.Second), Device: "/dev/video0"},
 	}
 
 	avg := AverageEmbedding(embeddings)
@@ -92,6 +171,42 @@ func TestAverageEmbedding(t *testing.T) {
 	if avg.Vector[0] != 2.0 || avg.Vector[1] != 3.0 || avg.Vector[2] != 4.0 {
 		t.Errorf("expected [2, 3, 4], got [%f, %f, %f]", avg.Vector[0], avg.Vector[1], avg.Vector[2])
 	}
+	if !avg.CapturedAt.Equal(captured) || avg.Device != "/dev/video2" {
+		t.Errorf("expected capture metadata of the latest embedding, got %v %q", avg.CapturedAt, avg.Device)
+	}
+}
+
+func TestRejectOutliers(t *testing.T) {
+	good := []Embedding{
+		{Vector: Descriptor{1, 2, 3}},
+		{Vector: Descriptor{1.05, 2, 3}},
+		{Vector: Descriptor{1, 2.05, 3}},
+	}
+	drifted := Embedding{Vector: Descriptor{4, -1, 0}}
+
+	kept := RejectOutliers(append(append([]Embedding{}, good...), drifted), 0.3)
+	if len(kept) != len(good) {
+		t.Fatalf("RejectOutliers() kept %d embeddings, want %d", len(kept), len(good))
+	}
+	for _, emb := range kept {
+		if emb.Vector == drifted.Vector {
+			t.Error("RejectOutliers() kept the drifted embedding")
+		}
+	}
+
+	// Disabled, too few to tell, or everything far apart: unchanged
+	for name, tt := range map[string]struct {
+		embeddings  []Embedding
+		maxDistance float64
+	}{
+		"disabled":  {append(good, drifted), 0},
+		"two":       {[]Embedding{good[0], drifted}, 0.3},
+		"all apart": {[]Embedding{good[0], drifted, {Vector: Descriptor{-5, 5, -5}}}, 0.01},
+	} {
+		if got := RejectOutliers(tt.embeddings, tt.maxDistance); len(got) != len(tt.embeddings) {
+			t.Errorf("%s: RejectOutliers() kept %d of %d embeddings", name, len(got), len(tt.embeddings))
+		}
+	}
 }
 
 func TestMatch(t *testing.T) {
@@ -191,6 +306,100 @@ func TestDetectFaces(t *testing.T) {
 	}
 }
 
+func TestDetectFaces_Detector(t *testing.T) {
+	oneFace := []face.Face{{Rectangle: image.Rect(0, 0, 100, 100), Descriptor: face.Descriptor{1}}}
+	var used string
+	cnnEngine := &MockCNNEngine{
+		MockFaceEngine: MockFaceEngine{RecognizeFunc: func(data []byte) ([]face.Face, error) {
+			used = DetectorHOG
+			return oneFace, nil
+		}},
+		RecognizeCNNFunc: func(data []byte) ([]face.Face, error) {
+			used = DetectorCNN
+			return oneFace, nil
+		},
+	}
+	hogOnly := &MockFaceEngine{RecognizeFunc: func(data []byte) ([]face.Face, error) {
+		used = DetectorHOG
+		return oneFace, nil
+	}}
+
+	tests := []struct {
+		name     string
+		engine   FaceEngine
+		detector string
+		want     string
+	}{
+		{name: "default", engine: cnnEngine, detector: "", want: DetectorHOG},
+		{name: "hog", engine: cnnEngine, detector: DetectorHOG, want: DetectorHOG},
+		{name: "cnn", engine: cnnEngine, detector: DetectorCNN, want: DetectorCNN},
+		{name: "cnn unsupported", engine: hogOnly, detector: DetectorCNN, want: DetectorHOG},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRecognizer()
+			r.factory = func(path string) (FaceEngine, error) { return tt.engine, nil }
+			r.SetDetector(tt.detector)
+			_ = r.LoadModels("dummy")
+
+			used = ""
+			if _, err := r.DetectFaces([]byte("image")); err != nil {
+				t.Fatalf("DetectFaces() error = %v", err)
+			}
+			if used != tt.want {
+				t.Errorf("DetectFaces() used the %q detector, want %q", used, tt.want)
+			}
+
+			used = ""
+			if _, err := r.DetectFacesImage(image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+				t.Fatalf("DetectFacesImage() error = %v", err)
+			}
+			if used != tt.want {
+				t.Errorf("DetectFacesImage() used the %q detector, want %q", used, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	r := NewRecognizer()
+	if err := r.WarmUp(); !errors.Is(err, ErrModelNotLoaded) {
+		t.Fatalf("WarmUp() before loading: error = %v, want ErrModelNotLoaded", err)
+	}
+
+	var calls int
+	var decoded image.Image
+	engine := &MockCNNEngine{
+		MockFaceEngine: MockFaceEngine{RecognizeFunc: func(data []byte) ([]face.Face, error) {
+			calls++
+			decoded = decodeImage(data)
+			return nil, nil
+		}},
+		RecognizeCNNFunc: func(data []byte) ([]face.Face, error) {
+			return nil, errors.New("out of memory")
+		},
+	}
+	r.factory = func(path string) (FaceEngine, error) { return engine, nil }
+	_ = r.LoadModels("dummy")
+
+	// Finding no face is the expected outcome
+	if err := r.WarmUp(); err != nil {
+		t.Fatalf("WarmUp() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected one inference, got %d", calls)
+	}
+	if decoded == nil || decoded.Bounds().Dx() != warmUpWidth || decoded.Bounds().Dy() != warmUpHeight {
+		t.Errorf("expected a decodable %dx%d warm-up image", warmUpWidth, warmUpHeight)
+	}
+
+	// The selected detector is the one warmed up, and its errors are reported
+	r.SetDetector(DetectorCNN)
+	if err := r.WarmUp(); err == nil {
+		t.Error("expected the CNN detector's error from WarmUp()")
+	}
+}
+
 func TestDetectFaces_NotLoaded(t *testing.T) {
 	r := NewRecognizer()
 	_, err := r.DetectFaces([]byte("image"))
@@ -354,3 +563,244 @@ func TestFindBestMatch(t *testing.T) {
 		t.Errorf("Expected -1 for empty gallery, got %d", idx)
 	}
 }
+
+func TestFindBestMatch_MinQuality(t *testing.T) {
+	r := NewRecognizer()
+	r.SetMinQuality(0.5)
+
+	probe := Embedding{Vector: face.Descriptor{1, 0, 0}}
+	gallery := []Embedding{
+		{Vector: face.Descriptor{1, 0.05, 0}, Quality: 0.2}, // Closest, but too low quality
+		{Vector: face.Descriptor{1, 0.2, 0}, Quality: 0.9},
+	}
+
+	idx, _, match := r.FindBestMatch(probe, gallery)
+	if idx != 1 || !match {
+		t.Errorf("FindBestMatch() = %d, %v, want 1, true", idx, match)
+	}
+
+	// If every embedding is below the minimum, all are used
+	gallery[1].Quality = 0.1
+	idx, _, _ = r.FindBestMatch(probe, gallery)
+	if idx != 0 {
+		t.Errorf("FindBestMatch() with all low quality = %d, want 0", idx)
+	}
+}
+
+func TestNormalizeEmbedding(t *testing.T) {
+	emb := NormalizeEmbedding(Embedding{Vector: face.Descriptor{3, 4}, Angle: "front"})
+	if emb.Vector[0] != 0.6 || emb.Vector[1] != 0.8 {
+		t.Errorf("NormalizeEmbedding() = %v, want [0.6 0.8 ...]", emb.Vector[:2])
+	}
+	if emb.Angle != "front" {
+		t.Error("NormalizeEmbedding() should preserve metadata")
+	}
+	if n := EuclideanDistance(emb.Vector, Descriptor{}); math.Abs(n-1) > 1e-6 {
+		t.Errorf("norm = %f, want 1", n)
+	}
+
+	zero := NormalizeEmbedding(Embedding{})
+	if zero.Vector != (Descriptor{}) {
+		t.Error("zero vector should stay zero")
+	}
+}
+
+func TestAverageNormalizedEmbedding(t *testing.T) {
+	// A long vector would dominate a naive average
+	embeddings := []Embedding{
+		{Vector: face.Descriptor{100, 0}},
+		{Vector: face.Descriptor{0, 1}},
+	}
+
+	avg := AverageNormalizedEmbedding(embeddings)
+	if n := EuclideanDistance(avg.Vector, Descriptor{}); math.Abs(n-1) > 1e-6 {
+		t.Errorf("norm = %f, want 1", n)
+	}
+	if math.Abs(float64(avg.Vector[0]-avg.Vector[1])) > 1e-6 {
+		t.Errorf("AverageNormalizedEmbedding() = %v, want equal components", avg.Vector[:2])
+	}
+}
+
+func TestCompareFaces_Normalized(t *testing.T) {
+	r := NewRecognizer()
+	a := Embedding{Vector: face.Descriptor{2, 0}}
+	b := Embedding{Vector: face.Descriptor{1, 0}}
+
+	if d := r.CompareFaces(a, b); d != 1 {
+		t.Errorf("unnormalized distance = %f, want 1", d)
+	}
+
+	r.SetNormalize(true)
+	if d := r.CompareFaces(a, b); d != 0 {
+		t.Errorf("normalized distance = %f, want 0", d)
+	}
+}
+
+func TestDetectFacesBatch(t *testing.T) {
+	r := NewRecognizer()
+	if _, err := r.DetectFacesBatch([][]byte{[]byte("a")}); err != ErrModelNotLoaded {
+		t.Errorf("Expected ErrModelNotLoaded, got %v", err)
+	}
+
+	mockEngine := &MockFaceEngine{
+		RecognizeFunc: func(data []byte) ([]face.Face, error) {
+			switch string(data) {
+			case "face":
+				return []face.Face{{Rectangle: image.Rect(0, 0, 100, 100)}}, nil
+			case "error":
+				return nil, errors.New("engine error")
+			default:
+				return nil, nil
+			}
+		},
+	}
+	r.factory = func(path string) (FaceEngine, error) {
+		return mockEngine, nil
+	}
+	_ = r.LoadModels("dummy")
+
+	images := [][]byte{[]byte("face"), []byte("none"), []byte("error"), []byte("face")}
+	results, err := r.DetectFacesBatch(images)
+	if err != nil {
+		t.Fatalf("DetectFacesBatch failed: %v", err)
+	}
+	if len(results) != len(images) {
+		t.Fatalf("Expected %d results, got %d", len(images), len(results))
+	}
+	for i, want := range []int{1, 0, 0, 1} {
+		if len(results[i]) != want {
+			t.Errorf("image %d: expected %d face(s), got %d", i, want, len(results[i]))
+		}
+	}
+}
+
+// slowEngine simulates the fixed per-call cost of the dlib recognizer.
+func slowEngine() *MockFaceEngine {
+	return &MockFaceEngine{
+		RecognizeFunc: func(data []byte) ([]face.Face, error) {
+			time.Sleep(time.Millisecond)
+			return []face.Face{{Rectangle: image.Rect(0, 0, 100, 100)}}, nil
+		},
+	}
+}
+
+func benchmarkImages() [][]byte {
+	images := make([][]byte, 10)
+	for i := range images {
+		images[i] = []byte("frame")
+	}
+	return images
+}
+
+func BenchmarkDetectFaces_PerFrame(b *testing.B) {
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) { return slowEngine(), nil }
+	_ = r.LoadModels("dummy")
+	images := benchmarkImages()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, img := range images {
+			_, _ = r.DetectSingleFace(img)
+		}
+	}
+}
+
+func BenchmarkDetectFacesBatch(b *testing.B) {
+	r := NewRecognizer()
+	r.factory = func(path string) (FaceEngine, error) { return slowEngine(), nil }
+	_ = r.LoadModels("dummy")
+	images := benchmarkImages()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = r.DetectFacesBatch(images)
+	}
+}
+
+func TestDetectFaces_MinFaceSize(t *testing.T) {
+	r := NewRecognizer()
+	r.SetMinFaceSize(80)
+	r.factory = func(path string) (FaceEngine, error) {
+		return &MockFaceEngine{
+			RecognizeFunc: func(data []byte) ([]face.Face, error) {
+				if string(data) == "far" {
+					return []face.Face{{Rectangle: image.Rect(0, 0, 40, 40)}}, nil
+				}
+				return []face.Face{
+					{Rectangle: image.Rect(0, 0, 40, 40)},
+					{Rectangle: image.Rect(100, 100, 220, 220)},
+				}, nil
+			},
+		}, nil
+	}
+	_ = r.LoadModels("dummy")
+
+	if _, err := r.DetectFaces([]byte("far")); err != ErrFaceTooSmall {
+		t.Errorf("Expected ErrFaceTooSmall, got %v", err)
+	}
+
+	// The small background face is ignored, leaving a single face
+	f, err := r.DetectSingleFace([]byte("mixed"))
+	if err != nil {
+		t.Fatalf("DetectSingleFace failed: %v", err)
+	}
+	if f.BoundingBox.Width != 120 {
+		t.Errorf("Expected the 120px face, got width %d", f.BoundingBox.Width)
+	}
+}
+
+func TestCompareFaceSets(t *testing.T) {
+	probe := []Embedding{
+		{Vector: face.Descriptor{0, 0}},
+		{Vector: face.Descriptor{1, 0}},
+	}
+	gallery := []Embedding{
+		{Vector: face.Descriptor{0, 1}},
+		{Vector: face.Descriptor{0, 3}},
+	}
+
+	// Distances: 1, 3, sqrt(2), sqrt(10)
+	minDist, meanDist := CompareFaceSets(probe, gallery)
+	if minDist != 1 {
+		t.Errorf("minDist = %f, want 1", minDist)
+	}
+	want := (1 + 3 + math.Sqrt2 + math.Sqrt(10)) / 4
+	if math.Abs(meanDist-want) > 1e-6 {
+		t.Errorf("meanDist = %f, want %f", meanDist, want)
+	}
+
+	minDist, meanDist = CompareFaceSets(nil, gallery)
+	if minDist != math.MaxFloat64 || meanDist != math.MaxFloat64 {
+		t.Errorf("empty probe = %f, %f, want MaxFloat64", minDist, meanDist)
+	}
+}
+
+func TestCheckFaceInFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		box    Rectangle
+		margin int
+		want   error
+	}{
+		{"centered", Rectangle{X: 200, Y: 100, Width: 200, Height: 200}, 10, nil},
+		{"left edge", Rectangle{X: 5, Y: 100, Width: 200, Height: 200}, 10, ErrFaceAtEdge},
+		{"bottom edge", Rectangle{X: 200, Y: 300, Width: 200, Height: 200}, 10, ErrFaceAtEdge},
+		{"partially outside", Rectangle{X: -20, Y: 100, Width: 200, Height: 200}, 10, ErrFaceAtEdge},
+		{"check disabled", Rectangle{X: 0, Y: 0, Width: 200, Height: 200}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Face{BoundingBox: tt.box}
+			if err := CheckFaceInFrame(f, 640, 480, tt.margin); err != tt.want {
+				t.Errorf("CheckFaceInFrame() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Unknown frame size disables the check
+	if err := CheckFaceInFrame(&Face{}, 0, 0, 10); err != nil {
+		t.Errorf("CheckFaceInFrame() with unknown size = %v, want nil", err)
+	}
+}
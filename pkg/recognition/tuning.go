@@ -0,0 +1,109 @@
+package recognition
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultTuningTolerances are the tolerances a TuningReport is evaluated at
+// unless others are given.
+var DefaultTuningTolerances = []float64{0.30, 0.35, 0.40, 0.45, 0.50, 0.55, 0.60}
+
+// OperatingPoint holds the error rates of one tolerance.
+type OperatingPoint struct {
+	Tolerance float64
+	FAR       float64 // Share of impostor comparisons that would be accepted
+	FRR       float64 // Share of genuine comparisons that would be rejected
+}
+
+// TuningReport collects best-match distances of labeled probes against
+// enrolled users, split into genuine (probe and user are the same person) and
+// impostor comparisons, to choose recognition.tolerance from evidence.
+type TuningReport struct {
+	Genuine  []float64
+	Impostor []float64
+}
+
+// Add records the best-match distance of a probe against one user's gallery,
+// e.g. as returned by FindBestMatch.
+func (r *TuningReport) Add(distance float64, genuine bool) {
+	if genuine {
+		r.Genuine = append(r.Genuine, distance)
+	} else {
+		r.Impostor = append(r.Impostor, distance)
+	}
+}
+
+// At returns the error rates at tolerance. As in matching, a distance below
+// the tolerance is accepted. Rates without comparisons of that kind are NaN.
+func (r *TuningReport) At(tolerance float64) OperatingPoint {
+	rejected := 0
+	for _, d := range r.Genuine {
+		if d >= tolerance {
+			rejected++
+		}
+	}
+	accepted := 0
+	for _, d := range r.Impostor {
+		if d < tolerance {
+			accepted++
+		}
+	}
+	return OperatingPoint{
+		Tolerance: tolerance,
+		FAR:       rate(accepted, len(r.Impostor)),
+		FRR:       rate(rejected, len(r.Genuine)),
+	}
+}
+
+// OperatingPoints evaluates the report at each tolerance.
+func (r *TuningReport) OperatingPoints(tolerances []float64) []OperatingPoint {
+	points := make([]OperatingPoint, 0, len(tolerances))
+	for _, tolerance := range tolerances {
+		points = append(points, r.At(tolerance))
+	}
+	return points
+}
+
+// ZeroFAR returns the most lenient tolerance that accepts no impostor
+// comparison: the smallest impostor distance. It reports false if there are
+// no impostor comparisons.
+func (r *TuningReport) ZeroFAR() (OperatingPoint, bool) {
+	if len(r.Impostor) == 0 {
+		return OperatingPoint{}, false
+	}
+	minImpostor := math.MaxFloat64
+	for _, d := range r.Impostor {
+		minImpostor = math.Min(minImpostor, d)
+	}
+	return r.At(minImpostor), true
+}
+
+// EqualError returns the observed distance at which FAR and FRR are closest,
+// a balanced operating point. It reports false unless both genuine and
+// impostor comparisons were recorded.
+func (r *TuningReport) EqualError() (OperatingPoint, bool) {
+	if len(r.Genuine) == 0 || len(r.Impostor) == 0 {
+		return OperatingPoint{}, false
+	}
+
+	candidates := append(append([]float64{}, r.Genuine...), r.Impostor...)
+	sort.Float64s(candidates)
+
+	var best OperatingPoint
+	bestGap := math.MaxFloat64
+	for _, tolerance := range candidates {
+		point := r.At(tolerance)
+		if gap := math.Abs(point.FAR - point.FRR); gap < bestGap {
+			best, bestGap = point, gap
+		}
+	}
+	return best, true
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return math.NaN()
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,49 @@
+package recognition
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTuningReport(t *testing.T) {
+	var r TuningReport
+	for _, d := range []float64{0.20, 0.30, 0.35, 0.50} {
+		r.Add(d, true)
+	}
+	for _, d := range []float64{0.45, 0.55, 0.60, 0.70} {
+		r.Add(d, false)
+	}
+
+	points := r.OperatingPoints([]float64{0.40, 0.60})
+	if p := points[0]; p.FAR != 0 || p.FRR != 0.25 {
+		t.Errorf("At(0.40) = %+v, want FAR 0, FRR 0.25", p)
+	}
+	if p := points[1]; p.FAR != 0.5 || p.FRR != 0 {
+		t.Errorf("At(0.60) = %+v, want FAR 0.5, FRR 0", p)
+	}
+
+	zero, ok := r.ZeroFAR()
+	if !ok || zero.Tolerance != 0.45 || zero.FAR != 0 || zero.FRR != 0.25 {
+		t.Errorf("ZeroFAR() = %+v, %t, want tolerance 0.45 with FRR 0.25", zero, ok)
+	}
+
+	eer, ok := r.EqualError()
+	if !ok || math.Abs(eer.FAR-eer.FRR) > 0.25 {
+		t.Errorf("EqualError() = %+v, %t", eer, ok)
+	}
+}
+
+func TestTuningReport_Empty(t *testing.T) {
+	var r TuningReport
+	r.Add(0.3, true)
+
+	if p := r.At(0.4); !math.IsNaN(p.FAR) || p.FRR != 0 {
+		t.Errorf("At() without impostors = %+v, want FAR NaN", p)
+	}
+	if _, ok := r.ZeroFAR(); ok {
+		t.Error("ZeroFAR() without impostors should report false")
+	}
+	if _, ok := r.EqualError(); ok {
+		t.Error("EqualError() without impostors should report false")
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// Backend types selectable via storage.backend.
+const (
+	BackendFile   = "file"
+	BackendSQLite = "sqlite"
+)
+
+// Backend is the interface implemented by all face data stores.
+type Backend interface {
+	SaveUser(user UserFaceData) error
+	LoadUser(username string) (*UserFaceData, error)
+	DeleteUser(username string) error
+	ListUsers() ([]string, error)
+	UserExists(username string) bool
+	CreateUser(username string, embeddings []recognition.Embedding, metadata map[string]string) error
+	GetAllEmbeddings(username string) ([]recognition.Embedding, error)
+	CountEmbeddings(username string) (int, error)
+	Stats() (users int, totalEmbeddings int, err error)
+	AddEmbedding(username string, embedding recognition.Embedding) error
+	AddEmbeddingWithLimit(username string, embedding recognition.Embedding, maxEmbeddings int) error
+	AddEmbeddingToProfile(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error
+	UpdateLastUsed(username string) error
+	UpdateUser(username string, fn func(*UserFaceData) error) error
+	MigrateUser(username string) (bool, error)
+	RotateKey(oldKey, newKey [KeySize]byte) error
+}
+
+// RemoveAll deletes every user listed by b. A user that cannot be deleted is
+// reported in failed and does not stop the others; err is only set if the
+// users cannot be listed.
+func RemoveAll(b Backend) (removed []string, failed map[string]error, err error) {
+	users, err := b.ListUsers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	failed = make(map[string]error)
+	for _, username := range users {
+		if err := b.DeleteUser(username); err != nil {
+			failed[username] = err
+			continue
+		}
+		removed = append(removed, username)
+	}
+	return removed, failed, nil
+}
+
+// Options configures NewBackend.
+type Options struct {
+	Backend           string // "file" (default) or "sqlite"
+	DataDir           string
+	EncryptionEnabled bool
+	KeySource         KeySource
+	KeyFile           string
+	Compress          bool
+	LastUsedInterval  time.Duration // Minimum time between LastUsed writes
+}
+
+// NewBackend creates the storage backend selected by opts.Backend.
+func NewBackend(opts Options) (Backend, error) {
+	switch opts.Backend {
+	case BackendFile, "":
+		fs, err := NewFileStorageWithKeySource(opts.DataDir, opts.EncryptionEnabled, opts.KeySource, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		fs.SetCompression(opts.Compress)
+		fs.SetLastUsedInterval(opts.LastUsedInterval)
+		return fs, nil
+	case BackendSQLite:
+		s, err := NewSQLiteStorage(opts.DataDir, opts.EncryptionEnabled, opts.KeySource, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.SetCompression(opts.Compress)
+		s.SetLastUsedInterval(opts.LastUsedInterval)
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", opts.Backend)
+	}
+}
@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupVersion is the manifest version written by Backup.
+const BackupVersion = 1
+
+const (
+	// backupManifestName is the archive entry holding the BackupManifest
+	backupManifestName = "manifest.json"
+	// maxBackupEntrySize bounds the size of a single archive entry read by RestoreAll
+	maxBackupEntrySize = 256 << 20
+)
+
+// ErrInvalidBackup is returned when a backup archive is damaged or was not
+// written by Backup.
+var ErrInvalidBackup = errors.New("invalid backup archive")
+
+// ErrRestoreConflict is returned when a restore would overwrite existing face data.
+var ErrRestoreConflict = errors.New("restore would overwrite existing face data")
+
+// BackupManifest describes the contents of a backup archive.
+type BackupManifest struct {
+	Version        int       `json:"version"`
+	Created        time.Time `json:"created"`
+	Backend        string    `json:"backend"`
+	Encrypted      bool      `json:"encrypted"`
+	KeyFingerprint string    `json:"key_fingerprint,omitempty"` // Key the data is encrypted with
+	Users          []string  `json:"users"`
+	Files          []string  `json:"files"` // Archive entries, relative to the data directory
+}
+
+// KeyMatches reports whether data in the backup can be decrypted with key.
+// It returns true for unencrypted backups.
+func (m *BackupManifest) KeyMatches(key [KeySize]byte) bool {
+	return !m.Encrypted || m.KeyFingerprint == "" || m.KeyFingerprint == KeyFingerprint(key)
+}
+
+// backendName returns the canonical name of the backend selected by opts.
+func backendName(opts Options) string {
+	if opts.Backend == "" {
+		return BackendFile
+	}
+	return opts.Backend
+}
+
+// Backup writes all face data of the storage selected by opts to w as a
+// gzip-compressed tar archive with a manifest. The data is copied as stored,
+// so encrypted data stays encrypted with the current key and can only be
+// restored where the same key is available.
+func Backup(opts Options, w io.Writer) (*BackupManifest, error) {
+	b, err := NewBackend(opts)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := b.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	users, err := b.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(users)
+
+	var files map[string][]byte
+	var fingerprint string
+	var key [KeySize]byte
+	switch s := b.(type) {
+	case *FileStorage:
+		files, err = s.backupFiles(users)
+		fingerprint, key = s.storedFingerprint(), s.encryptionKey
+	case *SQLiteStorage:
+		files, err = s.backupFiles()
+		fingerprint, key = s.storedFingerprint(), s.encryptionKey
+	default:
+		err = fmt.Errorf("backup is not supported by the %s backend", backendName(opts))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.EncryptionEnabled && fingerprint == "" {
+		fingerprint = KeyFingerprint(key)
+	}
+
+	manifest := &BackupManifest{
+		Version:        BackupVersion,
+		Created:        time.Now().UTC(),
+		Backend:        backendName(opts),
+		Encrypted:      opts.EncryptionEnabled,
+		KeyFingerprint: fingerprint,
+		Users:          users,
+	}
+	for name := range files {
+		manifest.Files = append(manifest.Files, name)
+	}
+	sort.Strings(manifest.Files)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeEntry := func(name string, data []byte) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: manifest.Created,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := writeEntry(backupManifestName, manifestData); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	for _, name := range manifest.Files {
+		if err := writeEntry(name, files[name]); err != nil {
+			return nil, fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// backupFiles reads the stored files of users and the key fingerprint.
+func (fs *FileStorage) backupFiles(users []string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, username := range users {
+		for _, ext := range []string{".json", ".enc"} {
+			name := path.Join("users", username+ext)
+			data, err := os.ReadFile(filepath.Join(fs.dataDir, filepath.FromSlash(name)))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read user data: %w", err)
+			}
+			files[name] = data
+		}
+	}
+
+	data, err := os.ReadFile(fs.fingerprintPath())
+	if err == nil {
+		files[keyFingerprintFile] = data
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read key fingerprint: %w", err)
+	}
+	return files, nil
+}
+
+// backupFiles returns a consistent copy of the database, taken with
+// VACUUM INTO so concurrent writers cannot leave it half-written.
+func (s *SQLiteStorage) backupFiles() (map[string][]byte, error) {
+	var dbPath string
+	if err := s.db.QueryRow(`SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&dbPath); err != nil {
+		return nil, fmt.Errorf("failed to locate database: %w", err)
+	}
+
+	// Snapshot next to the database so it never leaves the data directory
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dbPath), ".backup-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, SQLiteDatabaseFile)
+	if _, err := s.db.Exec(`VACUUM INTO ?`, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database snapshot: %w", err)
+	}
+	return map[string][]byte{SQLiteDatabaseFile: data}, nil
+}
+
+// validBackupEntry reports whether name may be restored for the backend.
+// Anything else, in particular paths leaving the data directory, is rejected.
+func validBackupEntry(backend, name string) bool {
+	switch backend {
+	case BackendSQLite:
+		return name == SQLiteDatabaseFile
+	case BackendFile:
+		if name == keyFingerprintFile {
+			return true
+		}
+		dir, file := path.Split(name)
+		ext := path.Ext(file)
+		if dir != "users/" || (ext != ".json" && ext != ".enc") {
+			return false
+		}
+		return ValidateUsername(strings.TrimSuffix(file, ext)) == nil
+	}
+	return false
+}
+
+// readBackup reads and checks the manifest and all entries of a backup archive.
+func readBackup(r io.Reader) (*BackupManifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidBackup, header.Name)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxBackupEntrySize+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if len(data) > maxBackupEntrySize {
+			return nil, nil, fmt.Errorf("%w: entry %s is too large", ErrInvalidBackup, header.Name)
+		}
+		entries[header.Name] = data
+	}
+
+	manifestData, ok := entries[backupManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, backupManifestName)
+	}
+	delete(entries, backupManifestName)
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to parse manifest: %v", ErrInvalidBackup, err)
+	}
+	if manifest.Version < 1 || manifest.Version > BackupVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, manifest.Version)
+	}
+
+	for name := range entries {
+		if !validBackupEntry(manifest.Backend, name) {
+			return nil, nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidBackup, name)
+		}
+	}
+	for _, name := range manifest.Files {
+		if _, ok := entries[name]; !ok {
+			return nil, nil, fmt.Errorf("%w: missing %s", ErrInvalidBackup, name)
+		}
+	}
+
+	return &manifest, entries, nil
+}
+
+// RestoreAll restores a backup written by Backup into the storage selected
+// by opts. The whole archive is checked before anything is written. Existing
+// face data that the backup would replace is only overwritten if overwrite
+// is set; other users are kept.
+//
+// The data is restored as stored, so encrypted data can only be read if the
+// configured key matches the backup (see BackupManifest.KeyMatches).
+func RestoreAll(opts Options, r io.Reader, overwrite bool) (*BackupManifest, error) {
+	manifest, entries, err := readBackup(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.Backend != backendName(opts) {
+		return nil, fmt.Errorf("backup was made with the %s backend, but storage.backend is %s", manifest.Backend, backendName(opts))
+	}
+	if manifest.Encrypted != opts.EncryptionEnabled {
+		return nil, fmt.Errorf("backup encryption (%t) does not match storage.encryption_enabled (%t)", manifest.Encrypted, opts.EncryptionEnabled)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !overwrite {
+		for _, name := range names {
+			if name == keyFingerprintFile {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(opts.DataDir, filepath.FromSlash(name))); err == nil {
+				return nil, fmt.Errorf("%w: %s exists", ErrRestoreConflict, name)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(opts.DataDir, "users"), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create users directory: %w", err)
+	}
+	for _, name := range names {
+		if err := writeFileAtomic(filepath.Join(opts.DataDir, filepath.FromSlash(name)), entries[name], 0600); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+	}
+
+	return manifest, nil
+}
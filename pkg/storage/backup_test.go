@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for _, backend := range []string{BackendFile, BackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			t.Setenv(KeyEnvVar, strings.Repeat("06", KeySize))
+			opts := Options{Backend: backend, DataDir: t.TempDir(), EncryptionEnabled: true, KeySource: KeySourceEnv}
+
+			b, err := NewBackend(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, username := range []string{"alice", "bob"} {
+				embedding := recognition.Embedding{Vector: recognition.Descriptor{float32(i + 1)}}
+				if err := b.CreateUser(username, []recognition.Embedding{embedding}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var archive bytes.Buffer
+			manifest, err := Backup(opts, &archive)
+			if err != nil {
+				t.Fatalf("Backup() error = %v", err)
+			}
+			if manifest.Backend != backend || len(manifest.Users) != 2 || !manifest.Encrypted {
+				t.Errorf("manifest = %+v", manifest)
+			}
+
+			key, _ := ResolveKey(KeySourceEnv, "")
+			if !manifest.KeyMatches(key) {
+				t.Error("KeyMatches() = false for the backup key")
+			}
+			if manifest.KeyMatches([KeySize]byte{1}) {
+				t.Error("KeyMatches() = true for another key")
+			}
+
+			restoreOpts := opts
+			restoreOpts.DataDir = t.TempDir()
+			if _, err := RestoreAll(restoreOpts, bytes.NewReader(archive.Bytes()), false); err != nil {
+				t.Fatalf("RestoreAll() error = %v", err)
+			}
+			restored, err := NewBackend(restoreOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, err := restored.LoadUser("bob")
+			if err != nil || user.Embeddings[0].Vector[0] != 2 {
+				t.Errorf("restored LoadUser() = %+v, %v", user, err)
+			}
+
+			// The restored data is only replaced on request
+			if _, err := RestoreAll(restoreOpts, bytes.NewReader(archive.Bytes()), false); !errors.Is(err, ErrRestoreConflict) {
+				t.Errorf("RestoreAll() over existing data error = %v, want ErrRestoreConflict", err)
+			}
+			if _, err := RestoreAll(restoreOpts, bytes.NewReader(archive.Bytes()), true); err != nil {
+				t.Errorf("RestoreAll() with overwrite error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRestoreAll_Mismatch(t *testing.T) {
+	opts := Options{DataDir: t.TempDir()}
+	fs, err := NewFileStorage(opts.DataDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.CreateUser("alice", []recognition.Embedding{{}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := Backup(opts, &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, restoreOpts := range map[string]Options{
+		"Backend":    {Backend: BackendSQLite, DataDir: t.TempDir()},
+		"Encryption": {DataDir: t.TempDir(), EncryptionEnabled: true},
+	} {
+		if _, err := RestoreAll(restoreOpts, bytes.NewReader(archive.Bytes()), false); err == nil {
+			t.Errorf("%s: RestoreAll() should fail", name)
+		}
+	}
+}
+
+func TestRestoreAll_InvalidArchive(t *testing.T) {
+	archive := func(entries map[string]string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, data := range entries {
+			_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))})
+			_, _ = tw.Write([]byte(data))
+		}
+		_ = tw.Close()
+		_ = gz.Close()
+		return buf.Bytes()
+	}
+	manifest := `{"version": 1, "backend": "file"}`
+
+	for name, data := range map[string][]byte{
+		"NotGzip":     []byte("not an archive"),
+		"NoManifest":  archive(map[string]string{"users/alice.json": "{}"}),
+		"NewVersion":  archive(map[string]string{"manifest.json": `{"version": 99, "backend": "file"}`}),
+		"Traversal":   archive(map[string]string{"manifest.json": manifest, "users/../../evil.json": "{}"}),
+		"BadUsername": archive(map[string]string{"manifest.json": manifest, "users/.x.json": "{}"}),
+		"MissingFile": archive(map[string]string{"manifest.json": `{"version": 1, "backend": "file", "files": ["users/alice.json"]}`}),
+	} {
+		_, err := RestoreAll(Options{DataDir: t.TempDir()}, bytes.NewReader(data), false)
+		if !errors.Is(err, ErrInvalidBackup) {
+			t.Errorf("%s: RestoreAll() error = %v, want ErrInvalidBackup", name, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ErrUserLocked is returned when another process holds a user's lock for
+// longer than lockTimeout.
+var ErrUserLocked = errors.New("user data is locked by another process")
+
+// lockTimeout bounds how long FileStorage waits for a user's lock, so a
+// stuck process cannot hang PAM authentication.
+var lockTimeout = 5 * time.Second
+
+// lockPath returns the lock file guarding a user's data. The data file is
+// replaced on every write, so the lock lives in a separate file. Lock files
+// are never removed: unlinking one while another process waits on it would
+// let a third process lock a new file and run concurrently.
+func (fs *FileStorage) lockPath(username string) string {
+	return filepath.Join(fs.dataDir, "locks", username+".lock")
+}
+
+// lockUser takes an exclusive flock on the user's lock file, serializing
+// load-modify-save cycles across processes and FileStorage instances. The
+// returned function releases the lock.
+func (fs *FileStorage) lockUser(username string) (func(), error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+
+	path := fs.lockPath(username)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock user data: %w", err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrUserLocked, username)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
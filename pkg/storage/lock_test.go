@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// Each goroutine uses its own FileStorage, like separate processes would.
+func TestFileStorage_ConcurrentAddEmbedding(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := fs.CreateUser("alice", createTestEmbeddings(1), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	const writers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		embedding := recognition.Embedding{Angle: "auto"}
+		embedding.Vector[0] = float32(i + 1)
+		go func() {
+			defer wg.Done()
+			other, err := NewFileStorage(tmpDir, false)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := other.AddEmbedding("alice", embedding); err != nil {
+				t.Errorf("AddEmbedding() error = %v", err)
+			}
+			if err := other.UpdateLastUsed("alice"); err != nil {
+				t.Errorf("UpdateLastUsed() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := fs.CountEmbeddings("alice")
+	if err != nil {
+		t.Fatalf("CountEmbeddings() error = %v", err)
+	}
+	if count != writers+1 {
+		t.Errorf("embeddings = %d, want %d (lost updates)", count, writers+1)
+	}
+}
+
+func TestFileStorage_LockTimeout(t *testing.T) {
+	orig := lockTimeout
+	lockTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { lockTimeout = orig })
+
+	fs, err := NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := fs.CreateUser("alice", createTestEmbeddings(1), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	unlock, err := fs.lockUser("alice")
+	if err != nil {
+		t.Fatalf("lockUser() error = %v", err)
+	}
+	if err := fs.UpdateLastUsed("alice"); !errors.Is(err, ErrUserLocked) {
+		t.Errorf("UpdateLastUsed() while locked error = %v, want ErrUserLocked", err)
+	}
+	unlock()
+
+	if err := fs.UpdateLastUsed("alice"); err != nil {
+		t.Errorf("UpdateLastUsed() after unlock error = %v", err)
+	}
+}
+
+// Removing the lock file would let a waiting process and a newcomer lock
+// different files for the same user.
+func TestFileStorage_DeleteUserKeepsLock(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := fs.CreateUser("alice", createTestEmbeddings(1), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := fs.DeleteUser("alice"); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if _, err := os.Stat(fs.lockPath("alice")); err != nil {
+		t.Errorf("lock file after DeleteUser() error = %v, want it kept", err)
+	}
+}
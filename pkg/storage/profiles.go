@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+// DefaultProfile holds embeddings enrolled without a profile name,
+// including all embeddings enrolled before profiles were introduced.
+const DefaultProfile = "default"
+
+// ErrInvalidProfile is returned for profile names that are empty or contain
+// unsupported characters.
+var ErrInvalidProfile = errors.New("invalid profile name")
+
+// ErrDuplicateEmbedding is returned when adding an embedding with the same
+// fingerprint as one the user already has (see recognition.EmbeddingFingerprint).
+var ErrDuplicateEmbedding = errors.New("embedding is already enrolled")
+
+// profilePattern allows short names such as "glasses" or "no-glasses".
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,31}$`)
+
+// ValidateProfile checks that name can be used as an enrollment profile.
+func ValidateProfile(name string) error {
+	if !profilePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidProfile, name)
+	}
+	return nil
+}
+
+// ProfileNames returns the user's profile names in sorted order, which is
+// also the order of the flattened Embeddings.
+func (u *UserFaceData) ProfileNames() []string {
+	names := make([]string, 0, len(u.Profiles))
+	for name := range u.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileAt returns the profile of the i-th flattened embedding, or "" if i
+// is out of range.
+func (u *UserFaceData) ProfileAt(i int) string {
+	if i < 0 {
+		return ""
+	}
+	for _, name := range u.ProfileNames() {
+		if i < len(u.Profiles[name]) {
+			return name
+		}
+		i -= len(u.Profiles[name])
+	}
+	return ""
+}
+
+// HasEmbedding reports whether any profile holds an embedding with the same
+// fingerprint as embedding.
+func (u *UserFaceData) HasEmbedding(embedding recognition.Embedding) bool {
+	fp := recognition.EmbeddingFingerprint(embedding)
+	for _, embeddings := range u.Profiles {
+		for _, e := range embeddings {
+			if recognition.EmbeddingFingerprint(e) == fp {
+				return true
+			}
+		}
+	}
+	for _, e := range u.Embeddings {
+		if recognition.EmbeddingFingerprint(e) == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// AddEmbedding appends embedding to profile. If the user then has more than
+// maxEmbeddings embeddings, the oldest ones of that profile are evicted; a
+// profile keeps at least the new embedding. A maxEmbeddings of zero or less
+// disables the limit. It returns the number of evicted embeddings.
+//
+// Age is taken from CapturedAt. Embeddings without a capture time predate
+// capture metadata and are evicted first, in stored order.
+func (u *UserFaceData) AddEmbedding(profile string, embedding recognition.Embedding, maxEmbeddings int) int {
+	u.normalizeProfiles()
+	u.Profiles[profile] = append(u.Profiles[profile], embedding)
+
+	evicted := 0
+	if maxEmbeddings > 0 {
+		excess := u.countEmbeddings() - maxEmbeddings
+		if n := len(u.Profiles[profile]) - 1; excess > n {
+			excess = n
+		}
+		if excess > 0 {
+			u.Profiles[profile] = evictOldest(u.Profiles[profile], excess)
+			evicted = excess
+		}
+	}
+
+	u.flattenProfiles()
+	return evicted
+}
+
+// RemoveEmbeddings removes the embeddings at the given indexes of the
+// flattened Embeddings, as numbered by 'facepass stats'. Profiles left empty
+// are deleted. Out-of-range indexes are ignored; it returns the number of
+// embeddings removed.
+func (u *UserFaceData) RemoveEmbeddings(indexes []int) int {
+	u.normalizeProfiles()
+	remove := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		remove[i] = true
+	}
+
+	removed, offset := 0, 0
+	for _, name := range u.ProfileNames() {
+		embeddings := u.Profiles[name]
+		kept := make([]recognition.Embedding, 0, len(embeddings))
+		for i, e := range embeddings {
+			if !remove[offset+i] {
+				kept = append(kept, e)
+			}
+		}
+		offset += len(embeddings)
+		removed += len(embeddings) - len(kept)
+		if len(kept) == 0 {
+			delete(u.Profiles, name)
+		} else {
+			u.Profiles[name] = kept
+		}
+	}
+
+	u.flattenProfiles()
+	return removed
+}
+
+// RemoveFingerprints removes the embeddings whose
+// recognition.EmbeddingFingerprint is one of fingerprints, wherever they are
+// now stored. Unlike indexes, fingerprints still select the same embeddings
+// after others were added or evicted. It returns the number removed.
+func (u *UserFaceData) RemoveFingerprints(fingerprints []string) int {
+	remove := make(map[string]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		remove[fp] = true
+	}
+	u.normalizeProfiles()
+	u.flattenProfiles()
+	var indexes []int
+	for i, e := range u.Embeddings {
+		if remove[recognition.EmbeddingFingerprint(e)] {
+			indexes = append(indexes, i)
+		}
+	}
+	return u.RemoveEmbeddings(indexes)
+}
+
+// evictOldest returns embeddings without the n oldest, never evicting the
+// last one. The remaining embeddings keep their order.
+func evictOldest(embeddings []recognition.Embedding, n int) []recognition.Embedding {
+	candidates := make([]int, len(embeddings)-1)
+	for i := range candidates {
+		candidates[i] = i
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return embeddings[candidates[a]].CapturedAt.Before(embeddings[candidates[b]].CapturedAt)
+	})
+
+	evict := make(map[int]bool, n)
+	for _, i := range candidates[:n] {
+		evict[i] = true
+	}
+	kept := make([]recognition.Embedding, 0, len(embeddings)-n)
+	for i, e := range embeddings {
+		if !evict[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// normalizeProfiles moves embeddings of data without profiles, such as
+// records written before profiles existed or built by CreateUser, into
+// DefaultProfile.
+func (u *UserFaceData) normalizeProfiles() {
+	if len(u.Profiles) > 0 {
+		return
+	}
+	u.Profiles = map[string][]recognition.Embedding{}
+	if len(u.Embeddings) > 0 {
+		u.Profiles[DefaultProfile] = u.Embeddings
+	}
+}
+
+// flattenProfiles rebuilds Embeddings from Profiles.
+func (u *UserFaceData) flattenProfiles() {
+	embeddings := make([]recognition.Embedding, 0, u.countEmbeddings())
+	for _, name := range u.ProfileNames() {
+		embeddings = append(embeddings, u.Profiles[name]...)
+	}
+	u.Embeddings = embeddings
+}
+
+func (u *UserFaceData) countEmbeddings() int {
+	n := 0
+	for _, embeddings := range u.Profiles {
+		n += len(embeddings)
+	}
+	return n
+}
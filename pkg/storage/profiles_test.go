@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+func TestValidateProfile(t *testing.T) {
+	for _, name := range []string{"default", "glasses", "no-glasses", "v2.1", "_tmp"} {
+		if err := ValidateProfile(name); err != nil {
+			t.Errorf("ValidateProfile(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".hidden", "a b", "../x", "with/slash"} {
+		if err := ValidateProfile(name); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("ValidateProfile(%q) error = %v, want ErrInvalidProfile", name, err)
+		}
+	}
+}
+
+func TestUserFaceData_ProfileAt(t *testing.T) {
+	embeddings := createTestEmbeddings(3)
+	user := UserFaceData{Profiles: map[string][]recognition.Embedding{
+		"glasses": embeddings[:1],
+		"default": embeddings[1:],
+	}}
+	user.flattenProfiles()
+
+	// Profiles are flattened in name order
+	want := []string{"default", "default", "glasses", ""}
+	for i, profile := range want {
+		if got := user.ProfileAt(i); got != profile {
+			t.Errorf("ProfileAt(%d) = %q, want %q", i, got, profile)
+		}
+	}
+	if user.Embeddings[2].Vector != embeddings[0].Vector {
+		t.Error("flattened embeddings out of order")
+	}
+}
+
+func TestUserFaceData_RemoveEmbeddings(t *testing.T) {
+	embeddings := createTestEmbeddings(4)
+	user := UserFaceData{Profiles: map[string][]recognition.Embedding{
+		"glasses": embeddings[3:],
+		"default": embeddings[:3],
+	}}
+	user.flattenProfiles()
+
+	// 1 is in default, 3 is the only glasses embedding, 7 does not exist
+	if removed := user.RemoveEmbeddings([]int{1, 3, 7}); removed != 2 {
+		t.Errorf("RemoveEmbeddings() = %d, want 2", removed)
+	}
+	if _, ok := user.Profiles["glasses"]; ok {
+		t.Error("empty profile should be deleted")
+	}
+	if len(user.Embeddings) != 2 || user.Embeddings[0].Vector != embeddings[0].Vector || user.Embeddings[1].Vector != embeddings[2].Vector {
+		t.Errorf("remaining embeddings = %d, want embeddings 0 and 2", len(user.Embeddings))
+	}
+}
+
+func TestUserFaceData_RemoveFingerprints(t *testing.T) {
+	embeddings := createTestEmbeddings(4)
+	user := UserFaceData{Embeddings: embeddings[:3]}
+	selected := []string{recognition.EmbeddingFingerprint(embeddings[0]), recognition.EmbeddingFingerprint(embeddings[2])}
+
+	// An embedding added since the selection shifts nothing
+	user.AddEmbedding("glasses", embeddings[3], 0)
+	user.AddEmbedding(DefaultProfile, recognition.Embedding{Angle: "new"}, 0)
+
+	if removed := user.RemoveFingerprints(selected); removed != 2 {
+		t.Errorf("RemoveFingerprints() = %d, want 2", removed)
+	}
+	if user.HasEmbedding(embeddings[0]) || user.HasEmbedding(embeddings[2]) {
+		t.Error("selected embeddings should be removed")
+	}
+	if len(user.Embeddings) != 3 || !user.HasEmbedding(embeddings[1]) || !user.HasEmbedding(embeddings[3]) {
+		t.Errorf("remaining embeddings = %d, want the other three kept", len(user.Embeddings))
+	}
+}
+
+func TestUserFaceData_AddEmbedding(t *testing.T) {
+	user := UserFaceData{Embeddings: createTestEmbeddings(3)}
+
+	glasses := recognition.Embedding{Angle: "front"}
+	if evicted := user.AddEmbedding("glasses", glasses, 0); evicted != 0 {
+		t.Errorf("AddEmbedding() without limit evicted %d", evicted)
+	}
+	if len(user.Profiles[DefaultProfile]) != 3 || len(user.Profiles["glasses"]) != 1 {
+		t.Fatalf("profiles = %v, want 3 default and 1 glasses", user.ProfileNames())
+	}
+
+	// Eviction only touches the profile being added to
+	if evicted := user.AddEmbedding("glasses", glasses, 4); evicted != 1 {
+		t.Errorf("AddEmbedding() evicted %d, want 1", evicted)
+	}
+	if len(user.Profiles[DefaultProfile]) != 3 || len(user.Profiles["glasses"]) != 1 {
+		t.Errorf("eviction removed embeddings from other profiles")
+	}
+	if len(user.Embeddings) != 4 {
+		t.Errorf("flattened embeddings = %d, want 4", len(user.Embeddings))
+	}
+}
+
+func TestUserFaceData_AddEmbedding_EvictsOldest(t *testing.T) {
+	now := time.Now()
+	embeddings := createTestEmbeddings(4)
+	embeddings[0].CapturedAt = now.Add(-time.Hour)
+	embeddings[1].CapturedAt = now.Add(-3 * time.Hour)
+	embeddings[2].CapturedAt = now.Add(-2 * time.Hour)
+	// embeddings[3] predates capture metadata
+	user := UserFaceData{Embeddings: embeddings}
+
+	added := recognition.Embedding{Vector: recognition.Descriptor{9}, CapturedAt: now}
+	if evicted := user.AddEmbedding(DefaultProfile, added, 3); evicted != 2 {
+		t.Fatalf("AddEmbedding() evicted %d, want 2", evicted)
+	}
+
+	// The undated and the oldest dated embedding go; the rest keep their order
+	kept := user.Profiles[DefaultProfile]
+	if len(kept) != 3 || kept[0].Vector != embeddings[0].Vector || kept[1].Vector != embeddings[2].Vector || kept[2].Vector != added.Vector {
+		t.Errorf("kept %v, want embeddings 0, 2 and the new one", kept)
+	}
+}
+
+func TestFileStorage_MigrateFlatEmbeddings(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	vector := "[0.5" + strings.Repeat(",0.1", recognition.DescriptorSize-1) + "]"
+	legacy := `{"schema_version":1,"username":"legacy","embeddings":[{"vector":` + vector + `,"quality":0.9,"angle":"front"}]}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "users", "legacy.json"), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrated, err := fs.MigrateUser("legacy"); err != nil || !migrated {
+		t.Fatalf("MigrateUser(legacy) = %v, %v, want true, nil", migrated, err)
+	}
+	loaded, err := fs.LoadUser("legacy")
+	if err != nil {
+		t.Fatalf("LoadUser(legacy) error = %v", err)
+	}
+	if len(loaded.Profiles[DefaultProfile]) != 1 || len(loaded.Embeddings) != 1 {
+		t.Fatalf("flat embeddings not migrated to the default profile: %+v", loaded.Profiles)
+	}
+	if loaded.Embeddings[0].Vector[0] != 0.5 {
+		t.Error("migrated embedding changed")
+	}
+
+	if err := fs.AddEmbeddingToProfile("legacy", "glasses", recognition.Embedding{Angle: "front"}, 0); err != nil {
+		t.Fatalf("AddEmbeddingToProfile() error = %v", err)
+	}
+	if err := fs.AddEmbeddingToProfile("legacy", "../bad", recognition.Embedding{}, 0); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("AddEmbeddingToProfile(../bad) error = %v, want ErrInvalidProfile", err)
+	}
+	loaded, _ = fs.LoadUser("legacy")
+	if names := loaded.ProfileNames(); len(names) != 2 || names[0] != DefaultProfile || names[1] != "glasses" {
+		t.Errorf("ProfileNames() = %v, want [default glasses]", names)
+	}
+}
+
+func TestSQLiteStorage_Profiles(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+
+	if err := s.CreateUser("alice", createTestEmbeddings(2), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	glasses := recognition.Embedding{Angle: "front"}
+	glasses.Vector[0] = 42
+	if err := s.AddEmbeddingToProfile("alice", "glasses", glasses, 0); err != nil {
+		t.Fatalf("AddEmbeddingToProfile() error = %v", err)
+	}
+	if err := s.AddEmbeddingToProfile("alice", "glasses", glasses, 0); !errors.Is(err, ErrDuplicateEmbedding) {
+		t.Errorf("AddEmbeddingToProfile() of a duplicate error = %v, want ErrDuplicateEmbedding", err)
+	}
+	// With a limit of 3 only the glasses profile may shrink
+	glasses.Vector[0] = 43
+	if err := s.AddEmbeddingToProfile("alice", "glasses", glasses, 3); err != nil {
+		t.Fatalf("AddEmbeddingToProfile() error = %v", err)
+	}
+
+	user, err := s.LoadUser("alice")
+	if err != nil {
+		t.Fatalf("LoadUser() error = %v", err)
+	}
+	if len(user.Profiles[DefaultProfile]) != 2 || len(user.Profiles["glasses"]) != 1 {
+		t.Errorf("profiles = default:%d glasses:%d, want 2 and 1",
+			len(user.Profiles[DefaultProfile]), len(user.Profiles["glasses"]))
+	}
+	if len(user.Embeddings) != 3 || user.ProfileAt(2) != "glasses" {
+		t.Errorf("flattened embeddings = %d, profile of last = %q", len(user.Embeddings), user.ProfileAt(2))
+	}
+
+	embeddings, err := s.GetAllEmbeddings("alice")
+	if err != nil || len(embeddings) != 3 {
+		t.Errorf("GetAllEmbeddings() = %d embeddings, %v, want 3", len(embeddings), err)
+	}
+
+	// SaveUser keeps the profiles
+	if err := s.SaveUser(*user); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+	user, _ = s.LoadUser("alice")
+	if len(user.Profiles["glasses"]) != 1 {
+		t.Error("SaveUser() lost the glasses profile")
+	}
+}
+
+func TestSQLiteStorage_AddsProfileColumn(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, SQLiteDatabaseFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+CREATE TABLE users (username TEXT PRIMARY KEY, schema_version INTEGER NOT NULL,
+	enrolled_at TIMESTAMP NOT NULL, last_used TIMESTAMP NOT NULL, metadata BLOB);
+CREATE TABLE embeddings (id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE, data BLOB NOT NULL);
+INSERT INTO users VALUES ('bob', 2, '2024-01-01 00:00:00', '2024-01-01 00:00:00', NULL);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteStorage(dir, false, KeySourceMachine, "")
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() on an old database error = %v", err)
+	}
+	defer s.Close()
+	if err := s.CreateUser("alice", createTestEmbeddings(1), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	user, err := s.LoadUser("alice")
+	if err != nil || len(user.Profiles[DefaultProfile]) != 1 {
+		t.Errorf("LoadUser() = %+v, %v, want one default embedding", user, err)
+	}
+	if user, err := s.LoadUser("bob"); err != nil || user.Disabled || user.Tolerance != nil {
+		t.Errorf("LoadUser(bob) = %+v, %v, want an existing user to stay enabled without a tolerance override", user, err)
+	}
+}
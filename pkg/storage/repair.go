@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+)
+
+// ErrRepairConflict is returned for a user who has both a .json and a .enc
+// file, so repairing would overwrite one with the other.
+var ErrRepairConflict = errors.New("both a .json and a .enc file exist")
+
+// RepairReport lists what RepairEncryption did.
+type RepairReport struct {
+	Repaired []string         // users whose file was rewritten in the configured state
+	Skipped  map[string]error // users whose file was left alone, and why
+}
+
+// RepairEncryption brings user files saved with the other encryption
+// setting into the configured one: with encryption enabled plaintext .json
+// files are encrypted, with it disabled .enc files are decrypted with key,
+// which may be nil if no key is available. Each file is written in the
+// configured state before the old one is removed. Files that cannot be read
+// or that conflict with a file in the configured state are skipped and
+// reported; err is only set if the users directory cannot be read or the
+// configured key does not match the stored data.
+func (fs *FileStorage) RepairEncryption(key *[KeySize]byte) (RepairReport, error) {
+	report := RepairReport{Skipped: make(map[string]error)}
+	if fs.encryptionEnabled && !fs.KeyMatches() {
+		return report, ErrWrongKey
+	}
+
+	strayExt := ".enc"
+	if fs.encryptionEnabled {
+		strayExt = ".json"
+	}
+	usersDir := filepath.Join(fs.dataDir, "users")
+	entries, err := os.ReadDir(usersDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return report, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	var strays []string
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, strayExt) {
+			strays = append(strays, strings.TrimSuffix(name, strayExt))
+		}
+	}
+	sort.Strings(strays)
+
+	for _, username := range strays {
+		if err := fs.repairUser(username, filepath.Join(usersDir, username+strayExt), key); err != nil {
+			logging.Warnf("Skipping repair of %s: %v", username, err)
+			report.Skipped[username] = err
+			continue
+		}
+		report.Repaired = append(report.Repaired, username)
+	}
+
+	if len(report.Repaired) > 0 {
+		logging.Infof("Repaired encryption state of %d user(s)", len(report.Repaired))
+	}
+	return report, nil
+}
+
+// repairUser rewrites the user's file at path, which is in the other
+// encryption state, in the configured one and removes it.
+func (fs *FileStorage) repairUser(username, path string, key *[KeySize]byte) error {
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+	unlock, err := fs.lockUser(username)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if fs.UserExists(username) {
+		return fmt.Errorf("%w; %s is in use, remove %s if it is outdated", ErrRepairConflict,
+			filepath.Base(fs.getUserPath(username)), filepath.Base(path))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read user data: %w", err)
+	}
+	// The file is encrypted exactly when encryption is now disabled
+	if !fs.encryptionEnabled {
+		if key == nil {
+			return fmt.Errorf("%w: no key to decrypt %s", ErrEncryption, filepath.Base(path))
+		}
+		if stored := fs.storedFingerprint(); stored != "" && stored != KeyFingerprint(*key) {
+			return ErrWrongKey
+		}
+		if data, err = openWithKey(data, key); err != nil {
+			return fmt.Errorf("failed to decrypt user data: %w", err)
+		}
+	}
+	user, err := decodeUserData(data)
+	if err != nil {
+		return err
+	}
+	if user.Username == "" {
+		user.Username = username
+	} else if user.Username != username {
+		return fmt.Errorf("file belongs to user %q", user.Username)
+	}
+	if err := migrateUserData(user); err != nil {
+		return err
+	}
+
+	if err := fs.saveUser(*user); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("saved in the configured state, but failed to remove %s: %w", filepath.Base(path), err)
+	}
+	logging.Infof("Repaired encryption state of user data for: %s", username)
+	return nil
+}
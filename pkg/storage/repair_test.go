@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStorage_RepairEncryption(t *testing.T) {
+	tmpDir := t.TempDir()
+	plain, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	encrypted, err := NewFileStorage(tmpDir, true)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	usersDir := filepath.Join(tmpDir, "users")
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(usersDir, name))
+		return err == nil
+	}
+
+	// alice was enrolled before encryption was turned on, bob both before
+	// and after, and carol's file is damaged
+	for _, username := range []string{"alice", "bob"} {
+		if err := plain.CreateUser(username, createTestEmbeddings(2), nil); err != nil {
+			t.Fatalf("CreateUser(%s) failed: %v", username, err)
+		}
+	}
+	if err := encrypted.CreateUser("bob", createTestEmbeddings(1), nil); err != nil {
+		t.Fatalf("CreateUser(bob) failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(usersDir, "carol.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := encrypted.RepairEncryption(nil)
+	if err != nil {
+		t.Fatalf("RepairEncryption() error = %v", err)
+	}
+	if len(report.Repaired) != 1 || report.Repaired[0] != "alice" {
+		t.Errorf("Repaired = %v, want [alice]", report.Repaired)
+	}
+	if !errors.Is(report.Skipped["bob"], ErrRepairConflict) || report.Skipped["carol"] == nil || len(report.Skipped) != 2 {
+		t.Errorf("Skipped = %v, want a conflict for bob and an error for carol", report.Skipped)
+	}
+
+	if exists("alice.json") || !exists("alice.enc") {
+		t.Error("alice.json should have been replaced by alice.enc")
+	}
+	if user, err := encrypted.LoadUser("alice"); err != nil || len(user.Embeddings) != 2 {
+		t.Errorf("LoadUser(alice) after repair = %v, %v", user, err)
+	}
+	if !exists("bob.json") || !exists("bob.enc") || !exists("carol.json") {
+		t.Error("skipped files should be left alone")
+	}
+
+	// Turning encryption off again decrypts alice with the old key
+	if err := os.Remove(filepath.Join(usersDir, "bob.json")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = plain.RepairEncryption(nil)
+	if err != nil {
+		t.Fatalf("RepairEncryption() error = %v", err)
+	}
+	if len(report.Repaired) != 0 || !errors.Is(report.Skipped["alice"], ErrEncryption) {
+		t.Errorf("RepairEncryption(nil) = %+v, want alice skipped without a key", report)
+	}
+
+	var wrongKey [KeySize]byte
+	if report, _ := plain.RepairEncryption(&wrongKey); !errors.Is(report.Skipped["alice"], ErrWrongKey) {
+		t.Errorf("RepairEncryption() with the wrong key = %+v, want ErrWrongKey", report)
+	}
+
+	key := encrypted.encryptionKey
+	report, err = plain.RepairEncryption(&key)
+	if err != nil {
+		t.Fatalf("RepairEncryption() error = %v", err)
+	}
+	if len(report.Repaired) != 2 || len(report.Skipped) != 0 {
+		t.Errorf("RepairEncryption() = %+v, want alice and bob repaired", report)
+	}
+	if exists("alice.enc") || exists("bob.enc") {
+		t.Error(".enc files should have been removed")
+	}
+	if user, err := plain.LoadUser("bob"); err != nil || len(user.Embeddings) != 1 {
+		t.Errorf("LoadUser(bob) after repair = %v, %v", user, err)
+	}
+}
@@ -0,0 +1,732 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/logging"
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteDatabaseFile is the database file name inside the data directory.
+const SQLiteDatabaseFile = "facepass.db"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	username       TEXT PRIMARY KEY,
+	schema_version INTEGER NOT NULL,
+	enrolled_at    TIMESTAMP NOT NULL,
+	last_used      TIMESTAMP NOT NULL,
+	metadata       BLOB,
+	disabled       INTEGER NOT NULL DEFAULT 0,
+	tolerance      REAL
+);
+CREATE TABLE IF NOT EXISTS embeddings (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+	profile  TEXT NOT NULL DEFAULT 'default',
+	data     BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS embeddings_username ON embeddings(username);
+CREATE TABLE IF NOT EXISTS settings (
+	name  TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// SQLiteStorage implements Backend using a single SQLite database.
+// Each embedding is stored as its own row, encrypted individually when
+// encryption is enabled. Usernames and timestamps are stored in plain text.
+type SQLiteStorage struct {
+	db                *sql.DB
+	encryptionEnabled bool
+	encryptionKey     [KeySize]byte
+	compress          bool
+	lastUsedInterval  time.Duration
+}
+
+// NewSQLiteStorage opens (or creates) the SQLite database in dataDir.
+func NewSQLiteStorage(dataDir string, encryptionEnabled bool, source KeySource, keyFile string) (*SQLiteStorage, error) {
+	s := &SQLiteStorage{
+		encryptionEnabled: encryptionEnabled,
+	}
+
+	if encryptionEnabled {
+		key, err := deriveKey(source, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+		}
+		s.encryptionKey = key
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	path := filepath.Join(dataDir, SQLiteDatabaseFile)
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if err := upgradeSchema(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade database: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		logging.Warnf("Failed to restrict database permissions: %v", err)
+	}
+	s.db = db
+
+	if encryptionEnabled && !s.KeyMatches() {
+		logging.Warnf("Encryption key does not match stored key fingerprint in %s", path)
+	}
+
+	return s, nil
+}
+
+// upgradeSchema adds the columns introduced after a database was created:
+// embeddings.profile, where existing rows join the default profile,
+// users.disabled, where existing users stay enabled, and users.tolerance,
+// which is NULL for users without an override.
+func upgradeSchema(db *sql.DB) error {
+	if err := addColumn(db, "embeddings", "profile", `TEXT NOT NULL DEFAULT '`+DefaultProfile+`'`); err != nil {
+		return err
+	}
+	if err := addColumn(db, "users", "disabled", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return addColumn(db, "users", "tolerance", "REAL")
+}
+
+// addColumn adds column to table unless it already exists.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// Close closes the underlying database.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// SetCompression enables or disables gzip compression of newly written records.
+func (s *SQLiteStorage) SetCompression(enabled bool) {
+	s.compress = enabled
+}
+
+// SetLastUsedInterval sets the minimum age of the stored LastUsed timestamp
+// before UpdateLastUsed writes a new one. Zero writes on every call.
+func (s *SQLiteStorage) SetLastUsedInterval(interval time.Duration) {
+	s.lastUsedInterval = interval
+}
+
+// seal compresses and encrypts data as configured.
+func (s *SQLiteStorage) seal(data []byte) ([]byte, error) {
+	if s.compress {
+		var err error
+		data, err = compressData(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !s.encryptionEnabled {
+		return data, nil
+	}
+	return sealWithKey(data, &s.encryptionKey)
+}
+
+// open decrypts and decompresses data as needed.
+func (s *SQLiteStorage) open(data []byte) ([]byte, error) {
+	if s.encryptionEnabled {
+		var err error
+		data, err = openWithKey(data, &s.encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decompressData(data)
+}
+
+// storedFingerprint returns the key fingerprint recorded in the database, if any.
+func (s *SQLiteStorage) storedFingerprint() string {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE name = 'key_fingerprint'`).Scan(&value)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// writeFingerprint records the fingerprint of key.
+func (s *SQLiteStorage) writeFingerprint(tx *sql.Tx, key [KeySize]byte) error {
+	_, err := tx.Exec(`INSERT INTO settings (name, value) VALUES ('key_fingerprint', ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value`, KeyFingerprint(key))
+	return err
+}
+
+// KeyMatches reports whether the current key matches the fingerprint stored
+// alongside the data. It returns true when no fingerprint has been recorded yet.
+func (s *SQLiteStorage) KeyMatches() bool {
+	stored := s.storedFingerprint()
+	return stored == "" || stored == KeyFingerprint(s.encryptionKey)
+}
+
+// insertEmbedding stores a single embedding row.
+func (s *SQLiteStorage) insertEmbedding(tx *sql.Tx, username, profile string, embedding recognition.Embedding) error {
+	data, err := json.Marshal(embedding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+	data, err = s.seal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt embedding: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO embeddings (username, profile, data) VALUES (?, ?, ?)`, username, profile, data)
+	return err
+}
+
+// SaveUser saves user face data, replacing any existing record.
+func (s *SQLiteStorage) SaveUser(user UserFaceData) error {
+	if err := ValidateUsername(user.Username); err != nil {
+		return err
+	}
+	if s.encryptionEnabled && !s.KeyMatches() {
+		return ErrWrongKey
+	}
+
+	needFingerprint := s.encryptionEnabled && s.storedFingerprint() == ""
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.writeUser(tx, user); err != nil {
+		return err
+	}
+
+	if needFingerprint {
+		if err := s.writeFingerprint(tx, s.encryptionKey); err != nil {
+			logging.Warnf("Failed to write key fingerprint: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+
+	logging.Debugf("Saved user data for: %s", user.Username)
+	return nil
+}
+
+// writeUser replaces the user's record and embeddings within tx.
+func (s *SQLiteStorage) writeUser(tx *sql.Tx, user UserFaceData) error {
+	metadata, err := json.Marshal(user.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	metadata, err = s.seal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt user data: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO users (username, schema_version, enrolled_at, last_used, metadata, disabled, tolerance)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET
+			schema_version = excluded.schema_version,
+			enrolled_at = excluded.enrolled_at,
+			last_used = excluded.last_used,
+			metadata = excluded.metadata,
+			disabled = excluded.disabled,
+			tolerance = excluded.tolerance`,
+		user.Username, CurrentSchemaVersion, user.EnrolledAt, user.LastUsed, metadata, user.Disabled, user.Tolerance)
+	if err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM embeddings WHERE username = ?`, user.Username); err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+	user.normalizeProfiles()
+	for _, profile := range user.ProfileNames() {
+		for _, embedding := range user.Profiles[profile] {
+			if err := s.insertEmbedding(tx, user.Username, profile, embedding); err != nil {
+				return fmt.Errorf("failed to write user data: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadUser loads user face data, migrating older schema versions in memory.
+func (s *SQLiteStorage) LoadUser(username string) (*UserFaceData, error) {
+	user, err := s.readUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateUserData(user); err != nil {
+		return nil, err
+	}
+
+	logging.Debugf("Loaded user data for: %s", username)
+	return user, nil
+}
+
+// readUser reads a user record without schema migration.
+func (s *SQLiteStorage) readUser(username string) (*UserFaceData, error) {
+	return s.readUserFrom(s.db, username)
+}
+
+// readUserFrom reads a user record through q, a database or transaction.
+func (s *SQLiteStorage) readUserFrom(q querier, username string) (*UserFaceData, error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	if s.encryptionEnabled && !s.KeyMatches() {
+		return nil, ErrWrongKey
+	}
+
+	user := UserFaceData{Username: username}
+	var metadata []byte
+	err := q.QueryRow(`SELECT schema_version, enrolled_at, last_used, metadata, disabled, tolerance FROM users WHERE username = ?`, username).
+		Scan(&user.SchemaVersion, &user.EnrolledAt, &user.LastUsed, &metadata, &user.Disabled, &user.Tolerance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to read user data: %w", err)
+	}
+
+	if len(metadata) > 0 {
+		metadata, err = s.open(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt user data: %w", err)
+		}
+		if err := json.Unmarshal(metadata, &user.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal user data: %w", err)
+		}
+	}
+
+	user.Profiles, err = s.readProfiles(q, username)
+	if err != nil {
+		return nil, err
+	}
+	user.flattenProfiles()
+
+	return &user, nil
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// readProfiles returns a user's embeddings by profile, oldest first.
+func (s *SQLiteStorage) readProfiles(q querier, username string) (map[string][]recognition.Embedding, error) {
+	rows, err := q.Query(`SELECT profile, data FROM embeddings WHERE username = ? ORDER BY id`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := map[string][]recognition.Embedding{}
+	for rows.Next() {
+		var profile string
+		var data []byte
+		if err := rows.Scan(&profile, &data); err != nil {
+			return nil, fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		data, err = s.open(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt embedding: %w", err)
+		}
+		var embedding recognition.Embedding
+		if err := json.Unmarshal(data, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal embedding: %w", err)
+		}
+		profiles[profile] = append(profiles[profile], embedding)
+	}
+
+	return profiles, rows.Err()
+}
+
+// MigrateUser rewrites a user's record in the current schema version.
+// It reports whether the record needed upgrading.
+func (s *SQLiteStorage) MigrateUser(username string) (bool, error) {
+	user, err := s.readUser(username)
+	if err != nil {
+		return false, err
+	}
+
+	if user.SchemaVersion == CurrentSchemaVersion {
+		return false, nil
+	}
+
+	from := user.SchemaVersion
+	if err := migrateUserData(user); err != nil {
+		return false, err
+	}
+	if err := s.SaveUser(*user); err != nil {
+		return false, err
+	}
+
+	logging.Infof("Migrated user data for %s from schema version %d to %d", username, from, CurrentSchemaVersion)
+	return true, nil
+}
+
+// DeleteUser removes a user and their embeddings.
+func (s *SQLiteStorage) DeleteUser(username string) error {
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM users WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("failed to delete user data: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	logging.Infof("Deleted user data for: %s", username)
+	return nil
+}
+
+// ListUsers returns a list of all enrolled usernames.
+func (s *SQLiteStorage) ListUsers() ([]string, error) {
+	rows, err := s.db.Query(`SELECT username FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		users = append(users, username)
+	}
+
+	return users, rows.Err()
+}
+
+// UserExists checks if a user is enrolled.
+func (s *SQLiteStorage) UserExists(username string) bool {
+	var exists int
+	err := s.db.QueryRow(`SELECT 1 FROM users WHERE username = ?`, username).Scan(&exists)
+	return err == nil
+}
+
+// CreateUser creates a new user with initial embeddings.
+func (s *SQLiteStorage) CreateUser(username string, embeddings []recognition.Embedding, metadata map[string]string) error {
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+
+	if s.UserExists(username) {
+		return ErrUserExists
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+
+	return s.SaveUser(UserFaceData{
+		Username:   username,
+		Embeddings: embeddings,
+		EnrolledAt: time.Now(),
+		LastUsed:   time.Now(),
+		Metadata:   metadata,
+	})
+}
+
+// GetAllEmbeddings returns all embeddings for a user.
+func (s *SQLiteStorage) GetAllEmbeddings(username string) ([]recognition.Embedding, error) {
+	if s.encryptionEnabled && !s.KeyMatches() {
+		return nil, ErrWrongKey
+	}
+	if !s.UserExists(username) {
+		return nil, ErrUserNotFound
+	}
+	profiles, err := s.readProfiles(s.db, username)
+	if err != nil {
+		return nil, err
+	}
+	user := UserFaceData{Profiles: profiles}
+	user.flattenProfiles()
+	return user.Embeddings, nil
+}
+
+// CountEmbeddings returns the number of embeddings stored for a user.
+func (s *SQLiteStorage) CountEmbeddings(username string) (int, error) {
+	if !s.UserExists(username) {
+		return 0, ErrUserNotFound
+	}
+
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM embeddings WHERE username = ?`, username).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count embeddings: %w", err)
+	}
+	return count, nil
+}
+
+// Stats returns the number of enrolled users and their total embeddings
+// without decrypting any records.
+func (s *SQLiteStorage) Stats() (users int, totalEmbeddings int, err error) {
+	err = s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM users), (SELECT COUNT(*) FROM embeddings)`).
+		Scan(&users, &totalEmbeddings)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read storage stats: %w", err)
+	}
+	return users, totalEmbeddings, nil
+}
+
+// AddEmbedding adds a new embedding to the default profile of an existing user.
+func (s *SQLiteStorage) AddEmbedding(username string, embedding recognition.Embedding) error {
+	return s.AddEmbeddingToProfile(username, DefaultProfile, embedding, 0)
+}
+
+// AddEmbeddingWithLimit adds a new embedding to the default profile of an
+// existing user and evicts the oldest embeddings so that at most
+// maxEmbeddings are kept. A maxEmbeddings of zero or less disables the limit.
+func (s *SQLiteStorage) AddEmbeddingWithLimit(username string, embedding recognition.Embedding, maxEmbeddings int) error {
+	return s.AddEmbeddingToProfile(username, DefaultProfile, embedding, maxEmbeddings)
+}
+
+// AddEmbeddingToProfile adds a new embedding to the named profile of an
+// existing user. Beyond maxEmbeddings, the oldest embeddings of that
+// profile are evicted; the profile keeps at least the new embedding. An
+// embedding the user already has is skipped with ErrDuplicateEmbedding.
+func (s *SQLiteStorage) AddEmbeddingToProfile(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error {
+	if err := ValidateProfile(profile); err != nil {
+		return err
+	}
+	if s.encryptionEnabled && !s.KeyMatches() {
+		return ErrWrongKey
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET last_used = ? WHERE username = ?`, time.Now(), username)
+	if err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	existing, err := s.readProfiles(tx, username)
+	if err != nil {
+		return err
+	}
+	if (&UserFaceData{Profiles: existing}).HasEmbedding(embedding) {
+		return ErrDuplicateEmbedding
+	}
+
+	if err := s.insertEmbedding(tx, username, profile, embedding); err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+
+	if maxEmbeddings > 0 {
+		var others int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM embeddings WHERE username = ? AND profile != ?`,
+			username, profile).Scan(&others); err != nil {
+			return fmt.Errorf("failed to count embeddings: %w", err)
+		}
+		keep := maxEmbeddings - others
+		if keep < 1 {
+			keep = 1
+		}
+		result, err := tx.Exec(`DELETE FROM embeddings WHERE username = ? AND profile = ? AND id NOT IN
+			(SELECT id FROM embeddings WHERE username = ? AND profile = ? ORDER BY id DESC LIMIT ?)`,
+			username, profile, username, profile, keep)
+		if err != nil {
+			return fmt.Errorf("failed to evict embeddings: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			logging.Debugf("Evicted %d oldest embedding(s) for: %s", n, username)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateUser applies fn to the user's data and saves the result in one
+// transaction, so concurrent updates are not lost. Nothing is saved if fn
+// returns an error; ErrSkipUpdate makes UpdateUser return nil.
+func (s *SQLiteStorage) UpdateUser(username string, fn func(*UserFaceData) error) error {
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+	if s.encryptionEnabled && !s.KeyMatches() {
+		return ErrWrongKey
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Write first so the transaction holds the write lock before reading
+	result, err := tx.Exec(`UPDATE users SET last_used = last_used WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("failed to lock user data: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+
+	user, err := s.readUserFrom(tx, username)
+	if err != nil {
+		return err
+	}
+	if err := migrateUserData(user); err != nil {
+		return err
+	}
+	if err := fn(user); err != nil {
+		if errors.Is(err, ErrSkipUpdate) {
+			return nil
+		}
+		return err
+	}
+	user.Username = username
+	if err := s.writeUser(tx, *user); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+	logging.Debugf("Updated user data for: %s", username)
+	return nil
+}
+
+// UpdateLastUsed updates the last used timestamp for a user.
+func (s *SQLiteStorage) UpdateLastUsed(username string) error {
+	var lastUsed time.Time
+	err := s.db.QueryRow(`SELECT last_used FROM users WHERE username = ?`, username).Scan(&lastUsed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to read user data: %w", err)
+	}
+
+	now := time.Now()
+	if s.lastUsedInterval > 0 && now.Sub(lastUsed) < s.lastUsedInterval {
+		return nil
+	}
+
+	if _, err := s.db.Exec(`UPDATE users SET last_used = ? WHERE username = ?`, now, username); err != nil {
+		return fmt.Errorf("failed to write user data: %w", err)
+	}
+	return nil
+}
+
+// RotateKey re-encrypts all stored data from oldKey to newKey in a single
+// transaction and records the new key's fingerprint.
+func (s *SQLiteStorage) RotateKey(oldKey, newKey [KeySize]byte) error {
+	if !s.encryptionEnabled {
+		return errors.New("encryption is not enabled")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	reseal := func(data []byte) ([]byte, error) {
+		plaintext, err := openWithKey(data, &oldKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt with old key: %w", err)
+		}
+		return sealWithKey(plaintext, &newKey)
+	}
+
+	if err := resealColumn(tx, "users", "username", "metadata", reseal); err != nil {
+		return err
+	}
+	if err := resealColumn(tx, "embeddings", "id", "data", reseal); err != nil {
+		return err
+	}
+
+	if err := s.writeFingerprint(tx, newKey); err != nil {
+		return fmt.Errorf("failed to write key fingerprint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit key rotation: %w", err)
+	}
+	// Only now is the database on the new key
+	s.encryptionKey = newKey
+
+	logging.Infof("Rotated encryption key for SQLite storage")
+	return nil
+}
+
+// resealColumn rewrites every non-empty value of column in table using fn.
+func resealColumn(tx *sql.Tx, table, keyColumn, column string, fn func([]byte) ([]byte, error)) error {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT %s, %s FROM %s`, keyColumn, column, table))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+
+	type row struct {
+		key  interface{}
+		data []byte
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.key, &r.data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		if len(r.data) > 0 {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+
+	for _, r := range pending {
+		data, err := fn(r.data)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt %s %v: %w", table, r.key, err)
+		}
+		query := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, table, column, keyColumn)
+		if _, err := tx.Exec(query, data, r.key); err != nil {
+			return fmt.Errorf("failed to write %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrCodeEU/facepass/pkg/recognition"
+)
+
+func newTestSQLiteStorage(t *testing.T, encrypted bool) *SQLiteStorage {
+	t.Helper()
+	t.Setenv(KeyEnvVar, strings.Repeat("0a", KeySize))
+
+	s, err := NewSQLiteStorage(t.TempDir(), encrypted, KeySourceEnv, "")
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStorage_CreateAndLoadUser(t *testing.T) {
+	for _, encrypted := range []bool{false, true} {
+		s := newTestSQLiteStorage(t, encrypted)
+
+		embeddings := createTestEmbeddings(3)
+		if err := s.CreateUser("alice", embeddings, map[string]string{"device": "/dev/video2"}); err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+		if err := s.CreateUser("alice", embeddings, nil); !errors.Is(err, ErrUserExists) {
+			t.Errorf("CreateUser() duplicate error = %v, want ErrUserExists", err)
+		}
+
+		user, err := s.LoadUser("alice")
+		if err != nil {
+			t.Fatalf("LoadUser() error = %v", err)
+		}
+		if len(user.Embeddings) != 3 {
+			t.Errorf("embeddings count = %d, want 3", len(user.Embeddings))
+		}
+		if user.Embeddings[2].Vector != embeddings[2].Vector {
+			t.Error("embedding vector not preserved")
+		}
+		if user.Metadata["device"] != "/dev/video2" {
+			t.Error("metadata not preserved")
+		}
+		if user.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("SchemaVersion = %d, want %d", user.SchemaVersion, CurrentSchemaVersion)
+		}
+
+		if _, err := s.LoadUser("bob"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("LoadUser(bob) error = %v, want ErrUserNotFound", err)
+		}
+	}
+}
+
+func TestSQLiteStorage_Compressed(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+	s.SetCompression(true)
+
+	embeddings := createTestEmbeddings(2)
+	if err := s.CreateUser("alice", embeddings, map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	user, err := s.LoadUser("alice")
+	if err != nil {
+		t.Fatalf("LoadUser() error = %v", err)
+	}
+	if user.Embeddings[1].Vector != embeddings[1].Vector || user.Metadata["k"] != "v" {
+		t.Error("compressed data not preserved")
+	}
+}
+
+func TestSQLiteStorage_ListAndDelete(t *testing.T) {
+	s := newTestSQLiteStorage(t, false)
+
+	for _, name := range []string{"carol", "alice", "bob"} {
+		if err := s.CreateUser(name, createTestEmbeddings(1), nil); err != nil {
+			t.Fatalf("CreateUser(%s) error = %v", name, err)
+		}
+	}
+
+	users, err := s.ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if strings.Join(users, ",") != "alice,bob,carol" {
+		t.Errorf("ListUsers() = %v", users)
+	}
+
+	if err := s.DeleteUser("bob"); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if s.UserExists("bob") {
+		t.Error("bob should not exist after delete")
+	}
+	if err := s.DeleteUser("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("DeleteUser() twice error = %v, want ErrUserNotFound", err)
+	}
+
+	// Embeddings are removed together with the user
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM embeddings WHERE username = 'bob'`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("bob still has %d embedding rows", count)
+	}
+}
+
+func TestSQLiteStorage_AddEmbeddingWithLimit(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+
+	if err := s.CreateUser("alice", createTestEmbeddings(3), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	newest := recognition.Embedding{Quality: 0.5, Angle: "auto"}
+	newest.Vector[0] = 42
+	if err := s.AddEmbeddingWithLimit("alice", newest, 2); err != nil {
+		t.Fatalf("AddEmbeddingWithLimit() error = %v", err)
+	}
+
+	embeddings, err := s.GetAllEmbeddings("alice")
+	if err != nil {
+		t.Fatalf("GetAllEmbeddings() error = %v", err)
+	}
+	if len(embeddings) != 2 {
+		t.Fatalf("embeddings count = %d, want 2", len(embeddings))
+	}
+	if embeddings[1].Vector[0] != 42 || embeddings[1].Angle != "auto" {
+		t.Error("newest embedding should be kept last")
+	}
+
+	if err := s.AddEmbedding("nobody", newest); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("AddEmbedding(nobody) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSQLiteStorage_UpdateLastUsed_Throttled(t *testing.T) {
+	s := newTestSQLiteStorage(t, false)
+	s.SetLastUsedInterval(time.Hour)
+
+	written := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := s.SaveUser(UserFaceData{Username: "alice", LastUsed: written}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	if err := s.UpdateLastUsed("alice"); err != nil {
+		t.Fatalf("UpdateLastUsed() error = %v", err)
+	}
+	user, _ := s.LoadUser("alice")
+	if !user.LastUsed.Equal(written) {
+		t.Errorf("LastUsed = %v, want unchanged %v", user.LastUsed, written)
+	}
+
+	s.SetLastUsedInterval(0)
+	if err := s.UpdateLastUsed("alice"); err != nil {
+		t.Fatalf("UpdateLastUsed() error = %v", err)
+	}
+	user, _ = s.LoadUser("alice")
+	if !user.LastUsed.After(written) {
+		t.Errorf("LastUsed = %v, want newer than %v", user.LastUsed, written)
+	}
+
+	if err := s.UpdateLastUsed("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateLastUsed(bob) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestSQLiteStorage_UpdateUser(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+	if err := s.CreateUser("alice", createTestEmbeddings(2), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	testUpdateUser(t, s)
+}
+
+func TestSQLiteStorage_Stats(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+
+	s.CreateUser("alice", createTestEmbeddings(3), nil)
+	s.CreateUser("bob", createTestEmbeddings(2), nil)
+
+	count, err := s.CountEmbeddings("bob")
+	if err != nil || count != 2 {
+		t.Errorf("CountEmbeddings(bob) = %d, %v, want 2", count, err)
+	}
+	if _, err := s.CountEmbeddings("carol"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("CountEmbeddings(carol) error = %v, want ErrUserNotFound", err)
+	}
+
+	users, embeddings, err := s.Stats()
+	if err != nil || users != 2 || embeddings != 5 {
+		t.Errorf("Stats() = %d, %d, %v, want 2, 5, nil", users, embeddings, err)
+	}
+}
+
+func TestSQLiteStorage_RotateKey(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+
+	if err := s.CreateUser("alice", createTestEmbeddings(2), map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	oldKey := s.encryptionKey
+	var newKey [KeySize]byte
+	newKey[0] = 0xff
+
+	var wrongKey [KeySize]byte
+	if err := s.RotateKey(wrongKey, newKey); err == nil {
+		t.Fatal("RotateKey() with wrong old key should fail")
+	}
+
+	if err := s.RotateKey(oldKey, newKey); err != nil {
+		t.Fatalf("RotateKey() error = %v", err)
+	}
+
+	user, err := s.LoadUser("alice")
+	if err != nil {
+		t.Fatalf("LoadUser() after rotation error = %v", err)
+	}
+	if len(user.Embeddings) != 2 || user.Metadata["k"] != "v" {
+		t.Error("data not preserved across rotation")
+	}
+
+	s.encryptionKey = oldKey
+	if _, err := s.LoadUser("alice"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("LoadUser() with old key error = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestSQLiteStorage_RotateKey_Rollback(t *testing.T) {
+	s := newTestSQLiteStorage(t, true)
+	if err := s.CreateUser("alice", createTestEmbeddings(1), nil); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	oldKey := s.encryptionKey
+	var newKey [KeySize]byte
+	newKey[0] = 0xff
+
+	// Recording the fingerprint fails, so the transaction rolls back
+	if _, err := s.db.Exec(`DROP TABLE settings`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RotateKey(oldKey, newKey); err == nil {
+		t.Fatal("RotateKey() should fail without a settings table")
+	}
+	if s.encryptionKey != oldKey {
+		t.Error("the storage should keep the old key after a failed rotation")
+	}
+	if _, err := s.LoadUser("alice"); err != nil {
+		t.Errorf("LoadUser() after failed rotation error = %v", err)
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	b, err := NewBackend(Options{DataDir: tmpDir})
+	if err != nil {
+		t.Fatalf("NewBackend(default) error = %v", err)
+	}
+	if _, ok := b.(*FileStorage); !ok {
+		t.Errorf("NewBackend(default) = %T, want *FileStorage", b)
+	}
+
+	b, err = NewBackend(Options{Backend: BackendSQLite, DataDir: tmpDir})
+	if err != nil {
+		t.Fatalf("NewBackend(sqlite) error = %v", err)
+	}
+	if s, ok := b.(*SQLiteStorage); !ok {
+		t.Errorf("NewBackend(sqlite) = %T, want *SQLiteStorage", b)
+	} else {
+		s.Close()
+	}
+
+	if _, err := NewBackend(Options{Backend: "postgres", DataDir: tmpDir}); err == nil {
+		t.Error("NewBackend(postgres) should fail")
+	}
+}
+
+// failingBackend fails to delete one user.
+type failingBackend struct {
+	*FileStorage
+	fail string
+}
+
+func (b *failingBackend) DeleteUser(username string) error {
+	if username == b.fail {
+		return ErrStorageAccess
+	}
+	return b.FileStorage.DeleteUser(username)
+}
+
+func TestRemoveAll(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if err := fs.CreateUser(username, createTestEmbeddings(1), nil); err != nil {
+			t.Fatalf("CreateUser(%s) error = %v", username, err)
+		}
+	}
+
+	removed, failed, err := RemoveAll(&failingBackend{FileStorage: fs, fail: "bob"})
+	if err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	if len(removed) != 2 || len(failed) != 1 || !errors.Is(failed["bob"], ErrStorageAccess) {
+		t.Errorf("RemoveAll() = %v, %v, want 2 removed and bob failed", removed, failed)
+	}
+	if users, _ := fs.ListUsers(); len(users) != 1 || users[0] != "bob" {
+		t.Errorf("remaining users = %v, want [bob]", users)
+	}
+}
+
+func TestUserDisabled(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	backends := map[string]Backend{
+		"file":   fs,
+		"sqlite": newTestSQLiteStorage(t, true),
+	}
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			if err := b.CreateUser("alice", createTestEmbeddings(2), nil); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			user, err := b.LoadUser("alice")
+			if err != nil {
+				t.Fatalf("LoadUser() error = %v", err)
+			}
+			if user.Disabled {
+				t.Fatal("new users should be enabled")
+			}
+
+			user.Disabled = true
+			if err := b.SaveUser(*user); err != nil {
+				t.Fatalf("SaveUser() error = %v", err)
+			}
+			user, err = b.LoadUser("alice")
+			if err != nil {
+				t.Fatalf("LoadUser() error = %v", err)
+			}
+			if !user.Disabled || len(user.Embeddings) != 2 {
+				t.Errorf("LoadUser() = disabled %t with %d embeddings, want disabled with the enrollment kept",
+					user.Disabled, len(user.Embeddings))
+			}
+
+			// Adding embeddings must not re-enable the user
+			if err := b.AddEmbedding("alice", createTestEmbeddings(3)[2]); err != nil {
+				t.Fatalf("AddEmbedding() error = %v", err)
+			}
+			if user, _ = b.LoadUser("alice"); !user.Disabled {
+				t.Error("AddEmbedding() re-enabled the user")
+			}
+		})
+	}
+}
+
+func TestUserTolerance(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	backends := map[string]Backend{
+		"file":   fs,
+		"sqlite": newTestSQLiteStorage(t, true),
+	}
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			if err := b.CreateUser("alice", createTestEmbeddings(2), nil); err != nil {
+				t.Fatalf("CreateUser() error = %v", err)
+			}
+			user, err := b.LoadUser("alice")
+			if err != nil {
+				t.Fatalf("LoadUser() error = %v", err)
+			}
+			if user.Tolerance != nil || user.MatchTolerance(0.4) != 0.4 {
+				t.Fatalf("new users should use the default tolerance, got %v", user.Tolerance)
+			}
+
+			tolerance := 0.32
+			user.Tolerance = &tolerance
+			if err := b.SaveUser(*user); err != nil {
+				t.Fatalf("SaveUser() error = %v", err)
+			}
+			if user, _ = b.LoadUser("alice"); user.Tolerance == nil || user.MatchTolerance(0.4) != 0.32 {
+				t.Errorf("LoadUser() tolerance = %v, want 0.32", user.Tolerance)
+			}
+
+			user.Tolerance = nil
+			if err := b.SaveUser(*user); err != nil {
+				t.Fatalf("SaveUser() error = %v", err)
+			}
+			if user, _ = b.LoadUser("alice"); user.Tolerance != nil {
+				t.Errorf("LoadUser() tolerance = %v after clearing it", *user.Tolerance)
+			}
+		})
+	}
+}
@@ -3,15 +3,21 @@
 package storage
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/MrCodeEU/facepass/pkg/logging"
@@ -24,15 +30,47 @@ const (
 	NonceSize = 24
 	// KeySize is the size of the encryption key
 	KeySize = 32
+	// keyFingerprintFile stores the fingerprint of the key used to encrypt user data
+	keyFingerprintFile = "key.fingerprint"
 )
 
+// CurrentSchemaVersion is the UserFaceData schema version written by SaveUser.
+// Files written before versioning was introduced have version 0; version 2
+// groups embeddings into profiles.
+const CurrentSchemaVersion = 2
+
 // UserFaceData contains all face data for a user.
+//
+// Profiles holds the embeddings grouped by enrollment profile (e.g. with and
+// without glasses) and is what gets stored. Embeddings is the flattened view
+// of all profiles used for matching; loaded data has it filled in. Data
+// with only Embeddings set is saved as DefaultProfile.
 type UserFaceData struct {
-	Username   string                  `json:"username"`
-	Embeddings []recognition.Embedding `json:"embeddings"`
-	EnrolledAt time.Time               `json:"enrolled_at"`
-	LastUsed   time.Time               `json:"last_used"`
-	Metadata   map[string]string       `json:"metadata"`
+	SchemaVersion int                                `json:"schema_version"`
+	Username      string                             `json:"username"`
+	Profiles      map[string][]recognition.Embedding `json:"profiles,omitempty"`
+	Embeddings    []recognition.Embedding            `json:"embeddings,omitempty"`
+	EnrolledAt    time.Time                          `json:"enrolled_at"`
+	LastUsed      time.Time                          `json:"last_used"`
+	Metadata      map[string]string                  `json:"metadata"`
+
+	// Disabled suspends face authentication for the user without removing
+	// the enrollment. It is stored negated so that data written before it
+	// existed stays enabled.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Tolerance overrides recognition.tolerance for this user when set,
+	// e.g. a stricter value for someone with a lookalike sibling.
+	Tolerance *float64 `json:"tolerance,omitempty"`
+}
+
+// MatchTolerance returns the user's tolerance override, or def if none is
+// set.
+func (u *UserFaceData) MatchTolerance(def float64) float64 {
+	if u.Tolerance != nil {
+		return *u.Tolerance
+	}
+	return def
 }
 
 // ErrUserNotFound is returned when the user is not enrolled.
@@ -47,23 +85,93 @@ var ErrStorageAccess = errors.New("failed to access storage")
 // ErrEncryption is returned when encryption/decryption fails.
 var ErrEncryption = errors.New("encryption error")
 
-// FileStorage implements Storage interface using file-based storage.
+// ErrWrongKey is returned when the encryption key does not match the key the data was encrypted with.
+var ErrWrongKey = errors.New("encryption key does not match stored data (machine identity changed? see 'facepass rekey')")
+
+// ErrInvalidUsername is returned when a username is unsafe to use as a storage key.
+var ErrInvalidUsername = errors.New("invalid username")
+
+// MaxUsernameLength is the longest username accepted by ValidateUsername.
+const MaxUsernameLength = 128
+
+// usernamePattern allows the characters found in local and directory-service
+// usernames (e.g. "john.doe", "svc_backup", "user@example.com").
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._@-]*$`)
+
+// ValidateUsername checks that a username is safe to use as a file name:
+// no path separators, no "..", no leading dot, and only a conservative charset.
+func ValidateUsername(username string) error {
+	switch {
+	case username == "":
+		return fmt.Errorf("%w: username is empty", ErrInvalidUsername)
+	case len(username) > MaxUsernameLength:
+		return fmt.Errorf("%w: username is longer than %d characters", ErrInvalidUsername, MaxUsernameLength)
+	case strings.ContainsAny(username, `/\`):
+		return fmt.Errorf("%w: %q contains a path separator", ErrInvalidUsername, username)
+	case strings.Contains(username, ".."):
+		return fmt.Errorf("%w: %q contains \"..\"", ErrInvalidUsername, username)
+	case strings.HasPrefix(username, "."):
+		return fmt.Errorf("%w: %q starts with a dot", ErrInvalidUsername, username)
+	case !usernamePattern.MatchString(username):
+		return fmt.Errorf("%w: %q contains characters other than letters, digits, '.', '_', '-' and '@'", ErrInvalidUsername, username)
+	}
+	return nil
+}
+
+// ErrUnsupportedSchema is returned when user data was written by a newer FacePass version.
+var ErrUnsupportedSchema = errors.New("unsupported user data schema version")
+
+// ErrSkipUpdate is returned by the function passed to UpdateUser to leave
+// the user's data unchanged without failing.
+var ErrSkipUpdate = errors.New("skip update")
+
+// ErrInvalidKey is returned when a supplied key cannot be parsed.
+var ErrInvalidKey = errors.New("invalid encryption key")
+
+// KeySource identifies where the storage encryption key comes from.
+type KeySource string
+
+const (
+	// KeySourceMachine derives the key from machine-specific information.
+	KeySourceMachine KeySource = "machine"
+	// KeySourceFile reads the key from a file (e.g. a TPM-sealed key).
+	KeySourceFile KeySource = "file"
+	// KeySourceEnv reads the key from the FACEPASS_KEY environment variable.
+	KeySourceEnv KeySource = "env"
+)
+
+// KeyEnvVar is the environment variable read by KeySourceEnv.
+const KeyEnvVar = "FACEPASS_KEY"
+
+// FileStorage implements Backend using one file per user.
 type FileStorage struct {
 	dataDir           string
 	encryptionEnabled bool
 	encryptionKey     [KeySize]byte
+	compress          bool
+	lastUsedInterval  time.Duration
+
+	// pendingLastUsed holds LastUsed timestamps not yet written because of lastUsedInterval
+	mu              sync.Mutex
+	pendingLastUsed map[string]time.Time
 }
 
-// NewFileStorage creates a new FileStorage instance.
+// NewFileStorage creates a new FileStorage instance using the machine-derived key.
 func NewFileStorage(dataDir string, encryptionEnabled bool) (*FileStorage, error) {
+	return NewFileStorageWithKeySource(dataDir, encryptionEnabled, KeySourceMachine, "")
+}
+
+// NewFileStorageWithKeySource creates a new FileStorage instance whose encryption
+// key is obtained from the given source. keyFile is only used by KeySourceFile.
+func NewFileStorageWithKeySource(dataDir string, encryptionEnabled bool, source KeySource, keyFile string) (*FileStorage, error) {
 	fs := &FileStorage{
 		dataDir:           dataDir,
 		encryptionEnabled: encryptionEnabled,
 	}
 
-	// Derive encryption key from machine-specific information
+	// Obtain encryption key from the configured source
 	if encryptionEnabled {
-		key, err := deriveKey()
+		key, err := deriveKey(source, keyFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to derive encryption key: %w", err)
 		}
@@ -76,40 +184,149 @@ func NewFileStorage(dataDir string, encryptionEnabled bool) (*FileStorage, error
 		return nil, fmt.Errorf("failed to create users directory: %w", err)
 	}
 
+	if encryptionEnabled && !fs.KeyMatches() {
+		logging.Warnf("Encryption key does not match stored key fingerprint in %s", dataDir)
+	}
+
 	return fs, nil
 }
 
-// deriveKey derives an encryption key from machine-specific information.
-// This ties the encrypted data to this specific machine.
-func deriveKey() ([KeySize]byte, error) {
-	var key [KeySize]byte
+// SetCompression enables or disables gzip compression of newly written user data.
+// Compressed and uncompressed data can always be read.
+func (fs *FileStorage) SetCompression(enabled bool) {
+	fs.compress = enabled
+}
 
-	// Combine multiple sources of machine identity
-	var identity strings.Builder
+// SetLastUsedInterval sets the minimum age of the stored LastUsed timestamp
+// before UpdateLastUsed rewrites the user file. Zero writes on every call.
+func (fs *FileStorage) SetLastUsedInterval(interval time.Duration) {
+	fs.lastUsedInterval = interval
+}
 
-	// Machine ID (Linux specific)
-	if machineID, err := os.ReadFile("/etc/machine-id"); err == nil {
-		identity.Write(machineID)
+// compressData gzips data.
+func compressData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	// Hostname
-	if hostname, err := os.Hostname(); err == nil {
-		identity.WriteString(hostname)
+// decompressData gunzips data if it starts with the gzip magic bytes and
+// returns it unchanged otherwise (plain JSON never starts with them).
+func decompressData(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
 	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
 
-	// User ID
-	identity.WriteString(fmt.Sprintf("%d", os.Getuid()))
+// ResolveKey returns the encryption key provided by the given source.
+func ResolveKey(source KeySource, keyFile string) ([KeySize]byte, error) {
+	return deriveKey(source, keyFile)
+}
 
-	// Add a constant salt for additional security
-	identity.WriteString("facepass-v1-salt")
+// KeyFingerprint returns a short, non-reversible identifier for a key.
+// It allows detecting a wrong key without attempting decryption.
+func KeyFingerprint(key [KeySize]byte) string {
+	hash := sha256.Sum256(append([]byte("facepass-key-fingerprint:"), key[:]...))
+	return hex.EncodeToString(hash[:8])
+}
 
-	// Hash to derive key
-	hash := sha256.Sum256([]byte(identity.String()))
-	copy(key[:], hash[:])
+// ParseKey parses a key given as 64 hexadecimal characters.
+func ParseKey(s string) ([KeySize]byte, error) {
+	var key [KeySize]byte
 
+	decoded, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(decoded) != KeySize {
+		return key, fmt.Errorf("%w: expected %d hex-encoded bytes", ErrInvalidKey, KeySize)
+	}
+
+	copy(key[:], decoded)
 	return key, nil
 }
 
+// ReadKeyFile reads a key from a file containing either 32 raw bytes or 64 hexadecimal characters.
+func ReadKeyFile(path string) ([KeySize]byte, error) {
+	var key [KeySize]byte
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return key, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	if len(data) == KeySize {
+		copy(key[:], data)
+		return key, nil
+	}
+
+	return ParseKey(string(bytes.TrimSpace(data)))
+}
+
+// deriveKey obtains the encryption key from the given source.
+func deriveKey(source KeySource, keyFile string) ([KeySize]byte, error) {
+	switch source {
+	case KeySourceMachine, "":
+		return deriveMachineKey()
+	case KeySourceFile:
+		if keyFile == "" {
+			return [KeySize]byte{}, fmt.Errorf("%w: key source 'file' requires a key file", ErrInvalidKey)
+		}
+		return ReadKeyFile(keyFile)
+	case KeySourceEnv:
+		value := os.Getenv(KeyEnvVar)
+		if value == "" {
+			return [KeySize]byte{}, fmt.Errorf("%w: %s is not set", ErrInvalidKey, KeyEnvVar)
+		}
+		return ParseKey(value)
+	default:
+		return [KeySize]byte{}, fmt.Errorf("%w: unknown key source %q", ErrInvalidKey, source)
+	}
+}
+
+// MachineIdentity is what the machine key source derives the key from.
+type MachineIdentity struct {
+	MachineID string // contents of /etc/machine-id, including the newline
+	Hostname  string
+	UID       int
+}
+
+// CurrentMachineIdentity returns the identity of this machine and user.
+func CurrentMachineIdentity() MachineIdentity {
+	id := MachineIdentity{UID: os.Getuid()}
+	if machineID, err := os.ReadFile("/etc/machine-id"); err == nil {
+		id.MachineID = string(machineID)
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		id.Hostname = hostname
+	}
+	return id
+}
+
+// MachineKey derives the key the machine key source yields for id. Given
+// the identity from before /etc/machine-id or the hostname changed, it
+// recovers the key the face data was encrypted with.
+func MachineKey(id MachineIdentity) [KeySize]byte {
+	// Add a constant salt for additional security
+	identity := fmt.Sprintf("%s%s%dfacepass-v1-salt", id.MachineID, id.Hostname, id.UID)
+	return sha256.Sum256([]byte(identity))
+}
+
+// deriveMachineKey derives an encryption key from machine-specific information.
+// This ties the encrypted data to this specific machine.
+func deriveMachineKey() ([KeySize]byte, error) {
+	return MachineKey(CurrentMachineIdentity()), nil
+}
+
 // getUserPath returns the file path for a user's data.
 func (fs *FileStorage) getUserPath(username string) string {
 	filename := username + ".json"
@@ -119,9 +336,84 @@ func (fs *FileStorage) getUserPath(username string) string {
 	return filepath.Join(fs.dataDir, "users", filename)
 }
 
+// writeFileAtomic writes data to a temporary file in the target directory,
+// syncs it, and renames it over path so readers never see a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath, err := writeTempFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// writeTempFile writes data to a synced temporary file next to path, to be
+// renamed over it, and returns its path.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+
+	// Clean up the temp file on any failure
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	success = true
+	return tmpPath, nil
+}
+
+// syncDir syncs a directory so renames into it survive a crash.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
 // SaveUser saves user face data to storage.
 func (fs *FileStorage) SaveUser(user UserFaceData) error {
+	unlock, err := fs.lockUser(user.Username)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fs.saveUser(user)
+}
+
+// saveUser writes user data; the caller holds the user's lock.
+func (fs *FileStorage) saveUser(user UserFaceData) error {
 	path := fs.getUserPath(user.Username)
+	user.SchemaVersion = CurrentSchemaVersion
+
+	// Only the profiles are stored; Embeddings is rebuilt when loading
+	user.normalizeProfiles()
+	user.Embeddings = nil
 
 	// Marshal to JSON
 	data, err := json.MarshalIndent(user, "", "  ")
@@ -129,25 +421,128 @@ func (fs *FileStorage) SaveUser(user UserFaceData) error {
 		return fmt.Errorf("failed to marshal user data: %w", err)
 	}
 
-	// Encrypt if enabled
+	// Compress before encryption, since ciphertext does not compress
+	if fs.compress {
+		data, err = compressData(data)
+		if err != nil {
+			return fmt.Errorf("failed to compress user data: %w", err)
+		}
+	}
+
+	// Encrypt if enabled, refusing to mix keys within one data directory
 	if fs.encryptionEnabled {
+		if !fs.KeyMatches() {
+			return ErrWrongKey
+		}
 		data, err = fs.encrypt(data)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt user data: %w", err)
 		}
 	}
 
-	// Write to file
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	// Write atomically so a crash mid-write cannot corrupt the enrollment
+	if err := writeFileAtomic(path, data, 0600); err != nil {
 		return fmt.Errorf("failed to write user data: %w", err)
 	}
 
+	fs.mu.Lock()
+	delete(fs.pendingLastUsed, user.Username)
+	fs.mu.Unlock()
+
+	// Record which key encrypted the data so a wrong key can be detected later
+	if fs.encryptionEnabled && fs.storedFingerprint() == "" {
+		if err := fs.writeFingerprint(); err != nil {
+			logging.Warnf("Failed to write key fingerprint: %v", err)
+		}
+	}
+
 	logging.Debugf("Saved user data for: %s", user.Username)
 	return nil
 }
 
-// LoadUser loads user face data from storage.
+// LoadUser loads user face data from storage, migrating older schema versions in memory.
 func (fs *FileStorage) LoadUser(username string) (*UserFaceData, error) {
+	user, err := fs.readUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateUserData(user); err != nil {
+		return nil, err
+	}
+
+	// Report a newer LastUsed that was throttled and not yet written
+	fs.mu.Lock()
+	if pending, ok := fs.pendingLastUsed[username]; ok && pending.After(user.LastUsed) {
+		user.LastUsed = pending
+	}
+	fs.mu.Unlock()
+
+	logging.Debugf("Loaded user data for: %s", username)
+	return user, nil
+}
+
+// MigrateUser rewrites a user's file in the current schema version.
+// It reports whether the file needed upgrading.
+func (fs *FileStorage) MigrateUser(username string) (bool, error) {
+	unlock, err := fs.lockUser(username)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	user, err := fs.readUser(username)
+	if err != nil {
+		return false, err
+	}
+
+	if user.SchemaVersion == CurrentSchemaVersion {
+		return false, nil
+	}
+
+	from := user.SchemaVersion
+	if err := migrateUserData(user); err != nil {
+		return false, err
+	}
+	if err := fs.saveUser(*user); err != nil {
+		return false, err
+	}
+
+	logging.Infof("Migrated user data for %s from schema version %d to %d", username, from, CurrentSchemaVersion)
+	return true, nil
+}
+
+// migrateUserData upgrades user data to CurrentSchemaVersion in place.
+func migrateUserData(user *UserFaceData) error {
+	if user.SchemaVersion > CurrentSchemaVersion {
+		return fmt.Errorf("%w: %d (this version supports up to %d, please upgrade FacePass)",
+			ErrUnsupportedSchema, user.SchemaVersion, CurrentSchemaVersion)
+	}
+	if user.SchemaVersion < 0 {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSchema, user.SchemaVersion)
+	}
+
+	// Version 0 -> 1: schema version field introduced, no data changes
+	if user.SchemaVersion == 0 {
+		user.SchemaVersion = 1
+	}
+
+	// Version 1 -> 2: the flat embedding list becomes the default profile
+	if user.SchemaVersion == 1 {
+		user.normalizeProfiles()
+		user.SchemaVersion = 2
+	}
+
+	user.flattenProfiles()
+	return nil
+}
+
+// readUser reads and decodes a user's file without schema migration.
+func (fs *FileStorage) readUser(username string) (*UserFaceData, error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+
 	path := fs.getUserPath(username)
 
 	// Read file
@@ -161,24 +556,43 @@ func (fs *FileStorage) LoadUser(username string) (*UserFaceData, error) {
 
 	// Decrypt if enabled
 	if fs.encryptionEnabled {
+		if !fs.KeyMatches() {
+			return nil, ErrWrongKey
+		}
 		data, err = fs.decrypt(data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt user data: %w", err)
 		}
 	}
 
+	return decodeUserData(data)
+}
+
+// decodeUserData decodes the decrypted contents of a user's file.
+func decodeUserData(data []byte) (*UserFaceData, error) {
+	// Decompress regardless of the current setting so toggling it keeps old files readable
+	data, err := decompressData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress user data: %w", err)
+	}
+
 	// Unmarshal JSON
 	var user UserFaceData
 	if err := json.Unmarshal(data, &user); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal user data: %w", err)
 	}
 
-	logging.Debugf("Loaded user data for: %s", username)
 	return &user, nil
 }
 
 // DeleteUser removes user face data from storage.
 func (fs *FileStorage) DeleteUser(username string) error {
+	unlock, err := fs.lockUser(username)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	path := fs.getUserPath(username)
 
 	if err := os.Remove(path); err != nil {
@@ -225,37 +639,127 @@ func (fs *FileStorage) ListUsers() ([]string, error) {
 
 // UserExists checks if a user is enrolled.
 func (fs *FileStorage) UserExists(username string) bool {
+	if ValidateUsername(username) != nil {
+		return false
+	}
+
 	path := fs.getUserPath(username)
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-// AddEmbedding adds a new embedding to an existing user.
+// AddEmbedding adds a new embedding to the default profile of an existing user.
 func (fs *FileStorage) AddEmbedding(username string, embedding recognition.Embedding) error {
+	return fs.AddEmbeddingToProfile(username, DefaultProfile, embedding, 0)
+}
+
+// AddEmbeddingWithLimit adds a new embedding to the default profile of an
+// existing user and evicts the oldest embeddings so that at most
+// maxEmbeddings are kept. A maxEmbeddings of zero or less disables the limit.
+func (fs *FileStorage) AddEmbeddingWithLimit(username string, embedding recognition.Embedding, maxEmbeddings int) error {
+	return fs.AddEmbeddingToProfile(username, DefaultProfile, embedding, maxEmbeddings)
+}
+
+// AddEmbeddingToProfile adds a new embedding to the named profile of an
+// existing user, creating the profile if needed. Beyond maxEmbeddings, the
+// oldest embeddings of that profile are evicted (see UserFaceData.AddEmbedding).
+// An embedding the user already has is skipped with ErrDuplicateEmbedding.
+func (fs *FileStorage) AddEmbeddingToProfile(username, profile string, embedding recognition.Embedding, maxEmbeddings int) error {
+	if err := ValidateProfile(profile); err != nil {
+		return err
+	}
+	unlock, err := fs.lockUser(username)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	user, err := fs.LoadUser(username)
 	if err != nil {
 		return err
 	}
+	if user.HasEmbedding(embedding) {
+		return ErrDuplicateEmbedding
+	}
 
-	user.Embeddings = append(user.Embeddings, embedding)
+	if evicted := user.AddEmbedding(profile, embedding, maxEmbeddings); evicted > 0 {
+		logging.Debugf("Evicted %d oldest embedding(s) for: %s", evicted, username)
+	}
 	user.LastUsed = time.Now()
 
-	return fs.SaveUser(*user)
+	return fs.saveUser(*user)
+}
+
+// UpdateUser applies fn to the user's data and saves the result, holding
+// the user's lock throughout so concurrent updates are not lost. Nothing is
+// saved if fn returns an error; ErrSkipUpdate makes UpdateUser return nil.
+func (fs *FileStorage) UpdateUser(username string, fn func(*UserFaceData) error) error {
+	unlock, err := fs.lockUser(username)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	user, err := fs.LoadUser(username)
+	if err != nil {
+		return err
+	}
+	if err := fn(user); err != nil {
+		if errors.Is(err, ErrSkipUpdate) {
+			return nil
+		}
+		return err
+	}
+	user.Username = username
+	return fs.saveUser(*user)
 }
 
 // UpdateLastUsed updates the last used timestamp for a user.
+// If a LastUsed interval is set and the stored timestamp is more recent than
+// that, the file is not rewritten and the new timestamp is kept in memory.
 func (fs *FileStorage) UpdateLastUsed(username string) error {
-	user, err := fs.LoadUser(username)
+	unlock, err := fs.lockUser(username)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	user.LastUsed = time.Now()
-	return fs.SaveUser(*user)
+	user, err := fs.readUser(username)
+	if err != nil {
+		return err
+	}
+	if err := migrateUserData(user); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if fs.lastUsedInterval > 0 && now.Sub(user.LastUsed) < fs.lastUsedInterval {
+		fs.mu.Lock()
+		if fs.pendingLastUsed == nil {
+			fs.pendingLastUsed = make(map[string]time.Time)
+		}
+		fs.pendingLastUsed[username] = now
+		fs.mu.Unlock()
+		logging.Debugf("Skipping LastUsed write for %s (last written %s ago)", username, now.Sub(user.LastUsed).Round(time.Second))
+		return nil
+	}
+
+	user.LastUsed = now
+	return fs.saveUser(*user)
 }
 
 // encrypt encrypts data using NaCl secretbox.
 func (fs *FileStorage) encrypt(plaintext []byte) ([]byte, error) {
+	return sealWithKey(plaintext, &fs.encryptionKey)
+}
+
+// decrypt decrypts data using NaCl secretbox.
+func (fs *FileStorage) decrypt(ciphertext []byte) ([]byte, error) {
+	return openWithKey(ciphertext, &fs.encryptionKey)
+}
+
+// sealWithKey encrypts data with the given key using NaCl secretbox.
+func sealWithKey(plaintext []byte, key *[KeySize]byte) ([]byte, error) {
 	// Generate random nonce
 	var nonce [NonceSize]byte
 	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
@@ -263,12 +767,12 @@ func (fs *FileStorage) encrypt(plaintext []byte) ([]byte, error) {
 	}
 
 	// Encrypt
-	encrypted := secretbox.Seal(nonce[:], plaintext, &nonce, &fs.encryptionKey)
+	encrypted := secretbox.Seal(nonce[:], plaintext, &nonce, key)
 	return encrypted, nil
 }
 
-// decrypt decrypts data using NaCl secretbox.
-func (fs *FileStorage) decrypt(ciphertext []byte) ([]byte, error) {
+// openWithKey decrypts data with the given key using NaCl secretbox.
+func openWithKey(ciphertext []byte, key *[KeySize]byte) ([]byte, error) {
 	if len(ciphertext) < NonceSize {
 		return nil, ErrEncryption
 	}
@@ -278,7 +782,7 @@ func (fs *FileStorage) decrypt(ciphertext []byte) ([]byte, error) {
 	copy(nonce[:], ciphertext[:NonceSize])
 
 	// Decrypt
-	plaintext, ok := secretbox.Open(nil, ciphertext[NonceSize:], &nonce, &fs.encryptionKey)
+	plaintext, ok := secretbox.Open(nil, ciphertext[NonceSize:], &nonce, key)
 	if !ok {
 		return nil, ErrEncryption
 	}
@@ -286,8 +790,136 @@ func (fs *FileStorage) decrypt(ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// fingerprintPath returns the path of the stored key fingerprint.
+func (fs *FileStorage) fingerprintPath() string {
+	return filepath.Join(fs.dataDir, keyFingerprintFile)
+}
+
+// storedFingerprint returns the stored key fingerprint, or "" if none exists.
+func (fs *FileStorage) storedFingerprint() string {
+	data, err := os.ReadFile(fs.fingerprintPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeFingerprint stores the fingerprint of the current key.
+func (fs *FileStorage) writeFingerprint() error {
+	return writeFileAtomic(fs.fingerprintPath(), []byte(KeyFingerprint(fs.encryptionKey)+"\n"), 0600)
+}
+
+// KeyMatches reports whether the current key matches the stored key fingerprint.
+// It returns true when no fingerprint has been stored yet.
+func (fs *FileStorage) KeyMatches() bool {
+	stored := fs.storedFingerprint()
+	return stored == "" || stored == KeyFingerprint(fs.encryptionKey)
+}
+
+// RotateKey re-encrypts all user data from oldKey to newKey. Every user is
+// locked for the whole rotation. All files are decrypted and re-encrypted to
+// temporary files before any is replaced, so a wrong oldKey or a failed
+// write leaves the data untouched; if replacing or writing the fingerprint
+// fails, the replaced files are restored. On success the storage uses newKey
+// for subsequent operations.
+func (fs *FileStorage) RotateKey(oldKey, newKey [KeySize]byte) error {
+	if !fs.encryptionEnabled {
+		return errors.New("encryption is not enabled")
+	}
+
+	users, err := fs.ListUsers()
+	if err != nil {
+		return err
+	}
+	sort.Strings(users)
+	for _, username := range users {
+		unlock, err := fs.lockUser(username)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	type rotation struct {
+		path, tmpPath string
+		old           []byte
+	}
+	var rotations []rotation
+	defer func() {
+		for _, r := range rotations {
+			os.Remove(r.tmpPath)
+		}
+	}()
+
+	for _, username := range users {
+		path := fs.getUserPath(username)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Unencrypted file, nothing to rotate
+				continue
+			}
+			return fmt.Errorf("failed to read user data for %s: %w", username, err)
+		}
+
+		plaintext, err := openWithKey(data, &oldKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt user data for %s with old key: %w", username, err)
+		}
+		sealed, err := sealWithKey(plaintext, &newKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt user data for %s: %w", username, err)
+		}
+		tmpPath, err := writeTempFile(path, sealed, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write user data for %s: %w", username, err)
+		}
+		rotations = append(rotations, rotation{path: path, tmpPath: tmpPath, old: data})
+	}
+
+	// Put back the old files if the rotation cannot complete
+	replaced := 0
+	restore := func(cause error) error {
+		var failed []string
+		for _, r := range rotations[:replaced] {
+			if err := writeFileAtomic(r.path, r.old, 0600); err != nil {
+				failed = append(failed, filepath.Base(r.path))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%w; failed to restore %s, which now need the new key", cause, strings.Join(failed, ", "))
+		}
+		return cause
+	}
+	for _, r := range rotations {
+		if err := os.Rename(r.tmpPath, r.path); err != nil {
+			return restore(fmt.Errorf("failed to replace user data: %w", err))
+		}
+		replaced++
+	}
+	if len(rotations) > 0 {
+		syncDir(filepath.Dir(rotations[0].path))
+	}
+
+	previous := fs.encryptionKey
+	fs.encryptionKey = newKey
+	if err := fs.writeFingerprint(); err != nil {
+		fs.encryptionKey = previous
+		return restore(fmt.Errorf("failed to write key fingerprint: %w", err))
+	}
+
+	logging.Infof("Rotated encryption key for %d user(s)", len(rotations))
+	return nil
+}
+
 // CreateUser creates a new user with initial embeddings.
 func (fs *FileStorage) CreateUser(username string, embeddings []recognition.Embedding, metadata map[string]string) error {
+	unlock, err := fs.lockUser(username)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if fs.UserExists(username) {
 		return ErrUserExists
 	}
@@ -304,7 +936,35 @@ func (fs *FileStorage) CreateUser(username string, embeddings []recognition.Embe
 		Metadata:   metadata,
 	}
 
-	return fs.SaveUser(user)
+	return fs.saveUser(user)
+}
+
+// CountEmbeddings returns the number of embeddings stored for a user.
+func (fs *FileStorage) CountEmbeddings(username string) (int, error) {
+	user, err := fs.LoadUser(username)
+	if err != nil {
+		return 0, err
+	}
+	return len(user.Embeddings), nil
+}
+
+// Stats returns the number of enrolled users and their total embeddings.
+// The file backend has to read every user file to count embeddings.
+func (fs *FileStorage) Stats() (users int, totalEmbeddings int, err error) {
+	usernames, err := fs.ListUsers()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, username := range usernames {
+		count, err := fs.CountEmbeddings(username)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to count embeddings for %s: %w", username, err)
+		}
+		totalEmbeddings += count
+	}
+
+	return len(usernames), totalEmbeddings, nil
 }
 
 // GetAllEmbeddings returns all embeddings for a user.
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -92,6 +97,150 @@ func TestFileStorage_SaveAndLoadUser(t *testing.T) {
 	}
 }
 
+func TestFileStorage_SaveUser_Atomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := fs.SaveUser(UserFaceData{Username: "testuser", Embeddings: createTestEmbeddings(i)}); err != nil {
+			t.Fatalf("SaveUser failed: %v", err)
+		}
+	}
+
+	// Only the final user file should remain, with no leftover temp files
+	entries, err := os.ReadDir(filepath.Join(tmpDir, "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "testuser.json" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("unexpected files in users dir: %v", names)
+	}
+
+	info, err := os.Stat(filepath.Join(tmpDir, "users", "testuser.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := fs.LoadUser("testuser")
+	if err != nil {
+		t.Fatalf("LoadUser failed: %v", err)
+	}
+	if len(loaded.Embeddings) != 3 {
+		t.Errorf("embeddings count = %d, want 3", len(loaded.Embeddings))
+	}
+}
+
+func TestFileStorage_SchemaVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	usersDir := filepath.Join(tmpDir, "users")
+
+	// Legacy file without schema_version
+	legacy := `{"username":"legacy","embeddings":[],"metadata":{}}`
+	if err := os.WriteFile(filepath.Join(usersDir, "legacy.json"), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := fs.LoadUser("legacy")
+	if err != nil {
+		t.Fatalf("LoadUser(legacy) error = %v", err)
+	}
+	if loaded.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", loaded.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	migrated, err := fs.MigrateUser("legacy")
+	if err != nil || !migrated {
+		t.Fatalf("MigrateUser(legacy) = %v, %v, want true, nil", migrated, err)
+	}
+	migrated, err = fs.MigrateUser("legacy")
+	if err != nil || migrated {
+		t.Errorf("second MigrateUser(legacy) = %v, %v, want false, nil", migrated, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(usersDir, "legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"schema_version": %d`, CurrentSchemaVersion)) {
+		t.Errorf("migrated file missing schema_version: %s", data)
+	}
+
+	// File written by a newer version
+	future := `{"schema_version":99,"username":"future","embeddings":[]}`
+	if err := os.WriteFile(filepath.Join(usersDir, "future.json"), []byte(future), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.LoadUser("future"); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("LoadUser(future) error = %v, want ErrUnsupportedSchema", err)
+	}
+	if _, err := fs.MigrateUser("future"); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("MigrateUser(future) error = %v, want ErrUnsupportedSchema", err)
+	}
+}
+
+func TestFileStorage_CompressedEncrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, true)
+	if err != nil {
+		t.Fatalf("failed to create encrypted storage: %v", err)
+	}
+
+	// Write one user uncompressed, then enable compression for another
+	if err := fs.CreateUser("plain", createTestEmbeddings(5), nil); err != nil {
+		t.Fatalf("CreateUser(plain) failed: %v", err)
+	}
+	fs.SetCompression(true)
+	if err := fs.CreateUser("packed", createTestEmbeddings(5), map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("CreateUser(packed) failed: %v", err)
+	}
+
+	plainInfo, err := os.Stat(filepath.Join(tmpDir, "users", "plain.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packedInfo, err := os.Stat(filepath.Join(tmpDir, "users", "packed.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packedInfo.Size() >= plainInfo.Size() {
+		t.Errorf("compressed file (%d bytes) not smaller than uncompressed (%d bytes)", packedInfo.Size(), plainInfo.Size())
+	}
+
+	// Both formats must load regardless of the current setting
+	for _, name := range []string{"plain", "packed"} {
+		user, err := fs.LoadUser(name)
+		if err != nil {
+			t.Fatalf("LoadUser(%s) failed: %v", name, err)
+		}
+		if len(user.Embeddings) != 5 {
+			t.Errorf("LoadUser(%s) embeddings = %d, want 5", name, len(user.Embeddings))
+		}
+		if user.Embeddings[4].Vector != createTestEmbeddings(5)[4].Vector {
+			t.Errorf("LoadUser(%s) embedding vector not preserved", name)
+		}
+	}
+
+	fs.SetCompression(false)
+	user, err := fs.LoadUser("packed")
+	if err != nil || user.Metadata["k"] != "v" {
+		t.Errorf("LoadUser(packed) with compression disabled = %v, %v", user, err)
+	}
+}
+
 func TestFileStorage_SaveAndLoadUser_Encrypted(t *testing.T) {
 	tmpDir := t.TempDir()
 	fs, err := NewFileStorage(tmpDir, true)
@@ -149,6 +298,25 @@ func TestFileStorage_LoadUser_NotFound(t *testing.T) {
 	}
 }
 
+func TestFileStorage_LoadUser_IncompatibleEmbedding(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	// Written by a model with 512-dimensional embeddings
+	vector := "[0.1" + strings.Repeat(",0.1", 511) + "]"
+	data := `{"schema_version":2,"username":"other","profiles":{"default":[{"vector":` + vector + `,"quality":0.9,"angle":"front"}]}}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "users", "other.json"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.LoadUser("other"); !errors.Is(err, recognition.ErrIncompatibleEmbedding) {
+		t.Errorf("LoadUser() error = %v, want ErrIncompatibleEmbedding", err)
+	}
+}
+
 func TestFileStorage_DeleteUser(t *testing.T) {
 	tmpDir := t.TempDir()
 	fs, err := NewFileStorage(tmpDir, false)
@@ -291,11 +459,16 @@ func TestFileStorage_AddEmbedding(t *testing.T) {
 	}
 
 	// Add another embedding
-	newEmb := createTestEmbeddings(1)[0]
+	newEmb := createTestEmbeddings(2)[1]
 	if err := fs.AddEmbedding("testuser", newEmb); err != nil {
 		t.Fatalf("AddEmbedding failed: %v", err)
 	}
 
+	// Adding it again is skipped
+	if err := fs.AddEmbedding("testuser", newEmb); !errors.Is(err, ErrDuplicateEmbedding) {
+		t.Errorf("AddEmbedding() of a duplicate error = %v, want ErrDuplicateEmbedding", err)
+	}
+
 	// Load and verify
 	loaded, err := fs.LoadUser("testuser")
 	if err != nil {
@@ -306,6 +479,127 @@ func TestFileStorage_AddEmbedding(t *testing.T) {
 	}
 }
 
+func TestFileStorage_AddEmbeddingWithLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	// Create user with 3 embeddings
+	embeddings := createTestEmbeddings(3)
+	userData := UserFaceData{
+		Username:   "testuser",
+		Embeddings: embeddings,
+		EnrolledAt: time.Now(),
+	}
+	if err := fs.SaveUser(userData); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+
+	// Add an embedding with a limit of 3, evicting the oldest
+	newEmb := recognition.Embedding{Vector: recognition.Descriptor{9}, Angle: "auto"}
+	if err := fs.AddEmbeddingWithLimit("testuser", newEmb, 3); err != nil {
+		t.Fatalf("AddEmbeddingWithLimit failed: %v", err)
+	}
+
+	loaded, err := fs.LoadUser("testuser")
+	if err != nil {
+		t.Fatalf("LoadUser failed: %v", err)
+	}
+	if len(loaded.Embeddings) != 3 {
+		t.Fatalf("expected 3 embeddings, got %d", len(loaded.Embeddings))
+	}
+	if loaded.Embeddings[0].Vector != embeddings[1].Vector {
+		t.Error("expected oldest embedding to be evicted")
+	}
+	if loaded.Embeddings[2].Angle != "auto" {
+		t.Errorf("expected newest embedding last, got angle %s", loaded.Embeddings[2].Angle)
+	}
+
+	// A non-positive limit keeps everything
+	newEmb.Vector[0] = 10
+	if err := fs.AddEmbeddingWithLimit("testuser", newEmb, 0); err != nil {
+		t.Fatalf("AddEmbeddingWithLimit failed: %v", err)
+	}
+	loaded, _ = fs.LoadUser("testuser")
+	if len(loaded.Embeddings) != 4 {
+		t.Errorf("expected 4 embeddings without limit, got %d", len(loaded.Embeddings))
+	}
+}
+
+// testUpdateUser checks UpdateUser on a backend with alice enrolled with
+// two embeddings.
+func testUpdateUser(t *testing.T, b Backend) {
+	t.Helper()
+	tolerance := 0.3
+	if err := b.UpdateUser("alice", func(user *UserFaceData) error {
+		user.Tolerance = &tolerance
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if user, err := b.LoadUser("alice"); err != nil || user.Tolerance == nil || *user.Tolerance != tolerance || len(user.Embeddings) != 2 {
+		t.Errorf("LoadUser() after UpdateUser = %+v, %v, want the tolerance set and the embeddings kept", user, err)
+	}
+
+	// Neither a skipped nor a failed update is saved
+	disable := func(result error) func(*UserFaceData) error {
+		return func(user *UserFaceData) error {
+			user.Disabled = true
+			return result
+		}
+	}
+	if err := b.UpdateUser("alice", disable(ErrSkipUpdate)); err != nil {
+		t.Errorf("UpdateUser() skipped: error = %v, want nil", err)
+	}
+	errFailed := errors.New("failed")
+	if err := b.UpdateUser("alice", disable(errFailed)); err != errFailed {
+		t.Errorf("UpdateUser() failed: error = %v, want %v", err, errFailed)
+	}
+	if user, _ := b.LoadUser("alice"); user.Disabled {
+		t.Error("a skipped or failed update should not be saved")
+	}
+
+	if err := b.UpdateUser("nobody", func(*UserFaceData) error { return nil }); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateUser(nobody) error = %v, want ErrUserNotFound", err)
+	}
+
+	// Concurrent updates are all kept
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.UpdateUser("alice", func(user *UserFaceData) error {
+				n, _ := strconv.Atoi(user.Metadata["n"])
+				if user.Metadata == nil {
+					user.Metadata = map[string]string{}
+				}
+				user.Metadata["n"] = strconv.Itoa(n + 1)
+				return nil
+			}); err != nil {
+				t.Errorf("UpdateUser() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if user, _ := b.LoadUser("alice"); user.Metadata["n"] != "10" {
+		t.Errorf("after 10 concurrent updates n = %q, want 10", user.Metadata["n"])
+	}
+}
+
+func TestFileStorage_UpdateUser(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := fs.CreateUser("alice", createTestEmbeddings(2), nil); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	testUpdateUser(t, fs)
+}
+
 func TestFileStorage_UpdateLastUsed(t *testing.T) {
 	tmpDir := t.TempDir()
 	fs, err := NewFileStorage(tmpDir, false)
@@ -467,6 +761,407 @@ func TestDecrypt_InvalidData(t *testing.T) {
 	}
 }
 
+func TestFileStorage_RotateKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, true)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	if err := fs.CreateUser("alice", createTestEmbeddings(2), nil); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	oldKey := fs.encryptionKey
+	var newKey [KeySize]byte
+	for i := range newKey {
+		newKey[i] = byte(i)
+	}
+
+	// Rotating with the wrong old key must fail and leave data readable
+	if err := fs.RotateKey(newKey, newKey); err == nil {
+		t.Fatal("expected RotateKey with wrong old key to fail")
+	}
+	if _, err := fs.LoadUser("alice"); err != nil {
+		t.Fatalf("data should be unchanged after failed rotation: %v", err)
+	}
+
+	if err := fs.RotateKey(oldKey, newKey); err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+
+	loaded, err := fs.LoadUser("alice")
+	if err != nil {
+		t.Fatalf("LoadUser after rotation failed: %v", err)
+	}
+	if len(loaded.Embeddings) != 2 {
+		t.Errorf("expected 2 embeddings after rotation, got %d", len(loaded.Embeddings))
+	}
+
+	// A fresh storage using the machine key now detects the mismatch
+	fs2, err := NewFileStorage(tmpDir, true)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if fs2.KeyMatches() {
+		t.Error("expected key mismatch to be detected")
+	}
+	if _, err := fs2.LoadUser("alice"); err != ErrWrongKey {
+		t.Errorf("expected ErrWrongKey, got %v", err)
+	}
+	if err := fs2.SaveUser(UserFaceData{Username: "bob"}); err != ErrWrongKey {
+		t.Errorf("expected ErrWrongKey on save, got %v", err)
+	}
+}
+
+func TestFileStorage_RotateKey_Rollback(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, true)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	for _, username := range []string{"alice", "bob"} {
+		if err := fs.CreateUser(username, createTestEmbeddings(1), nil); err != nil {
+			t.Fatalf("CreateUser(%s) failed: %v", username, err)
+		}
+	}
+	oldKey := fs.encryptionKey
+	var newKey [KeySize]byte
+	newKey[0] = 1
+
+	unchanged := func() {
+		t.Helper()
+		if fs.encryptionKey != oldKey {
+			t.Error("the storage should keep the old key")
+		}
+		for _, username := range []string{"alice", "bob"} {
+			if _, err := fs.LoadUser(username); err != nil {
+				t.Errorf("LoadUser(%s) with the old key failed: %v", username, err)
+			}
+		}
+	}
+
+	// Another process holds bob's lock: nothing is rotated
+	origTimeout := lockTimeout
+	lockTimeout = 50 * time.Millisecond
+	defer func() { lockTimeout = origTimeout }()
+	unlock, err := fs.lockUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RotateKey(oldKey, newKey); err == nil {
+		t.Error("expected RotateKey to fail while a user is locked")
+	}
+	unlock()
+	unchanged()
+
+	// The fingerprint cannot be written after the files were replaced:
+	// the old files are put back
+	fingerprint := fs.fingerprintPath()
+	if err := os.Remove(fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(fingerprint, "blocked"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RotateKey(oldKey, newKey); err == nil {
+		t.Error("expected RotateKey to fail without a fingerprint")
+	}
+	unchanged()
+	if leftovers, _ := filepath.Glob(filepath.Join(tmpDir, "users", ".*.tmp-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestFileStorage_RotateKey_Unencrypted(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	var key [KeySize]byte
+	if err := fs.RotateKey(key, key); err == nil {
+		t.Error("expected error when encryption is disabled")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	valid := strings.Repeat("ab", KeySize)
+	key, err := ParseKey(valid)
+	if err != nil {
+		t.Fatalf("ParseKey failed: %v", err)
+	}
+	if key[0] != 0xab {
+		t.Errorf("unexpected key byte: %x", key[0])
+	}
+
+	for _, input := range []string{"", "zz", strings.Repeat("ab", KeySize-1)} {
+		if _, err := ParseKey(input); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParseKey(%q) error = %v, want ErrInvalidKey", input, err)
+		}
+	}
+}
+
+func TestReadKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	raw := make([]byte, KeySize)
+	raw[0] = 7
+	rawPath := filepath.Join(tmpDir, "raw.key")
+	if err := os.WriteFile(rawPath, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadKeyFile(rawPath)
+	if err != nil || key[0] != 7 {
+		t.Errorf("ReadKeyFile(raw) = %v, %v", key[0], err)
+	}
+
+	hexPath := filepath.Join(tmpDir, "hex.key")
+	if err := os.WriteFile(hexPath, []byte(strings.Repeat("01", KeySize)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err = ReadKeyFile(hexPath)
+	if err != nil || key[0] != 1 {
+		t.Errorf("ReadKeyFile(hex) = %v, %v", key[0], err)
+	}
+
+	if _, err := ReadKeyFile(filepath.Join(tmpDir, "missing.key")); err == nil {
+		t.Error("expected error for missing key file")
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	var k1, k2 [KeySize]byte
+	k2[0] = 1
+
+	if KeyFingerprint(k1) != KeyFingerprint(k1) {
+		t.Error("fingerprint should be deterministic")
+	}
+	if KeyFingerprint(k1) == KeyFingerprint(k2) {
+		t.Error("different keys should have different fingerprints")
+	}
+}
+
+func TestFileStorage_UpdateLastUsed_Throttled(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	fs.SetLastUsedInterval(time.Hour)
+
+	written := time.Now().Add(-time.Minute).Truncate(time.Second)
+	user := UserFaceData{Username: "alice", Embeddings: createTestEmbeddings(1), LastUsed: written}
+	if err := fs.SaveUser(user); err != nil {
+		t.Fatalf("SaveUser failed: %v", err)
+	}
+
+	path := filepath.Join(tmpDir, "users", "alice.json")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.UpdateLastUsed("alice"); err != nil {
+		t.Fatalf("UpdateLastUsed failed: %v", err)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("UpdateLastUsed rewrote the file within the throttle interval")
+	}
+
+	// The newer timestamp is still visible in memory
+	loaded, err := fs.LoadUser("alice")
+	if err != nil {
+		t.Fatalf("LoadUser failed: %v", err)
+	}
+	if !loaded.LastUsed.After(written) {
+		t.Errorf("LastUsed = %v, want newer than %v", loaded.LastUsed, written)
+	}
+
+	// Once the stored timestamp is older than the interval it is written
+	fs.SetLastUsedInterval(time.Second)
+	if err := fs.UpdateLastUsed("alice"); err != nil {
+		t.Fatalf("UpdateLastUsed failed: %v", err)
+	}
+	fresh, err := NewFileStorage(tmpDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := fresh.LoadUser("alice")
+	if err != nil {
+		t.Fatalf("LoadUser failed: %v", err)
+	}
+	if !stored.LastUsed.After(written) {
+		t.Errorf("stored LastUsed = %v, want newer than %v", stored.LastUsed, written)
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		valid    bool
+	}{
+		{"john", true},
+		{"john.doe", true},
+		{"svc_backup-2", true},
+		{"user@example.com", true},
+		{"", false},
+		{"../root", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"..", false},
+		{"john..doe", false},
+		{".hidden", false},
+		{"-flag", false},
+		{"john doe", false},
+		{"john\x00", false},
+		{strings.Repeat("a", MaxUsernameLength+1), false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateUsername(tt.username)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateUsername(%q) error = %v, want nil", tt.username, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidUsername) {
+			t.Errorf("ValidateUsername(%q) error = %v, want ErrInvalidUsername", tt.username, err)
+		}
+	}
+}
+
+func TestFileStorage_RejectsUnsafeUsernames(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, err := NewFileStorage(filepath.Join(tmpDir, "data"), false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	if err := fs.CreateUser("../../escape", createTestEmbeddings(1), nil); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("CreateUser() error = %v, want ErrInvalidUsername", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "escape.json")); !os.IsNotExist(err) {
+		t.Error("file was written outside the users directory")
+	}
+	if _, err := fs.LoadUser("../x"); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("LoadUser() error = %v, want ErrInvalidUsername", err)
+	}
+	if err := fs.DeleteUser("../x"); !errors.Is(err, ErrInvalidUsername) {
+		t.Errorf("DeleteUser() error = %v, want ErrInvalidUsername", err)
+	}
+	if fs.UserExists("../data/users") {
+		t.Error("UserExists() should be false for an invalid username")
+	}
+}
+
+func TestFileStorage_Stats(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	users, embeddings, err := fs.Stats()
+	if err != nil || users != 0 || embeddings != 0 {
+		t.Errorf("Stats() on empty storage = %d, %d, %v", users, embeddings, err)
+	}
+
+	fs.CreateUser("alice", createTestEmbeddings(3), nil)
+	fs.CreateUser("bob", createTestEmbeddings(2), nil)
+
+	count, err := fs.CountEmbeddings("alice")
+	if err != nil || count != 3 {
+		t.Errorf("CountEmbeddings(alice) = %d, %v, want 3", count, err)
+	}
+	if _, err := fs.CountEmbeddings("carol"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("CountEmbeddings(carol) error = %v, want ErrUserNotFound", err)
+	}
+
+	users, embeddings, err = fs.Stats()
+	if err != nil || users != 2 || embeddings != 5 {
+		t.Errorf("Stats() = %d, %d, %v, want 2, 5, nil", users, embeddings, err)
+	}
+}
+
+func TestResolveKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := filepath.Join(tmpDir, "facepass.key")
+	if err := os.WriteFile(keyPath, []byte(strings.Repeat("02", KeySize)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ResolveKey(KeySourceFile, keyPath)
+	if err != nil || key[0] != 2 {
+		t.Errorf("ResolveKey(file) = %v, %v", key[0], err)
+	}
+
+	if _, err := ResolveKey(KeySourceFile, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ResolveKey(file, \"\") error = %v, want ErrInvalidKey", err)
+	}
+
+	t.Setenv(KeyEnvVar, strings.Repeat("03", KeySize))
+	key, err = ResolveKey(KeySourceEnv, "")
+	if err != nil || key[0] != 3 {
+		t.Errorf("ResolveKey(env) = %v, %v", key[0], err)
+	}
+
+	t.Setenv(KeyEnvVar, "")
+	if _, err := ResolveKey(KeySourceEnv, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ResolveKey(env unset) error = %v, want ErrInvalidKey", err)
+	}
+
+	if _, err := ResolveKey("tpm", ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ResolveKey(unknown) error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestMachineKey(t *testing.T) {
+	key, err := ResolveKey(KeySourceMachine, "")
+	if err != nil {
+		t.Fatalf("ResolveKey(machine) error = %v", err)
+	}
+	current := CurrentMachineIdentity()
+	if MachineKey(current) != key {
+		t.Error("MachineKey(CurrentMachineIdentity()) should be the machine key")
+	}
+
+	// A reinstall changes /etc/machine-id; the old identity recovers the old key
+	old := current
+	old.MachineID = "0123456789abcdef0123456789abcdef\n"
+	if MachineKey(old) == key {
+		t.Error("a different machine ID should give a different key")
+	}
+	if MachineKey(old) != MachineKey(MachineIdentity{MachineID: old.MachineID, Hostname: old.Hostname, UID: old.UID}) {
+		t.Error("MachineKey() should only depend on the identity")
+	}
+}
+
+func TestNewFileStorageWithKeySource(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv(KeyEnvVar, strings.Repeat("04", KeySize))
+
+	fs, err := NewFileStorageWithKeySource(tmpDir, true, KeySourceEnv, "")
+	if err != nil {
+		t.Fatalf("NewFileStorageWithKeySource() error = %v", err)
+	}
+	if err := fs.SaveUser(UserFaceData{Username: "alice", Embeddings: createTestEmbeddings(1)}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	// A storage using a different key must refuse the data
+	t.Setenv(KeyEnvVar, strings.Repeat("05", KeySize))
+	other, err := NewFileStorageWithKeySource(tmpDir, true, KeySourceEnv, "")
+	if err != nil {
+		t.Fatalf("NewFileStorageWithKeySource() error = %v", err)
+	}
+	if _, err := other.LoadUser("alice"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("LoadUser() with wrong key error = %v, want ErrWrongKey", err)
+	}
+}
+
 // Helper function to create test embeddings
 func createTestEmbeddings(count int) []recognition.Embedding {
 	embeddings := make([]recognition.Embedding, count)